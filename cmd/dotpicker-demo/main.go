@@ -15,7 +15,7 @@ func main() {
 	fmt.Println()
 
 	// load config
-	cfg, err := config.Default()
+	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
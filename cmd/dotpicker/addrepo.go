@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/history"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
+)
+
+// addedCategory is where creators added with add-repo show up in the tui
+var addedCategory = manifest.Category{
+	ID:          "added",
+	Name:        "added by you",
+	Description: "repos you added with dotpicker add-repo",
+}
+
+// runAddRepo handles `dotpicker add-repo <url>`: clones the repo, proposes
+// dotfiles for it and saves the creator to cfg.AddedManifestPath
+func runAddRepo(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("add-repo", flag.ContinueOnError)
+	fs.SetOutput(out)
+	id := fs.String("id", "", "creator id (default: guessed from the url)")
+	name := fs.String("name", "", "creator name (default: guessed from the url)")
+	dryRun := fs.Bool("dry-run", false, "only print what was found, don't save the creator")
+
+	// the url may come before or after the flags
+	var repo string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		repo, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if repo == "" {
+		repo = fs.Arg(0)
+	}
+	if repo == "" {
+		return fmt.Errorf("usage: dotpicker add-repo <url> [--id id] [--name name] [--dry-run]")
+	}
+
+	creator := creatorFromRepo(repo)
+	if *id != "" {
+		creator.ID = *id
+	}
+	if *name != "" {
+		creator.Name = *name
+	}
+	if creator.ID == "" {
+		return fmt.Errorf("couldn't guess an id from %s, pass --id", repo)
+	}
+	if err := checkCreatorID(creator.ID); err != nil {
+		return err
+	}
+
+	// curated creators win, an added one would quietly replace them
+	man, err := loadManifest(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if existing := man.GetCreator(creator.ID); existing != nil && existing.Registry != registry.Added {
+		return fmt.Errorf("%s is already in the %s registry (%s), pass --id to add it under another id",
+			creator.ID, existing.Registry, existing.Repo)
+	}
+
+	// discovery needs the whole tree, not a sparse checkout
+	manager := cache.NewManager(cfg.CacheDir)
+	manager.SetAuthenticator(cache.NewAuthenticator(cfg.GitAuth))
+	manager.SetLinked(history.NewStore(cfg.HistoryPath).Linked)
+	fmt.Fprintf(out, "fetching %s...\n", creator.Repo)
+	sync, err := manager.EnsureRepoWithOptions(ctx, &creator, cache.GitOptions{})
+	if err != nil {
+		return fmt.Errorf("couldn't fetch %s: %w", creator.Repo, err)
+	}
+	if note := sync.Summary(); note != "" {
+		fmt.Fprintf(out, "warning: %s\n", note)
+	}
+
+	repoPath := manager.GetRepoPath(creator.ID)
+	candidates := manifest.DetectStructures(repoPath)
+	creator.Dotfiles = manifest.Discover(repoPath, cfg.XDGDirectories)
+	printDiscovery(out, &creator, candidates)
+
+	if len(creator.Dotfiles) == 0 {
+		return fmt.Errorf("found no dotfiles in %s", creator.Repo)
+	}
+	if *dryRun {
+		return nil
+	}
+
+	added := &manifest.Manifest{Version: "1.0"}
+	if err := manifest.MergeFile(added, cfg.AddedManifestPath); err != nil {
+		return err
+	}
+	added.Merge(&manifest.Manifest{
+		Categories: []manifest.Category{addedCategory},
+		Creators:   []manifest.Creator{creator},
+	})
+	// a broken added.json would keep the tui from loading it at all
+	if err := checkManifest(added); err != nil {
+		return fmt.Errorf("not saving %s: %w", creator.ID, err)
+	}
+	if err := manifest.SaveFile(cfg.AddedManifestPath, added); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nadded %s to %s, it's under %q in dotpicker\n", creator.ID, cfg.AddedManifestPath, addedCategory.Name)
+	return nil
+}
+
+// printDiscovery writes the detected layout and the proposed dotfiles
+func printDiscovery(out io.Writer, creator *manifest.Creator, candidates []manifest.Candidate) {
+	if len(candidates) > 0 {
+		top := candidates[0]
+		fmt.Fprintf(out, "layout: %s (%d%%, %s)\n", top.Structure, top.Score, strings.Join(top.Evidence, "; "))
+	} else {
+		fmt.Fprintln(out, "layout: unknown")
+	}
+
+	fmt.Fprintf(out, "\nfound %d dotfiles:\n", len(creator.Dotfiles))
+	for _, d := range creator.Dotfiles {
+		deps := ""
+		if len(d.Dependencies) > 0 {
+			deps = " (needs " + strings.Join(d.Dependencies, ", ") + ")"
+		}
+		fmt.Fprintf(out, "  %-12s %s%s\n", d.ID, strings.Join(d.PathNames(), " "), deps)
+	}
+}
+
+// validID is the schema's creator id pattern
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// checkCreatorID rejects ids the schema wouldn't take, an id like ../x
+// would also put the repo outside the cache directory
+func checkCreatorID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("%q isn't a valid id: use lowercase letters, digits, - and _", id)
+	}
+	return nil
+}
+
+// checkManifest validates a manifest the way loading it will, so nothing
+// that fails to load later gets saved
+func checkManifest(m *manifest.Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal manifest: %w", err)
+	}
+	_, err = manifest.Parse(data)
+	return err
+}
+
+// creatorFromRepo guesses a creator from a repo url or path: the owner
+// for hosted repos (github.com/owner/dotfiles), the directory name otherwise
+func creatorFromRepo(repo string) manifest.Creator {
+	creator := manifest.Creator{Repo: repo, Categories: []string{addedCategory.ID}}
+
+	// relative paths wouldn't resolve from wherever the tui runs next
+	if strings.HasPrefix(repo, "./") || strings.HasPrefix(repo, "../") {
+		if abs, err := filepath.Abs(repo); err == nil {
+			creator.Repo = abs
+		}
+	}
+
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(creator.Repo, "/"), ".git")
+	segments := strings.FieldsFunc(trimmed, func(r rune) bool { return r == '/' || r == ':' || r == '\\' })
+	if len(segments) == 0 {
+		return creator
+	}
+
+	name := segments[len(segments)-1]
+	hosted := strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@")
+	if hosted && len(segments) >= 3 {
+		owner := segments[len(segments)-2]
+		name = owner
+		if strings.Contains(segments[len(segments)-3], "github.com") {
+			creator.GitHub = owner
+		}
+	}
+
+	creator.Name = name
+	creator.ID = manifest.SlugID(name)
+	creator.Description = "added from " + creator.Repo
+	return creator
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestCheckCreatorID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{id: "folke", valid: true},
+		{id: "the-primeagen_2", valid: true},
+		{id: "../../x"},
+		{id: "Foo"},
+		{id: "-dash"},
+		{id: ""},
+	}
+	for _, tt := range tests {
+		if err := checkCreatorID(tt.id); (err == nil) != tt.valid {
+			t.Errorf("checkCreatorID(%q) = %v, want valid %v", tt.id, err, tt.valid)
+		}
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	creator := creatorFromRepo("https://github.com/folke/dot")
+	creator.Dotfiles = []manifest.Dotfile{{ID: "nvim", Name: "neovim", Paths: []manifest.PathSpec{{Target: ".config/nvim"}}, Dependencies: []string{}}}
+	m := &manifest.Manifest{
+		Version:    "1.0",
+		Categories: []manifest.Category{addedCategory},
+		Creators:   []manifest.Creator{creator},
+	}
+	if err := checkManifest(m); err != nil {
+		t.Fatalf("expected a valid manifest, got %v", err)
+	}
+
+	m.Creators[0].ID = "Folke"
+	if err := checkManifest(m); err == nil {
+		t.Error("expected an invalid id to fail")
+	}
+}
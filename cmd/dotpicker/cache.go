@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/history"
+	"github.com/milxzy/dotfile-picker/internal/registry"
+)
+
+// runCache handles `dotpicker cache ls` and `dotpicker cache gc`
+func runCache(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: dotpicker cache ls | gc [flags]")
+	}
+
+	man, statuses, err := loadRegistries(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	manager := cache.NewManager(cfg.CacheDir)
+	manager.SetLinked(history.NewStore(cfg.HistoryPath).Linked)
+	referenced := man.CreatorIDs()
+
+	switch args[0] {
+	case "ls":
+		repos, err := manager.ListRepos(referenced)
+		if err != nil {
+			return err
+		}
+		printRepos(out, repos)
+		return nil
+
+	case "gc":
+		fs := flag.NewFlagSet("cache gc", flag.ContinueOnError)
+		fs.SetOutput(out)
+		unreferenced := fs.Bool("unreferenced", false, "remove repos for creators no longer in the manifest")
+		olderThan := fs.Int("older-than", 0, "remove repos not fetched in this many days")
+		maxSize := fs.String("max-size", "", "remove least recently fetched repos until the cache fits, e.g. 500MB")
+		dryRun := fs.Bool("dry-run", false, "only print what would be removed")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		policy := cache.GCPolicy{
+			Unreferenced: *unreferenced,
+			OlderThan:    time.Duration(*olderThan) * 24 * time.Hour,
+		}
+		if *maxSize != "" {
+			if policy.MaxTotalSize, err = cache.ParseSize(*maxSize); err != nil {
+				return err
+			}
+		}
+		// no rules at all means the safe default
+		if policy == (cache.GCPolicy{}) {
+			policy.Unreferenced = true
+		}
+
+		// a registry that didn't load makes its creators look unreferenced
+		if failed := registry.Failed(statuses); policy.Unreferenced && len(failed) > 0 {
+			return fmt.Errorf("not removing unreferenced repos while the %s registry is unavailable", failed[0].Name)
+		}
+
+		removed, err := manager.GC(referenced, policy, *dryRun)
+		printGC(out, removed, *dryRun)
+		return err
+
+	default:
+		return fmt.Errorf("unknown cache command %q (want ls or gc)", args[0])
+	}
+}
+
+// printRepos writes the cache listing as a table
+func printRepos(out io.Writer, repos []cache.RepoInfo) {
+	if len(repos) == 0 {
+		fmt.Fprintln(out, "cache is empty")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATOR\tSIZE\tFETCHED\tCOMMIT\tIN MANIFEST\tLINKS")
+
+	var total int64
+	for _, r := range repos {
+		total += r.Size
+		fetched := "unknown"
+		if !r.LastFetch.IsZero() {
+			fetched = cache.FormatAge(r.Age())
+		}
+		commit := "-"
+		if r.Commit != "" {
+			commit = shortHash(r.Commit)
+		}
+		inManifest := "yes"
+		if !r.Referenced {
+			inManifest = "no"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", r.CreatorID, cache.FormatSize(r.Size), fetched, commit, inManifest, len(r.Links))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d repos, %s total\n", len(repos), cache.FormatSize(total))
+}
+
+// printGC reports what a gc run removed
+func printGC(out io.Writer, removed []cache.RepoInfo, dryRun bool) {
+	if len(removed) == 0 {
+		fmt.Fprintln(out, "nothing to remove")
+		return
+	}
+
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+
+	var freed int64
+	for _, r := range removed {
+		freed += r.Size
+		fmt.Fprintf(out, "%s %s (%s)\n", verb, r.CreatorID, cache.FormatSize(r.Size))
+	}
+	fmt.Fprintf(out, "%s %s in total\n", verb, cache.FormatSize(freed))
+}
@@ -2,27 +2,38 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 
 	"github.com/milxzy/dotfile-picker/internal/config"
 	"github.com/milxzy/dotfile-picker/internal/logger"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
 	"github.com/milxzy/dotfile-picker/internal/tui"
 )
 
 func main() {
 	// parse command line flags
 	verbose := flag.Bool("verbose", false, "enable verbose debug logging to terminal")
+	offline := flag.Bool("offline", false, "use cached repos without pulling updates")
+	refresh := flag.Bool("refresh", false, "check for manifest updates now instead of waiting for the refresh interval")
+	flag.Usage = usage
 	flag.Parse()
 
-	// load config to get log directory
-	cfg, err := config.Default()
+	// load config (defaults plus the user's config.json)
+	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
+	if *offline {
+		cfg.RepoRefresh = config.RepoRefreshNever
+	}
+	cfg.RefreshManifest = *refresh
+
 	// initialize logger
 	if err := logger.Init(cfg.LogDir, *verbose); err != nil {
 		fmt.Fprintf(os.Stderr, "error initializing logger: %v\n", err)
@@ -30,10 +41,77 @@ func main() {
 	}
 	defer logger.Close()
 
+	// subcommands run without the tui
+	switch flag.Arg(0) {
+	case "":
+	case "outdated":
+		if err := runOutdated(context.Background(), cfg, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "add-repo":
+		if err := runAddRepo(context.Background(), cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "manifest":
+		if err := runManifest(context.Background(), cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "cache":
+		if err := runCache(context.Background(), cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
 	// run the TUI
-	if err := tui.Run(); err != nil {
+	if err := tui.Run(cfg); err != nil {
 		logger.Error("Application error: %v", err)
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// usage prints the flags and subcommands
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: dotpicker [flags] [command]\n\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "commands:\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  outdated    show upstream changes to dotfiles you've applied\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  add-repo    clone any dotfiles repo and list what's in it (--id, --name, --dry-run)\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  manifest lint  check manifests against the schema (--resolve also checks paths exist)\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  manifest init  print a ready-to-submit creator entry for a repo (--id, --name, --category)\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  cache ls    list cached repos with size, age and commit\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  cache gc    remove cached repos (--unreferenced, --older-than, --max-size, --dry-run)\n\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "flags:\n")
+	flag.PrintDefaults()
+}
+
+// loadManifest merges every registry (see registry.FromConfig)
+// mirrors what the tui does at startup
+func loadManifest(ctx context.Context, cfg *config.Config) (*manifest.Manifest, error) {
+	man, _, err := loadRegistries(ctx, cfg)
+	return man, err
+}
+
+// loadRegistries is loadManifest plus how each registry went, for commands
+// that mustn't act on a partial manifest
+func loadRegistries(ctx context.Context, cfg *config.Config) (*manifest.Manifest, []registry.Status, error) {
+	man, statuses, err := registry.Load(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't load manifest: %w", err)
+	}
+	for _, failed := range registry.Failed(statuses) {
+		fmt.Fprintf(os.Stderr, "warning: %s registry unavailable: %v\n", failed.Name, failed.Err)
+	}
+	return man, statuses, nil
+}
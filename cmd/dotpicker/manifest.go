@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/milxzy/dotfile-picker/configs"
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/deps"
+	"github.com/milxzy/dotfile-picker/internal/history"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// defaultLintFile is the bundled manifest in a checkout of this repo
+var defaultLintFile = filepath.Join("configs", "manifest.json")
+
+// runManifest handles `dotpicker manifest lint` and `dotpicker manifest init`
+func runManifest(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: dotpicker manifest lint [--resolve] [file...] | manifest init <repo-url-or-path>")
+	}
+
+	switch args[0] {
+	case "lint":
+		fs := flag.NewFlagSet("manifest lint", flag.ContinueOnError)
+		fs.SetOutput(out)
+		resolve := fs.Bool("resolve", false, "clone every creator and check each dotfile path exists in its repo")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		files := fs.Args()
+		if len(files) == 0 {
+			files = []string{defaultLintFile}
+		}
+
+		var errs, warnings int
+		for _, file := range files {
+			issues, err := lintFile(ctx, cfg, file, *resolve)
+			if err != nil {
+				return err
+			}
+			for _, issue := range issues {
+				fmt.Fprintf(out, "%s:%s\n", file, issue)
+				if issue.Severity == manifest.SeverityError {
+					errs++
+				} else {
+					warnings++
+				}
+			}
+		}
+
+		fmt.Fprintf(out, "%d errors, %d warnings\n", errs, warnings)
+		if errs > 0 {
+			return fmt.Errorf("%d manifest errors", errs)
+		}
+		return nil
+
+	case "init":
+		return runManifestInit(ctx, cfg, args[1:], out)
+
+	default:
+		return fmt.Errorf("unknown manifest command %q (want lint or init)", args[0])
+	}
+}
+
+// lintFile checks one manifest file, and with resolve that its paths
+// exist in the creators' repos
+func lintFile(ctx context.Context, cfg *config.Config, file string, resolve bool) ([]manifest.Issue, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) && file == defaultLintFile {
+		// outside a checkout, lint the manifest built into the binary
+		data, err = configs.Manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", file, err)
+	}
+
+	man, issues := manifest.Check(data, manifest.CheckOptions{KnownDependency: deps.IsKnown, StrictFields: true})
+	if man == nil || !resolve {
+		return issues, nil
+	}
+	return append(issues, resolveIssues(ctx, cfg, data, man)...), nil
+}
+
+// resolveIssues clones every creator in full and reports the dotfile paths
+// that don't resolve the way the tui would resolve them
+func resolveIssues(ctx context.Context, cfg *config.Config, data []byte, man *manifest.Manifest) []manifest.Issue {
+	manager := cache.NewManager(cfg.CacheDir)
+	manager.SetAuthenticator(cache.NewAuthenticator(cfg.GitAuth))
+	manager.SetLinked(history.NewStore(cfg.HistoryPath).Linked)
+
+	var issues []manifest.Issue
+	issue := func(segments []any, format string, args ...any) {
+		line, col := manifest.Position(data, segments...)
+		issues = append(issues, manifest.Issue{
+			Line:     line,
+			Column:   col,
+			Field:    manifest.FieldName(segments...),
+			Severity: manifest.SeverityError,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// full clones, a sparse one only has the paths we're about to check
+	failed := make(map[string]error)
+	err := manager.EnsureReposWithOptions(ctx, man.Creators, cache.GitOptions{}, nil)
+	if fetchErrs, ok := err.(cache.EnsureErrors); ok {
+		failed = fetchErrs
+	} else if err != nil {
+		for _, creator := range man.Creators {
+			failed[creator.ID] = err
+		}
+	}
+
+	for i := range man.Creators {
+		creator := &man.Creators[i]
+		if err := failed[creator.ID]; err != nil {
+			issue([]any{"creators", i, "repo"}, "couldn't fetch %s: %v", creator.Repo, err)
+			continue
+		}
+
+		repoPath := manager.GetRepoPath(creator.ID)
+		candidates := manifest.DetectStructures(repoPath)
+		var layout *manifest.Layout
+		if len(candidates) > 0 {
+			layout = manifest.DecodeDeclaredLayout(repoPath, candidates[0].Structure)
+		}
+		for j, dotfile := range creator.Dotfiles {
+			for k, spec := range dotfile.Paths {
+				if spec.Explicit() {
+					if _, err := os.Stat(filepath.Join(repoPath, filepath.FromSlash(spec.Source))); err != nil && !spec.Optional {
+						issue([]any{"creators", i, "dotfiles", j, "paths", k, "source"},
+							"source %q isn't in %s", spec.Source, creator.Repo)
+					}
+					continue
+				}
+				if !pathResolves(repoPath, creator, spec.Path(), layout, candidates) && !spec.Optional {
+					issue([]any{"creators", i, "dotfiles", j, "paths", k},
+						"%q isn't in %s", spec.Path(), creator.Repo)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// pathResolves reports whether a dotfile path finds files in a repo, using
+// the same layouts the tui tries; layout is the repo's declared one, if any
+func pathResolves(repoPath string, creator *manifest.Creator, path string, layout *manifest.Layout, candidates []manifest.Candidate) bool {
+	structures := make([]manifest.RepoStructure, 0, len(candidates))
+	for _, c := range candidates {
+		structures = append(structures, c.Structure)
+	}
+	if len(structures) == 0 {
+		return false
+	}
+
+	switch structures[0] {
+	case manifest.StructureChezmoi:
+		if state, err := manifest.DecodeChezmoi(repoPath); err == nil {
+			renderDir, err := os.MkdirTemp("", "dotpicker-lint-")
+			if err == nil {
+				defer os.RemoveAll(renderDir)
+				if plan, err := state.Plan(path, renderDir); err == nil && len(plan.Files)+len(plan.Skipped) > 0 {
+					return true
+				}
+			}
+		}
+	case manifest.StructureStow:
+		if state, err := manifest.DecodeStow(repoPath, creator.Stow); err == nil {
+			if home, err := os.UserHomeDir(); err == nil && len(state.Plan(path, home, false).Sources) > 0 {
+				return true
+			}
+		}
+	}
+
+	_, ok := manifest.ResolveFilePath(repoPath, path, layout, structures...)
+	return ok
+}
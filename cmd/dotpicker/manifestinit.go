@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/deps"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
+)
+
+// dotfileCategories guesses the official categories from discovered
+// dotfile ids, only the ones the loaded manifest has are used
+var dotfileCategories = map[string]string{
+	"nvim":      "vim-wizards",
+	"vim":       "vim-wizards",
+	"emacs":     "emacs-enthusiasts",
+	"tmux":      "terminal-lovers",
+	"zsh":       "terminal-lovers",
+	"bash":      "terminal-lovers",
+	"fish":      "terminal-lovers",
+	"starship":  "terminal-lovers",
+	"kitty":     "terminal-lovers",
+	"alacritty": "terminal-lovers",
+	"wezterm":   "terminal-lovers",
+	"i3":        "tiling-wm",
+	"sway":      "tiling-wm",
+	"hyprland":  "tiling-wm",
+	"waybar":    "tiling-wm",
+	"polybar":   "tiling-wm",
+	"rofi":      "tiling-wm",
+}
+
+// runManifestInit handles `dotpicker manifest init <repo-url-or-path>`:
+// clones the repo, proposes its dotfiles and prints a creator entry that
+// passes `manifest lint`, ready to paste into a registry
+// progress and warnings go to stderr so the json can be piped
+func runManifestInit(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("manifest init", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "creator id (default: guessed from the url)")
+	name := fs.String("name", "", "creator name (default: guessed from the url)")
+	categories := fs.String("category", "", "comma-separated category ids (default: guessed from the dotfiles)")
+
+	// the repo may come before or after the flags
+	var repo string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		repo, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if repo == "" {
+		repo = fs.Arg(0)
+	}
+	if repo == "" {
+		return fmt.Errorf("usage: dotpicker manifest init <repo-url-or-path> [--id id] [--name name] [--category a,b]")
+	}
+
+	// "." names the directory, so the id can be guessed from it
+	if local := localRepoPath(repo); local != "" {
+		if abs, err := filepath.Abs(local); err == nil {
+			repo = abs
+		}
+	}
+
+	creator := creatorFromRepo(repo)
+
+	// a local checkout is submitted as the remote it was cloned from, and
+	// named after it; it's still fetched from disk
+	var origin string
+	if local := localRepoPath(repo); local != "" {
+		if origin = cache.OriginURL(local); origin != "" {
+			guess := creatorFromRepo(origin)
+			creator.ID, creator.Name, creator.GitHub = guess.ID, guess.Name, guess.GitHub
+		}
+	}
+	if *id != "" {
+		creator.ID = *id
+	}
+	if *name != "" {
+		creator.Name = *name
+	}
+	if creator.ID == "" {
+		return fmt.Errorf("couldn't guess an id from %s, pass --id", repo)
+	}
+	if err := checkCreatorID(creator.ID); err != nil {
+		return err
+	}
+
+	man, err := loadManifest(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if existing := man.GetCreator(creator.ID); existing != nil && existing.Registry != registry.Added {
+		return fmt.Errorf("%s is already in the %s registry (%s), pass --id to use another id",
+			creator.ID, existing.Registry, existing.Repo)
+	}
+
+	// discovery needs the whole tree, not a sparse checkout; it's fetched
+	// into a throwaway cache so nothing is left under an id no registry has
+	cacheDir, err := os.MkdirTemp("", "dotpicker-init-")
+	if err != nil {
+		return fmt.Errorf("couldn't create a cache directory: %w", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	manager := cache.NewManager(cacheDir)
+	manager.SetAuthenticator(cache.NewAuthenticator(cfg.GitAuth))
+	fmt.Fprintf(os.Stderr, "fetching %s...\n", creator.Repo)
+	sync, err := manager.EnsureRepoWithOptions(ctx, &creator, cache.GitOptions{})
+	if err != nil {
+		return fmt.Errorf("couldn't fetch %s: %w", creator.Repo, err)
+	}
+	if note := sync.Summary(); note != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", note)
+	}
+
+	repoPath := manager.GetRepoPath(creator.ID)
+	candidates := manifest.DetectStructures(repoPath)
+	creator.Dotfiles = manifest.Discover(repoPath, cfg.XDGDirectories)
+	printDiscovery(os.Stderr, &creator, candidates)
+	if len(creator.Dotfiles) == 0 {
+		return fmt.Errorf("found no dotfiles in %s", creator.Repo)
+	}
+
+	if origin != "" {
+		fmt.Fprintf(os.Stderr, "using the origin remote %s as the repo\n", origin)
+		creator.Repo = origin
+	}
+
+	for i := range creator.Dotfiles {
+		d := &creator.Dotfiles[i]
+		known := slices.DeleteFunc(slices.Clone(d.Dependencies), func(dep string) bool { return !deps.IsKnown(dep) })
+		if len(known) < len(d.Dependencies) {
+			fmt.Fprintf(os.Stderr, "note: %s needs something dotpicker can't install, dropped %s\n",
+				d.ID, strings.Join(slices.DeleteFunc(slices.Clone(d.Dependencies), deps.IsKnown), ", "))
+		}
+		d.Dependencies = known
+	}
+	creator.Description = describeDotfiles(creator.Dotfiles)
+
+	if *categories != "" {
+		creator.Categories = splitList(*categories)
+	} else {
+		creator.Categories = guessCategories(creator.Dotfiles, man.Categories)
+	}
+	if len(creator.Categories) == 0 {
+		var ids []string
+		for _, c := range man.Categories {
+			ids = append(ids, c.ID)
+		}
+		return fmt.Errorf("couldn't guess a category, pass --category (one of %s)", strings.Join(ids, ", "))
+	}
+
+	data, err := creatorEntry(&creator, man.Categories)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", data)
+	return nil
+}
+
+// creatorEntry marshals a creator and checks it the way `manifest lint`
+// would, inside a manifest with the categories it uses
+// errors fail, warnings are only printed
+func creatorEntry(creator *manifest.Creator, categories []manifest.Category) ([]byte, error) {
+	wrapper := manifest.Manifest{Version: "1.0", Categories: []manifest.Category{}, Creators: []manifest.Creator{*creator}}
+	for _, c := range categories {
+		if slices.Contains(creator.Categories, c.ID) {
+			wrapper.Categories = append(wrapper.Categories, c)
+		}
+	}
+	full, err := json.MarshalIndent(wrapper, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal the manifest: %w", err)
+	}
+
+	_, issues := manifest.Check(full, manifest.CheckOptions{KnownDependency: deps.IsKnown, StrictFields: true})
+	var errs int
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "%s\n", issue)
+		if issue.Severity == manifest.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return nil, fmt.Errorf("the generated entry has %d errors", errs)
+	}
+
+	data, err := json.MarshalIndent(creator, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal %s: %w", creator.ID, err)
+	}
+	return data, nil
+}
+
+// guessCategories picks the categories the dotfiles belong in, in the
+// manifest's order
+func guessCategories(dotfiles []manifest.Dotfile, categories []manifest.Category) []string {
+	wanted := make(map[string]bool)
+	for _, d := range dotfiles {
+		if category, ok := dotfileCategories[d.ID]; ok {
+			wanted[category] = true
+		}
+	}
+
+	var ids []string
+	for _, c := range categories {
+		if wanted[c.ID] {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// describeDotfiles is a first description to edit, e.g.
+// "neovim, tmux and zsh configs"
+func describeDotfiles(dotfiles []manifest.Dotfile) string {
+	names := make([]string, 0, len(dotfiles))
+	for _, d := range dotfiles {
+		names = append(names, d.Name)
+	}
+	if len(names) > 3 {
+		names = append(names[:3], "more")
+	}
+	if len(names) == 1 {
+		return names[0] + " config"
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1] + " configs"
+}
+
+// splitList splits a comma-separated flag, trimming spaces and dropping
+// empty entries so "a, b," is [a b]
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// localRepoPath is the directory a repo argument names, "" for urls
+func localRepoPath(repo string) string {
+	if strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@") {
+		return ""
+	}
+	if info, err := os.Stat(repo); err != nil || !info.IsDir() {
+		return ""
+	}
+	return repo
+}
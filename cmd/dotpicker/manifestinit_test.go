@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/deps"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+var testCategories = []manifest.Category{
+	{ID: "vim-wizards", Name: "Vim Wizards", Description: "vim and neovim"},
+	{ID: "terminal-lovers", Name: "Terminal Lovers", Description: "shells and terminals"},
+	{ID: "tiling-wm", Name: "Tiling WM", Description: "tiling window managers"},
+}
+
+func TestGuessCategories(t *testing.T) {
+	tests := []struct {
+		name     string
+		dotfiles []string
+		want     []string
+	}{
+		{name: "one", dotfiles: []string{"nvim"}, want: []string{"vim-wizards"}},
+		{name: "manifest order", dotfiles: []string{"sway", "zsh", "vim"}, want: []string{"vim-wizards", "terminal-lovers", "tiling-wm"}},
+		{name: "no duplicates", dotfiles: []string{"zsh", "tmux"}, want: []string{"terminal-lovers"}},
+		{name: "unknown dotfile", dotfiles: []string{"git"}},
+		{name: "category not in manifest", dotfiles: []string{"emacs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dotfiles []manifest.Dotfile
+			for _, id := range tt.dotfiles {
+				dotfiles = append(dotfiles, manifest.Dotfile{ID: id})
+			}
+			if got := guessCategories(dotfiles, testCategories); !slices.Equal(got, tt.want) {
+				t.Errorf("guessCategories(%v) = %v, want %v", tt.dotfiles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeDotfiles(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: []string{"neovim"}, want: "neovim config"},
+		{names: []string{"neovim", "tmux"}, want: "neovim and tmux configs"},
+		{names: []string{"neovim", "tmux", "zsh"}, want: "neovim, tmux and zsh configs"},
+		{names: []string{"neovim", "tmux", "zsh", "kitty", "git"}, want: "neovim, tmux, zsh and more configs"},
+	}
+	for _, tt := range tests {
+		var dotfiles []manifest.Dotfile
+		for _, name := range tt.names {
+			dotfiles = append(dotfiles, manifest.Dotfile{Name: name})
+		}
+		if got := describeDotfiles(dotfiles); got != tt.want {
+			t.Errorf("describeDotfiles(%v) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "vim-wizards", want: []string{"vim-wizards"}},
+		{value: "vim-wizards, minimalists", want: []string{"vim-wizards", "minimalists"}},
+		{value: " a ,, b ,", want: []string{"a", "b"}},
+		{value: " , "},
+	}
+	for _, tt := range tests {
+		if got := splitList(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLocalRepoPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{repo: dir, want: dir},
+		{repo: "https://github.com/folke/dot", want: ""},
+		{repo: "git@github.com:folke/dot.git", want: ""},
+		{repo: file, want: ""},
+		{repo: filepath.Join(dir, "missing"), want: ""},
+	}
+	for _, tt := range tests {
+		if got := localRepoPath(tt.repo); got != tt.want {
+			t.Errorf("localRepoPath(%q) = %q, want %q", tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestCreatorEntry(t *testing.T) {
+	creator := creatorFromRepo("https://github.com/folke/dot")
+	creator.Description = "neovim config"
+	creator.Categories = []string{"vim-wizards"}
+	creator.Dotfiles = []manifest.Dotfile{{ID: "nvim", Name: "neovim", Paths: []manifest.PathSpec{{Target: ".config/nvim"}}, Dependencies: []string{}}}
+
+	data, err := creatorEntry(&creator, testCategories)
+	if err != nil {
+		t.Fatalf("creatorEntry: %v", err)
+	}
+	var got manifest.Creator
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("entry isn't json: %v\n%s", err, data)
+	}
+	if got.ID != "folke" || got.Repo != creator.Repo {
+		t.Errorf("entry = %s/%s, want folke/%s", got.ID, got.Repo, creator.Repo)
+	}
+
+	creator.Categories = []string{"emcas"}
+	if _, err := creatorEntry(&creator, testCategories); err == nil {
+		t.Error("creatorEntry with an unknown category succeeded")
+	}
+}
+
+// TestManifestInitOrigin runs manifest init on a local checkout and checks
+// the entry names its origin remote, passes lint and leaves no cache behind
+func TestManifestInitOrigin(t *testing.T) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/someone/dotfiles"}}); err != nil {
+		t.Fatalf("CreateRemote: %v", err)
+	}
+	path := filepath.Join(repoDir, ".config", "nvim", "init.lua")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("vim.o.number = true\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+	if _, err := wt.Add(".config/nvim/init.lua"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := wt.Commit("initial commit", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com"}}); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if origin := cache.OriginURL(repoDir); creatorFromRepo(origin).ID != "someone" {
+		t.Fatalf("OriginURL(%s) = %q, want a someone/dotfiles url", repoDir, origin)
+	}
+
+	// the official registry is unreachable, so the bundled one is used
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg, err := config.Default()
+	if err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	server := httptest.NewServer(nil)
+	server.Close()
+	cfg.ManifestURL = server.URL
+
+	var out bytes.Buffer
+	if err := runManifestInit(context.Background(), cfg, []string{repoDir}, &out); err != nil {
+		t.Fatalf("runManifestInit: %v", err)
+	}
+
+	var creator manifest.Creator
+	if err := json.Unmarshal(out.Bytes(), &creator); err != nil {
+		t.Fatalf("output isn't a creator: %v\n%s", err, out.String())
+	}
+	if creator.ID != "someone" || creator.Repo != "https://github.com/someone/dotfiles" {
+		t.Errorf("creator = %s (%s), want someone (https://github.com/someone/dotfiles)", creator.ID, creator.Repo)
+	}
+
+	wrapper := manifest.Manifest{Version: "1.0", Categories: testCategories, Creators: []manifest.Creator{creator}}
+	data, err := json.Marshal(wrapper)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	_, issues := manifest.Check(data, manifest.CheckOptions{KnownDependency: deps.IsKnown, StrictFields: true})
+	for _, issue := range issues {
+		if issue.Severity == manifest.SeverityError {
+			t.Errorf("entry doesn't pass lint: %s", issue)
+		}
+	}
+
+	if entries, _ := os.ReadDir(cfg.CacheDir); len(entries) > 0 {
+		t.Errorf("manifest init left %d entries in the cache", len(entries))
+	}
+}
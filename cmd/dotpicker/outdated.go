@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/history"
+)
+
+// runOutdated prints what changed upstream in every applied dotfile
+// repos are always pulled first, except in offline mode
+func runOutdated(ctx context.Context, cfg *config.Config, out io.Writer) error {
+	store := history.NewStore(cfg.HistoryPath)
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "no dotfiles applied yet")
+		return nil
+	}
+
+	manager := cache.NewManager(cfg.CacheDir)
+	manager.SetAuthenticator(cache.NewAuthenticator(cfg.GitAuth))
+	manager.SetLinked(store.Linked)
+	if cfg.RepoRefresh == config.RepoRefreshNever {
+		manager.SetRefreshPolicy(cache.RefreshPolicy{Mode: cache.RefreshNever})
+	}
+
+	// each creator only needs pulling once
+	synced := make(map[string]error)
+
+	for _, e := range entries {
+		fmt.Fprintf(out, "%s · %s (applied %s at %s)\n",
+			e.CreatorName, e.DotfileName, cache.FormatAge(time.Since(e.AppliedAt)), shortHash(e.Commit))
+
+		if _, ok := synced[e.CreatorID]; !ok {
+			sync, err := manager.EnsureRepoWithOptions(ctx, e.Creator(), cache.GitOptions{})
+			if err == nil && sync.PullErr != nil {
+				fmt.Fprintf(out, "  warning: %s\n", sync.Summary())
+			}
+			if err == nil && sync.Repair != nil {
+				fmt.Fprintf(out, "  note: %s\n", sync.Repair.Summary())
+			}
+			synced[e.CreatorID] = err
+		}
+		if err := synced[e.CreatorID]; err != nil {
+			fmt.Fprintf(out, "  couldn't update repo: %v\n\n", err)
+			continue
+		}
+
+		repoPath := manager.GetRepoPath(e.CreatorID)
+		if err := cache.DeepenSince(ctx, repoPath, e.AppliedAt, manager.GitOptions()); err != nil {
+			// not fatal, we just may not see all the way back
+			fmt.Fprintf(out, "  warning: %v\n", err)
+		}
+
+		changes, err := cache.ChangesSince(repoPath, e.Commit, e.Paths)
+		if err != nil {
+			fmt.Fprintf(out, "  couldn't read history: %v\n\n", err)
+			continue
+		}
+
+		printChangelog(out, changes)
+		fmt.Fprintln(out)
+	}
+
+	return nil
+}
+
+// printChangelog writes one changelog as indented commit and file lines
+func printChangelog(out io.Writer, changes *cache.Changelog) {
+	if changes.UpToDate() {
+		fmt.Fprintln(out, "  up to date")
+		return
+	}
+
+	for _, c := range changes.Commits {
+		fmt.Fprintf(out, "  %s %s (%s, %s)\n", c.ShortHash(), c.Message, c.Author, cache.FormatAge(time.Since(c.When)))
+		for _, f := range c.Files {
+			fmt.Fprintf(out, "      %s +%d -%d\n", f.Path, f.Added, f.Deleted)
+		}
+	}
+
+	if changes.Truncated {
+		fmt.Fprintln(out, "  (older history isn't available locally, there may be more changes)")
+	}
+}
+
+// shortHash abbreviates a commit hash for display
+func shortHash(hash string) string {
+	return cache.CommitChange{Hash: hash}.ShortHash()
+}
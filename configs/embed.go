@@ -0,0 +1,10 @@
+// package configs holds the files built into the dotpicker binary
+package configs
+
+import _ "embed"
+
+// Manifest is the bundled registry, used when the remote and cached ones
+// are missing or older, so a first run works offline from any directory
+//
+//go:embed manifest.json
+var Manifest []byte
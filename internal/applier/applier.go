@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/milxzy/dotfile-picker/internal/backup"
@@ -42,21 +43,43 @@ type ApplyResult struct {
 	TargetPath string
 	Error      error
 	Skipped    bool
+	Linked     bool // the target links into the cache instead of being a copy
 }
 
 // Apply copies a dotfile from the cached repo to the target location
 // creates backup of existing file first
 func (a *Applier) Apply(sourcePath, targetRelPath string, creator *manifest.Creator, dotfile *manifest.Dotfile) *ApplyResult {
+	return a.ApplyWithAttrs(sourcePath, targetRelPath, manifest.FileAttrs{}, creator, dotfile)
+}
+
+// ApplyWithAttrs is Apply with a mode, symlink or create-only flag from the
+// repo's source state (e.g. chezmoi's private_ and symlink_ prefixes)
+func (a *Applier) ApplyWithAttrs(sourcePath, targetRelPath string, attrs manifest.FileAttrs, creator *manifest.Creator, dotfile *manifest.Dotfile) *ApplyResult {
 	result := &ApplyResult{}
 
 	// resolve target path (expand to full path)
 	targetPath := a.ResolveTargetPath(targetRelPath, a.homeDir)
 	result.TargetPath = targetPath
 
+	if _, err := os.Lstat(targetPath); err == nil && attrs.CreateOnly {
+		logger.Debug("  Target exists and is create-only, leaving it alone")
+		result.Skipped = true
+		result.Success = true
+		return result
+	}
+
 	logger.Debug("Applying file:")
 	logger.Debug("  Source: %s", sourcePath)
 	logger.Debug("  Target: %s", targetPath)
 
+	// a directory folded by a linked apply would take the write into the
+	// cache, and from there into every target linked to it
+	if err := a.unfoldCacheLinks(targetPath); err != nil {
+		logger.Error("  Unfold failed: %v", err)
+		result.Error = err
+		return result
+	}
+
 	// check if target exists
 	if info, err := os.Stat(targetPath); err == nil {
 		logger.Debug("  Existing file: YES (size: %d bytes, mode: %v)", info.Size(), info.Mode())
@@ -87,7 +110,7 @@ func (a *Applier) Apply(sourcePath, targetRelPath string, creator *manifest.Crea
 
 	// copy the file
 	logger.Debug("  Copying file...")
-	if err := copyFile(sourcePath, targetPath); err != nil {
+	if err := writeTarget(sourcePath, targetPath, attrs); err != nil {
 		logger.Error("  Copy failed: %v", err)
 		result.Error = fmt.Errorf("couldn't copy file: %w", err)
 		// try to restore backup if copy failed
@@ -100,12 +123,20 @@ func (a *Applier) Apply(sourcePath, targetRelPath string, creator *manifest.Crea
 
 	logger.Info("  ✓ File applied successfully")
 	result.Success = true
+	result.Linked = attrs.Link
 	return result
 }
 
 // ApplyMultiple applies multiple dotfiles
 // returns results for each file
 func (a *Applier) ApplyMultiple(files map[string]string, creator *manifest.Creator, dotfile *manifest.Dotfile) []*ApplyResult {
+	return a.ApplyMultipleWithAttrs(files, nil, creator, dotfile)
+}
+
+// ApplyMultipleWithAttrs is ApplyMultiple with per-target attributes, keyed
+// by the same target paths as files; attrs for targets that aren't in files
+// are directories, whose modes are set once everything inside is written
+func (a *Applier) ApplyMultipleWithAttrs(files map[string]string, attrs map[string]manifest.FileAttrs, creator *manifest.Creator, dotfile *manifest.Dotfile) []*ApplyResult {
 	logger.Section("Applying Files")
 	logger.Info("Total files to apply: %d", len(files))
 
@@ -115,7 +146,7 @@ func (a *Applier) ApplyMultiple(files map[string]string, creator *manifest.Creat
 	fileNum := 1
 	for sourcePath, targetRelPath := range files {
 		logger.Debug("--- File %d/%d ---", fileNum, len(files))
-		result := a.Apply(sourcePath, targetRelPath, creator, dotfile)
+		result := a.ApplyWithAttrs(sourcePath, targetRelPath, attrs[targetRelPath], creator, dotfile)
 		results = append(results, result)
 		if result.Success {
 			successCount++
@@ -123,6 +154,8 @@ func (a *Applier) ApplyMultiple(files map[string]string, creator *manifest.Creat
 		fileNum++
 	}
 
+	a.applyDirModes(files, attrs)
+
 	logger.Section("Application Summary")
 	logger.Info("Successfully applied: %d/%d files", successCount, len(files))
 	if successCount < len(files) {
@@ -220,6 +253,148 @@ func (a *Applier) Rollback(results []*ApplyResult) error {
 	return nil
 }
 
+// applyDirModes sets the modes of directories listed in attrs
+// deepest first, so a read-only parent never blocks its children
+func (a *Applier) applyDirModes(files map[string]string, attrs map[string]manifest.FileAttrs) {
+	isFile := make(map[string]bool, len(files))
+	for _, target := range files {
+		isFile[target] = true
+	}
+
+	var dirs []string
+	for target, attr := range attrs {
+		if !isFile[target] && attr.Mode != 0 {
+			dirs = append(dirs, target)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+
+	for _, dir := range dirs {
+		path := a.ResolveTargetPath(dir, a.homeDir)
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.Chmod(path, attrs[dir].Mode); err != nil {
+			logger.Warn("  Couldn't set mode of %s: %v", path, err)
+		}
+	}
+}
+
+// Unfold turns a folded directory, a symlink to a directory, back into a
+// real directory of links to what it held, so other packages can link
+// into it too (stow does the same when a second package needs the tree)
+func (a *Applier) Unfold(targetRelPath string) error {
+	return unfold(a.ResolveTargetPath(targetRelPath, a.homeDir))
+}
+
+// unfoldCacheLinks unfolds every parent of targetPath that links into the
+// cache, outermost first, whichever creator or mode put it there
+func (a *Applier) unfoldCacheLinks(targetPath string) error {
+	if a.config.CacheDir == "" {
+		return nil
+	}
+	cacheDir, err := filepath.EvalSymlinks(a.config.CacheDir)
+	if err != nil {
+		// no cache, nothing can link into it
+		return nil
+	}
+
+	var parents []string
+	for dir := filepath.Dir(targetPath); ; dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range parents {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			// missing, and so is everything below it
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		dest, err := filepath.EvalSymlinks(dir)
+		if err != nil || !fsutil.InsideDir(cacheDir, dest) {
+			continue
+		}
+		if err := unfold(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unfold replaces the directory link at targetPath with a directory of
+// links to its entries
+func unfold(targetPath string) error {
+	info, err := os.Lstat(targetPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("couldn't unfold %s: not a symlink", targetPath)
+	}
+	dest, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return fmt.Errorf("couldn't unfold %s: %w", targetPath, err)
+	}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		return fmt.Errorf("couldn't unfold %s: %w", targetPath, err)
+	}
+
+	logger.Debug("Unfolding %s (was a link to %s)", targetPath, dest)
+	if err := os.Remove(targetPath); err != nil {
+		return fmt.Errorf("couldn't remove link %s: %w", targetPath, err)
+	}
+	if err := os.Mkdir(targetPath, 0755); err != nil {
+		return fmt.Errorf("couldn't create directory %s: %w", targetPath, err)
+	}
+	for _, entry := range entries {
+		if err := os.Symlink(filepath.Join(dest, entry.Name()), filepath.Join(targetPath, entry.Name())); err != nil {
+			return fmt.Errorf("couldn't link %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// writeTarget puts a source file at the target, as a copy or a symlink
+func writeTarget(sourcePath, targetPath string, attrs manifest.FileAttrs) error {
+	if attrs.Link {
+		// the old file is backed up already
+		if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(sourcePath, targetPath)
+	}
+
+	if attrs.Symlink {
+		link, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return err
+		}
+		// the old file is backed up already
+		if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(strings.TrimSpace(string(link)), targetPath)
+	}
+
+	// a link from an earlier linked apply points into the cache, copying
+	// through it would overwrite the source; it's backed up already
+	if info, err := os.Lstat(targetPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(targetPath); err != nil {
+			return err
+		}
+	}
+	if err := copyFile(sourcePath, targetPath); err != nil {
+		return err
+	}
+	if attrs.Mode != 0 {
+		return os.Chmod(targetPath, attrs.Mode)
+	}
+	return nil
+}
+
 // copyFile copies a file from src to dst preserving permissions.
 func copyFile(src, dst string) error {
 	return fsutil.CopyFile(src, dst)
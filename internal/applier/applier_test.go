@@ -17,6 +17,7 @@ func setupApplier(t *testing.T) (*Applier, string) {
 	mgr := backup.NewManager(filepath.Join(dir, "backups"))
 
 	cfg := &config.Config{
+		CacheDir:         filepath.Join(dir, "cache"),
 		DotfilesRoot:     filepath.Join(dir, ".config"),
 		AutoXDGDetection: false, // disabled by default for existing tests
 		XDGDirectories:   []string{"nvim", "vim", "kitty"},
@@ -250,3 +251,179 @@ func TestRollback(t *testing.T) {
 		t.Errorf("post-rollback content wrong: %q", string(data))
 	}
 }
+
+func TestApplyMultipleWithAttrs(t *testing.T) {
+	a, dir := setupApplier(t)
+
+	script := filepath.Join(dir, "src", "executable_build.sh")
+	config := filepath.Join(dir, "src", "private_dot_ssh", "config")
+	link := filepath.Join(dir, "src", "symlink_dot_vimrc")
+	local := filepath.Join(dir, "src", "create_dot_gitconfig.local")
+	writeFile(t, script, "#!/bin/sh\n")
+	writeFile(t, config, "Host *\n")
+	writeFile(t, link, ".config/nvim/init.lua\n")
+	writeFile(t, local, "[user]\n")
+
+	// create-only targets that already exist are kept
+	writeFile(t, filepath.Join(dir, ".gitconfig.local"), "mine\n")
+
+	files := map[string]string{
+		script: ".local/bin/build.sh",
+		config: ".ssh/config",
+		link:   ".vimrc",
+		local:  ".gitconfig.local",
+	}
+	attrs := map[string]manifest.FileAttrs{
+		".local/bin/build.sh": {Mode: 0755},
+		".ssh":                {Mode: 0700},
+		".ssh/config":         {Mode: 0600},
+		".vimrc":              {Symlink: true},
+		".gitconfig.local":    {Mode: 0644, CreateOnly: true},
+	}
+
+	for _, r := range a.ApplyMultipleWithAttrs(files, attrs, fakeCreator, fakeDotfile) {
+		if !r.Success {
+			t.Errorf("Apply failed for %s: %v", r.TargetPath, r.Error)
+		}
+	}
+
+	modes := map[string]os.FileMode{
+		".local/bin/build.sh": 0755,
+		".ssh":                0700,
+		".ssh/config":         0600,
+	}
+	for target, mode := range modes {
+		info, err := os.Stat(filepath.Join(dir, target))
+		if err != nil {
+			t.Errorf("Stat %s: %v", target, err)
+			continue
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s: expected mode %o, got %o", target, mode, info.Mode().Perm())
+		}
+	}
+
+	if dest, err := os.Readlink(filepath.Join(dir, ".vimrc")); err != nil || dest != ".config/nvim/init.lua" {
+		t.Errorf("expected .vimrc to link to .config/nvim/init.lua, got %q (%v)", dest, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".gitconfig.local")); string(data) != "mine\n" {
+		t.Errorf("expected the existing create-only target to be kept, got %q", data)
+	}
+}
+
+func TestUnfoldAndLink(t *testing.T) {
+	a, dir := setupApplier(t)
+
+	// a folded .config/fish from one package, another package adds conf.d
+	fish := filepath.Join(dir, "stow", "fish", ".config", "fish")
+	writeFile(t, filepath.Join(fish, "config.fish"), "set -g fish_greeting\n")
+	extra := filepath.Join(dir, "stow", "fish-extra", ".config", "fish", "conf.d")
+	writeFile(t, filepath.Join(extra, "a.fish"), "alias g git\n")
+	writeFile(t, filepath.Join(dir, ".config", "placeholder"), "")
+	if err := os.Symlink(fish, filepath.Join(dir, ".config", "fish")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	if err := a.Unfold(".config/fish"); err != nil {
+		t.Fatalf("Unfold: %v", err)
+	}
+	info, err := os.Lstat(filepath.Join(dir, ".config", "fish"))
+	if err != nil || !info.IsDir() {
+		t.Fatalf("expected .config/fish to be a real directory, got %v (%v)", info, err)
+	}
+	if dest, err := os.Readlink(filepath.Join(dir, ".config", "fish", "config.fish")); err != nil || dest != filepath.Join(fish, "config.fish") {
+		t.Errorf("expected config.fish to link into the first package, got %q (%v)", dest, err)
+	}
+
+	result := a.ApplyWithAttrs(extra, ".config/fish/conf.d", manifest.FileAttrs{Link: true}, fakeCreator, fakeDotfile)
+	if !result.Success {
+		t.Fatalf("Apply: %v", result.Error)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".config", "fish", "conf.d", "a.fish"))
+	if err != nil || string(data) != "alias g git\n" {
+		t.Errorf("expected conf.d to be linked in, got %q (%v)", data, err)
+	}
+
+	if err := a.Unfold(".config/placeholder"); err == nil {
+		t.Error("expected unfolding a plain file to fail")
+	}
+}
+
+func TestCopyOverLink(t *testing.T) {
+	a, dir := setupApplier(t)
+
+	src := filepath.Join(dir, "cache", "kitty.conf")
+	writeFile(t, src, "font_size 12\n")
+	if err := os.Chmod(src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// linked first, then applied again as a copy with a different mode
+	if result := a.ApplyWithAttrs(src, ".config/kitty/kitty.conf", manifest.FileAttrs{Link: true}, fakeCreator, fakeDotfile); !result.Success {
+		t.Fatalf("linked Apply: %v", result.Error)
+	}
+	if result := a.ApplyWithAttrs(src, ".config/kitty/kitty.conf", manifest.FileAttrs{Mode: 0600}, fakeCreator, fakeDotfile); !result.Success {
+		t.Fatalf("copied Apply: %v", result.Error)
+	}
+
+	target := filepath.Join(dir, ".config", "kitty", "kitty.conf")
+	info, err := os.Lstat(target)
+	if err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("expected the link to be replaced by a copy, got %v (%v)", info, err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "font_size 12\n" {
+		t.Errorf("unexpected target content %q", data)
+	}
+	if data, _ := os.ReadFile(src); string(data) != "font_size 12\n" {
+		t.Errorf("the cached source was overwritten: %q", data)
+	}
+	if info, err := os.Stat(src); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("the cached source's mode changed: %v (%v)", info, err)
+	}
+}
+
+func TestCopyIntoFoldedDir(t *testing.T) {
+	a, dir := setupApplier(t)
+
+	// creator a's nvim was linked with stow_link, folding .config/nvim
+	folded := filepath.Join(dir, "cache", "a", "nvim", ".config", "nvim")
+	writeFile(t, filepath.Join(folded, "init.lua"), "-- a\n")
+	writeFile(t, filepath.Join(folded, "lua", "a.lua"), "return 'a'\n")
+	writeFile(t, filepath.Join(dir, ".config", "placeholder"), "")
+	if err := os.Symlink(folded, filepath.Join(dir, ".config", "nvim")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	// creator b's nvim is then copied over it
+	other := filepath.Join(dir, "cache", "b", ".config", "nvim")
+	writeFile(t, filepath.Join(other, "init.lua"), "-- b\n")
+	writeFile(t, filepath.Join(other, "lua", "b.lua"), "return 'b'\n")
+	creatorB := &manifest.Creator{ID: "b"}
+	results := a.ApplyMultiple(map[string]string{
+		filepath.Join(other, "init.lua"):     ".config/nvim/init.lua",
+		filepath.Join(other, "lua", "b.lua"): ".config/nvim/lua/b.lua",
+	}, creatorB, fakeDotfile)
+	for _, result := range results {
+		if !result.Success {
+			t.Fatalf("Apply %s: %v", result.TargetPath, result.Error)
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(folded, "init.lua")); string(data) != "-- a\n" {
+		t.Errorf("creator a's cached init.lua was overwritten: %q", data)
+	}
+	if _, err := os.Lstat(filepath.Join(folded, "lua", "b.lua")); err == nil {
+		t.Error("creator b's file was written into creator a's cache")
+	}
+	for _, target := range []string{".config/nvim", ".config/nvim/lua"} {
+		if info, err := os.Lstat(filepath.Join(dir, target)); err != nil || !info.IsDir() {
+			t.Errorf("expected %s to be unfolded into a real directory, got %v (%v)", target, info, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".config", "nvim", "init.lua")); string(data) != "-- b\n" {
+		t.Errorf("expected creator b's init.lua, got %q", data)
+	}
+	if dest, err := os.Readlink(filepath.Join(dir, ".config", "nvim", "lua", "a.lua")); err != nil || dest != filepath.Join(folded, "lua", "a.lua") {
+		t.Errorf("expected a.lua to still link into creator a's cache, got %q (%v)", dest, err)
+	}
+}
@@ -0,0 +1,373 @@
+// package cache downloads and unpacks tarball and zip sources
+package cache
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// archiveClient downloads archives, no timeout since ctx cancels downloads
+var archiveClient = &http.Client{}
+
+// archiveSource downloads a release tarball or zip over http(s)
+type archiveSource struct {
+	url string
+}
+
+func (s *archiveSource) Kind() string { return manifest.SourceArchive }
+
+// Fetch downloads and unpacks the archive into dir
+func (s *archiveSource) Fetch(ctx context.Context, dir string, opts GitOptions) error {
+	return s.Update(ctx, dir, opts)
+}
+
+// Update downloads the archive again and swaps in the new contents
+func (s *archiveSource) Update(ctx context.Context, dir string, opts GitOptions) error {
+	file, err := s.download(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+
+	return replaceDir(dir, func(tmp string) error {
+		if err := extractArchive(file, s.url, tmp); err != nil {
+			return fmt.Errorf("couldn't unpack %s: %w", s.url, err)
+		}
+		return flattenSingleDir(tmp)
+	})
+}
+
+// download saves the archive to a temp file and returns its path
+func (s *archiveSource) download(ctx context.Context, opts GitOptions) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create request: %w", err)
+	}
+
+	// token auth works for archives too, e.g. release assets of private repos
+	creds, err := opts.credentials(ctx, s.url)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get credentials: %w", err)
+	}
+	if method := creds.method(); method != nil {
+		if basic, ok := method.(interface{ SetAuth(*http.Request) }); ok {
+			basic.SetAuth(req)
+		}
+	}
+
+	resp, err := archiveClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("download cancelled: %w", ctx.Err())
+		}
+		return "", fmt.Errorf("couldn't download %s: %w", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't download %s: unexpected status code: %d", s.url, resp.StatusCode)
+	}
+
+	out, err := os.CreateTemp("", "dotpicker-archive-*")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create temp file: %w", err)
+	}
+	defer out.Close()
+
+	var body io.Reader = resp.Body
+	if opts.Progress != nil {
+		body = &countingReader{r: resp.Body, total: resp.ContentLength, report: opts.Progress}
+	}
+
+	if _, err := io.Copy(out, body); err != nil {
+		os.Remove(out.Name())
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("download cancelled: %w", ctx.Err())
+		}
+		return "", fmt.Errorf("couldn't download %s: %w", s.url, err)
+	}
+
+	return out.Name(), nil
+}
+
+// countingReader reports download progress in kilobytes
+type countingReader struct {
+	r      io.Reader
+	read   int64
+	total  int64 // -1 when the server didn't say
+	report ProgressFunc
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+
+	progress := Progress{Stage: "Downloading archive", Current: int(c.read / 1024)}
+	if c.total > 0 {
+		progress.Total = int(c.total / 1024)
+	}
+	progress.Done = err == io.EOF
+	c.report(progress)
+
+	return n, err
+}
+
+// isArchiveName reports whether a url path looks like a supported archive
+func isArchiveName(name string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArchive unpacks a tarball or zip, picking the format from the url
+func extractArchive(file, url, dir string) error {
+	name, _, _ := strings.Cut(strings.ToLower(url), "?")
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(file, dir)
+	case strings.HasSuffix(name, ".tar"):
+		return extractTar(file, dir, false)
+	default:
+		return extractTar(file, dir, true)
+	}
+}
+
+// extractTar unpacks a (gzipped) tarball into dir
+func extractTar(file, dir string, gzipped bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var links []archiveLink
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return makeLinks(dir, links)
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			links = append(links, archiveLink{target: target, link: header.Linkname})
+		}
+		// hard links, devices and the like are skipped
+	}
+}
+
+// extractZip unpacks a zip archive into dir
+func extractZip(file, dir string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var links []archiveLink
+	for _, entry := range zr.File {
+		target, err := safeJoin(dir, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			link, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			links = append(links, archiveLink{target: target, link: string(link)})
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, entry.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return makeLinks(dir, links)
+}
+
+// archiveLink is a symlink entry, created once everything else is written
+// so no file or directory is ever written through one
+type archiveLink struct {
+	target string
+	link   string
+}
+
+// makeLinks creates the archive's symlinks and checks where they really
+// point: chained links (a -> ., a/b -> ..) escape dir even though each one
+// looks fine on its own. every link is checked as it's made, so later ones
+// never get created through an escaping one, and again at the end since a
+// dangling link can start resolving once its target shows up
+func makeLinks(dir string, links []archiveLink) error {
+	if len(links) == 0 {
+		return nil
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range links {
+		if err := safeLink(dir, l.target, l.link); err != nil {
+			return err
+		}
+		if err := checkLink(realDir, l); err != nil {
+			return err
+		}
+	}
+	for _, l := range links {
+		if err := checkLink(realDir, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLink fails when a created symlink resolves outside realDir
+func checkLink(realDir string, l archiveLink) error {
+	resolved, err := filepath.EvalSymlinks(l.target)
+	if err != nil {
+		// dangling links don't lead anywhere (yet)
+		return nil
+	}
+	if !within(realDir, resolved) {
+		return fmt.Errorf("archive symlink %s -> %s escapes the target directory", l.target, l.link)
+	}
+	return nil
+}
+
+// within reports whether path is dir or inside it
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// safeJoin joins an archive entry name onto dir, rejecting entries that
+// would land outside it ("zip slip")
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !within(dir, target) {
+		return "", fmt.Errorf("archive entry %q escapes the target directory", name)
+	}
+	return target, nil
+}
+
+// safeLink creates a symlink, refusing ones that point outside dir
+func safeLink(dir, target, link string) error {
+	resolved := filepath.Join(filepath.Dir(target), link)
+	if filepath.IsAbs(link) || !within(dir, resolved) {
+		return fmt.Errorf("archive symlink %s -> %s escapes the target directory", target, link)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(link, target)
+}
+
+// writeFile writes r to path, creating parent directories
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0644
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// flattenSingleDir hoists the contents of a lone top-level directory
+// release archives usually wrap everything in "<repo>-<version>/", which is
+// never hidden, so a lone .config stays put
+func flattenSingleDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() || strings.HasPrefix(entries[0].Name(), ".") {
+		return nil
+	}
+
+	inner := filepath.Join(dir, entries[0].Name())
+	children, err := os.ReadDir(inner)
+	if err != nil {
+		return err
+	}
+
+	// a child named like the wrapper would collide mid-move, rename first
+	wrapper := filepath.Join(dir, ".dotpicker-unwrap")
+	if err := os.Rename(inner, wrapper); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(wrapper, child.Name()), filepath.Join(dir, child.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(wrapper)
+}
@@ -0,0 +1,318 @@
+// package cache resolves credentials for private creator repos
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/milxzy/dotfile-picker/internal/config"
+)
+
+// Credentials is the auth resolved for one remote
+type Credentials struct {
+	// Method is passed to go-git, nil means anonymous
+	Method transport.AuthMethod
+
+	// Env is added to git cli commands so sparse clones and pulls
+	// authenticate the same way
+	Env []string
+
+	// Args go before the git cli command, for config git can't read from
+	// the environment
+	Args []string
+}
+
+// Authenticator supplies credentials for remote urls
+type Authenticator interface {
+	// Credentials returns the auth for url, nil when none is configured
+	Credentials(ctx context.Context, url string) (*Credentials, error)
+}
+
+// hostAuthenticator looks credentials up by the remote's host
+type hostAuthenticator struct {
+	hosts map[string]config.GitAuth
+}
+
+// NewAuthenticator creates an Authenticator from per-host settings
+func NewAuthenticator(hosts map[string]config.GitAuth) Authenticator {
+	return &hostAuthenticator{hosts: hosts}
+}
+
+// Credentials implements Authenticator
+func (a *hostAuthenticator) Credentials(ctx context.Context, rawURL string) (*Credentials, error) {
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil || endpoint.Protocol == "file" {
+		return nil, nil
+	}
+
+	auth, ok := a.hosts[endpoint.Host]
+	if !ok {
+		return nil, nil
+	}
+
+	switch auth.Method {
+	case config.GitAuthSSHAgent:
+		return sshAgentCredentials(endpoint, auth)
+	case config.GitAuthSSHKey:
+		return sshKeyCredentials(endpoint, auth)
+	case config.GitAuthToken:
+		return tokenCredentials(endpoint, auth)
+	case config.GitAuthCredentialHelper:
+		return helperCredentials(ctx, endpoint, auth)
+	default:
+		return nil, fmt.Errorf("unknown auth method %q for %s", auth.Method, endpoint.Host)
+	}
+}
+
+// sshAgentCredentials uses keys loaded in the running ssh-agent
+func sshAgentCredentials(endpoint *transport.Endpoint, auth config.GitAuth) (*Credentials, error) {
+	if endpoint.Protocol != "ssh" {
+		return nil, fmt.Errorf("ssh-agent auth for %s needs an ssh url", endpoint.Host)
+	}
+
+	method, err := gitssh.NewSSHAgentAuth(sshUser(endpoint, auth))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach ssh-agent: %w", err)
+	}
+	// the git cli talks to the agent on its own
+	return &Credentials{Method: method}, nil
+}
+
+// sshKeyCredentials uses a private key file
+func sshKeyCredentials(endpoint *transport.Endpoint, auth config.GitAuth) (*Credentials, error) {
+	if endpoint.Protocol != "ssh" {
+		return nil, fmt.Errorf("ssh-key auth for %s needs an ssh url", endpoint.Host)
+	}
+
+	var passphrase string
+	if auth.PassphraseEnv != "" {
+		passphrase = os.Getenv(auth.PassphraseEnv)
+	}
+
+	method, err := gitssh.NewPublicKeysFromFile(sshUser(endpoint, auth), auth.KeyFile, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load ssh key %s: %w", auth.KeyFile, err)
+	}
+
+	return &Credentials{
+		Method: method,
+		Env:    []string{"GIT_SSH_COMMAND=ssh -i " + shellQuote(auth.KeyFile) + " -o IdentitiesOnly=yes"},
+	}, nil
+}
+
+// tokenCredentials sends an https token from the environment or a credentials file
+func tokenCredentials(endpoint *transport.Endpoint, auth config.GitAuth) (*Credentials, error) {
+	if endpoint.Protocol != "https" && endpoint.Protocol != "http" {
+		return nil, fmt.Errorf("token auth for %s needs an https url", endpoint.Host)
+	}
+
+	user := auth.Username
+	var token string
+	if auth.TokenEnv != "" {
+		token = os.Getenv(auth.TokenEnv)
+	}
+	if token == "" && auth.CredentialsFile != "" {
+		fileUser, fileToken, err := readCredentialsFile(auth.CredentialsFile, endpoint.Host)
+		if err != nil {
+			return nil, err
+		}
+		token = fileToken
+		if user == "" {
+			user = fileUser
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no token for %s (set %s or add it to the credentials file)", endpoint.Host, auth.TokenEnv)
+	}
+
+	return basicCredentials(endpoint, user, token), nil
+}
+
+// helperCredentials asks git's credential helpers, like `git credential fill`
+func helperCredentials(ctx context.Context, endpoint *transport.Endpoint, auth config.GitAuth) (*Credentials, error) {
+	if endpoint.Protocol != "https" && endpoint.Protocol != "http" {
+		return nil, fmt.Errorf("credential helpers for %s need an https url", endpoint.Host)
+	}
+
+	args := []string{"credential", "fill"}
+	if auth.Helper != "" {
+		// reset the configured list so only this helper is asked
+		args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + auth.Helper}, args...)
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n", endpoint.Protocol, endpoint.Host, strings.TrimPrefix(endpoint.Path, "/"))
+	if auth.Username != "" {
+		input += "username=" + auth.Username + "\n"
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = strings.NewReader(input + "\n")
+	// never block the tui on a credential prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper has nothing for %s: %w", endpoint.Host, err)
+	}
+
+	var user, password string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "username":
+			user = value
+		case "password":
+			password = value
+		}
+	}
+	if password == "" {
+		return nil, fmt.Errorf("credential helper has nothing for %s", endpoint.Host)
+	}
+
+	return basicCredentials(endpoint, user, password), nil
+}
+
+// basicCredentials builds http basic auth for go-git and the git cli
+func basicCredentials(endpoint *transport.Endpoint, user, password string) *Credentials {
+	if user == "" {
+		// github, gitea and friends accept any user name with a token
+		user = "x-access-token"
+	}
+
+	creds := &Credentials{Method: &githttp.BasicAuth{Username: user, Password: password}}
+	host := endpoint.Protocol + "://" + endpoint.Host
+	if gitReadsConfigEnv() {
+		// passed through the environment so the token never shows up in ps,
+		// scoped to the host so submodules elsewhere never see it
+		header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+		creds.Env = []string{
+			"GIT_CONFIG_COUNT=1",
+			fmt.Sprintf("GIT_CONFIG_KEY_0=http.%s/.extraHeader", host),
+			"GIT_CONFIG_VALUE_0=" + header,
+		}
+		return creds
+	}
+
+	// older git ignores GIT_CONFIG_*, so a helper scoped to the host hands
+	// over the credentials; they stay in the environment, out of ps
+	creds.Env = []string{"DOTPICKER_GIT_USERNAME=" + user, "DOTPICKER_GIT_PASSWORD=" + password}
+	creds.Args = []string{
+		"-c", "credential." + host + ".helper=",
+		"-c", "credential." + host + ".helper=" + envCredentialHelper,
+	}
+	return creds
+}
+
+// envCredentialHelper answers git's credential requests from the
+// DOTPICKER_GIT_* variables basicCredentials sets
+const envCredentialHelper = `!f() { if test "$1" = get; then printf 'username=%s\npassword=%s\n' "$DOTPICKER_GIT_USERNAME" "$DOTPICKER_GIT_PASSWORD"; fi; }; f`
+
+// gitReadsConfigEnv reports whether the installed git reads config from
+// GIT_CONFIG_COUNT, which came in 2.31; true when git isn't installed,
+// nothing runs it then
+var gitReadsConfigEnv = sync.OnceValue(func() bool {
+	out, err := exec.Command("git", "version").Output()
+	if err != nil {
+		return true
+	}
+	major, minor, ok := parseGitVersion(string(out))
+	return !ok || major > 2 || major == 2 && minor >= 31
+})
+
+// parseGitVersion reads `git version` output, e.g. "git version 2.39.3
+// (Apple Git-146)" or "git version 2.45.1.windows.1"
+func parseGitVersion(out string) (major, minor int, ok bool) {
+	fields := strings.Fields(out)
+	if len(fields) < 3 {
+		return 0, 0, false
+	}
+	parts := strings.Split(fields[2], ".")
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// readCredentialsFile finds a host's entry in a git-credentials style file
+func readCredentialsFile(path, host string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't read credentials file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Host != host || u.User == nil {
+			continue
+		}
+		password, _ := u.User.Password()
+		return u.User.Username(), password, nil
+	}
+
+	return "", "", fmt.Errorf("no entry for %s in %s", host, path)
+}
+
+// sshUser picks the ssh login, the url's user wins over the configured one
+func sshUser(endpoint *transport.Endpoint, auth config.GitAuth) string {
+	switch {
+	case endpoint.User != "":
+		return endpoint.User
+	case auth.Username != "":
+		return auth.Username
+	default:
+		return "git"
+	}
+}
+
+// shellQuote quotes a path for GIT_SSH_COMMAND, which git runs via the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// method returns the go-git auth, nil safe
+func (c *Credentials) method() transport.AuthMethod {
+	if c == nil {
+		return nil
+	}
+	return c.Method
+}
+
+// env returns the git cli environment, nil safe
+func (c *Credentials) env() []string {
+	if c == nil {
+		return nil
+	}
+	return c.Env
+}
+
+// args returns the git cli options, nil safe
+func (c *Credentials) args() []string {
+	if c == nil {
+		return nil
+	}
+	return c.Args
+}
@@ -0,0 +1,195 @@
+// package cache walks repo history to find upstream changes to applied dotfiles
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// FileChange is the diff stat for one file in a commit
+type FileChange struct {
+	Path    string
+	Added   int
+	Deleted int
+}
+
+// CommitChange is one upstream commit that touched applied paths
+type CommitChange struct {
+	Hash    string
+	Author  string
+	When    time.Time
+	Message string // first line only
+	Files   []FileChange
+}
+
+// ShortHash returns the abbreviated commit hash
+func (c CommitChange) ShortHash() string {
+	if len(c.Hash) > 7 {
+		return c.Hash[:7]
+	}
+	return c.Hash
+}
+
+// Changelog lists what changed upstream since a dotfile was applied
+type Changelog struct {
+	From    string
+	To      string
+	Commits []CommitChange // newest first
+
+	// Truncated is set when history ran out (shallow clone) before
+	// reaching the applied commit, so older changes may be missing
+	Truncated bool
+}
+
+// UpToDate reports whether nothing relevant changed
+func (c *Changelog) UpToDate() bool {
+	return len(c.Commits) == 0 && !c.Truncated
+}
+
+// ChangesSince walks first-parent history from HEAD back to fromCommit and
+// returns the commits touching any of paths (repo-relative, files or dirs)
+// only reads local history, call DeepenSince first for shallow clones
+func ChangesSince(repoDir, fromCommit string, paths []string) (*Changelog, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get head: %w", err)
+	}
+
+	log := &Changelog{From: fromCommit, To: head.Hash().String()}
+	from := plumbing.NewHash(fromCommit)
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read head commit: %w", err)
+	}
+
+	for commit.Hash != from {
+		if commit.NumParents() == 0 {
+			// walked the whole history without meeting the applied commit
+			log.Truncated = true
+			break
+		}
+
+		parent, err := commit.Parent(0)
+		if err != nil {
+			// shallow boundary, the parent was never fetched
+			log.Truncated = true
+			break
+		}
+
+		files, err := changedFiles(parent, commit, paths)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't diff %s: %w", commit.Hash.String()[:7], err)
+		}
+
+		if len(files) > 0 {
+			log.Commits = append(log.Commits, CommitChange{
+				Hash:    commit.Hash.String(),
+				Author:  commit.Author.Name,
+				When:    commit.Author.When,
+				Message: firstLine(commit.Message),
+				Files:   files,
+			})
+		}
+
+		commit = parent
+	}
+
+	return log, nil
+}
+
+// changedFiles diffs a commit against its parent, limited to paths
+func changedFiles(parent, commit *object.Commit, paths []string) ([]FileChange, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileChange
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name // deletion
+		}
+		if !touchesPaths(name, paths) {
+			continue
+		}
+
+		fc := FileChange{Path: name}
+		// partial clones may lack old blobs, then we only know the file changed
+		if patch, err := change.Patch(); err == nil {
+			for _, stat := range patch.Stats() {
+				fc.Added += stat.Addition
+				fc.Deleted += stat.Deletion
+			}
+		}
+		files = append(files, fc)
+	}
+
+	return files, nil
+}
+
+// touchesPaths reports whether a file is one of paths or inside one of them
+func touchesPaths(name string, paths []string) bool {
+	for _, p := range paths {
+		p = strings.TrimSuffix(filepath.ToSlash(p), "/")
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// firstLine returns the subject line of a commit message
+func firstLine(message string) string {
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = message[:i]
+	}
+	return strings.TrimSpace(message)
+}
+
+// DeepenSince fetches enough history of a shallow clone to reach back to since
+// no-op for full clones or when the git cli isn't available
+func DeepenSince(ctx context.Context, repoDir string, since time.Time, opts GitOptions) error {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git", "shallow")); err != nil {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil
+	}
+
+	// a day of slack covers clock skew between us and the commit author
+	cutoff := since.Add(-24 * time.Hour).UTC().Format(time.RFC3339)
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	if err := runGit(ctx, repoDir, nil, creds, "fetch", "--shallow-since="+cutoff); err != nil {
+		return fmt.Errorf("couldn't fetch history: %w", err)
+	}
+	return nil
+}
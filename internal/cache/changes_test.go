@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestChangesSince(t *testing.T) {
+	dir := newTestRepo(t, map[string]string{
+		".config/nvim/init.lua": "vim.o.number = true\n",
+		".zshrc":                "export EDITOR=vim\n",
+	})
+
+	applied, err := GetLatestCommit(dir)
+	if err != nil {
+		t.Fatalf("GetLatestCommit: %v", err)
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("PlainOpen: %v", err)
+	}
+	commitFiles(t, repo, dir, map[string]string{".zshrc": "export EDITOR=nvim\n"}, "zsh: switch editor")
+	commitFiles(t, repo, dir, map[string]string{
+		".config/nvim/init.lua":        "vim.o.number = true\nvim.o.relativenumber = true\n",
+		".config/nvim/lua/plugins.lua": "return {}\n",
+	}, "nvim: relative numbers\n\nlonger body")
+
+	log, err := ChangesSince(dir, applied, []string{".config/nvim"})
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+
+	if log.Truncated {
+		t.Error("history is complete, expected Truncated to be false")
+	}
+	if len(log.Commits) != 1 {
+		t.Fatalf("expected 1 commit touching nvim, got %d", len(log.Commits))
+	}
+
+	c := log.Commits[0]
+	if c.Message != "nvim: relative numbers" {
+		t.Errorf("expected first line of message, got %q", c.Message)
+	}
+	if len(c.Files) != 2 {
+		t.Fatalf("expected 2 changed files, got %d", len(c.Files))
+	}
+	for _, f := range c.Files {
+		if f.Path == ".config/nvim/init.lua" && (f.Added != 1 || f.Deleted != 0) {
+			t.Errorf("init.lua: expected +1 -0, got +%d -%d", f.Added, f.Deleted)
+		}
+	}
+
+	// nothing changed after head
+	head, _ := GetLatestCommit(dir)
+	log, err = ChangesSince(dir, head, []string{".config/nvim"})
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if !log.UpToDate() {
+		t.Errorf("expected up to date, got %+v", log)
+	}
+}
+
+func TestChangesSinceUnknownCommitIsTruncated(t *testing.T) {
+	dir := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=vim\n"})
+
+	log, err := ChangesSince(dir, "0123456789abcdef0123456789abcdef01234567", []string{".zshrc"})
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if !log.Truncated {
+		t.Error("expected Truncated when the applied commit isn't in history")
+	}
+}
+
+func TestTouchesPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  bool
+	}{
+		{".zshrc", []string{".zshrc"}, true},
+		{".zshrc.local", []string{".zshrc"}, false},
+		{"nvim/init.lua", []string{"nvim/"}, true},
+		{"nvimrc", []string{"nvim"}, false},
+		{"tmux/tmux.conf", []string{"nvim", "tmux"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := touchesPaths(tt.name, tt.paths); got != tt.want {
+			t.Errorf("touchesPaths(%q, %v) = %v, want %v", tt.name, tt.paths, got, tt.want)
+		}
+	}
+}
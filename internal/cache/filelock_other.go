@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package cache
+
+import "os"
+
+// tryLockFile is a no-op where there's no file locking (e.g. wasm)
+// the in-process lock still applies
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op, see tryLockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
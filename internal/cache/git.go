@@ -3,9 +3,9 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -13,15 +13,42 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 )
 
+// GitOptions carries optional settings for clone and pull operations
+type GitOptions struct {
+	// Progress receives transfer updates, nil disables reporting
+	Progress ProgressFunc
+
+	// Sparse limits a fresh clone to paths matching these sparse-checkout
+	// patterns (see manifest.SparsePatterns), empty means a full clone
+	Sparse []string
+
+	// Auth supplies credentials for private repos, nil means anonymous
+	Auth Authenticator
+}
+
+// credentials resolves the auth for a remote url, nil when there's none
+func (o GitOptions) credentials(ctx context.Context, url string) (*Credentials, error) {
+	if o.Auth == nil {
+		return nil, nil
+	}
+	return o.Auth.Credentials(ctx, url)
+}
+
 // CloneRepo clones a git repository to the target directory
 // supports context cancellation for long-running operations
 func CloneRepo(ctx context.Context, url, targetDir string) error {
+	return CloneRepoWithOptions(ctx, url, targetDir, GitOptions{})
+}
+
+// CloneRepoWithOptions clones a git repository with progress reporting
+// a cancelled or failed clone never leaves a half-finished directory behind
+func CloneRepoWithOptions(ctx context.Context, url, targetDir string, opts GitOptions) error {
 	// check if the directory already exists and is a valid git repo
 	if _, err := os.Stat(targetDir); err == nil {
 		// Check if it's actually a git repo (not just an empty directory)
 		if RepoExists(targetDir) {
 			// repo already exists, try to pull instead
-			return PullRepo(ctx, targetDir)
+			return PullRepoWithOptions(ctx, targetDir, opts)
 		}
 		// Directory exists but is not a git repo - remove it and re-clone
 		if err := os.RemoveAll(targetDir); err != nil {
@@ -29,14 +56,25 @@ func CloneRepo(ctx context.Context, url, targetDir string) error {
 		}
 	}
 
+	creds, err := opts.credentials(ctx, url)
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
 	// clone the repo
-	_, err := git.PlainCloneContext(ctx, targetDir, false, &git.CloneOptions{
+	_, err = git.PlainCloneContext(ctx, targetDir, false, &git.CloneOptions{
 		URL:      url,
-		Progress: nil, // we'll add progress later
-		Depth:    1,   // shallow clone for speed
+		Auth:     creds.method(),
+		Progress: newProgressWriter(opts.Progress),
+		Depth:    1, // shallow clone for speed
 	})
 
 	if err != nil {
+		// don't leave a partial checkout around, the next run would treat it as cached
+		_ = os.RemoveAll(targetDir)
+		if ctx.Err() != nil {
+			return fmt.Errorf("clone cancelled: %w", ctx.Err())
+		}
 		return fmt.Errorf("couldn't clone repo: %w", err)
 	}
 
@@ -46,6 +84,16 @@ func CloneRepo(ctx context.Context, url, targetDir string) error {
 // PullRepo updates an existing git repository
 // pulls latest changes from the default remote
 func PullRepo(ctx context.Context, repoDir string) error {
+	return PullRepoWithOptions(ctx, repoDir, GitOptions{})
+}
+
+// PullRepoWithOptions updates an existing git repository with progress reporting
+func PullRepoWithOptions(ctx context.Context, repoDir string, opts GitOptions) error {
+	// partial clones are missing blobs go-git would need, let the git cli handle them
+	if IsSparse(repoDir) {
+		return pullSparse(ctx, repoDir, opts)
+	}
+
 	// open the existing repo
 	repo, err := git.PlainOpen(repoDir)
 	if err != nil {
@@ -58,9 +106,16 @@ func PullRepo(ctx context.Context, repoDir string) error {
 		return fmt.Errorf("couldn't get worktree: %w", err)
 	}
 
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
 	// pull latest changes
 	err = worktree.PullContext(ctx, &git.PullOptions{
 		RemoteName: "origin",
+		Auth:       creds.method(),
+		Progress:   newProgressWriter(opts.Progress),
 	})
 
 	// if already up to date, that's fine
@@ -68,6 +123,11 @@ func PullRepo(ctx context.Context, repoDir string) error {
 		return nil
 	}
 
+	// a force-push upstream or a commit made in the cache
+	if errors.Is(err, git.ErrNonFastForwardUpdate) {
+		return fmt.Errorf("couldn't pull updates: %w", ErrDiverged)
+	}
+
 	if err != nil {
 		return fmt.Errorf("couldn't pull updates: %w", err)
 	}
@@ -75,6 +135,19 @@ func PullRepo(ctx context.Context, repoDir string) error {
 	return nil
 }
 
+// OriginURL returns the url of a repo's origin remote, empty if unknown
+func OriginURL(repoDir string) string {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return ""
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
 // GetLatestCommit returns the hash of the latest commit
 // useful for checking if repo has been updated
 func GetLatestCommit(repoDir string) (string, error) {
@@ -134,44 +207,6 @@ func HasSubmodules(repoDir string) (bool, error) {
 	return true, nil
 }
 
-// InitSubmodules initializes git submodules in a repository
-// Note: go-git has limited submodule support, so we fall back to git CLI
-func InitSubmodules(ctx context.Context, repoDir string) error {
-	// Try using git CLI directly for better submodule support
-	// This handles SSH keys, HTTPS auth, and recursive submodules better
-
-	// First check if git is available
-	if _, err := exec.LookPath("git"); err != nil {
-		return fmt.Errorf("git command not found (needed for submodule support)")
-	}
-
-	// Run: git submodule update --init --recursive
-	cmd := exec.CommandContext(ctx, "git", "submodule", "update", "--init", "--recursive")
-	cmd.Dir = repoDir
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		outputStr := string(output)
-
-		// Check for specific error types
-		if strings.Contains(outputStr, "Repository not found") {
-			return fmt.Errorf("some submodules are private or don't exist - this is normal, skip and continue\n\nDetails: %s", outputStr)
-		}
-
-		if strings.Contains(outputStr, "ssh:") || strings.Contains(outputStr, "Permission denied") {
-			return fmt.Errorf("submodule uses SSH authentication - please set up SSH keys or skip submodules\n%s", outputStr)
-		}
-
-		if strings.Contains(outputStr, "correct access rights") {
-			return fmt.Errorf("submodule requires authentication - skip this step to continue\n\nDetails: %s", outputStr)
-		}
-
-		return fmt.Errorf("couldn't initialize submodules: %w\n%s", err, output)
-	}
-
-	return nil
-}
-
 // CountSubmodules returns the number of submodules in a repo
 func CountSubmodules(repoDir string) (int, error) {
 	gitmodulesPath := filepath.Join(repoDir, ".gitmodules")
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRepo creates a local git repo with one commit containing files
+// it stands in for a creator's remote so tests never touch the network
+func newTestRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	commitFiles(t, repo, dir, files, "initial commit")
+	return dir
+}
+
+// commitFiles writes files into the worktree and commits them
+func commitFiles(t *testing.T, repo *git.Repository, dir string, files map[string]string, message string) {
+	t.Helper()
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatalf("Add %s: %v", name, err)
+		}
+	}
+
+	_, err = wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+func TestCloneRepoWithOptions(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".tmux.conf": "set -g mouse on\n"})
+	target := filepath.Join(t.TempDir(), "creator")
+
+	err := CloneRepoWithOptions(context.Background(), remote, target, GitOptions{
+		Progress: func(Progress) {},
+	})
+	if err != nil {
+		t.Fatalf("CloneRepoWithOptions failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(target, ".tmux.conf")); err != nil {
+		t.Errorf("expected cloned file to exist: %v", err)
+	}
+}
+
+func TestCloneRepoCancelledLeavesNoDirectory(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	target := filepath.Join(t.TempDir(), "creator")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := CloneRepoWithOptions(ctx, remote, target, GitOptions{}); err == nil {
+		t.Fatal("expected an error for a cancelled clone")
+	}
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected partial clone to be removed, stat err = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// package cache serialises work on a creator's repo across goroutines and processes
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// lockRetryInterval is how often a busy file lock is retried
+const lockRetryInterval = 50 * time.Millisecond
+
+// creatorMutex returns the in-process lock for one creator
+func (m *Manager) creatorMutex(creatorID string) *sync.Mutex {
+	m.locksMu.Lock()
+	defer m.locksMu.Unlock()
+
+	if m.locks == nil {
+		m.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := m.locks[creatorID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[creatorID] = lock
+	}
+	return lock
+}
+
+// lockCreator takes the in-process and cross-process locks for a creator's
+// repo, so two dotpicker instances never clone into the same directory
+// waits until the lock is free or ctx is done, call the returned func to release
+func (m *Manager) lockCreator(ctx context.Context, creatorID string) (func(), error) {
+	mu := m.creatorMutex(creatorID)
+
+	// sync.Mutex can't be cancelled, so take it in the background
+	acquired := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-ctx.Done():
+		// release it once the background Lock finally succeeds
+		go func() {
+			<-acquired
+			mu.Unlock()
+		}()
+		return nil, ctx.Err()
+	}
+
+	file, err := m.lockFile(ctx, creatorID)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+		mu.Unlock()
+	}, nil
+}
+
+// lockFile opens and locks the creator's lock file under cacheDir/.locks
+func (m *Manager) lockFile(ctx context.Context, creatorID string) (*os.File, error) {
+	dir := filepath.Join(m.cacheDir, ".locks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create lock directory: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, creatorID+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open lock file: %w", err)
+	}
+
+	for {
+		ok, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("couldn't lock %s: %w", creatorID, err)
+		}
+		if ok {
+			return file, nil
+		}
+
+		// another dotpicker is working on this repo, wait for it
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
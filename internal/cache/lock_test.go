@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestLockIsPerCreator(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	m := NewManager(t.TempDir())
+
+	unlock, err := m.lockCreator(context.Background(), "busy")
+	if err != nil {
+		t.Fatalf("lockCreator: %v", err)
+	}
+	defer unlock()
+
+	// another creator and path lookups don't wait for the busy one
+	done := make(chan error, 1)
+	go func() {
+		_ = m.GetRepoPath("busy")
+		done <- m.EnsureRepo(context.Background(), &manifest.Creator{ID: "free", Name: "Free", Repo: "file://" + remote})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("EnsureRepo for another creator failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("EnsureRepo for another creator blocked behind a locked one")
+	}
+
+	// the busy creator itself waits until ctx gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = m.EnsureRepo(ctx, &manifest.Creator{ID: "busy", Name: "Busy", Repo: "file://" + remote})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the locked creator to time out, got %v", err)
+	}
+}
+
+func TestFileLockAcrossManagers(t *testing.T) {
+	cacheDir := t.TempDir()
+	first := NewManager(cacheDir)
+	second := NewManager(cacheDir) // stands in for a second dotpicker process
+
+	unlock, err := first.lockCreator(context.Background(), "shared")
+	if err != nil {
+		t.Fatalf("lockCreator: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := second.lockCreator(ctx, "shared"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the file lock to be held, got %v", err)
+	}
+
+	unlock()
+	unlockSecond, err := second.lockCreator(context.Background(), "shared")
+	if err != nil {
+		t.Fatalf("lock wasn't released: %v", err)
+	}
+	unlockSecond()
+}
+
+func TestEnsureReposAggregatesErrors(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	missing := filepath.Join(t.TempDir(), "missing")
+	m := NewManager(t.TempDir())
+
+	creators := []manifest.Creator{
+		{ID: "good", Name: "Good", Repo: "file://" + remote},
+		{ID: "bad-one", Name: "Bad One", Repo: "file://" + missing},
+		{ID: "bad-two", Name: "Bad Two", Repo: "file://" + missing + "-too"},
+	}
+
+	finished := make(chan string, len(creators))
+	err := m.EnsureReposWithOptions(context.Background(), creators, GitOptions{},
+		func(c *manifest.Creator, _ *SyncResult, _ error) { finished <- c.ID })
+
+	var errs EnsureErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected EnsureErrors, got %T: %v", err, err)
+	}
+	if len(errs) != 2 || errs["bad-one"] == nil || errs["bad-two"] == nil {
+		t.Errorf("expected both bad creators in the errors, got %v", errs)
+	}
+	if !strings.Contains(err.Error(), "bad-one") || !strings.Contains(err.Error(), "bad-two") {
+		t.Errorf("expected every failure in the message, got %q", err.Error())
+	}
+	if !m.IsRepoCached("good") {
+		t.Error("one failure shouldn't stop the others")
+	}
+	if len(finished) != len(creators) {
+		t.Errorf("expected a callback per creator, got %d", len(finished))
+	}
+}
@@ -3,69 +3,344 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/milxzy/dotfile-picker/internal/fsutil"
 	"github.com/milxzy/dotfile-picker/internal/manifest"
 )
 
+// ErrLinked is returned for repos that targets in the home directory still
+// link into (stow_link), removing or resetting them would break those
+var ErrLinked = errors.New("still linked from your home directory")
+
+// LinkedFunc lists the targets earlier applies linked into a creator's
+// repo, the history keeps them
+type LinkedFunc func(creatorID string) []string
+
 // Manager handles caching and syncing of dotfile repos
+// work on different creators runs in parallel, work on the same creator is
+// serialised, also across processes sharing the cache directory
 type Manager struct {
 	cacheDir string
-	mu       sync.RWMutex
+
+	// mu only guards the settings below, never held during git work
+	mu     sync.RWMutex
+	policy RefreshPolicy
+	auth   Authenticator
+	linked LinkedFunc
+
+	// per-creator locks, see lockCreator
+	locksMu sync.Mutex
+	locks   map[string]*sync.Mutex
 }
 
 // NewManager creates a cache manager
 // cacheDir is where all repos will be stored
+// repos are pulled every time they're used until SetRefreshPolicy says otherwise
 func NewManager(cacheDir string) *Manager {
 	return &Manager{
 		cacheDir: cacheDir,
+		policy:   RefreshPolicy{Mode: RefreshAlways},
 	}
 }
 
-// EnsureRepo makes sure a creator's repo is downloaded and up to date
-// clones if missing, pulls if stale
-func (m *Manager) EnsureRepo(ctx context.Context, creator *manifest.Creator) error {
+// SetRefreshPolicy changes when existing repos are pulled again
+func (m *Manager) SetRefreshPolicy(policy RefreshPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+}
+
+// SetAuthenticator sets the credentials used for private repos
+func (m *Manager) SetAuthenticator(auth Authenticator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auth = auth
+}
+
+// SetLinked tells the manager which targets link into each repo; repos
+// with live links are never removed, and edits in them never reset
+func (m *Manager) SetLinked(linked LinkedFunc) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.linked = linked
+}
+
+// LiveLinks returns the linked targets that still point into a creator's
+// repo, or hold links into it after being unfolded
+func (m *Manager) LiveLinks(creatorID string) []string {
+	m.mu.RLock()
+	linked := m.linked
+	m.mu.RUnlock()
+	if linked == nil {
+		return nil
+	}
+
+	// a local source used in place is a link itself
+	repoPath, err := filepath.EvalSymlinks(m.getRepoPath(creatorID))
+	if err != nil {
+		return nil
+	}
+	var live []string
+	for _, target := range linked(creatorID) {
+		if linksInto(target, repoPath) {
+			live = append(live, target)
+		}
+	}
+	return live
+}
+
+// linksInto reports whether target is a symlink into dir or a directory
+// with one inside
+func linksInto(target, dir string) bool {
+	found := false
+	_ = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if dest, err := filepath.EvalSymlinks(path); err == nil && fsutil.InsideDir(dir, dest) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// linkedError describes the live links that keep a repo in place
+func linkedError(creatorID string, live []string) error {
+	more := ""
+	if len(live) > 1 {
+		more = fmt.Sprintf(" and %d more", len(live)-1)
+	}
+	return fmt.Errorf("%s is %w (%s%s), apply it again as a copy first", creatorID, ErrLinked, live[0], more)
+}
+
+// GitOptions returns options carrying the manager's credentials, for git
+// operations on cached repos outside EnsureRepo
+func (m *Manager) GitOptions() GitOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return GitOptions{Auth: m.auth}
+}
+
+// EnsureRepo makes sure a creator's repo is downloaded and up to date
+// clones if missing, pulls if the refresh policy says it's stale
+func (m *Manager) EnsureRepo(ctx context.Context, creator *manifest.Creator) error {
+	_, err := m.EnsureRepoWithOptions(ctx, creator, GitOptions{})
+	return err
+}
+
+// EnsureRepoWithOptions is EnsureRepo with progress reporting and sparse clones
+// cancelling ctx aborts the clone and removes the partial checkout
+// the returned SyncResult says whether we're working from a stale copy
+func (m *Manager) EnsureRepoWithOptions(ctx context.Context, creator *manifest.Creator, opts GitOptions) (*SyncResult, error) {
+	m.mu.RLock()
+	policy := m.policy
+	if opts.Auth == nil {
+		opts.Auth = m.auth
+	}
+	m.mu.RUnlock()
+
+	unlock, err := m.lockCreator(ctx, creator.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't lock %s's repo: %w", creator.Name, err)
+	}
+	defer unlock()
+
+	source, err := NewSource(creator)
+	if err != nil {
+		return nil, err
+	}
+	if source.Kind() != manifest.SourceGit {
+		// only git can fetch part of a repo
+		opts.Sparse = nil
+	}
 
 	repoPath := m.getRepoPath(creator.ID)
+	isGit := source.Kind() == manifest.SourceGit
+
+	// a clone that never finished is cloned again next to it and swapped in
+	if isGit && !m.isCached(creator.ID) && hasGitDir(repoPath) {
+		repair := RepairRepo(ctx, repoPath, creator.Repo, []RepoProblem{ProblemBroken}, opts)
+		if repair.Err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("couldn't download %s's dotfiles: %w", creator.Name, repair.Err)
+		}
+		m.recordFetch(creator.ID, nil)
+		return &SyncResult{Action: SyncCloned, Repair: repair}, nil
+	}
 
 	// check if repo exists
-	if !RepoExists(repoPath) {
-		// clone it
-		if err := CloneRepo(ctx, creator.Repo, repoPath); err != nil {
-			return fmt.Errorf("couldn't download %s's dotfiles: %w", creator.Name, err)
+	if !m.isCached(creator.ID) {
+		// a leftover non-repo directory (e.g. from an interrupted clone) is in the way
+		if err := os.RemoveAll(repoPath); err != nil {
+			return nil, fmt.Errorf("couldn't remove leftover directory: %w", err)
 		}
-		return nil
+		// clone it, only fetching the requested paths when we know them
+		if err := source.Fetch(ctx, repoPath, opts); err != nil {
+			return nil, fmt.Errorf("couldn't download %s's dotfiles: %w", creator.Name, err)
+		}
+		m.recordFetch(creator.ID, nil)
+		return &SyncResult{Action: SyncCloned}, nil
+	}
+
+	// local edits or a detached HEAD would make the pull fail, fix them first
+	var repair *RepairReport
+	if isGit {
+		if problems := DiagnoseRepo(repoPath); len(problems) > 0 {
+			if slices.Contains(problems, ProblemDirty) && len(m.LiveLinks(creator.ID)) > 0 {
+				// edits made through the links land here, a reset would lose them
+				lastFetch := m.lastFetch(creator.ID, m.loadState(creator.ID))
+				repair = &RepairReport{Problems: problems, Action: RepairKept}
+				return &SyncResult{Action: SyncCached, Age: time.Since(lastFetch), Repair: repair}, nil
+			}
+			repair = RepairRepo(ctx, repoPath, creator.Repo, problems, opts)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if repair.Err == nil && repair.Action != RepairReset {
+				// went to the remote anyway, that counts as a fetch
+				m.recordFetch(creator.ID, nil)
+				return &SyncResult{Action: repairSyncAction(repair), Repair: repair}, nil
+			}
+			if repair.Err != nil && slices.Contains(problems, ProblemBroken) {
+				// nothing usable left to fall back to
+				return nil, fmt.Errorf("couldn't repair %s's repo: %w", creator.Name, repair.Err)
+			}
+		}
+	}
+
+	state := m.loadState(creator.ID)
+	lastFetch := m.lastFetch(creator.ID, state)
+
+	// a sparse checkout from an earlier dotfile may not cover this one yet
+	// not fatal: detection falls back to the full tree if it's still missing
+	if len(opts.Sparse) > 0 {
+		if err := AddSparsePatterns(ctx, repoPath, opts.Sparse, opts); err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	if !policy.ShouldRefresh(lastFetch) {
+		return &SyncResult{Action: SyncCached, Age: time.Since(lastFetch), Repair: repair}, nil
 	}
 
-	// repo exists, check if we should update it
-	// for now, just try to pull
-	if err := PullRepo(ctx, repoPath); err != nil {
+	err = source.Update(ctx, repoPath, opts)
+	if errors.Is(err, ErrDiverged) && ctx.Err() == nil {
+		// upstream was force-pushed, our commits are the wrong ones
+		repair = RepairRepo(ctx, repoPath, creator.Repo, []RepoProblem{ProblemDiverged}, opts)
+		if repair.Err == nil {
+			m.recordFetch(creator.ID, nil)
+			return &SyncResult{Action: repairSyncAction(repair), Repair: repair}, nil
+		}
+	}
+	if err != nil {
+		// a cancelled pull should stop the workflow, not fall through
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		// not critical if pull fails - we have the cached version
-		// just continue with what we have
-		return nil
+		// remember the failure so the ui can tell the user
+		m.recordFetch(creator.ID, err)
+		return &SyncResult{Action: SyncCached, Age: time.Since(lastFetch), PullErr: err, Repair: repair}, nil
 	}
 
-	return nil
+	m.recordFetch(creator.ID, nil)
+	return &SyncResult{Action: SyncPulled, Repair: repair}, nil
+}
+
+// repairSyncAction maps a successful repair that went to the remote onto
+// what EnsureRepo reports
+func repairSyncAction(repair *RepairReport) SyncAction {
+	if repair.Action == RepairReclone {
+		return SyncCloned
+	}
+	return SyncPulled
+}
+
+// hasGitDir reports whether dir has a .git, usable or not
+func hasGitDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// isCached reports whether a creator's files are in the cache
+// git repos must open cleanly, other sources just need a non-empty directory
+func (m *Manager) isCached(creatorID string) bool {
+	repoPath := m.getRepoPath(creatorID)
+	if RepoExists(repoPath) {
+		return true
+	}
+	if hasGitDir(repoPath) {
+		// a broken git checkout doesn't count
+		return false
+	}
+	empty, err := IsEmptyDirectory(repoPath)
+	return err == nil && !empty
+}
+
+// recordFetch updates a repo's state after a fetch attempt
+// a failed attempt keeps the previous LastFetch so the age stays honest
+func (m *Manager) recordFetch(creatorID string, fetchErr error) {
+	state := m.loadState(creatorID)
+	if fetchErr != nil {
+		state.LastError = fetchErr.Error()
+	} else {
+		state.LastFetch = time.Now()
+		state.LastError = ""
+	}
+	// state is advisory, a write failure just means we pull again next time
+	_ = m.saveState(creatorID, state)
+}
+
+// lastFetch returns when a repo was last fetched
+// repos cached before we tracked state fall back to the .git mtime
+func (m *Manager) lastFetch(creatorID string, state RepoState) time.Time {
+	if !state.LastFetch.IsZero() {
+		return state.LastFetch
+	}
+	info, err := os.Stat(filepath.Join(m.getRepoPath(creatorID), ".git"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
 // EnsureRepos downloads multiple repos concurrently
 // uses a worker pool to limit concurrent git operations
+// failures are returned together as EnsureErrors, keyed by creator
 func (m *Manager) EnsureRepos(ctx context.Context, creators []manifest.Creator) error {
+	return m.EnsureReposWithOptions(ctx, creators, GitOptions{}, nil)
+}
+
+// EnsureReposWithOptions is EnsureRepos with git options and a callback that
+// runs as each creator finishes (from worker goroutines, keep it quick)
+// opts.Progress is ignored, updates from parallel clones would interleave
+func (m *Manager) EnsureReposWithOptions(ctx context.Context, creators []manifest.Creator, opts GitOptions,
+	done func(creator *manifest.Creator, result *SyncResult, err error)) error {
+	opts.Progress = nil
+
 	// use a worker pool to limit concurrency
-	maxWorkers := 5
-	sem := make(chan struct{}, maxWorkers)
-	errChan := make(chan error, len(creators))
+	sem := make(chan struct{}, maxParallelFetches)
 	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	errs := make(EnsureErrors)
 
-	for _, creator := range creators {
+	for i := range creators {
 		wg.Add(1)
-		go func(c manifest.Creator) {
+		go func(c *manifest.Creator) {
 			defer wg.Done()
 
 			// acquire semaphore
@@ -73,92 +348,124 @@ func (m *Manager) EnsureRepos(ctx context.Context, creators []manifest.Creator)
 			defer func() { <-sem }()
 
 			// download the repo
-			if err := m.EnsureRepo(ctx, &c); err != nil {
-				errChan <- err
+			result, err := m.EnsureRepoWithOptions(ctx, c, opts)
+			if err != nil {
+				errsMu.Lock()
+				errs[c.ID] = err
+				errsMu.Unlock()
 			}
-		}(creator)
+			if done != nil {
+				done(c, result, err)
+			}
+		}(&creators[i])
 	}
 
 	// wait for all downloads to complete
 	wg.Wait()
-	close(errChan)
 
-	// check if any errors occurred
-	var errs []error
-	for err := range errChan {
-		errs = append(errs, err)
+	if len(errs) > 0 {
+		return errs
 	}
+	return nil
+}
 
-	if len(errs) > 0 {
-		// return the first error for now
-		// (we could combine them later)
-		return errs[0]
+// maxParallelFetches caps how many repos EnsureRepos fetches at once
+const maxParallelFetches = 5
+
+// EnsureErrors maps creator ids to the error their fetch failed with
+type EnsureErrors map[string]error
+
+// Error lists every failed creator, sorted for stable output
+func (e EnsureErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
 	}
+	sort.Strings(ids)
 
-	return nil
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		lines = append(lines, fmt.Sprintf("%s: %v", id, e[id]))
+	}
+	return fmt.Sprintf("%d repo(s) failed:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As
+func (e EnsureErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
 }
 
 // GetRepoPath returns the local path to a creator's repo
+// never blocks, even while that repo is being cloned
 func (m *Manager) GetRepoPath(creatorID string) string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
 	return m.getRepoPath(creatorID)
 }
 
-// getRepoPath is the internal version without locking
+// getRepoPath builds the path, cacheDir never changes so no locking needed
 func (m *Manager) getRepoPath(creatorID string) string {
 	return filepath.Join(m.cacheDir, creatorID)
 }
 
 // IsRepoCached checks if a creator's repo exists locally
 func (m *Manager) IsRepoCached(creatorID string) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	repoPath := m.getRepoPath(creatorID)
-	return RepoExists(repoPath)
+	return m.isCached(creatorID)
 }
 
-// GetRepoAge returns how long ago the repo was last updated
+// GetRepoAge returns how long ago the repo was last fetched
 func (m *Manager) GetRepoAge(creatorID string) (time.Duration, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	repoPath := m.getRepoPath(creatorID)
+	if !m.isCached(creatorID) {
+		return 0, fmt.Errorf("couldn't stat repo: %s is not cached", creatorID)
+	}
 
-	// check the .git directory's modification time
-	gitDir := filepath.Join(repoPath, ".git")
-	info, err := os.Stat(gitDir)
-	if err != nil {
-		return 0, fmt.Errorf("couldn't stat repo: %w", err)
+	lastFetch := m.lastFetch(creatorID, m.loadState(creatorID))
+	if lastFetch.IsZero() {
+		return 0, fmt.Errorf("couldn't determine when %s was fetched", creatorID)
 	}
 
-	return time.Since(info.ModTime()), nil
+	return time.Since(lastFetch), nil
 }
 
 // ClearCache removes all cached repos
 // useful for testing or forcing a fresh download
 func (m *Manager) ClearCache() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	ids, err := m.ListCachedCreators()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if live := m.LiveLinks(id); len(live) > 0 {
+			return linkedError(id, live)
+		}
+	}
 	return os.RemoveAll(m.cacheDir)
 }
 
 // ClearCreatorCache removes a specific creator's cached repo
 func (m *Manager) ClearCreatorCache(creatorID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	// wait for any clone or pull of this repo to finish first
+	unlock, err := m.lockCreator(context.Background(), creatorID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if live := m.LiveLinks(creatorID); len(live) > 0 {
+		return linkedError(creatorID, live)
+	}
 
 	repoPath := m.getRepoPath(creatorID)
-	return os.RemoveAll(repoPath)
+	if err := os.RemoveAll(repoPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(m.statePath(creatorID))
 }
 
 // ListCachedCreators returns a list of all cached creator IDs
 func (m *Manager) ListCachedCreators() ([]string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	entries, err := os.ReadDir(m.cacheDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -169,7 +476,8 @@ func (m *Manager) ListCachedCreators() ([]string, error) {
 
 	var creators []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// hidden dirs hold our own bookkeeping, not repos
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			creators = append(creators, entry.Name())
 		}
 	}
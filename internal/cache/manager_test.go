@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestRefreshPolicyShouldRefresh(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		policy    RefreshPolicy
+		lastFetch time.Time
+		expected  bool
+	}{
+		{"always", RefreshPolicy{Mode: RefreshAlways}, time.Now(), true},
+		{"never", RefreshPolicy{Mode: RefreshNever}, time.Time{}, false},
+		{"stale and old", RefreshPolicy{Mode: RefreshStale, MaxAge: time.Minute}, hourAgo, true},
+		{"stale but fresh", RefreshPolicy{Mode: RefreshStale, MaxAge: 2 * time.Hour}, hourAgo, false},
+		{"stale and unknown", RefreshPolicy{Mode: RefreshStale, MaxAge: time.Hour}, time.Time{}, true},
+		{"unknown mode", RefreshPolicy{Mode: "sometimes"}, time.Now(), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.ShouldRefresh(tt.lastFetch); got != tt.expected {
+			t.Errorf("%s: ShouldRefresh = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		10 * time.Second: "just now",
+		time.Minute:      "1 minute ago",
+		5 * time.Hour:    "5 hours ago",
+		72 * time.Hour:   "3 days ago",
+	}
+	for d, expected := range tests {
+		if got := FormatAge(d); got != expected {
+			t.Errorf("FormatAge(%v) = %q, want %q", d, got, expected)
+		}
+	}
+}
+
+func TestEnsureRepoRespectsRefreshPolicy(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".tmux.conf": "set -g mouse on\n"})
+	m := NewManager(t.TempDir())
+	m.SetRefreshPolicy(RefreshPolicy{Mode: RefreshStale, MaxAge: time.Hour})
+	creator := &manifest.Creator{ID: "tester", Name: "Tester", Repo: "file://" + remote}
+	ctx := context.Background()
+
+	result, err := m.EnsureRepoWithOptions(ctx, creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("first EnsureRepo failed: %v", err)
+	}
+	if result.Action != SyncCloned {
+		t.Errorf("expected SyncCloned, got %v", result.Action)
+	}
+
+	// fresh enough, so no pull even though the remote is gone
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	result, err = m.EnsureRepoWithOptions(ctx, creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("second EnsureRepo failed: %v", err)
+	}
+	if result.Action != SyncCached || result.PullErr != nil {
+		t.Errorf("expected cached copy without a pull, got %+v", result)
+	}
+
+	if age, err := m.GetRepoAge(creator.ID); err != nil || age > time.Minute {
+		t.Errorf("expected recorded fetch time, got age %v err %v", age, err)
+	}
+
+	// always pulling against a missing remote falls back to the cache with the error
+	m.SetRefreshPolicy(RefreshPolicy{Mode: RefreshAlways})
+	result, err = m.EnsureRepoWithOptions(ctx, creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("third EnsureRepo failed: %v", err)
+	}
+	if result.PullErr == nil {
+		t.Fatal("expected a pull error against the missing remote")
+	}
+	if !strings.Contains(result.Summary(), "pull failed") {
+		t.Errorf("expected summary to mention the failed pull, got %q", result.Summary())
+	}
+	if state := m.loadState(creator.ID); state.LastError == "" {
+		t.Error("expected the pull failure to be recorded")
+	}
+}
+
+func TestListCachedCreatorsSkipsState(t *testing.T) {
+	cacheDir := t.TempDir()
+	m := NewManager(cacheDir)
+
+	if err := os.MkdirAll(filepath.Join(cacheDir, "creator"), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := m.saveState("creator", RepoState{LastFetch: time.Now()}); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+
+	creators, err := m.ListCachedCreators()
+	if err != nil {
+		t.Fatalf("ListCachedCreators: %v", err)
+	}
+	if len(creators) != 1 || creators[0] != "creator" {
+		t.Errorf("expected only [creator], got %v", creators)
+	}
+}
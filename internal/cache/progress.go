@@ -0,0 +1,116 @@
+// package cache turns git transfer output into progress updates
+package cache
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Progress is a single transfer update from a clone or pull
+// stages mirror what git prints, like "Counting objects" or "Resolving deltas"
+type Progress struct {
+	Stage   string
+	Current int
+	Total   int
+	Done    bool
+}
+
+// Percent returns how far along the current stage is (0-100)
+// stages without a known total report 0
+func (p Progress) Percent() int {
+	if p.Total <= 0 {
+		return 0
+	}
+	if p.Current >= p.Total {
+		return 100
+	}
+	return p.Current * 100 / p.Total
+}
+
+// ProgressFunc receives progress updates while git is transferring
+// it's called from the clone goroutine so it shouldn't block for long
+type ProgressFunc func(Progress)
+
+var (
+	// matches "Receiving objects:  45% (450/1000), 1.2 MiB | 600 KiB/s"
+	progressPercentRe = regexp.MustCompile(`^([A-Za-z ]+):\s+\d+% \((\d+)/(\d+)\)`)
+
+	// matches "Enumerating objects: 1234, done."
+	progressCountRe = regexp.MustCompile(`^([A-Za-z ]+):\s+(\d+)`)
+)
+
+// progressWriter is an io.Writer that parses git sideband output
+// git separates updates with \r (same line) or \n (new stage)
+type progressWriter struct {
+	fn  ProgressFunc
+	mu  sync.Mutex
+	buf []byte
+}
+
+// newProgressWriter wraps a ProgressFunc, returns a nil writer if fn is nil
+// so callers can hand the result straight to go-git
+func newProgressWriter(fn ProgressFunc) io.Writer {
+	if fn == nil {
+		return nil
+	}
+	return &progressWriter{fn: fn}
+}
+
+// Write buffers partial lines and emits an update for every complete one
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexAny(w.buf, "\r\n")
+		if idx < 0 {
+			break
+		}
+		line := string(w.buf[:idx])
+		w.buf = w.buf[idx+1:]
+
+		if update, ok := parseProgressLine(line); ok {
+			w.fn(update)
+		}
+	}
+
+	return len(p), nil
+}
+
+// parseProgressLine converts one line of git progress output
+// lines that aren't progress (warnings, hints) are ignored
+func parseProgressLine(line string) (Progress, bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "remote:"))
+	if line == "" {
+		return Progress{}, false
+	}
+
+	done := strings.HasSuffix(line, "done.") || strings.Contains(line, ", done")
+
+	if m := progressPercentRe.FindStringSubmatch(line); m != nil {
+		current, _ := strconv.Atoi(m[2])
+		total, _ := strconv.Atoi(m[3])
+		return Progress{
+			Stage:   strings.TrimSpace(m[1]),
+			Current: current,
+			Total:   total,
+			Done:    done,
+		}, true
+	}
+
+	if m := progressCountRe.FindStringSubmatch(line); m != nil {
+		current, _ := strconv.Atoi(m[2])
+		return Progress{
+			Stage:   strings.TrimSpace(m[1]),
+			Current: current,
+			Done:    done,
+		}, true
+	}
+
+	return Progress{}, false
+}
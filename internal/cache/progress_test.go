@@ -0,0 +1,92 @@
+package cache
+
+import "testing"
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Progress
+		ok       bool
+	}{
+		{
+			line:     "Counting objects:  45% (450/1000)",
+			expected: Progress{Stage: "Counting objects", Current: 450, Total: 1000},
+			ok:       true,
+		},
+		{
+			line:     "Receiving objects: 100% (1000/1000), 1.20 MiB | 2.00 MiB/s, done.",
+			expected: Progress{Stage: "Receiving objects", Current: 1000, Total: 1000, Done: true},
+			ok:       true,
+		},
+		{
+			line:     "remote: Enumerating objects: 1234, done.",
+			expected: Progress{Stage: "Enumerating objects", Current: 1234, Done: true},
+			ok:       true,
+		},
+		{
+			line: "warning: redirecting to https://github.com/user/repo.git/",
+			ok:   false,
+		},
+		{
+			line: "",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseProgressLine(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseProgressLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if ok && got != tt.expected {
+			t.Errorf("parseProgressLine(%q) = %+v, want %+v", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestProgressWriterSplitsUpdates(t *testing.T) {
+	var updates []Progress
+	w := newProgressWriter(func(p Progress) {
+		updates = append(updates, p)
+	})
+
+	// git rewrites the same line with \r and only ends a stage with \n,
+	// and the sideband can split a line across writes
+	chunks := []string{
+		"Counting objects:  10% (1/10)\rCounting obj",
+		"ects:  50% (5/10)\rCounting objects: 100% (10/10), done.\n",
+		"Compressing objects:  50% (2/4)",
+	}
+	for _, c := range chunks {
+		if _, err := w.Write([]byte(c)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	if len(updates) != 3 {
+		t.Fatalf("expected 3 updates (last line is still buffered), got %d: %+v", len(updates), updates)
+	}
+	if updates[1].Current != 5 || updates[1].Percent() != 50 {
+		t.Errorf("expected second update at 5/10, got %+v", updates[1])
+	}
+	if !updates[2].Done {
+		t.Errorf("expected final counting update to be done, got %+v", updates[2])
+	}
+}
+
+func TestNewProgressWriterNil(t *testing.T) {
+	// a nil func must produce a nil interface so go-git skips progress entirely
+	if w := newProgressWriter(nil); w != nil {
+		t.Errorf("expected nil writer, got %#v", w)
+	}
+}
+
+func TestProgressPercent(t *testing.T) {
+	if p := (Progress{Current: 5}); p.Percent() != 0 {
+		t.Errorf("expected 0%% without a total, got %d", p.Percent())
+	}
+	if p := (Progress{Current: 12, Total: 10}); p.Percent() != 100 {
+		t.Errorf("expected percent to cap at 100, got %d", p.Percent())
+	}
+}
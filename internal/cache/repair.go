@@ -0,0 +1,351 @@
+// package cache spots broken cached checkouts and repairs them
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// RepoProblem is something wrong with a cached checkout that breaks pulls
+type RepoProblem string
+
+const (
+	// ProblemBroken means the clone never finished or .git is damaged
+	ProblemBroken RepoProblem = "half-finished clone"
+
+	// ProblemDirty means files in the checkout were changed, added or removed
+	ProblemDirty RepoProblem = "local modifications"
+
+	// ProblemDetached means HEAD isn't on a branch, so there's nothing to pull into
+	ProblemDetached RepoProblem = "detached HEAD"
+
+	// ProblemDiverged means upstream history was rewritten (force-push) or
+	// the cache has commits of its own, found when a pull can't fast-forward
+	ProblemDiverged RepoProblem = "diverged from upstream"
+)
+
+// ErrDiverged is returned by pulls that can't fast-forward
+var ErrDiverged = errors.New("local history diverged from upstream")
+
+// RepairAction is how RepairRepo fixed a checkout
+type RepairAction int
+
+const (
+	// RepairNone means nothing was done (or nothing worked)
+	RepairNone RepairAction = iota
+
+	// RepairReset hard reset to the remote branch we already had
+	RepairReset
+
+	// RepairRefetch fetched the remote branch again, then hard reset
+	RepairRefetch
+
+	// RepairReclone cloned from scratch into a temp dir and swapped it in
+	RepairReclone
+
+	// RepairKept left local modifications alone, targets link into the
+	// checkout so they're likely the user's own edits
+	RepairKept
+)
+
+// String describes the action for the ui
+func (a RepairAction) String() string {
+	switch a {
+	case RepairReset:
+		return "reset to upstream"
+	case RepairRefetch:
+		return "fetched again and reset to upstream"
+	case RepairReclone:
+		return "cloned again"
+	case RepairKept:
+		return "kept them, your linked dotfiles point into it (not pulling until they're committed or reverted)"
+	default:
+		return "not repaired"
+	}
+}
+
+// RepairReport says what was wrong with a cached repo and how it was fixed
+type RepairReport struct {
+	Problems []RepoProblem
+	Action   RepairAction
+
+	// Err is set when every repair failed, the old copy is left as it was
+	Err error
+}
+
+// Summary returns a one-line, human readable description for the ui
+func (r *RepairReport) Summary() string {
+	if r == nil || len(r.Problems) == 0 {
+		return ""
+	}
+
+	problems := make([]string, len(r.Problems))
+	for i, p := range r.Problems {
+		problems[i] = string(p)
+	}
+	found := strings.Join(problems, ", ")
+
+	if r.Err != nil {
+		return fmt.Sprintf("cached repo has %s, repair failed: %v", found, r.Err)
+	}
+	return fmt.Sprintf("cached repo had %s, %s", found, r.Action)
+}
+
+// DiagnoseRepo checks a cached git checkout for states that break pulls
+// diverged history only shows up when pulling, see ErrDiverged
+func DiagnoseRepo(repoDir string) []RepoProblem {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
+		// not a git checkout, nothing we know how to check
+		return nil
+	}
+
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return []RepoProblem{ProblemBroken}
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return []RepoProblem{ProblemBroken}
+	}
+	if _, err := repo.CommitObject(head.Hash()); err != nil {
+		return []RepoProblem{ProblemBroken}
+	}
+
+	var problems []RepoProblem
+	dirty, err := isDirty(repo, repoDir)
+	if err != nil {
+		return []RepoProblem{ProblemBroken}
+	}
+	if dirty {
+		problems = append(problems, ProblemDirty)
+	}
+	if !head.Name().IsBranch() {
+		problems = append(problems, ProblemDetached)
+	}
+	return problems
+}
+
+// isDirty reports whether a checkout differs from its HEAD commit
+func isDirty(repo *git.Repository, repoDir string) (bool, error) {
+	if IsSparse(repoDir) {
+		// go-git sees every path outside the sparse patterns as deleted
+		if _, err := exec.LookPath("git"); err != nil {
+			return false, nil
+		}
+		out, err := exec.Command("git", "-C", repoDir, "status", "--porcelain").Output()
+		if err != nil {
+			return false, fmt.Errorf("couldn't get status: %w", err)
+		}
+		return len(strings.TrimSpace(string(out))) > 0, nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, fmt.Errorf("couldn't get worktree: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return false, fmt.Errorf("couldn't get status: %w", err)
+	}
+	return !status.IsClean(), nil
+}
+
+// RepairRepo fixes the problems DiagnoseRepo or a failed pull found
+// cheapest first: reset to the remote branch we already have, then fetch it
+// again and reset, then clone from scratch into a temp dir and swap it in,
+// so a failed repair never loses the copy we had
+// url is only needed for the re-clone, empty means the checkout's origin
+func RepairRepo(ctx context.Context, repoDir, url string, problems []RepoProblem, opts GitOptions) *RepairReport {
+	report := &RepairReport{Problems: problems}
+	if url == "" {
+		url = OriginURL(repoDir)
+	}
+
+	steps := repairSteps(problems)
+	for _, action := range steps {
+		var err error
+		switch action {
+		case RepairReset:
+			err = resetToUpstream(ctx, repoDir, false, opts)
+		case RepairRefetch:
+			err = resetToUpstream(ctx, repoDir, true, opts)
+		case RepairReclone:
+			err = recloneRepo(ctx, repoDir, url, opts)
+		}
+		if err == nil {
+			report.Action = action
+			report.Err = nil
+			return report
+		}
+		report.Err = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return report
+}
+
+// repairSteps lists the repairs worth trying for a set of problems
+func repairSteps(problems []RepoProblem) []RepairAction {
+	for _, p := range problems {
+		switch p {
+		case ProblemBroken:
+			// nothing in there worth resetting
+			return []RepairAction{RepairReclone}
+		case ProblemDiverged:
+			// the commits we have are the wrong ones
+			return []RepairAction{RepairRefetch, RepairReclone}
+		}
+	}
+	return []RepairAction{RepairReset, RepairRefetch, RepairReclone}
+}
+
+// resetToUpstream points the checkout's branch at its remote branch and
+// throws away everything else, fetching the remote branch first if asked
+func resetToUpstream(ctx context.Context, repoDir string, fetch bool, opts GitOptions) error {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return fmt.Errorf("couldn't open repo: %w", err)
+	}
+	branch, err := upstreamBranch(repo)
+	if err != nil {
+		return err
+	}
+	remoteRef := plumbing.NewRemoteReferenceName("origin", branch)
+
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	// go-git can't check out a partial clone, let the git cli handle it
+	if IsSparse(repoDir) {
+		return resetSparse(ctx, repoDir, branch, fetch, creds, opts)
+	}
+
+	if fetch {
+		err := repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: "origin",
+			RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:%s", branch, remoteRef))},
+			Auth:       creds.method(),
+			Progress:   newProgressWriter(opts.Progress),
+			Depth:      1,
+			Force:      true,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("couldn't fetch %s: %w", branch, err)
+		}
+	}
+
+	target, err := repo.Reference(remoteRef, true)
+	if err != nil {
+		return fmt.Errorf("couldn't find %s: %w", remoteRef.Short(), err)
+	}
+
+	// move the branch, then put HEAD back on it
+	local := plumbing.NewBranchReferenceName(branch)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(local, target.Hash())); err != nil {
+		return fmt.Errorf("couldn't move %s: %w", branch, err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, local)); err != nil {
+		return fmt.Errorf("couldn't check out %s: %w", branch, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("couldn't get worktree: %w", err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: target.Hash(), Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("couldn't reset to %s: %w", remoteRef.Short(), err)
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("couldn't remove untracked files: %w", err)
+	}
+	return nil
+}
+
+// resetSparse is resetToUpstream for partial clones, via the git cli
+func resetSparse(ctx context.Context, repoDir, branch string, fetch bool, creds *Credentials, opts GitOptions) error {
+	remoteRef := "refs/remotes/origin/" + branch
+
+	if fetch {
+		err := runGit(ctx, repoDir, opts.Progress, creds,
+			"fetch", "--depth", "1", "--force", "--progress", "origin", "+refs/heads/"+branch+":"+remoteRef)
+		if err != nil {
+			return fmt.Errorf("couldn't fetch %s: %w", branch, err)
+		}
+	}
+
+	// checkout fetches the blobs the new commit needs
+	if err := runGit(ctx, repoDir, nil, creds, "checkout", "--force", "-B", branch, remoteRef); err != nil {
+		return fmt.Errorf("couldn't reset to origin/%s: %w", branch, err)
+	}
+	if err := runGit(ctx, repoDir, nil, nil, "clean", "-fd"); err != nil {
+		return fmt.Errorf("couldn't remove untracked files: %w", err)
+	}
+	return nil
+}
+
+// upstreamBranch works out which remote branch a checkout follows
+func upstreamBranch(repo *git.Repository) (string, error) {
+	hasRemote := func(branch string) bool {
+		_, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), false)
+		return err == nil
+	}
+
+	// the branch we're on, as long as the remote has it
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() && hasRemote(head.Name().Short()) {
+		return head.Name().Short(), nil
+	}
+
+	// the remote's default branch, the git cli records it on clone
+	if ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false); err == nil &&
+		ref.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(ref.Target().String(), "refs/remotes/origin/"), nil
+	}
+
+	// the branch the clone set up tracking for
+	if cfg, err := repo.Config(); err == nil {
+		for name, b := range cfg.Branches {
+			if b.Remote == "origin" && hasRemote(name) {
+				return name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("couldn't work out the upstream branch")
+}
+
+// recloneRepo clones url next to repoDir and swaps it in
+// keeps a sparse checkout sparse, with the patterns it had
+func recloneRepo(ctx context.Context, repoDir, url string, opts GitOptions) error {
+	if url == "" {
+		return fmt.Errorf("couldn't clone again: no remote url")
+	}
+
+	switch {
+	case IsSparse(repoDir):
+		existing, err := readSparsePatterns(repoDir)
+		if err != nil {
+			return err
+		}
+		opts.Sparse = mergePatterns(existing, opts.Sparse)
+	case RepoExists(repoDir):
+		// a full checkout stays full
+		opts.Sparse = nil
+	}
+
+	source := &gitSource{url: url}
+	return replaceDir(repoDir, func(tmp string) error {
+		return source.Fetch(ctx, tmp, opts)
+	})
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// cachedTestRepo clones a fresh test remote through a manager
+func cachedTestRepo(t *testing.T, sparse []string) (*Manager, *manifest.Creator, string) {
+	t.Helper()
+	remote := newTestRepo(t, map[string]string{".tmux.conf": "set -g mouse on\n"})
+	m := NewManager(t.TempDir())
+	creator := &manifest.Creator{ID: "tester", Name: "Tester", Repo: "file://" + remote}
+
+	if _, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{Sparse: sparse}); err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	return m, creator, remote
+}
+
+// readFile returns a file's contents or fails the test
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+func TestRepairDirtyCheckout(t *testing.T) {
+	m, creator, _ := cachedTestRepo(t, nil)
+	repoPath := m.GetRepoPath(creator.ID)
+
+	if err := os.WriteFile(filepath.Join(repoPath, ".tmux.conf"), []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "stray"), []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if problems := DiagnoseRepo(repoPath); !slices.Equal(problems, []RepoProblem{ProblemDirty}) {
+		t.Fatalf("expected [dirty], got %v", problems)
+	}
+
+	result, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	if result.Repair == nil || result.Repair.Action != RepairReset || result.Repair.Err != nil {
+		t.Fatalf("expected a reset, got %+v", result.Repair)
+	}
+	if got := readFile(t, filepath.Join(repoPath, ".tmux.conf")); got != "set -g mouse on\n" {
+		t.Errorf("expected the edit to be undone, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "stray")); !os.IsNotExist(err) {
+		t.Error("expected untracked file to be removed")
+	}
+	if problems := DiagnoseRepo(repoPath); len(problems) != 0 {
+		t.Errorf("expected a clean checkout after repair, got %v", problems)
+	}
+}
+
+func TestRepairKeepsLinkedEdits(t *testing.T) {
+	m, creator, _ := cachedTestRepo(t, nil)
+	repoPath := m.GetRepoPath(creator.ID)
+
+	// ~/.tmux.conf was linked into the cache and edited through the link
+	target := filepath.Join(t.TempDir(), ".tmux.conf")
+	if err := os.Symlink(filepath.Join(repoPath, ".tmux.conf"), target); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("my edit\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	m.SetLinked(func(string) []string { return []string{target} })
+
+	result, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	if result.Repair == nil || result.Repair.Action != RepairKept || result.Action != SyncCached {
+		t.Fatalf("expected the checkout to be kept, got %+v (%v)", result.Repair, result.Action)
+	}
+	if result.Repair.Summary() == "" {
+		t.Error("expected the kept edits to be reported")
+	}
+	if got := readFile(t, target); got != "my edit\n" {
+		t.Errorf("expected the edit to survive, got %q", got)
+	}
+}
+
+func TestRepairDetachedHead(t *testing.T) {
+	m, creator, remote := cachedTestRepo(t, nil)
+	repoPath := m.GetRepoPath(creator.ID)
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		t.Fatalf("PlainOpen: %v", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: head.Hash()}); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+
+	if problems := DiagnoseRepo(repoPath); !slices.Equal(problems, []RepoProblem{ProblemDetached}) {
+		t.Fatalf("expected [detached HEAD], got %v", problems)
+	}
+
+	// the repaired checkout can pull again
+	remoteRepo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("PlainOpen remote: %v", err)
+	}
+	commitFiles(t, remoteRepo, remote, map[string]string{".tmux.conf": "set -g mouse off\n"}, "turn mouse off")
+
+	result, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	if result.Repair == nil || result.Repair.Err != nil {
+		t.Fatalf("expected a repair, got %+v", result.Repair)
+	}
+	if result.Action != SyncPulled || result.PullErr != nil {
+		t.Errorf("expected a pull after the repair, got %+v", result)
+	}
+	if got := readFile(t, filepath.Join(repoPath, ".tmux.conf")); got != "set -g mouse off\n" {
+		t.Errorf("expected upstream change, got %q", got)
+	}
+}
+
+func TestRepairForcePushedUpstream(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sparse []string
+	}{
+		{"full", nil},
+		{"sparse", []string{"/*"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.sparse != nil {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git cli not installed")
+				}
+			}
+			m, creator, remote := cachedTestRepo(t, tc.sparse)
+			repoPath := m.GetRepoPath(creator.ID)
+
+			// rewrite the remote's history from scratch
+			if err := os.RemoveAll(filepath.Join(remote, ".git")); err != nil {
+				t.Fatalf("RemoveAll: %v", err)
+			}
+			repo, err := git.PlainInit(remote, false)
+			if err != nil {
+				t.Fatalf("PlainInit: %v", err)
+			}
+			commitFiles(t, repo, remote, map[string]string{".tmux.conf": "rewritten\n"}, "new history")
+
+			result, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{Sparse: tc.sparse})
+			if err != nil {
+				t.Fatalf("EnsureRepo failed: %v", err)
+			}
+			if result.Repair == nil || result.Repair.Err != nil || result.PullErr != nil {
+				t.Fatalf("expected a successful repair, got %+v (repair %+v)", result, result.Repair)
+			}
+			if !slices.Contains(result.Repair.Problems, ProblemDiverged) {
+				t.Errorf("expected diverged history to be reported, got %v", result.Repair.Problems)
+			}
+			if got := readFile(t, filepath.Join(repoPath, ".tmux.conf")); got != "rewritten\n" {
+				t.Errorf("expected the rewritten history, got %q", got)
+			}
+			if tc.sparse != nil && !IsSparse(repoPath) {
+				t.Error("expected the checkout to stay sparse")
+			}
+		})
+	}
+}
+
+func TestRepairHalfFinishedClone(t *testing.T) {
+	m, creator, _ := cachedTestRepo(t, nil)
+	repoPath := m.GetRepoPath(creator.ID)
+
+	// as if the process died while git was writing objects
+	if err := os.RemoveAll(filepath.Join(repoPath, ".git", "objects")); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if problems := DiagnoseRepo(repoPath); !slices.Equal(problems, []RepoProblem{ProblemBroken}) {
+		t.Fatalf("expected [half-finished clone], got %v", problems)
+	}
+
+	result, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	if result.Action != SyncCloned || result.Repair == nil || result.Repair.Action != RepairReclone {
+		t.Fatalf("expected a re-clone, got %+v (repair %+v)", result, result.Repair)
+	}
+	if got := readFile(t, filepath.Join(repoPath, ".tmux.conf")); got != "set -g mouse on\n" {
+		t.Errorf("expected a working checkout, got %q", got)
+	}
+
+	// an unopenable .git goes the same way
+	if err := os.WriteFile(filepath.Join(repoPath, ".git", "HEAD"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	result, err = m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	if result.Repair == nil || result.Repair.Action != RepairReclone {
+		t.Errorf("expected a re-clone, got %+v", result.Repair)
+	}
+}
+
+func TestRepairFailureKeepsCopy(t *testing.T) {
+	m, creator, remote := cachedTestRepo(t, nil)
+	repoPath := m.GetRepoPath(creator.ID)
+
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	// the broken copy is the only one there is, so the re-clone must not lose it
+	report := RepairRepo(context.Background(), repoPath, creator.Repo, []RepoProblem{ProblemDiverged}, GitOptions{})
+	if report.Err == nil {
+		t.Fatal("expected the repair to fail without a remote")
+	}
+	if got := readFile(t, filepath.Join(repoPath, ".tmux.conf")); got != "set -g mouse on\n" {
+		t.Errorf("expected the old copy to survive, got %q", got)
+	}
+	if report.Summary() == "" {
+		t.Error("expected a summary for the failed repair")
+	}
+}
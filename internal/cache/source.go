@@ -0,0 +1,202 @@
+// package cache fetches creator files from git, local directories or archives
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/fsutil"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// Source puts a creator's files into a cache directory
+// every kind ends up as a plain directory, so detection works the same
+type Source interface {
+	// Kind is one of the manifest.Source* types
+	Kind() string
+
+	// Fetch fills dir, which doesn't exist yet
+	Fetch(ctx context.Context, dir string, opts GitOptions) error
+
+	// Update refreshes a dir filled by an earlier Fetch
+	Update(ctx context.Context, dir string, opts GitOptions) error
+}
+
+// NewSource picks the source for a creator, see manifest.Source
+func NewSource(creator *manifest.Creator) (Source, error) {
+	kind := ""
+	copyLocal := false
+	if creator.Source != nil {
+		kind = creator.Source.Type
+		copyLocal = creator.Source.Copy
+	}
+	if kind == "" {
+		kind = guessSourceKind(creator.Repo)
+	}
+
+	switch kind {
+	case manifest.SourceGit:
+		return &gitSource{url: creator.Repo}, nil
+	case manifest.SourceLocal:
+		return &localSource{path: fsutil.ExpandHome(creator.Repo), copy: copyLocal}, nil
+	case manifest.SourceArchive:
+		return &archiveSource{url: creator.Repo}, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q for %s", kind, creator.Name)
+	}
+}
+
+// guessSourceKind infers the source type from the shape of repo
+// file:// urls stay git, that's how git spells a local remote
+func guessSourceKind(repo string) string {
+	lower := strings.ToLower(repo)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		if path, _, _ := strings.Cut(lower, "?"); isArchiveName(path) {
+			return manifest.SourceArchive
+		}
+		return manifest.SourceGit
+	}
+
+	if filepath.IsAbs(repo) || repo == "~" || strings.HasPrefix(repo, "~/") ||
+		strings.HasPrefix(repo, "./") || strings.HasPrefix(repo, "../") {
+		return manifest.SourceLocal
+	}
+
+	return manifest.SourceGit
+}
+
+// gitSource clones and pulls a git remote
+type gitSource struct {
+	url string
+}
+
+func (s *gitSource) Kind() string { return manifest.SourceGit }
+
+// Fetch clones, only the sparse paths when opts asks for them
+func (s *gitSource) Fetch(ctx context.Context, dir string, opts GitOptions) error {
+	if len(opts.Sparse) > 0 {
+		return SparseCloneRepo(ctx, s.url, dir, opts.Sparse, opts)
+	}
+	return CloneRepoWithOptions(ctx, s.url, dir, opts)
+}
+
+// Update pulls the latest commits
+func (s *gitSource) Update(ctx context.Context, dir string, opts GitOptions) error {
+	return PullRepoWithOptions(ctx, dir, opts)
+}
+
+// localSource serves a directory that's already on disk
+type localSource struct {
+	path string
+	copy bool
+}
+
+func (s *localSource) Kind() string { return manifest.SourceLocal }
+
+// Fetch links dir to the local path, or snapshots it when copy is set
+// falls back to a copy where symlinks aren't allowed
+func (s *localSource) Fetch(ctx context.Context, dir string, opts GitOptions) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("couldn't read local source: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("local source %s is not a directory", s.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("couldn't create cache directory: %w", err)
+	}
+
+	if !s.copy {
+		abs, err := filepath.Abs(s.path)
+		if err != nil {
+			return fmt.Errorf("couldn't resolve local source: %w", err)
+		}
+		if err := os.Symlink(abs, dir); err == nil {
+			return nil
+		}
+	}
+
+	return replaceDir(dir, func(tmp string) error {
+		return copyTree(ctx, s.path, tmp)
+	})
+}
+
+// Update re-copies a snapshot, a linked source is always current
+func (s *localSource) Update(ctx context.Context, dir string, opts GitOptions) error {
+	if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	return replaceDir(dir, func(tmp string) error {
+		return copyTree(ctx, s.path, tmp)
+	})
+}
+
+// replaceDir fills a temp directory next to dir and swaps it in
+// dir is left untouched if fill fails, so a bad update never loses the cache
+func replaceDir(dir string, fill func(tmp string) error) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("couldn't create cache directory: %w", err)
+	}
+
+	// hidden, so ListCachedCreators never mistakes it for a repo
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+"-")
+	if err != nil {
+		return fmt.Errorf("couldn't create temp directory: %w", err)
+	}
+
+	if err := fill(tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("couldn't remove old copy: %w", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("couldn't move new copy into place: %w", err)
+	}
+	return nil
+}
+
+// copyTree copies a directory tree, symlinks are copied as links
+func copyTree(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return fsutil.CopyFile(path, target)
+		default:
+			// sockets, fifos and devices have no place in dotfiles
+			return nil
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestGuessSourceKind(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/folke/dot":                        manifest.SourceGit,
+		"git@github.com:folke/dot.git":                        manifest.SourceGit,
+		"file:///srv/git/dotfiles.git":                        manifest.SourceGit,
+		"https://example.com/releases/dotfiles-1.2.tar.gz":    manifest.SourceArchive,
+		"https://example.com/dotfiles.zip?token=abc":          manifest.SourceArchive,
+		"https://github.com/team/dotfiles/archive/v1.0.0.tgz": manifest.SourceArchive,
+		"/mnt/nfs/team/dotfiles":                              manifest.SourceLocal,
+		"~/src/dotfiles":                                      manifest.SourceLocal,
+		"./testdata/creator":                                  manifest.SourceLocal,
+	}
+
+	for repo, want := range tests {
+		if got := guessSourceKind(repo); got != want {
+			t.Errorf("guessSourceKind(%q) = %q, want %q", repo, got, want)
+		}
+	}
+}
+
+// writeTree creates files under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+// readCached reads a file from a creator's cached copy
+func readCached(t *testing.T, m *Manager, creatorID, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.GetRepoPath(creatorID), name))
+	if err != nil {
+		t.Fatalf("reading cached %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestLocalSourceInPlace(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{".config/nvim/init.lua": "-- v1\n"})
+
+	m := NewManager(t.TempDir())
+	creator := &manifest.Creator{ID: "nfs", Name: "NFS", Repo: local}
+
+	if err := m.EnsureRepo(context.Background(), creator); err != nil {
+		t.Fatalf("EnsureRepo: %v", err)
+	}
+	if !m.IsRepoCached("nfs") {
+		t.Fatal("expected local source to count as cached")
+	}
+
+	// edits show up immediately, nothing was copied
+	writeTree(t, local, map[string]string{".config/nvim/init.lua": "-- v2\n"})
+	if got := readCached(t, m, "nfs", ".config/nvim/init.lua"); got != "-- v2\n" {
+		t.Errorf("expected in-place source to reflect edits, got %q", got)
+	}
+
+	// clearing the cache must never touch the user's directory
+	if err := m.ClearCreatorCache("nfs"); err != nil {
+		t.Fatalf("ClearCreatorCache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, ".config/nvim/init.lua")); err != nil {
+		t.Errorf("local source was deleted along with the cache: %v", err)
+	}
+}
+
+func TestLocalSourceCopy(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{".zshrc": "v1\n"})
+
+	m := NewManager(t.TempDir())
+	creator := &manifest.Creator{
+		ID: "snap", Name: "Snap", Repo: local,
+		Source: &manifest.Source{Type: manifest.SourceLocal, Copy: true},
+	}
+	ctx := context.Background()
+
+	if err := m.EnsureRepo(ctx, creator); err != nil {
+		t.Fatalf("EnsureRepo: %v", err)
+	}
+
+	writeTree(t, local, map[string]string{".zshrc": "v2\n"})
+	if got := readCached(t, m, "snap", ".zshrc"); got != "v1\n" {
+		t.Errorf("expected a snapshot, got %q", got)
+	}
+
+	// the default policy refreshes on every use
+	result, err := m.EnsureRepoWithOptions(ctx, creator, GitOptions{})
+	if err != nil || result.Action != SyncPulled {
+		t.Fatalf("expected a refresh, got %+v, %v", result, err)
+	}
+	if got := readCached(t, m, "snap", ".zshrc"); got != "v2\n" {
+		t.Errorf("expected refreshed snapshot, got %q", got)
+	}
+}
+
+// tarball builds a gzipped tarball the way release pages do, everything
+// wrapped in a single top-level directory
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: "dotfiles-1.0/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatalf("WriteHeader: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// zipball builds a zip archive with files at the root
+func zipball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestArchiveSource(t *testing.T) {
+	archives := map[string][]byte{
+		"/dotfiles-1.0.tar.gz": tarball(t, map[string]string{".config/kitty/kitty.conf": "font_size 12\n"}),
+		"/dotfiles.zip":        zipball(t, map[string]string{".config/kitty/kitty.conf": "font_size 12\n"}),
+		"/evil.zip":            zipball(t, map[string]string{"../../escape": "gotcha\n"}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	m := NewManager(t.TempDir())
+	ctx := context.Background()
+
+	for _, name := range []string{"dotfiles-1.0.tar.gz", "dotfiles.zip"} {
+		t.Run(name, func(t *testing.T) {
+			creator := &manifest.Creator{ID: name, Name: name, Repo: server.URL + "/" + name}
+			var reported bool
+			_, err := m.EnsureRepoWithOptions(ctx, creator, GitOptions{
+				Progress: func(Progress) { reported = true },
+			})
+			if err != nil {
+				t.Fatalf("EnsureRepo: %v", err)
+			}
+			if got := readCached(t, m, name, ".config/kitty/kitty.conf"); got != "font_size 12\n" {
+				t.Errorf("unexpected contents %q", got)
+			}
+			if !reported {
+				t.Error("expected download progress")
+			}
+		})
+	}
+
+	t.Run("path traversal", func(t *testing.T) {
+		creator := &manifest.Creator{ID: "evil", Name: "Evil", Repo: server.URL + "/evil.zip"}
+		if err := m.EnsureRepo(ctx, creator); err == nil {
+			t.Fatal("expected an archive escaping its directory to be rejected")
+		}
+		if m.IsRepoCached("evil") {
+			t.Error("a rejected archive shouldn't leave a cache entry")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		creator := &manifest.Creator{ID: "gone", Name: "Gone", Repo: server.URL + "/gone.tar.gz"}
+		if err := m.EnsureRepo(ctx, creator); err == nil {
+			t.Fatal("expected a 404 to fail")
+		}
+	})
+}
+
+func TestExtractTarChainedSymlinks(t *testing.T) {
+	type entry struct{ name, link, content string }
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{
+			name: "write through a chain",
+			entries: []entry{
+				{name: "a", link: "."},
+				{name: "a/b", link: ".."},
+				{name: "a/b/escape", content: "gotcha\n"},
+			},
+		},
+		{
+			name: "link through a link",
+			entries: []entry{
+				{name: "a", link: "."},
+				{name: "escape", link: "a/.."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, e := range tt.entries {
+				header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+				if e.link != "" {
+					header = &tar.Header{Name: e.name, Linkname: e.link, Typeflag: tar.TypeSymlink}
+				}
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatalf("WriteHeader: %v", err)
+				}
+				if _, err := tw.Write([]byte(e.content)); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			tw.Close()
+
+			root := t.TempDir()
+			file := filepath.Join(root, "evil.tar")
+			if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(root, "out")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := extractTar(file, dir, false); err == nil {
+				t.Error("expected chained symlinks escaping the directory to be rejected")
+			}
+			if _, err := os.Lstat(filepath.Join(root, "escape")); err == nil {
+				t.Error("the archive wrote outside its directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// package cache handles partial clones that only fetch the paths we need
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// SparseCloneRepo clones only the files matching the sparse-checkout patterns
+// go-git can't do blob-filtered clones, so this uses the git cli and falls back
+// to a regular full clone when git isn't installed
+func SparseCloneRepo(ctx context.Context, url, targetDir string, patterns []string, opts GitOptions) error {
+	if _, err := exec.LookPath("git"); err != nil || len(patterns) == 0 {
+		return CloneRepoWithOptions(ctx, url, targetDir, opts)
+	}
+
+	// an existing checkout just gets widened and updated
+	if RepoExists(targetDir) {
+		if err := AddSparsePatterns(ctx, targetDir, patterns, opts); err != nil {
+			return err
+		}
+		return PullRepoWithOptions(ctx, targetDir, opts)
+	}
+	if err := os.RemoveAll(targetDir); err != nil {
+		return fmt.Errorf("couldn't remove empty directory: %w", err)
+	}
+
+	err := sparseClone(ctx, url, targetDir, patterns, opts)
+	if err != nil {
+		// don't leave a partial checkout around, the next run would treat it as cached
+		_ = os.RemoveAll(targetDir)
+		if ctx.Err() != nil {
+			return fmt.Errorf("clone cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("couldn't clone repo: %w", err)
+	}
+
+	return nil
+}
+
+// sparseClone does the actual blob-filtered clone and sparse checkout
+func sparseClone(ctx context.Context, url, targetDir string, patterns []string, opts GitOptions) error {
+	creds, err := opts.credentials(ctx, url)
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	// trees and commits only - file contents are fetched on checkout for matched paths
+	err = runGit(ctx, "", opts.Progress, creds,
+		"clone", "--depth", "1", "--filter=blob:none", "--no-checkout", "--progress", url, targetDir)
+	if err != nil {
+		return err
+	}
+
+	if err := runGit(ctx, targetDir, nil, nil, "config", "core.sparseCheckout", "true"); err != nil {
+		return err
+	}
+	if err := writeSparsePatterns(targetDir, patterns); err != nil {
+		return err
+	}
+
+	// checkout fetches the missing blobs, so it needs credentials too
+	return runGit(ctx, targetDir, opts.Progress, creds, "checkout", "--progress")
+}
+
+// IsSparse reports whether a cached repo only has part of its tree checked out
+func IsSparse(repoDir string) bool {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return false
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(cfg.Raw.Section("core").Option("sparseCheckout"), "true")
+}
+
+// AddSparsePatterns widens an existing sparse checkout with more patterns
+// missing file contents are fetched from the remote on demand
+func AddSparsePatterns(ctx context.Context, repoDir string, patterns []string, opts GitOptions) error {
+	if !IsSparse(repoDir) {
+		// full checkouts already have everything
+		return nil
+	}
+
+	existing, err := readSparsePatterns(repoDir)
+	if err != nil {
+		return err
+	}
+
+	merged := mergePatterns(existing, patterns)
+	if len(merged) == len(existing) {
+		return nil
+	}
+
+	if err := writeSparsePatterns(repoDir, merged); err != nil {
+		return err
+	}
+
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	if err := runGit(ctx, repoDir, nil, creds, "read-tree", "-mu", "HEAD"); err != nil {
+		return fmt.Errorf("couldn't widen sparse checkout: %w", err)
+	}
+
+	return nil
+}
+
+// ExpandSparse turns a sparse checkout into a full one
+// used when structure detection needs to see the whole tree
+func ExpandSparse(ctx context.Context, repoDir string, opts GitOptions) error {
+	if !IsSparse(repoDir) {
+		return nil
+	}
+
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	// what `git sparse-checkout disable` does, without needing git 2.25:
+	// widen the patterns to everything, check the tree out (fetching the
+	// missing blobs) and only then turn the flag off
+	if err := writeSparsePatterns(repoDir, []string{"/*"}); err != nil {
+		return err
+	}
+	if err := runGit(ctx, repoDir, opts.Progress, creds, "read-tree", "-mu", "HEAD"); err != nil {
+		return fmt.Errorf("couldn't expand sparse checkout: %w", err)
+	}
+	if err := runGit(ctx, repoDir, nil, nil, "config", "core.sparseCheckout", "false"); err != nil {
+		return fmt.Errorf("couldn't expand sparse checkout: %w", err)
+	}
+
+	return nil
+}
+
+// pullSparse updates a sparse checkout, go-git can't read the missing blobs
+func pullSparse(ctx context.Context, repoDir string, opts GitOptions) error {
+	creds, err := opts.credentials(ctx, OriginURL(repoDir))
+	if err != nil {
+		return fmt.Errorf("couldn't get credentials: %w", err)
+	}
+
+	if err := runGit(ctx, repoDir, opts.Progress, creds, "pull", "--ff-only", "--progress"); err != nil {
+		if strings.Contains(err.Error(), "Not possible to fast-forward") {
+			return fmt.Errorf("couldn't pull updates: %w", ErrDiverged)
+		}
+		return fmt.Errorf("couldn't pull updates: %w", err)
+	}
+	return nil
+}
+
+// mergePatterns appends the patterns existing doesn't have yet
+func mergePatterns(existing, patterns []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		seen[p] = true
+	}
+
+	merged := existing
+	for _, p := range patterns {
+		if !seen[p] {
+			seen[p] = true
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// sparseFile returns the path of the sparse-checkout pattern file
+func sparseFile(repoDir string) string {
+	return filepath.Join(repoDir, ".git", "info", "sparse-checkout")
+}
+
+// readSparsePatterns loads the current sparse-checkout patterns
+func readSparsePatterns(repoDir string) ([]string, error) {
+	data, err := os.ReadFile(sparseFile(repoDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("couldn't read sparse-checkout patterns: %w", err)
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// writeSparsePatterns replaces the sparse-checkout pattern file
+// written directly instead of via `git sparse-checkout set` so git older
+// than 2.25 works too; the blob filter still needs 2.19
+func writeSparsePatterns(repoDir string, patterns []string) error {
+	path := sparseFile(repoDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("couldn't create git info directory: %w", err)
+	}
+
+	data := strings.Join(patterns, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return fmt.Errorf("couldn't write sparse-checkout patterns: %w", err)
+	}
+	return nil
+}
+
+// runGit runs a git cli command, feeding stderr into the progress parser
+// creds add to the inherited environment and go before the command
+func runGit(ctx context.Context, dir string, progress ProgressFunc, creds *Credentials, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append(slices.Clone(creds.args()), args...)...)
+	cmd.Dir = dir
+	// never block the tui on a credential prompt
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), creds.env()...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if w := newProgressWriter(progress); w != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, w)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("git %s failed: %w\n%s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseCloneLifecycle(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git cli not available")
+	}
+
+	remote := newTestRepo(t, map[string]string{
+		"tmux/.tmux.conf":            "set -g mouse on\n",
+		"nvim/.config/nvim/init.lua": "-- config\n",
+		"wallpapers/mountain.png":    "not really a png",
+		".chezmoiignore":             "README.md\n",
+	})
+	target := filepath.Join(t.TempDir(), "creator")
+	ctx := context.Background()
+
+	// file:// so git treats it like a real remote (local clones ignore --filter)
+	url := "file://" + remote
+	err := SparseCloneRepo(ctx, url, target, []string{"/*", "!/*/", "/*/.tmux.conf"}, GitOptions{})
+	if err != nil {
+		t.Fatalf("SparseCloneRepo failed: %v", err)
+	}
+
+	assertExists := func(rel string, want bool) {
+		t.Helper()
+		_, err := os.Stat(filepath.Join(target, rel))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", rel, exists, want)
+		}
+	}
+
+	if !IsSparse(target) {
+		t.Fatal("expected clone to be sparse")
+	}
+	assertExists("tmux/.tmux.conf", true)
+	assertExists(".chezmoiignore", true)
+	assertExists("wallpapers/mountain.png", false)
+	assertExists("nvim/.config/nvim/init.lua", false)
+
+	// a second dotfile widens the checkout
+	if err := AddSparsePatterns(ctx, target, []string{"/*/.config/nvim"}, GitOptions{}); err != nil {
+		t.Fatalf("AddSparsePatterns failed: %v", err)
+	}
+	assertExists("nvim/.config/nvim/init.lua", true)
+	assertExists("wallpapers/mountain.png", false)
+
+	// pulls go through the git cli for sparse checkouts
+	if err := PullRepo(ctx, target); err != nil {
+		t.Fatalf("PullRepo on sparse checkout failed: %v", err)
+	}
+
+	// detection fallback fetches everything
+	if err := ExpandSparse(ctx, target, GitOptions{}); err != nil {
+		t.Fatalf("ExpandSparse failed: %v", err)
+	}
+	if IsSparse(target) {
+		t.Error("expected checkout to be full after ExpandSparse")
+	}
+	assertExists("wallpapers/mountain.png", true)
+}
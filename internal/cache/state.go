@@ -0,0 +1,150 @@
+// package cache tracks when each cached repo was last fetched
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RefreshMode controls when a cached repo is pulled again
+type RefreshMode string
+
+const (
+	// RefreshAlways pulls every time a repo is used
+	RefreshAlways RefreshMode = "always"
+
+	// RefreshStale pulls only when the last fetch is older than MaxAge
+	RefreshStale RefreshMode = "stale"
+
+	// RefreshNever never pulls a repo that's already cached (offline mode)
+	RefreshNever RefreshMode = "never"
+)
+
+// RefreshPolicy decides whether an existing repo should be pulled
+type RefreshPolicy struct {
+	Mode   RefreshMode
+	MaxAge time.Duration
+}
+
+// ShouldRefresh reports whether a repo last fetched at lastFetch needs a pull
+// a zero lastFetch means we don't know, which counts as stale
+func (p RefreshPolicy) ShouldRefresh(lastFetch time.Time) bool {
+	switch p.Mode {
+	case RefreshNever:
+		return false
+	case RefreshStale:
+		return lastFetch.IsZero() || time.Since(lastFetch) > p.MaxAge
+	default:
+		return true
+	}
+}
+
+// RepoState is what we remember about a cached repo between runs
+type RepoState struct {
+	// LastFetch is when the repo was last cloned or pulled successfully
+	LastFetch time.Time `json:"last_fetch"`
+
+	// LastError is the most recent pull failure, cleared on success
+	LastError string `json:"last_error,omitempty"`
+}
+
+// SyncAction is what EnsureRepo ended up doing
+type SyncAction int
+
+const (
+	// SyncCloned means the repo was downloaded fresh
+	SyncCloned SyncAction = iota
+
+	// SyncPulled means an existing repo was updated
+	SyncPulled
+
+	// SyncCached means the existing copy was used as-is
+	SyncCached
+)
+
+// SyncResult describes the copy of a repo we're about to use
+type SyncResult struct {
+	Action SyncAction
+
+	// Age is how old the copy in use is (zero right after a fetch)
+	Age time.Duration
+
+	// PullErr is set when a pull failed and we fell back to the cached copy
+	PullErr error
+
+	// Repair is set when the cached checkout was dirty or broken, see RepairRepo
+	Repair *RepairReport
+}
+
+// Summary returns a one-line, human readable description for the ui
+// empty when there's nothing worth mentioning (fresh clone or pull)
+func (r *SyncResult) Summary() string {
+	if r == nil || r.Action != SyncCached {
+		return ""
+	}
+	if r.PullErr != nil {
+		return fmt.Sprintf("using cached copy from %s, pull failed: %v", FormatAge(r.Age), r.PullErr)
+	}
+	return fmt.Sprintf("using cached copy from %s", FormatAge(r.Age))
+}
+
+// FormatAge renders a duration as "3 days ago" style text
+func FormatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	default:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+// plural formats a count with a singular or plural unit
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// statePath returns where a creator's repo state is stored
+// kept outside the repo so git operations never see it
+func (m *Manager) statePath(creatorID string) string {
+	return filepath.Join(m.cacheDir, ".state", creatorID+".json")
+}
+
+// loadState reads a creator's repo state, returns a zero state if missing
+func (m *Manager) loadState(creatorID string) RepoState {
+	var state RepoState
+	data, err := os.ReadFile(m.statePath(creatorID))
+	if err != nil {
+		return state
+	}
+	// a corrupt state file just means we treat the repo as stale
+	_ = json.Unmarshal(data, &state)
+	return state
+}
+
+// saveState writes a creator's repo state
+func (m *Manager) saveState(creatorID string, state RepoState) error {
+	path := m.statePath(creatorID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("couldn't create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal repo state: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("couldn't write repo state: %w", err)
+	}
+	return nil
+}
@@ -1,13 +1,20 @@
-// package cache handles submodule detection and resolution
+// package cache checks out git submodules at their pinned commits
 package cache
 
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 )
 
 // SubmoduleConfig represents a git submodule entry
@@ -107,51 +114,6 @@ func FindSubmoduleByPath(submodules []SubmoduleConfig, path string) *SubmoduleCo
 	return nil
 }
 
-// ResolveSubmodule attempts to resolve an empty directory as a submodule
-// by reading .gitmodules and cloning the submodule directly
-func ResolveSubmodule(ctx context.Context, repoDir, submodulePath string) error {
-	// Parse .gitmodules
-	submodules, err := ParseGitmodules(repoDir)
-	if err != nil {
-		return fmt.Errorf("couldn't parse .gitmodules: %w", err)
-	}
-
-	if len(submodules) == 0 {
-		return fmt.Errorf("no submodules found in .gitmodules")
-	}
-
-	// Find the submodule config for this path
-	// submodulePath is absolute, we need to make it relative to repoDir
-	relPath, err := filepath.Rel(repoDir, submodulePath)
-	if err != nil {
-		return fmt.Errorf("couldn't determine relative path: %w", err)
-	}
-
-	submodule := FindSubmoduleByPath(submodules, relPath)
-	if submodule == nil {
-		return fmt.Errorf("no submodule config found for path: %s", relPath)
-	}
-
-	// Convert SSH to HTTPS
-	cloneURL := ConvertSSHToHTTPS(submodule.URL)
-
-	// Try to clone the submodule directly
-	err = CloneRepo(ctx, cloneURL, submodulePath)
-	if err != nil {
-		// If HTTPS fails and original was SSH, try SSH
-		if cloneURL != submodule.URL {
-			err = CloneRepo(ctx, submodule.URL, submodulePath)
-			if err != nil {
-				return fmt.Errorf("couldn't clone submodule (tried HTTPS and SSH): %w", err)
-			}
-		} else {
-			return fmt.Errorf("couldn't clone submodule: %w", err)
-		}
-	}
-
-	return nil
-}
-
 // IsEmptyDirectory checks if a directory is empty or only contains .git metadata
 func IsEmptyDirectory(path string) (bool, error) {
 	entries, err := os.ReadDir(path)
@@ -172,98 +134,264 @@ func IsEmptyDirectory(path string) (bool, error) {
 	return count == 0, nil
 }
 
-// DefaultSubmoduleDepth is the recursion limit used by ResolveSubmodulesRecursive.
-// Pass this constant for the initial (top-level) call.
+// DefaultSubmoduleDepth is how deep ResolveSubmodules follows nested submodules
 const DefaultSubmoduleDepth = 3
 
-// ResolveSubmodulesRecursive recursively resolves submodules up to maxDepth.
-// Pass DefaultSubmoduleDepth for the initial (top-level) call.
-// This handles nested submodules (submodules that themselves have submodules).
-func ResolveSubmodulesRecursive(ctx context.Context, repoDir string, maxDepth int) error {
-	if maxDepth <= 0 {
-		return nil // Depth limit reached
+// SubmoduleStatus is how resolving one submodule went
+type SubmoduleStatus string
+
+const (
+	// SubmoduleResolved means it's checked out at the pinned commit
+	SubmoduleResolved SubmoduleStatus = "resolved"
+
+	// SubmodulePrivate means the remote wants credentials we don't have,
+	// or doesn't exist (hosts answer private repos with "not found")
+	SubmodulePrivate SubmoduleStatus = "private"
+
+	// SubmoduleFailed is anything else, e.g. the pinned commit is gone
+	SubmoduleFailed SubmoduleStatus = "failed"
+)
+
+// SubmoduleResult is the outcome for one submodule
+type SubmoduleResult struct {
+	Path   string // relative to the top-level repo, also for nested ones
+	URL    string // the url tried last
+	Commit string // pinned in the parent tree
+	Status SubmoduleStatus
+	Err    error // why it's private or failed
+}
+
+// ShortCommit returns the abbreviated pinned commit
+func (r SubmoduleResult) ShortCommit() string {
+	if len(r.Commit) > 7 {
+		return r.Commit[:7]
 	}
+	return r.Commit
+}
 
-	// Parse .gitmodules in the current repo
-	submodules, err := ParseGitmodules(repoDir)
-	if err != nil {
-		return fmt.Errorf("couldn't parse .gitmodules: %w", err)
+// SubmoduleReport lists every submodule ResolveSubmodules looked at
+type SubmoduleReport struct {
+	Results []SubmoduleResult
+}
+
+// Count returns how many submodules ended up with status
+func (r *SubmoduleReport) Count(status SubmoduleStatus) int {
+	if r == nil {
+		return 0
 	}
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
 
-	if len(submodules) == 0 {
-		return nil // No submodules to resolve
+// Summary returns a one-line, human readable description for the ui
+// empty when there were no submodules
+func (r *SubmoduleReport) Summary() string {
+	if r == nil || len(r.Results) == 0 {
+		return ""
 	}
 
-	// Only print the status message on the initial (top-level) call.
-	if maxDepth == DefaultSubmoduleDepth {
-		fmt.Fprintf(os.Stderr, "Resolving %d submodule(s)...\n", len(submodules))
+	var parts []string
+	for _, status := range []SubmoduleStatus{SubmoduleResolved, SubmodulePrivate, SubmoduleFailed} {
+		if n := r.Count(status); n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
 	}
+	return fmt.Sprintf("%s: %s", plural(len(r.Results), "submodule"), strings.Join(parts, ", "))
+}
 
-	// Resolve each submodule
-	// Track at least one successful resolution
-	successCount := 0
+// ResolveSubmodules checks out the submodules of a cached repo at the commits
+// pinned in the parent tree, shallow, following nested ones DefaultSubmoduleDepth deep
+// paths limits it to submodules at, inside or around those repo-relative
+// paths, empty means all of them. failures don't stop the others, they're
+// in the report
+func ResolveSubmodules(ctx context.Context, repoDir string, paths []string, opts GitOptions) *SubmoduleReport {
+	report := &SubmoduleReport{}
+
+	// a linked local source is the user's own checkout, leave it alone
+	if info, err := os.Lstat(repoDir); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		return report
+	}
+	// no repo, no submodules (local and archive sources)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return report
+	}
 
-	for _, submodule := range submodules {
-		submodulePath := filepath.Join(repoDir, submodule.Path)
+	resolveSubmodules(ctx, repo, "", paths, DefaultSubmoduleDepth, opts, report)
+	return report
+}
 
-		// Check if submodule directory is empty (needs resolution)
-		isEmpty, err := IsEmptyDirectory(submodulePath)
-		if err != nil {
-			// Directory doesn't exist yet, create it
-			if os.IsNotExist(err) {
-				if err := os.MkdirAll(submodulePath, 0755); err != nil {
-					// Warn but continue with other submodules
-					continue
-				}
-				isEmpty = true
-			} else {
-				// Warn but continue with other submodules
-				continue
-			}
+// resolveSubmodules resolves one repo's submodules, prefix is where the repo
+// sits inside the top-level one
+func resolveSubmodules(ctx context.Context, repo *git.Repository, prefix string, paths []string, depth int,
+	opts GitOptions, report *SubmoduleReport) {
+	if depth <= 0 {
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return
+	}
+	subs, err := worktree.Submodules()
+	if err != nil {
+		report.Results = append(report.Results, SubmoduleResult{
+			Path:   path.Join(prefix, ".gitmodules"),
+			Status: SubmoduleFailed,
+			Err:    fmt.Errorf("couldn't read .gitmodules: %w", err),
+		})
+		return
+	}
+
+	for _, sub := range subs {
+		if ctx.Err() != nil {
+			return
 		}
 
-		// If directory is not empty, it's already resolved
-		if !isEmpty {
-			// Still check for nested submodules
-			if err := ResolveSubmodulesRecursive(ctx, submodulePath, maxDepth-1); err != nil {
-				// Log but don't fail - nested submodules might not be critical
-			}
-			successCount++ // Already resolved counts as success
+		fullPath := path.Join(prefix, sub.Config().Path)
+		if !submoduleWanted(fullPath, paths) {
 			continue
 		}
 
-		// Convert SSH to HTTPS
-		cloneURL := ConvertSSHToHTTPS(submodule.URL)
-
-		// Try to clone the submodule
-		err = CloneRepo(ctx, cloneURL, submodulePath)
-		if err != nil {
-			// If HTTPS fails and original was SSH, try SSH
-			if cloneURL != submodule.URL {
-				err = CloneRepo(ctx, submodule.URL, submodulePath)
-				if err != nil {
-					// Warn but continue - submodule might be private (skip logging to keep UI clean)
-					continue
-				}
-			} else {
-				// Warn but continue - submodule might be private (skip logging to keep UI clean)
-				continue
+		result := resolveSubmodule(ctx, repo, worktree, sub, opts)
+		result.Path = fullPath
+		report.Results = append(report.Results, result)
+
+		if result.Status == SubmoduleResolved {
+			if subRepo, err := sub.Repository(); err == nil {
+				resolveSubmodules(ctx, subRepo, fullPath, paths, depth-1, opts, report)
 			}
 		}
+	}
+}
+
+// submoduleWanted reports whether a submodule is at, inside or around one of paths
+func submoduleWanted(subPath string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.Trim(filepath.ToSlash(p), "/")
+		if p == "" || p == "." || touchesPaths(subPath, []string{p}) || touchesPaths(p, []string{subPath}) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSubmodule checks out one submodule at its pinned commit
+func resolveSubmodule(ctx context.Context, repo *git.Repository, worktree *git.Worktree, sub *git.Submodule,
+	opts GitOptions) SubmoduleResult {
+	cfg := sub.Config()
+	result := SubmoduleResult{URL: cfg.URL}
+
+	status, err := sub.Status()
+	if err != nil {
+		result.Status = SubmoduleFailed
+		result.Err = fmt.Errorf("couldn't get status: %w", err)
+		return result
+	}
+	if status.Expected.IsZero() {
+		result.Status = SubmoduleFailed
+		result.Err = fmt.Errorf("no commit recorded in the parent tree")
+		return result
+	}
+	result.Commit = status.Expected.String()
+
+	if !status.Current.IsZero() && status.IsClean() {
+		// checked out on an earlier run
+		result.Status = SubmoduleResolved
+		return result
+	}
+
+	dir := filepath.Join(worktree.Filesystem.Root(), filepath.FromSlash(cfg.Path))
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+		// a standalone clone from older versions, pinned to nothing
+		_ = os.RemoveAll(dir)
+	}
 
-		successCount++
+	private := false
+	for _, url := range submoduleURLs(ctx, cfg.URL, opts) {
+		cfg.URL = url
+		result.URL = url
+
+		creds, err := opts.credentials(ctx, url)
+		if err == nil {
+			err = updateSubmodule(ctx, sub, creds, 1)
+			if errors.Is(err, plumbing.ErrObjectNotFound) && ctx.Err() == nil {
+				// the pinned commit isn't a branch tip and the server won't
+				// hand it out by hash, so fetch the whole history instead
+				resetSubmodule(repo, cfg.Name, dir)
+				err = updateSubmodule(ctx, sub, creds, 0)
+			}
+		}
+		if err == nil {
+			result.Status = SubmoduleResolved
+			result.Err = nil
+			return result
+		}
 
-		// Recursively resolve nested submodules
-		if err := ResolveSubmodulesRecursive(ctx, submodulePath, maxDepth-1); err != nil {
-			// Log but don't fail - nested submodules might not be critical
+		result.Err = err
+		private = private || isAuthError(err)
+		if ctx.Err() != nil {
+			break
 		}
+		// the next url needs a fresh module repo
+		resetSubmodule(repo, cfg.Name, dir)
 	}
 
-	// Only fail if we couldn't resolve ANY submodules
-	// This is lenient because some submodules might be private
-	if len(submodules) > 0 && successCount == 0 {
-		return fmt.Errorf("couldn't resolve any submodules (%d total)", len(submodules))
+	result.Status = SubmoduleFailed
+	if private {
+		result.Status = SubmodulePrivate
 	}
+	return result
+}
 
-	return nil
+// updateSubmodule fetches a submodule and checks out its pinned commit
+// depth 0 fetches the whole history
+func updateSubmodule(ctx context.Context, sub *git.Submodule, creds *Credentials, depth int) error {
+	return sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+		Init:              true,
+		Auth:              creds.method(),
+		Depth:             depth,
+		RecurseSubmodules: git.NoRecurseSubmodules, // we recurse ourselves to report each one
+	})
+}
+
+// submoduleURLs lists the urls to try for a submodule
+// ssh urls we have no credentials for try anonymous https first
+func submoduleURLs(ctx context.Context, url string, opts GitOptions) []string {
+	https := ConvertSSHToHTTPS(url)
+	if https == url {
+		return []string{url}
+	}
+	if creds, err := opts.credentials(ctx, url); err == nil && creds != nil {
+		return []string{url}
+	}
+	return []string{https, url}
+}
+
+// resetSubmodule removes a failed submodule's git dir and checkout
+func resetSubmodule(repo *git.Repository, name, dir string) {
+	if storage, ok := repo.Storer.(*filesystem.Storage); ok {
+		_ = os.RemoveAll(filepath.Join(storage.Filesystem().Root(), "modules", name))
+	}
+	_ = os.RemoveAll(dir)
+	_ = os.MkdirAll(dir, 0755)
+}
+
+// isAuthError reports whether err means the remote wants credentials
+func isAuthError(err error) bool {
+	if errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrRepositoryNotFound) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "unable to authenticate") || strings.Contains(msg, "SSH_AUTH_SOCK")
 }
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// gitCmd runs the git cli in dir, file:// submodules need an explicit opt-in
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "protocol.file.allow=always", "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestResolveSubmodules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git cli not installed")
+	}
+
+	// a plugin repo with a nested theme submodule, pinned one commit behind its tip
+	theme := newTestRepo(t, map[string]string{"colors.lua": "dark\n"})
+	plugin := newTestRepo(t, map[string]string{"init.lua": "v1\n"})
+	gitCmd(t, plugin, "submodule", "add", theme, "theme")
+	gitCmd(t, plugin, "commit", "-m", "add theme")
+	pinned := gitCmd(t, plugin, "rev-parse", "HEAD")
+	repo, err := git.PlainOpen(plugin)
+	if err != nil {
+		t.Fatalf("PlainOpen: %v", err)
+	}
+	commitFiles(t, repo, plugin, map[string]string{"init.lua": "v2\n"}, "v2")
+
+	parent := newTestRepo(t, map[string]string{"README": "dots\n"})
+	gitCmd(t, parent, "submodule", "add", plugin, "nvim/pack/plugin")
+	gitCmd(t, "", "-C", filepath.Join(parent, "nvim/pack/plugin"), "checkout", "-q", pinned)
+	gitCmd(t, parent, "add", "nvim/pack/plugin")
+	gitCmd(t, parent, "submodule", "add", theme, "private")
+	gitCmd(t, parent, "submodule", "add", theme, "zsh/theme")
+	gitCmd(t, parent, "commit", "-m", "add submodules")
+	// point one submodule at a remote that isn't there
+	gitCmd(t, parent, "config", "-f", ".gitmodules", "submodule.private.url", filepath.Join(t.TempDir(), "gone"))
+	gitCmd(t, parent, "commit", "-am", "private submodule")
+
+	m := NewManager(t.TempDir())
+	creator := &manifest.Creator{ID: "tester", Name: "Tester", Repo: "file://" + parent}
+	if _, err := m.EnsureRepoWithOptions(context.Background(), creator, GitOptions{}); err != nil {
+		t.Fatalf("EnsureRepo failed: %v", err)
+	}
+	repoPath := m.GetRepoPath(creator.ID)
+
+	report := ResolveSubmodules(context.Background(), repoPath, []string{"nvim", "private"}, GitOptions{})
+
+	statuses := make(map[string]SubmoduleStatus)
+	for _, r := range report.Results {
+		statuses[r.Path] = r.Status
+	}
+	expected := map[string]SubmoduleStatus{
+		"nvim/pack/plugin":       SubmoduleResolved,
+		"nvim/pack/plugin/theme": SubmoduleResolved,
+		"private":                SubmodulePrivate,
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	}
+	for path, status := range expected {
+		if statuses[path] != status {
+			t.Errorf("%s: expected %s, got %s", path, status, statuses[path])
+		}
+	}
+
+	// checked out at the pinned commit, not the tip
+	data, err := os.ReadFile(filepath.Join(repoPath, "nvim/pack/plugin/init.lua"))
+	if err != nil || string(data) != "v1\n" {
+		t.Errorf("expected the pinned v1, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "nvim/pack/plugin/theme/colors.lua")); err != nil {
+		t.Errorf("expected the nested submodule to be checked out: %v", err)
+	}
+	// outside the requested paths
+	if _, err := os.Stat(filepath.Join(repoPath, "zsh/theme/colors.lua")); err == nil {
+		t.Error("expected zsh/theme to be left alone")
+	}
+
+	// checked out submodules don't make the cache look dirty
+	if problems := DiagnoseRepo(repoPath); len(problems) != 0 {
+		t.Errorf("expected a clean checkout, got %v", problems)
+	}
+
+	if got := report.Summary(); got != "3 submodules: 2 resolved, 1 private" {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	// a second run finds everything already in place
+	again := ResolveSubmodules(context.Background(), repoPath, []string{"nvim"}, GitOptions{})
+	if again.Count(SubmoduleResolved) != 2 {
+		t.Errorf("expected 2 resolved on the second run, got %+v", again.Results)
+	}
+}
+
+func TestSubmoduleWanted(t *testing.T) {
+	tests := []struct {
+		sub      string
+		paths    []string
+		expected bool
+	}{
+		{"nvim/pack/plugin", nil, true},
+		{"nvim/pack/plugin", []string{"nvim"}, true},
+		{".config/nvim", []string{".config/nvim/lua"}, true},
+		{"zsh/theme", []string{"nvim", ".tmux.conf"}, false},
+		{"nvim2", []string{"nvim"}, false},
+		{"anything", []string{"."}, true},
+	}
+	for _, tt := range tests {
+		if got := submoduleWanted(tt.sub, tt.paths); got != tt.expected {
+			t.Errorf("submoduleWanted(%q, %v) = %v, want %v", tt.sub, tt.paths, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// package cache reports disk usage of cached repos and garbage collects them
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RepoInfo describes one cached creator repo
+type RepoInfo struct {
+	CreatorID  string
+	Path       string
+	Size       int64     // bytes on disk, including .git
+	LastFetch  time.Time // zero if unknown
+	Commit     string    // checked out commit, empty if unreadable
+	Referenced bool      // creator is still in the manifest
+	Links      []string  // targets still linked into the repo, gc keeps it
+}
+
+// Age returns how long ago the repo was fetched, zero if unknown
+func (r RepoInfo) Age() time.Duration {
+	if r.LastFetch.IsZero() {
+		return 0
+	}
+	return time.Since(r.LastFetch)
+}
+
+// GCPolicy picks which cached repos to remove, any matching rule removes a repo
+type GCPolicy struct {
+	// Unreferenced removes repos for creators no longer in the manifest
+	Unreferenced bool
+
+	// OlderThan removes repos not fetched for this long (0 disables)
+	OlderThan time.Duration
+
+	// MaxTotalSize removes the least recently fetched repos until the cache
+	// fits in this many bytes (0 disables)
+	MaxTotalSize int64
+}
+
+// ListRepos returns every cached repo with its size, age and commit
+// referenced holds the creator ids that are still in the manifest
+func (m *Manager) ListRepos(referenced map[string]bool) ([]RepoInfo, error) {
+	ids, err := m.ListCachedCreators()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list cache: %w", err)
+	}
+
+	repos := make([]RepoInfo, 0, len(ids))
+	for _, id := range ids {
+		path := m.getRepoPath(id)
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't measure %s: %w", id, err)
+		}
+
+		info := RepoInfo{
+			CreatorID:  id,
+			Path:       path,
+			Size:       size,
+			LastFetch:  m.lastFetch(id, m.loadState(id)),
+			Referenced: referenced[id],
+			Links:      m.LiveLinks(id),
+		}
+		// a broken checkout still shows up, just without a commit
+		if commit, err := GetLatestCommit(path); err == nil {
+			info.Commit = commit
+		}
+		repos = append(repos, info)
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].CreatorID < repos[j].CreatorID
+	})
+	return repos, nil
+}
+
+// SelectForGC returns the repos a policy would remove, without removing them
+// repos with live links are never picked, removing them would break the links
+func SelectForGC(repos []RepoInfo, policy GCPolicy) []RepoInfo {
+	selected := make(map[string]bool)
+	var total int64
+
+	for _, r := range repos {
+		switch {
+		case len(r.Links) > 0:
+			total += r.Size
+		case policy.Unreferenced && !r.Referenced:
+			selected[r.CreatorID] = true
+		case policy.OlderThan > 0 && r.Age() > policy.OlderThan:
+			selected[r.CreatorID] = true
+		default:
+			total += r.Size
+		}
+	}
+
+	if policy.MaxTotalSize > 0 && total > policy.MaxTotalSize {
+		// evict the least recently fetched first, unknown ages count as oldest
+		remaining := make([]RepoInfo, 0, len(repos))
+		for _, r := range repos {
+			if !selected[r.CreatorID] {
+				remaining = append(remaining, r)
+			}
+		}
+		sort.SliceStable(remaining, func(i, j int) bool {
+			return remaining[i].LastFetch.Before(remaining[j].LastFetch)
+		})
+		for _, r := range remaining {
+			if total <= policy.MaxTotalSize {
+				break
+			}
+			if len(r.Links) > 0 {
+				continue
+			}
+			selected[r.CreatorID] = true
+			total -= r.Size
+		}
+	}
+
+	var result []RepoInfo
+	for _, r := range repos {
+		if selected[r.CreatorID] {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// GC removes the cached repos selected by policy and returns them
+// dryRun only reports what would be removed
+func (m *Manager) GC(referenced map[string]bool, policy GCPolicy, dryRun bool) ([]RepoInfo, error) {
+	repos, err := m.ListRepos(referenced)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := SelectForGC(repos, policy)
+	if dryRun {
+		return selected, nil
+	}
+
+	for i, r := range selected {
+		if err := m.ClearCreatorCache(r.CreatorID); err != nil {
+			return selected[:i], fmt.Errorf("couldn't remove %s: %w", r.CreatorID, err)
+		}
+	}
+	return selected, nil
+}
+
+// dirSize adds up the size of every file under path
+// a local source linked in place is measured at its real location
+func dirSize(path string) (int64, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// FormatSize renders a byte count as "12.3 MB" style text
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGT"[exp])
+}
+
+// ParseSize reads sizes like "500MB", "2G" or "1024" (bytes)
+func ParseSize(input string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", input)
+	}
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestSelectForGC(t *testing.T) {
+	now := time.Now()
+	repos := []RepoInfo{
+		{CreatorID: "gone", Size: 100, LastFetch: now, Referenced: false},
+		{CreatorID: "old", Size: 100, LastFetch: now.Add(-60 * 24 * time.Hour), Referenced: true},
+		{CreatorID: "big", Size: 1000, LastFetch: now.Add(-2 * time.Hour), Referenced: true},
+		{CreatorID: "fresh", Size: 500, LastFetch: now, Referenced: true},
+	}
+
+	tests := []struct {
+		name   string
+		policy GCPolicy
+		want   []string
+	}{
+		{"empty policy removes nothing", GCPolicy{}, nil},
+		{"unreferenced", GCPolicy{Unreferenced: true}, []string{"gone"}},
+		{"older than 30 days", GCPolicy{OlderThan: 30 * 24 * time.Hour}, []string{"old"}},
+		{"budget evicts least recently fetched", GCPolicy{MaxTotalSize: 700}, []string{"old", "big"}},
+		{"budget counts after other rules", GCPolicy{Unreferenced: true, MaxTotalSize: 1500}, []string{"gone", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range SelectForGC(repos, tt.policy) {
+				got = append(got, r.CreatorID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectForGCKeepsLinked(t *testing.T) {
+	now := time.Now()
+	repos := []RepoInfo{
+		{CreatorID: "linked", Size: 1000, LastFetch: now.Add(-90 * 24 * time.Hour), Links: []string{"/home/me/.config/nvim"}},
+		{CreatorID: "free", Size: 100, LastFetch: now},
+	}
+
+	got := SelectForGC(repos, GCPolicy{Unreferenced: true, OlderThan: 30 * 24 * time.Hour, MaxTotalSize: 10})
+	if len(got) != 1 || got[0].CreatorID != "free" {
+		t.Errorf("expected only free to be removed, got %v", got)
+	}
+}
+
+func TestSizeFormatting(t *testing.T) {
+	formats := map[int64]string{
+		512:             "512 B",
+		2048:            "2.0 KB",
+		5 * 1024 * 1024: "5.0 MB",
+		3 << 30:         "3.0 GB",
+	}
+	for bytes, want := range formats {
+		if got := FormatSize(bytes); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+
+	sizes := map[string]int64{
+		"1024":   1024,
+		"500MB":  500 << 20,
+		"2g":     2 << 30,
+		"1.5KiB": 1536,
+	}
+	for input, want := range sizes {
+		got, err := ParseSize(input)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", input, got, err, want)
+		}
+	}
+
+	if _, err := ParseSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestManagerGC(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	m := NewManager(t.TempDir())
+
+	for _, id := range []string{"kept", "dropped"} {
+		creator := &manifest.Creator{ID: id, Name: id, Repo: "file://" + remote}
+		if err := m.EnsureRepo(context.Background(), creator); err != nil {
+			t.Fatalf("EnsureRepo(%s): %v", id, err)
+		}
+	}
+
+	referenced := map[string]bool{"kept": true}
+	repos, err := m.ListRepos(referenced)
+	if err != nil {
+		t.Fatalf("ListRepos: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 cached repos, got %d", len(repos))
+	}
+	for _, r := range repos {
+		if r.Size == 0 || r.Commit == "" || r.LastFetch.IsZero() {
+			t.Errorf("incomplete info for %s: %+v", r.CreatorID, r)
+		}
+	}
+
+	removed, err := m.GC(referenced, GCPolicy{Unreferenced: true}, true)
+	if err != nil || len(removed) != 1 || !m.IsRepoCached("dropped") {
+		t.Fatalf("dry run should report but keep dropped: removed=%v err=%v", removed, err)
+	}
+
+	if _, err := m.GC(referenced, GCPolicy{Unreferenced: true}, false); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if m.IsRepoCached("dropped") {
+		t.Error("expected unreferenced repo to be removed")
+	}
+	if !m.IsRepoCached("kept") {
+		t.Error("expected referenced repo to be kept")
+	}
+}
+
+func TestManagerKeepsLinkedRepos(t *testing.T) {
+	remote := newTestRepo(t, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	m := NewManager(t.TempDir())
+	for _, id := range []string{"linked", "free"} {
+		creator := &manifest.Creator{ID: id, Name: id, Repo: "file://" + remote}
+		if err := m.EnsureRepo(context.Background(), creator); err != nil {
+			t.Fatalf("EnsureRepo(%s): %v", id, err)
+		}
+	}
+
+	// stow_link left ~/.zshrc pointing into the linked repo
+	home := t.TempDir()
+	target := filepath.Join(home, ".zshrc")
+	if err := os.Symlink(filepath.Join(m.GetRepoPath("linked"), ".zshrc"), target); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	m.SetLinked(func(creatorID string) []string {
+		return []string{target, filepath.Join(home, ".missing")}
+	})
+
+	if live := m.LiveLinks("linked"); len(live) != 1 || live[0] != target {
+		t.Errorf("expected %s to be live, got %v", target, live)
+	}
+	if live := m.LiveLinks("free"); len(live) != 0 {
+		t.Errorf("expected no live links into free, got %v", live)
+	}
+
+	removed, err := m.GC(nil, GCPolicy{Unreferenced: true}, false)
+	if err != nil || len(removed) != 1 || removed[0].CreatorID != "free" {
+		t.Fatalf("expected gc to only remove free, removed=%v err=%v", removed, err)
+	}
+	if err := m.ClearCreatorCache("linked"); !errors.Is(err, ErrLinked) {
+		t.Errorf("expected clearing a linked repo to fail with ErrLinked, got %v", err)
+	}
+	if !m.IsRepoCached("linked") {
+		t.Fatal("the linked repo was removed")
+	}
+
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := m.ClearCreatorCache("linked"); err != nil {
+		t.Errorf("ClearCreatorCache once unlinked: %v", err)
+	}
+}
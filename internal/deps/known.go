@@ -0,0 +1,184 @@
+package deps
+
+// samePackage names a package the same everywhere
+func samePackage(name string) map[string]string {
+	return map[string]string{
+		"homebrew": name,
+		"apt":      name,
+		"pacman":   name,
+		"dnf":      name,
+	}
+}
+
+// known maps the dependency names manifests use to their metadata
+var known = map[string]Dependency{
+	"neovim": {
+		Name:         "neovim",
+		Command:      "nvim",
+		PackageNames: samePackage("neovim"),
+		Description:  "Neovim text editor",
+	},
+	"vim": {
+		Name:         "vim",
+		Command:      "vim",
+		PackageNames: samePackage("vim"),
+		Description:  "Vim text editor",
+	},
+	"emacs": {
+		Name:         "emacs",
+		Command:      "emacs",
+		PackageNames: samePackage("emacs"),
+		Description:  "GNU Emacs",
+	},
+	"helix": {
+		Name:         "helix",
+		Command:      "hx",
+		PackageNames: samePackage("helix"),
+		Description:  "Helix text editor",
+	},
+	"tmux": {
+		Name:         "tmux",
+		Command:      "tmux",
+		PackageNames: samePackage("tmux"),
+		Description:  "Terminal multiplexer",
+	},
+	"zsh": {
+		Name:         "zsh",
+		Command:      "zsh",
+		PackageNames: samePackage("zsh"),
+		Description:  "Z shell",
+	},
+	"bash": {
+		Name:         "bash",
+		Command:      "bash",
+		PackageNames: samePackage("bash"),
+		Description:  "Bourne again shell",
+	},
+	"fish": {
+		Name:         "fish",
+		Command:      "fish",
+		PackageNames: samePackage("fish"),
+		Description:  "Friendly interactive shell",
+	},
+	"starship": {
+		Name:         "starship",
+		Command:      "starship",
+		PackageNames: samePackage("starship"),
+		Description:  "Starship prompt",
+	},
+	"git": {
+		Name:         "git",
+		Command:      "git",
+		PackageNames: samePackage("git"),
+		Description:  "Git version control",
+	},
+	"alacritty": {
+		Name:         "alacritty",
+		Command:      "alacritty",
+		PackageNames: samePackage("alacritty"),
+		Description:  "GPU-accelerated terminal emulator",
+	},
+	"kitty": {
+		Name:         "kitty",
+		Command:      "kitty",
+		PackageNames: samePackage("kitty"),
+		Description:  "GPU-accelerated terminal emulator",
+	},
+	"wezterm": {
+		Name:    "wezterm",
+		Command: "wezterm",
+		PackageNames: map[string]string{
+			"homebrew": "wezterm",
+			"pacman":   "wezterm",
+		},
+		Description: "WezTerm terminal emulator",
+	},
+	"rxvt-unicode": {
+		Name:    "rxvt-unicode",
+		Command: "urxvt",
+		PackageNames: map[string]string{
+			"apt":    "rxvt-unicode",
+			"pacman": "rxvt-unicode",
+			"dnf":    "rxvt-unicode",
+		},
+		Description: "rxvt-unicode terminal emulator",
+	},
+	"i3-wm": {
+		Name:    "i3-wm",
+		Command: "i3",
+		PackageNames: map[string]string{
+			"homebrew": "i3",
+			"apt":      "i3-wm",
+			"pacman":   "i3-wm",
+			"dnf":      "i3",
+		},
+		Description: "i3 tiling window manager",
+	},
+	"i3status": {
+		Name:         "i3status",
+		Command:      "i3status",
+		PackageNames: samePackage("i3status"),
+		Description:  "i3 status bar generator",
+	},
+	"sway": {
+		Name:         "sway",
+		Command:      "sway",
+		PackageNames: samePackage("sway"),
+		Description:  "Sway wayland compositor",
+	},
+	"hyprland": {
+		Name:    "hyprland",
+		Command: "Hyprland",
+		PackageNames: map[string]string{
+			"pacman": "hyprland",
+			"dnf":    "hyprland",
+		},
+		Description: "Hyprland wayland compositor",
+	},
+	"waybar": {
+		Name:         "waybar",
+		Command:      "waybar",
+		PackageNames: samePackage("waybar"),
+		Description:  "Waybar status bar",
+	},
+	"polybar": {
+		Name:         "polybar",
+		Command:      "polybar",
+		PackageNames: samePackage("polybar"),
+		Description:  "Polybar status bar",
+	},
+	"rofi": {
+		Name:         "rofi",
+		Command:      "rofi",
+		PackageNames: samePackage("rofi"),
+		Description:  "Rofi application launcher",
+	},
+	"oh-my-zsh": {
+		Name:    "oh-my-zsh",
+		Command: "omz", // oh-my-zsh doesn't have a binary, just a framework
+		PackageNames: map[string]string{
+			"homebrew": "", // oh-my-zsh is installed via script, not package manager
+		},
+		Description: "Oh My Zsh framework (install manually)",
+	},
+}
+
+// Lookup returns a dependency's metadata by the name manifests use
+// unknown names are guessed to be a command and package of the same name
+func Lookup(name string) Dependency {
+	if dep, ok := known[name]; ok {
+		return dep
+	}
+	return Dependency{
+		Name:         name,
+		Command:      name,
+		PackageNames: samePackage(name),
+		Description:  name,
+	}
+}
+
+// IsKnown reports whether Lookup has real metadata for name
+func IsKnown(name string) bool {
+	_, ok := known[name]
+	return ok
+}
@@ -0,0 +1,15 @@
+// package fsutil provides shared filesystem utility functions.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InsideDir reports whether path is dir or inside it, lexically.
+// resolve symlinks first when they matter.
+func InsideDir(dir, path string) bool {
+	dir, path = filepath.Clean(dir), filepath.Clean(path)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
@@ -0,0 +1,139 @@
+// package history remembers which creator dotfiles were applied and at which commit
+// it's what lets us tell the user when a creator changed a config they're using
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// Entry records one dotfile applied from a creator's repo
+type Entry struct {
+	CreatorID   string           `json:"creator_id"`
+	CreatorName string           `json:"creator_name"`
+	DotfileID   string           `json:"dotfile_id"`
+	DotfileName string           `json:"dotfile_name"`
+	Repo        string           `json:"repo"`
+	Source      *manifest.Source `json:"source,omitempty"` // how Repo is fetched, nil for older entries
+	Commit      string           `json:"commit"`
+	Paths       []string         `json:"paths"`            // repo-relative source paths that were applied
+	Linked      []string         `json:"linked,omitempty"` // targets linked into the cache instead of copied
+	AppliedAt   time.Time        `json:"applied_at"`
+}
+
+// Creator is the creator the entry was applied from, enough to fetch its
+// repo again; entries without a source guess it from Repo
+func (e Entry) Creator() *manifest.Creator {
+	return &manifest.Creator{ID: e.CreatorID, Name: e.CreatorName, Repo: e.Repo, Source: e.Source}
+}
+
+// Store reads and writes the applied-dotfile history file
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a history store backed by the json file at path
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load returns every recorded entry, oldest first
+// a missing file just means nothing has been applied yet
+func (s *Store) Load() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// load is the internal version without locking
+func (s *Store) load() ([]Entry, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("couldn't read history: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("couldn't parse history: %w", err)
+	}
+	return entries, nil
+}
+
+// Record saves an entry, replacing any earlier apply of the same dotfile
+func (s *Store) Record(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.CreatorID != entry.CreatorID || e.DotfileID != entry.DotfileID {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, entry)
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].AppliedAt.Before(kept[j].AppliedAt)
+	})
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal history: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("couldn't create history directory: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("couldn't write history: %w", err)
+	}
+
+	return nil
+}
+
+// ForCreator returns the entries applied from one creator
+func (s *Store) ForCreator(creatorID string) ([]Entry, error) {
+	entries, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+	for _, e := range entries {
+		if e.CreatorID == creatorID {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// Linked returns every target linked into a creator's cached repo, for
+// cache.Manager.SetLinked; an unreadable history lists none
+func (s *Store) Linked(creatorID string) []string {
+	entries, err := s.ForCreator(creatorID)
+	if err != nil {
+		return nil
+	}
+	var linked []string
+	for _, e := range entries {
+		linked = append(linked, e.Linked...)
+	}
+	return linked
+}
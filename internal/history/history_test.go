@@ -0,0 +1,94 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+func TestStoreRecordReplacesSameDotfile(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "applied.json"))
+
+	entries, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load on missing file failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries, got %d", len(entries))
+	}
+
+	now := time.Now()
+	records := []Entry{
+		{CreatorID: "prime", DotfileID: "tmux", Commit: "aaa", AppliedAt: now.Add(-time.Hour)},
+		{CreatorID: "tj", DotfileID: "nvim", Commit: "bbb", AppliedAt: now.Add(-30 * time.Minute)},
+		{CreatorID: "prime", DotfileID: "tmux", Commit: "ccc", AppliedAt: now},
+	}
+	for _, r := range records {
+		if err := s.Record(r); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	entries, err = s.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries after re-applying tmux, got %d", len(entries))
+	}
+
+	prime, err := s.ForCreator("prime")
+	if err != nil {
+		t.Fatalf("ForCreator failed: %v", err)
+	}
+	if len(prime) != 1 || prime[0].Commit != "ccc" {
+		t.Errorf("expected latest tmux apply at ccc, got %+v", prime)
+	}
+}
+
+func TestEntryCreatorKeepsSource(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "applied.json"))
+	entry := Entry{
+		CreatorID: "me",
+		DotfileID: "nvim",
+		Repo:      "~/src/dotfiles",
+		Source:    &manifest.Source{Type: manifest.SourceLocal, Copy: true},
+		AppliedAt: time.Now(),
+	}
+	if err := s.Record(entry); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	entries, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	creator := entries[0].Creator()
+	if creator.Repo != entry.Repo || creator.Source == nil || *creator.Source != *entry.Source {
+		t.Errorf("Creator() = %+v, want repo %s from a copied local source", creator, entry.Repo)
+	}
+}
+
+func TestStoreLinked(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "applied.json"))
+	now := time.Now()
+	records := []Entry{
+		{CreatorID: "prime", DotfileID: "tmux", Linked: []string{"/home/me/.tmux.conf"}, AppliedAt: now},
+		{CreatorID: "prime", DotfileID: "nvim", Linked: []string{"/home/me/.config/nvim"}, AppliedAt: now},
+		{CreatorID: "tj", DotfileID: "nvim", AppliedAt: now},
+	}
+	for _, r := range records {
+		if err := s.Record(r); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	if got := s.Linked("prime"); len(got) != 2 {
+		t.Errorf("expected both of prime's links, got %v", got)
+	}
+	if got := s.Linked("tj"); len(got) != 0 {
+		t.Errorf("expected no links for a copied apply, got %v", got)
+	}
+}
@@ -0,0 +1,143 @@
+// package ignore decides which files a directory dotfile leaves behind,
+// with gitignore patterns collected from several places
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// FileName is the ignore file a creator can keep at the root of their repo
+const FileName = ".dotpickerignore"
+
+// where rules come from, shown next to what they left out
+const (
+	SourceDefault  = "default"
+	SourceRepo     = FileName
+	SourceManifest = "manifest"
+	SourceConfig   = "config"
+)
+
+// Defaults are left out of every directory dotfile: repo furniture, os
+// litter, screenshots, tests and generated plugin state nobody wants copied
+// into $HOME; a later "!pattern" brings one back
+var Defaults = []string{
+	".DS_Store",
+	"Thumbs.db",
+	"desktop.ini",
+	".gitignore",
+	".gitattributes",
+	".gitmodules",
+	".github/",
+	"README*",
+	"readme*",
+	"LICENSE*",
+	"CHANGELOG*",
+	"screenshot*",
+	"screenshots/",
+	"test/",
+	"tests/",
+	"lazy-lock.json",
+	"plugin/packer_compiled.lua",
+	"*.swp",
+	"*~",
+}
+
+// Rule is one pattern and where it came from
+type Rule struct {
+	Pattern string
+	Source  string
+	pattern gitignore.Pattern
+}
+
+// String says where the rule came from, e.g. "default: README*"
+func (r Rule) String() string {
+	return r.Source + ": " + r.Pattern
+}
+
+// Matcher holds rules in order, a later rule overrides an earlier one
+type Matcher struct {
+	rules []Rule
+}
+
+// Add appends gitignore patterns, "!" ones bring files back; blank lines
+// and # comments are skipped
+func (m *Matcher) Add(source string, patterns ...string) {
+	for _, p := range patterns {
+		p = strings.TrimRight(p, "\r")
+		if strings.TrimSpace(p) == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		m.rules = append(m.rules, Rule{Pattern: p, Source: source, pattern: gitignore.ParsePattern(p, nil)})
+	}
+}
+
+// Include appends patterns that bring files back, it's Add with each
+// pattern negated
+func (m *Matcher) Include(source string, patterns ...string) {
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			m.Add(source, "!"+strings.TrimPrefix(p, "!"))
+		}
+	}
+}
+
+// AddFile appends the patterns in a gitignore-style file, a missing file
+// adds nothing
+func (m *Matcher) AddFile(path, source string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %w", path, err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	m.Add(source, lines...)
+	return nil
+}
+
+// Empty reports whether there are no rules
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.rules) == 0
+}
+
+// Match decides a slash-separated path: the last rule matching it, or
+// one of its parent directories, wins; rule is nil when none matched, and
+// excluded says whether the winning rule leaves the path out
+// like git, a file can't be brought back from an excluded directory
+func (m *Matcher) Match(path string, isDir bool) (rule *Rule, excluded bool) {
+	if m.Empty() {
+		return nil, false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if r, excluded := m.decide(parts[:i], true); excluded {
+			return r, true
+		}
+	}
+	return m.decide(parts, isDir)
+}
+
+// decide finds the last rule matching parts exactly
+func (m *Matcher) decide(parts []string, isDir bool) (*Rule, bool) {
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		switch m.rules[i].pattern.Match(parts, isDir) {
+		case gitignore.Exclude:
+			return &m.rules[i], true
+		case gitignore.Include:
+			return &m.rules[i], false
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	var m Matcher
+	m.Add(SourceDefault, Defaults...)
+	m.Add(SourceManifest, "# comment", "", "*.log", "!keep.log", "cache/")
+	m.Include(SourceConfig, "README.md")
+
+	tests := []struct {
+		path     string
+		expected string // the rule that decided, "" when none did
+		excluded bool
+	}{
+		{path: "init.lua"},
+		{path: "lazy-lock.json", expected: "default: lazy-lock.json", excluded: true},
+		{path: "plugin/packer_compiled.lua", expected: "default: plugin/packer_compiled.lua", excluded: true},
+		{path: "lua/plugin/packer_compiled.lua"},
+		{path: "after/.DS_Store", expected: "default: .DS_Store", excluded: true},
+		{path: "tests/minimal_init.lua", expected: "default: tests/", excluded: true},
+		{path: "screenshots/desktop.png", expected: "default: screenshots/", excluded: true},
+		{path: ".gitconfig"},
+		{path: "README.md", expected: "config: !README.md"},
+		{path: "README.txt", expected: "default: README*", excluded: true},
+		{path: "nvim.log", expected: "manifest: *.log", excluded: true},
+		{path: "keep.log", expected: "manifest: !keep.log"},
+		{path: "cache/keep.log", expected: "manifest: cache/", excluded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule, excluded := m.Match(tt.path, false)
+			got := ""
+			if rule != nil {
+				got = rule.String()
+			}
+			if got != tt.expected || excluded != tt.excluded {
+				t.Errorf("got %q, %v, want %q, %v", got, excluded, tt.expected, tt.excluded)
+			}
+		})
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	dir := t.TempDir()
+
+	var m Matcher
+	if err := m.AddFile(filepath.Join(dir, FileName), SourceRepo); err != nil {
+		t.Fatalf("a missing file should be fine: %v", err)
+	}
+	if !m.Empty() {
+		t.Fatal("expected no rules")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("# wallpapers are huge\r\nwall/\r\n\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddFile(filepath.Join(dir, FileName), SourceRepo); err != nil {
+		t.Fatal(err)
+	}
+	if rule, excluded := m.Match("wall/mountains.png", false); !excluded || rule.String() != ".dotpickerignore: wall/" {
+		t.Errorf("got %v, %v", rule, excluded)
+	}
+}
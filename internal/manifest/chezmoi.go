@@ -0,0 +1,656 @@
+// package manifest decodes chezmoi source directories into target paths
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/milxzy/dotfile-picker/internal/fsutil"
+)
+
+// ChezmoiKind is what a chezmoi source entry turns into
+type ChezmoiKind int
+
+const (
+	// ChezmoiFile is a regular file, copied to the target
+	ChezmoiFile ChezmoiKind = iota
+
+	// ChezmoiDir is a directory, only its permissions matter
+	ChezmoiDir
+
+	// ChezmoiSymlink is a symlink, the source contents are the link target
+	ChezmoiSymlink
+
+	// ChezmoiCreate is a file only written when the target doesn't exist yet
+	ChezmoiCreate
+
+	// ChezmoiModify is a script that rewrites the existing target, never run
+	ChezmoiModify
+
+	// ChezmoiScript is a run_ script, never run
+	ChezmoiScript
+
+	// ChezmoiRemove asks chezmoi to delete the target, never done
+	ChezmoiRemove
+)
+
+// ChezmoiEntry is one decoded source-state entry
+type ChezmoiEntry struct {
+	Source    string // absolute path in the repo
+	Target    string // slash-separated, relative to home
+	Kind      ChezmoiKind
+	Mode      fs.FileMode // permissions the target gets
+	Template  bool        // .tmpl, contents are rendered first
+	Encrypted bool        // encrypted_, we can't decrypt it
+}
+
+// applicable reports whether the entry can be applied as a file
+func (e ChezmoiEntry) applicable() (bool, string) {
+	switch {
+	case e.Encrypted:
+		return false, "encrypted"
+	case e.Kind == ChezmoiModify:
+		return false, "modify script"
+	case e.Kind == ChezmoiScript:
+		return false, "script"
+	case e.Kind == ChezmoiRemove:
+		return false, "removal"
+	}
+	return true, ""
+}
+
+// ChezmoiState is a decoded chezmoi source directory
+type ChezmoiState struct {
+	// Root is the source directory, the repo root unless .chezmoiroot moves it
+	Root string
+
+	// Entries are sorted by Target, ignored targets are left out
+	Entries []ChezmoiEntry
+
+	data      map[string]any
+	templates map[string]string // .chezmoitemplates, by name
+}
+
+// DecodeChezmoi maps a chezmoi source directory to target paths and modes
+// honours .chezmoiroot and .chezmoiignore, template data comes from the
+// machine (.chezmoi.os, .chezmoi.hostname, ...) and .chezmoidata.json
+func DecodeChezmoi(repoPath string) (*ChezmoiState, error) {
+	root := repoPath
+	if data, err := os.ReadFile(filepath.Join(repoPath, ".chezmoiroot")); err == nil {
+		rel := strings.TrimSpace(string(data))
+		root = filepath.Join(repoPath, filepath.FromSlash(rel))
+		if !fsutil.InsideDir(repoPath, root) {
+			return nil, fmt.Errorf(".chezmoiroot points outside the repo: %s", rel)
+		}
+	}
+	if !dirExists(root) {
+		return nil, fmt.Errorf("chezmoi source directory %s doesn't exist", root)
+	}
+
+	state := &ChezmoiState{Root: root}
+	if err := state.loadData(); err != nil {
+		return nil, err
+	}
+	if err := state.loadTemplates(); err != nil {
+		return nil, err
+	}
+
+	ignore, err := state.loadIgnore()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := state.walk(root, "", ignore); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(state.Entries, func(i, j int) bool {
+		return state.Entries[i].Target < state.Entries[j].Target
+	})
+	return state, nil
+}
+
+// walk decodes one source directory, targetDir is where it lands
+func (s *ChezmoiState) walk(dir, targetDir string, ignore *chezmoiIgnore) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		// dotfiles in the source state are chezmoi's own (or git's)
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		source := filepath.Join(dir, name)
+		if entry.IsDir() {
+			decoded := parseChezmoiDir(name)
+			target := path.Join(targetDir, decoded.name)
+			if decoded.remove || ignore.match(target) {
+				continue
+			}
+			s.Entries = append(s.Entries, ChezmoiEntry{
+				Source: source,
+				Target: target,
+				Kind:   ChezmoiDir,
+				Mode:   decoded.mode,
+			})
+			if err := s.walk(source, target, ignore); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		e := parseChezmoiFile(name)
+		e.Source = source
+		if e.Kind == ChezmoiScript {
+			// scripts have no target, keep them so callers can say what was skipped
+			e.Target = path.Join(targetDir, name)
+			s.Entries = append(s.Entries, e)
+			continue
+		}
+		e.Target = path.Join(targetDir, e.Target)
+		if ignore.match(e.Target) {
+			continue
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	return nil
+}
+
+// chezmoiDirName is a decoded directory name
+type chezmoiDirName struct {
+	name   string
+	mode   fs.FileMode
+	remove bool
+}
+
+// parseChezmoiDir strips the attribute prefixes from a directory name
+func parseChezmoiDir(name string) chezmoiDirName {
+	d := chezmoiDirName{}
+	var private, readonly bool
+	for {
+		switch {
+		case strings.HasPrefix(name, "remove_"):
+			d.remove = true
+			name = strings.TrimPrefix(name, "remove_")
+		case strings.HasPrefix(name, "external_"):
+			name = strings.TrimPrefix(name, "external_")
+		case strings.HasPrefix(name, "exact_"):
+			// we never delete what the source doesn't list
+			name = strings.TrimPrefix(name, "exact_")
+		case strings.HasPrefix(name, "private_"):
+			private = true
+			name = strings.TrimPrefix(name, "private_")
+		case strings.HasPrefix(name, "readonly_"):
+			readonly = true
+			name = strings.TrimPrefix(name, "readonly_")
+		default:
+			d.name = chezmoiBaseName(name)
+			d.mode = chezmoiMode(0755, private, readonly, false)
+			return d
+		}
+	}
+}
+
+// parseChezmoiFile decodes a file name's prefixes and suffixes
+// Target is just the decoded base name, the caller adds the directory
+func parseChezmoiFile(name string) ChezmoiEntry {
+	e := ChezmoiEntry{Kind: ChezmoiFile}
+	var private, readonly, executable bool
+
+	switch {
+	case strings.HasPrefix(name, "create_"):
+		e.Kind = ChezmoiCreate
+		name = strings.TrimPrefix(name, "create_")
+	case strings.HasPrefix(name, "modify_"):
+		e.Kind = ChezmoiModify
+		name = strings.TrimPrefix(name, "modify_")
+	case strings.HasPrefix(name, "remove_"):
+		e.Kind = ChezmoiRemove
+		name = strings.TrimPrefix(name, "remove_")
+	case strings.HasPrefix(name, "run_"):
+		e.Kind = ChezmoiScript
+		name = strings.TrimPrefix(name, "run_")
+	case strings.HasPrefix(name, "symlink_"):
+		e.Kind = ChezmoiSymlink
+		name = strings.TrimPrefix(name, "symlink_")
+	}
+
+	literal := false
+	for !literal {
+		switch {
+		case strings.HasPrefix(name, "encrypted_"):
+			e.Encrypted = true
+			name = strings.TrimPrefix(name, "encrypted_")
+		case strings.HasPrefix(name, "private_"):
+			private = true
+			name = strings.TrimPrefix(name, "private_")
+		case strings.HasPrefix(name, "readonly_"):
+			readonly = true
+			name = strings.TrimPrefix(name, "readonly_")
+		case strings.HasPrefix(name, "executable_"):
+			executable = true
+			name = strings.TrimPrefix(name, "executable_")
+		case strings.HasPrefix(name, "empty_"):
+			// chezmoi deletes empty targets without it, we always copy
+			name = strings.TrimPrefix(name, "empty_")
+		case strings.HasPrefix(name, "once_"), strings.HasPrefix(name, "onchange_"),
+			strings.HasPrefix(name, "before_"), strings.HasPrefix(name, "after_"):
+			if e.Kind != ChezmoiScript {
+				literal = true
+				break
+			}
+			_, name, _ = strings.Cut(name, "_")
+		default:
+			literal = true
+		}
+	}
+	e.Mode = chezmoiMode(0644, private, readonly, executable)
+
+	// suffixes, .literal stops the parsing like literal_ does for prefixes
+	if trimmed, ok := strings.CutSuffix(name, ".literal"); ok {
+		name = trimmed
+	} else {
+		if trimmed, ok := strings.CutSuffix(name, ".tmpl"); ok {
+			e.Template = true
+			name = trimmed
+		}
+		if e.Encrypted {
+			for _, ext := range []string{".age", ".asc"} {
+				name = strings.TrimSuffix(name, ext)
+			}
+		}
+	}
+
+	e.Target = chezmoiBaseName(name)
+	return e
+}
+
+// chezmoiMode applies the permission attributes to a default mode
+func chezmoiMode(mode fs.FileMode, private, readonly, executable bool) fs.FileMode {
+	if executable {
+		mode |= 0111
+	}
+	if private {
+		mode &^= 0077
+	}
+	if readonly {
+		mode &^= 0222
+	}
+	return mode
+}
+
+// chezmoiBaseName turns dot_ into a leading dot, literal_ keeps the rest as is
+func chezmoiBaseName(name string) string {
+	if rest, ok := strings.CutPrefix(name, "literal_"); ok {
+		return rest
+	}
+	if rest, ok := strings.CutPrefix(name, "dot_"); ok {
+		return "." + rest
+	}
+	return name
+}
+
+// Lookup finds the entry for a target path (slash-separated, relative to home)
+func (s *ChezmoiState) Lookup(target string) (ChezmoiEntry, bool) {
+	target = normalizeTarget(target)
+	i := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].Target >= target })
+	if i < len(s.Entries) && s.Entries[i].Target == target {
+		return s.Entries[i], true
+	}
+	return ChezmoiEntry{}, false
+}
+
+// Under returns the entries at or inside target, empty or "." means all
+func (s *ChezmoiState) Under(target string) []ChezmoiEntry {
+	target = normalizeTarget(target)
+	var entries []ChezmoiEntry
+	for _, e := range s.Entries {
+		if target == "." || e.Target == target || strings.HasPrefix(e.Target, target+"/") {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// normalizeTarget makes a manifest path comparable with entry targets
+func normalizeTarget(target string) string {
+	target = filepath.ToSlash(target)
+	target = strings.TrimPrefix(strings.TrimPrefix(target, "~"), "/")
+	return path.Clean(target)
+}
+
+// ChezmoiPlan is what applying part of a chezmoi source state comes down to
+type ChezmoiPlan struct {
+	// Files maps source files to targets, like a plain repo's file map
+	// rendered templates point into the render directory
+	Files map[string]string
+
+	// Attrs has the modes, symlinks and create-only flags, keyed by target
+	// directories only show up when they're private or read-only
+	Attrs map[string]FileAttrs
+
+	// Skipped lists targets we can't apply and why (scripts, encrypted files)
+	Skipped map[string]string
+}
+
+// Plan builds the file map for target (a manifest path such as
+// ".config/nvim" or "~/.zshrc"), templates are rendered into renderDir
+// returned targets keep target's spelling, so they resolve like other repos
+func (s *ChezmoiState) Plan(target, renderDir string) (*ChezmoiPlan, error) {
+	plan := &ChezmoiPlan{
+		Files:   make(map[string]string),
+		Attrs:   make(map[string]FileAttrs),
+		Skipped: make(map[string]string),
+	}
+
+	base := normalizeTarget(target)
+	for _, e := range s.Under(target) {
+		rel := strings.TrimPrefix(strings.TrimPrefix(e.Target, base), "/")
+		if base == "." {
+			rel = e.Target
+		}
+		dest := filepath.Join(target, filepath.FromSlash(rel))
+
+		if ok, why := e.applicable(); !ok {
+			plan.Skipped[dest] = why
+			continue
+		}
+
+		if e.Kind == ChezmoiDir {
+			if e.Mode != 0755 {
+				plan.Attrs[dest] = FileAttrs{Mode: e.Mode}
+			}
+			continue
+		}
+
+		source := e.Source
+		if e.Template {
+			rendered, err := s.Render(e)
+			if err != nil {
+				plan.Skipped[dest] = fmt.Sprintf("template: %v", err)
+				continue
+			}
+			source = filepath.Join(renderDir, filepath.FromSlash(e.Target))
+			if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+				return nil, fmt.Errorf("couldn't create render directory: %w", err)
+			}
+			if err := os.WriteFile(source, rendered, 0600); err != nil {
+				return nil, fmt.Errorf("couldn't write rendered %s: %w", e.Target, err)
+			}
+		}
+
+		plan.Files[source] = dest
+		plan.Attrs[dest] = FileAttrs{
+			Mode:       e.Mode,
+			Symlink:    e.Kind == ChezmoiSymlink,
+			CreateOnly: e.Kind == ChezmoiCreate,
+		}
+	}
+	return plan, nil
+}
+
+// Render returns an entry's contents, executing it if it's a template
+func (s *ChezmoiState) Render(e ChezmoiEntry) ([]byte, error) {
+	data, err := os.ReadFile(e.Source)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", e.Source, err)
+	}
+	if !e.Template {
+		return data, nil
+	}
+	return s.execute(filepath.Base(e.Source), string(data))
+}
+
+// execute runs a template with chezmoi's data and the functions we support
+func (s *ChezmoiState) execute(name, text string) ([]byte, error) {
+	tmpl := template.New(name).Option("missingkey=zero").Funcs(s.funcs())
+	for tname, body := range s.templates {
+		if _, err := tmpl.New(tname).Parse(body); err != nil {
+			return nil, fmt.Errorf("couldn't parse .chezmoitemplates/%s: %w", tname, err)
+		}
+	}
+	if _, err := tmpl.New(name).Parse(text); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, s.data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chezmoiEnv are the variables env can read, rendered files end up in the
+// preview and on disk so anything that might hold a secret stays out
+var chezmoiEnv = map[string]bool{
+	"HOME": true, "USER": true, "LOGNAME": true, "SHELL": true, "TERM": true,
+	"LANG": true, "EDITOR": true, "VISUAL": true, "PAGER": true,
+	"XDG_CONFIG_HOME": true, "XDG_DATA_HOME": true, "XDG_STATE_HOME": true,
+	"XDG_CACHE_HOME": true, "XDG_RUNTIME_DIR": true,
+}
+
+// funcs is the subset of chezmoi's template functions that need no secrets
+func (s *ChezmoiState) funcs() template.FuncMap {
+	return template.FuncMap{
+		"env": func(key string) string {
+			if !chezmoiEnv[key] {
+				return ""
+			}
+			return os.Getenv(key)
+		},
+		"lookPath": func(file string) string {
+			p, _ := exec.LookPath(file)
+			return p
+		},
+		"joinPath":  filepath.Join,
+		"include":   s.include,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"contains":  func(substr, str string) bool { return strings.Contains(str, substr) },
+		"hasPrefix": func(prefix, str string) bool { return strings.HasPrefix(str, prefix) },
+		"hasSuffix": func(suffix, str string) bool { return strings.HasSuffix(str, suffix) },
+		"quote":     func(str string) string { return fmt.Sprintf("%q", str) },
+	}
+}
+
+// include reads a file from the source directory for the include template
+// function, refusing anything outside it, symlinks included
+func (s *ChezmoiState) include(name string) (string, error) {
+	path := filepath.Join(s.Root, filepath.FromSlash(name))
+	if !fsutil.InsideDir(s.Root, path) {
+		return "", fmt.Errorf("include %q is outside the source directory", name)
+	}
+	root, err := filepath.EvalSymlinks(s.Root)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !fsutil.InsideDir(root, real) {
+		return "", fmt.Errorf("include %q is outside the source directory", name)
+	}
+
+	data, err := os.ReadFile(real)
+	return string(data), err
+}
+
+// loadData builds the template data: .chezmoi.* about this machine plus
+// .chezmoidata.json and .chezmoidata/*.json merged on top
+func (s *ChezmoiState) loadData() error {
+	home, _ := os.UserHomeDir()
+	fqdn, _ := os.Hostname()
+	hostname, _, _ := strings.Cut(fqdn, ".")
+	username := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	s.data = map[string]any{
+		"chezmoi": map[string]any{
+			"os":           runtime.GOOS,
+			"arch":         runtime.GOARCH,
+			"hostname":     hostname,
+			"fqdnHostname": fqdn,
+			"username":     username,
+			"homeDir":      home,
+			"sourceDir":    s.Root,
+		},
+	}
+
+	files := []string{filepath.Join(s.Root, ".chezmoidata.json")}
+	if more, err := filepath.Glob(filepath.Join(s.Root, ".chezmoidata", "*.json")); err == nil {
+		sort.Strings(more)
+		files = append(files, more...)
+	}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var data map[string]any
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("couldn't parse %s: %w", filepath.Base(file), err)
+		}
+		for k, v := range data {
+			if k != "chezmoi" {
+				s.data[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+// loadTemplates reads the shared templates in .chezmoitemplates
+func (s *ChezmoiState) loadTemplates() error {
+	s.templates = make(map[string]string)
+	dir := filepath.Join(s.Root, ".chezmoitemplates")
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		s.templates[filepath.ToSlash(rel)] = string(body)
+		return nil
+	})
+}
+
+// chezmoiIgnore holds .chezmoiignore patterns, matched against targets
+type chezmoiIgnore struct {
+	include []string
+	exclude []string
+}
+
+// loadIgnore reads .chezmoiignore, which is always a template
+func (s *ChezmoiState) loadIgnore() (*chezmoiIgnore, error) {
+	ignore := &chezmoiIgnore{}
+	raw, err := os.ReadFile(filepath.Join(s.Root, ".chezmoiignore"))
+	if err != nil {
+		return ignore, nil
+	}
+	text, err := s.execute(".chezmoiignore", string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't render .chezmoiignore: %w", err)
+	}
+
+	for _, line := range strings.Split(string(text), "\n") {
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			ignore.exclude = append(ignore.exclude, strings.Trim(rest, "/"))
+		} else {
+			ignore.include = append(ignore.include, strings.Trim(line, "/"))
+		}
+	}
+	return ignore, nil
+}
+
+// match reports whether a target is ignored
+// a pattern matching a directory ignores everything inside it
+func (ig *chezmoiIgnore) match(target string) bool {
+	matchAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			if globMatch(p, target) {
+				return true
+			}
+		}
+		return false
+	}
+	if matchAny(ig.exclude) {
+		return false
+	}
+	for dir := target; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, p := range ig.include {
+			if globMatch(p, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globMatch matches a slash-separated name against a pattern where ** spans
+// any number of directories and everything else follows path.Match
+func globMatch(pattern, name string) bool {
+	return globSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func globSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if globSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,324 @@
+package manifest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeTree creates files under dir, keyed by slash-separated path
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestDecodeChezmoi(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".chezmoiroot":                           "home\n",
+		"README.md":                              "my dots\n",
+		"home/.chezmoidata.json":                 `{"editor": "nvim"}`,
+		"home/.chezmoiignore":                    "*.md\n{{ if ne .chezmoi.os \"plan9\" }}.plan9rc{{ end }}\n",
+		"home/.chezmoitemplates/header":          "# managed",
+		"home/dot_config/nvim/init.lua":          "-- nvim\n",
+		"home/dot_config/nvim/lua/plugins.lua":   "return {}\n",
+		"home/private_dot_ssh/config":            "Host *\n",
+		"home/private_dot_ssh/encrypted_id.age":  "secret",
+		"home/dot_local/bin/executable_hello":    "#!/bin/sh\n",
+		"home/symlink_dot_vimrc":                 ".config/nvim/init.lua\n",
+		"home/create_dot_gitconfig.local":        "[user]\n",
+		"home/readonly_dot_hushlogin":            "",
+		"home/dot_zshrc.tmpl":                    "{{ template \"header\" }}\nexport EDITOR={{ .editor }}\n",
+		"home/literal_dot_dot_literal":           "x\n",
+		"home/run_once_install.sh":               "#!/bin/sh\n",
+		"home/modify_dot_bashrc":                 "#!/bin/sh\n",
+		"home/notes.md":                          "ignored\n",
+		"home/dot_plan9rc":                       "ignored\n",
+		"home/.git-hooks/pre-commit":             "not source state\n",
+		"home/exact_dot_vim/autoload/plug.vim":   "\" plug\n",
+		"home/private_readonly_dot_netrc":        "machine x\n",
+		"home/dot_config/private_gh/hosts.yml":   "github.com:\n",
+		"home/dot_config/nvim/executable_run.sh": "#!/bin/sh\n",
+	})
+
+	state, err := DecodeChezmoi(repo)
+	if err != nil {
+		t.Fatalf("DecodeChezmoi: %v", err)
+	}
+	if state.Root != filepath.Join(repo, "home") {
+		t.Errorf("expected .chezmoiroot to move the root, got %s", state.Root)
+	}
+
+	tests := []struct {
+		target string
+		source string
+		kind   ChezmoiKind
+		mode   fs.FileMode
+	}{
+		{".config/nvim", "dot_config/nvim", ChezmoiDir, 0755},
+		{".config/nvim/init.lua", "dot_config/nvim/init.lua", ChezmoiFile, 0644},
+		{".config/nvim/run.sh", "dot_config/nvim/executable_run.sh", ChezmoiFile, 0755},
+		{".config/gh", "dot_config/private_gh", ChezmoiDir, 0700},
+		{".ssh", "private_dot_ssh", ChezmoiDir, 0700},
+		{".ssh/config", "private_dot_ssh/config", ChezmoiFile, 0644},
+		{".local/bin/hello", "dot_local/bin/executable_hello", ChezmoiFile, 0755},
+		{".vimrc", "symlink_dot_vimrc", ChezmoiSymlink, 0},
+		{".gitconfig.local", "create_dot_gitconfig.local", ChezmoiCreate, 0644},
+		{".hushlogin", "readonly_dot_hushlogin", ChezmoiFile, 0444},
+		{".netrc", "private_readonly_dot_netrc", ChezmoiFile, 0400},
+		{".zshrc", "dot_zshrc.tmpl", ChezmoiFile, 0644},
+		{"dot_dot_literal", "literal_dot_dot_literal", ChezmoiFile, 0644},
+		{".vim/autoload/plug.vim", "exact_dot_vim/autoload/plug.vim", ChezmoiFile, 0644},
+	}
+	for _, tt := range tests {
+		e, ok := state.Lookup(tt.target)
+		if !ok {
+			t.Errorf("%s: not found", tt.target)
+			continue
+		}
+		if want := filepath.Join(state.Root, filepath.FromSlash(tt.source)); e.Source != want {
+			t.Errorf("%s: expected source %s, got %s", tt.target, want, e.Source)
+		}
+		if e.Kind != tt.kind {
+			t.Errorf("%s: expected kind %d, got %d", tt.target, tt.kind, e.Kind)
+		}
+		if tt.kind != ChezmoiSymlink && e.Mode != tt.mode {
+			t.Errorf("%s: expected mode %o, got %o", tt.target, tt.mode, e.Mode)
+		}
+	}
+
+	for _, target := range []string{"notes.md", ".plan9rc", "README.md", ".git-hooks/pre-commit", ".chezmoidata.json"} {
+		if _, ok := state.Lookup(target); ok {
+			t.Errorf("expected %s to be left out", target)
+		}
+	}
+
+	if e, ok := state.Lookup(".ssh/id"); !ok || !e.Encrypted {
+		t.Errorf("expected .ssh/id to be an encrypted entry, got %+v", e)
+	}
+	// scripts have no target of their own, they keep the source name
+	if e, ok := state.Lookup("run_once_install.sh"); !ok || e.Kind != ChezmoiScript {
+		t.Errorf("expected run_once_install.sh to be a script, got %+v", e)
+	}
+	if e, ok := state.Lookup("~/.bashrc"); !ok || e.Kind != ChezmoiModify {
+		t.Errorf("expected .bashrc to be a modify script, got %+v", e)
+	}
+
+	zshrc, _ := state.Lookup(".zshrc")
+	rendered, err := state.Render(zshrc)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if string(rendered) != "# managed\nexport EDITOR=nvim\n" {
+		t.Errorf("unexpected rendered .zshrc %q", rendered)
+	}
+}
+
+func TestChezmoiPlan(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".chezmoidata.json":                   `{"font": "Iosevka"}`,
+		"dot_config/nvim/init.lua":            "-- nvim\n",
+		"dot_config/nvim/executable_build.sh": "#!/bin/sh\n",
+		"dot_config/kitty/kitty.conf.tmpl":    "font_family {{ .font }}\n",
+		"private_dot_ssh/config":              "Host *\n",
+		"private_dot_ssh/encrypted_id.age":    "secret",
+		"symlink_dot_vimrc":                   ".config/nvim/init.lua\n",
+	})
+
+	state, err := DecodeChezmoi(repo)
+	if err != nil {
+		t.Fatalf("DecodeChezmoi: %v", err)
+	}
+	renderDir := t.TempDir()
+
+	plan, err := state.Plan(".config/nvim", renderDir)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	expected := map[string]string{
+		filepath.Join(repo, "dot_config/nvim/init.lua"):            filepath.Join(".config/nvim", "init.lua"),
+		filepath.Join(repo, "dot_config/nvim/executable_build.sh"): filepath.Join(".config/nvim", "build.sh"),
+	}
+	if len(plan.Files) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, plan.Files)
+	}
+	for source, target := range expected {
+		if plan.Files[source] != target {
+			t.Errorf("%s: expected %s, got %s", source, target, plan.Files[source])
+		}
+	}
+	if mode := plan.Attrs[filepath.Join(".config/nvim", "build.sh")].Mode; mode != 0755 {
+		t.Errorf("expected build.sh to be executable, got %o", mode)
+	}
+
+	// templates are rendered, targets keep the manifest's spelling
+	plan, err = state.Plan("~/.config/kitty", renderDir)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	for source, target := range plan.Files {
+		if target != filepath.Join("~/.config/kitty", "kitty.conf") {
+			t.Errorf("unexpected target %s", target)
+		}
+		data, err := os.ReadFile(source)
+		if err != nil || string(data) != "font_family Iosevka\n" {
+			t.Errorf("expected the rendered template, got %q (%v)", data, err)
+		}
+	}
+
+	// private directories get their mode, encrypted files are skipped
+	plan, err = state.Plan(".ssh", renderDir)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(plan.Files) != 1 {
+		t.Errorf("expected just .ssh/config, got %v", plan.Files)
+	}
+	if mode := plan.Attrs[".ssh"].Mode; mode != 0700 {
+		t.Errorf("expected .ssh to be 0700, got %o", mode)
+	}
+	if why := plan.Skipped[filepath.Join(".ssh", "id")]; why != "encrypted" {
+		t.Errorf("expected .ssh/id to be skipped as encrypted, got %q", why)
+	}
+
+	plan, err = state.Plan(".vimrc", renderDir)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if !plan.Attrs[".vimrc"].Symlink {
+		t.Errorf("expected .vimrc to be a symlink, got %+v", plan.Attrs)
+	}
+}
+
+func TestResolveFilePathChezmoi(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".chezmoiignore":                 "",
+		"dot_config/nvim/init.lua":       "-- nvim\n",
+		"private_dot_config/gh/config":   "",
+		"dot_tmux.conf":                  "set -g mouse on\n",
+		"dot_config/private_fish/a.fish": "",
+	})
+
+	if structure := DetectStructure(repo); structure != StructureChezmoi {
+		t.Fatalf("expected chezmoi, got %d", structure)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{".config/nvim", "dot_config/nvim"},
+		{".tmux.conf", "dot_tmux.conf"},
+		{".config/fish", "dot_config/private_fish"},
+	}
+	for _, tt := range tests {
+		got, ok := ResolveFilePath(repo, tt.path, nil, StructureChezmoi)
+		if !ok {
+			t.Errorf("%s: not found", tt.path)
+			continue
+		}
+		if want := filepath.Join(repo, filepath.FromSlash(tt.expected)); got != want {
+			t.Errorf("%s: expected %s, got %s", tt.path, want, got)
+		}
+	}
+}
+
+func TestChezmoiMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+	tests := []struct {
+		base                          fs.FileMode
+		private, readonly, executable bool
+		expected                      fs.FileMode
+	}{
+		{0644, false, false, false, 0644},
+		{0644, true, false, false, 0600},
+		{0644, false, true, false, 0444},
+		{0644, false, false, true, 0755},
+		{0644, true, false, true, 0700},
+		{0644, true, true, true, 0500},
+		{0755, true, false, false, 0700},
+	}
+	for _, tt := range tests {
+		if got := chezmoiMode(tt.base, tt.private, tt.readonly, tt.executable); got != tt.expected {
+			t.Errorf("chezmoiMode(%o, %v, %v, %v) = %o, want %o",
+				tt.base, tt.private, tt.readonly, tt.executable, got, tt.expected)
+		}
+	}
+}
+
+func TestChezmoiTemplateConfinement(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "dots")
+	writeTree(t, dir, map[string]string{
+		"secret":                   "hunter2\n",
+		"dots-evil/dot_bashrc":     "sibling\n",
+		"dots/.chezmoitemplates/x": "",
+		"dots/colors":              "dark\n",
+		"dots/dot_a.tmpl":          `{{ include "colors" }}`,
+		"dots/dot_b.tmpl":          `{{ include "../secret" }}`,
+		"dots/dot_c.tmpl":          `{{ include "leak" }}`,
+		"dots/dot_d.tmpl":          `{{ env "DOTPICKER_TEST_TOKEN" }}|{{ env "HOME" }}`,
+	})
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(repo, "leak")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOTPICKER_TEST_TOKEN", "hunter2")
+	t.Setenv("HOME", "/home/test")
+
+	state, err := DecodeChezmoi(repo)
+	if err != nil {
+		t.Fatalf("DecodeChezmoi: %v", err)
+	}
+
+	tests := []struct {
+		target   string
+		expected string
+		wantErr  bool
+	}{
+		{target: ".a", expected: "dark\n"},
+		{target: ".b", wantErr: true},
+		{target: ".c", wantErr: true},
+		{target: ".d", expected: "|/home/test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e, ok := state.Lookup(tt.target)
+			if !ok {
+				t.Fatalf("%s: not found", tt.target)
+			}
+			got, err := state.Render(e)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, rendered %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// a sibling directory sharing the repo's name as a prefix isn't inside it
+	writeTree(t, repo, map[string]string{".chezmoiroot": "../dots-evil\n"})
+	if _, err := DecodeChezmoi(repo); err == nil {
+		t.Error("expected .chezmoiroot pointing at a sibling directory to be rejected")
+	}
+}
@@ -2,8 +2,10 @@
 package manifest
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/milxzy/dotfile-picker/internal/logger"
@@ -25,64 +27,122 @@ const (
 	// StructureChezmoi means chezmoi-managed dotfiles
 	StructureChezmoi
 
-	// StructureBareRepo means a bare git repo with worktree
+	// StructureBareRepo means the repo's tree is the home directory, as with
+	// yadm or a bare repo checked out into $HOME (##alternates are resolved)
 	StructureBareRepo
 
 	// StructureConfig means all files in a single config directory
 	StructureConfig
+
+	// StructureDotbot means dotbot, links are declared in install.conf.yaml
+	StructureDotbot
+
+	// StructureRcm means an rcm dotfiles dir (rcrc, tag-*, host-*)
+	StructureRcm
+
+	// StructureHomeshick means a homeshick castle, files live under home/
+	StructureHomeshick
 )
 
-// DetectStructure tries to figure out how the repo is organized
-// this helps us find files when paths aren't specified in manifest
-func DetectStructure(repoPath string) RepoStructure {
+// Candidate is a layout the repo might use, with how sure we are and why
+type Candidate struct {
+	Structure RepoStructure
+	Score     int      // 0-100
+	Evidence  []string // e.g. "found 7 package dirs containing dotfiles"
+}
+
+// note adds points to the candidate along with what earned them
+func (c *Candidate) note(points int, format string, args ...any) {
+	c.Score = min(c.Score+points, 100)
+	c.Evidence = append(c.Evidence, fmt.Sprintf(format, args...))
+}
+
+// detectors score every layout we know, in the order ties are broken:
+// layouts with their own metadata beat ones guessed from directory names
+var detectors = []func(repoPath string) Candidate{
+	scoreChezmoi,
+	scoreDotbot,
+	scoreRcm,
+	scoreHomeshick,
+	scoreYadm,
+	scoreStow,
+	scoreConfig,
+	scoreFlat,
+}
+
+// DetectStructures scores every layout the repo might use and returns the
+// ones with any evidence, most likely first
+func DetectStructures(repoPath string) []Candidate {
 	logger.Debug("Detecting repository structure for: %s", repoPath)
 	logger.DirListing(repoPath, "  ")
 
-	// check for chezmoi - has .chezmoi.toml or .chezmoiroot
-	logger.Debug("Checking for chezmoi indicators...")
-	if fileExists(filepath.Join(repoPath, ".chezmoi.toml")) ||
-		fileExists(filepath.Join(repoPath, ".chezmoiroot")) {
-		logger.Info("Detected structure: CHEZMOI")
-		return StructureChezmoi
-	}
-	logger.Debug("  No chezmoi indicators found")
-
-	// check for stow layout - multiple top-level dirs with config structure
-	logger.Debug("Checking for stow layout...")
-	if looksLikeStow(repoPath) {
-		logger.Info("Detected structure: STOW")
-		return StructureStow
+	var candidates []Candidate
+	for _, detect := range detectors {
+		c := detect(repoPath)
+		if c.Score == 0 {
+			continue
+		}
+		logger.Debug("  %s: %d (%s)", c.Structure, c.Score, strings.Join(c.Evidence, "; "))
+		candidates = append(candidates, c)
 	}
-	logger.Debug("  Not a stow layout")
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
 
-	// check if there's a single config directory
-	logger.Debug("Checking for config directory...")
-	configDir := filepath.Join(repoPath, "config")
-	if dirExists(configDir) {
-		logger.Info("Detected structure: CONFIG (single config directory)")
-		logger.DirListing(configDir, "  ")
-		return StructureConfig
+// DetectStructure tries to figure out how the repo is organized
+// this helps us find files when paths aren't specified in manifest
+func DetectStructure(repoPath string) RepoStructure {
+	candidates := DetectStructures(repoPath)
+	if len(candidates) == 0 {
+		logger.Warn("Could not detect repository structure - will use manual browsing")
+		return StructureUnknown
 	}
-	logger.Debug("  No config directory found")
+	logger.Info("Detected structure: %s (%d%%)", candidates[0].Structure, candidates[0].Score)
+	return candidates[0].Structure
+}
 
-	// check for flat layout - dotfiles at root
-	logger.Debug("Checking for flat layout (dotfiles at root)...")
-	if hasDotfilesAtRoot(repoPath) {
-		logger.Info("Detected structure: FLAT (dotfiles at root)")
-		return StructureFlat
+// String names a structure for logs and the tui
+func (s RepoStructure) String() string {
+	switch s {
+	case StructureFlat:
+		return "flat"
+	case StructureStow:
+		return "stow"
+	case StructureChezmoi:
+		return "chezmoi"
+	case StructureBareRepo:
+		return "yadm"
+	case StructureConfig:
+		return "config"
+	case StructureDotbot:
+		return "dotbot"
+	case StructureRcm:
+		return "rcm"
+	case StructureHomeshick:
+		return "homeshick"
+	default:
+		return "unknown"
 	}
-	logger.Debug("  No dotfiles at root")
-
-	// couldn't detect
-	logger.Warn("Could not detect repository structure - will use manual browsing")
-	return StructureUnknown
 }
 
 // ResolveFilePath tries to find a dotfile in the repo
-// uses the detected structure to search intelligently
+// uses the detected structures to search intelligently, trying them in
+// the order given (see DetectStructures)
+// layout is the repo's decoded declared layout, nil when it has none, so
+// callers resolving many paths decode it once
 // accepts both files and directories
-func ResolveFilePath(repoPath, relativePath string, structure RepoStructure) (string, bool) {
-	logger.Debug("Resolving file path: %s (structure: %v)", relativePath, structure)
+func ResolveFilePath(repoPath, relativePath string, layout *Layout, structures ...RepoStructure) (string, bool) {
+	logger.Debug("Resolving file path: %s (structures: %v)", relativePath, structures)
+
+	// repos that declare where their files go are taken at their word
+	if layout != nil {
+		if source, ok := layout.Lookup(relativePath); ok {
+			logger.Info("  ✓ FOUND via declared %s layout: %s", layout.Structure, source)
+			return source, true
+		}
+	}
 
 	// first try the exact path from manifest
 	exactPath := filepath.Join(repoPath, relativePath)
@@ -105,11 +165,6 @@ func ResolveFilePath(repoPath, relativePath string, structure RepoStructure) (st
 	}
 
 	// try common directory aliases (e.g., .config -> xdg_config, ~ -> home)
-	pathAliases := map[string][]string{
-		".config": {"xdg_config", "config"},
-		"~":       {"home"},
-	}
-
 	for pattern, replacements := range pathAliases {
 		if strings.Contains(relativePath, pattern) {
 			for _, replacement := range replacements {
@@ -127,141 +182,319 @@ func ResolveFilePath(repoPath, relativePath string, structure RepoStructure) (st
 
 	// search based on structure
 	logger.Debug("  Searching using structure-specific logic...")
-	var result string
-	var found bool
+	for _, structure := range structures {
+		if result, found := findInStructure(repoPath, relativePath, structure); found {
+			logger.Info("  ✓ FOUND via %s search: %s", structure, result)
+			return result, true
+		}
+	}
+
+	logger.Warn("  ✗ NOT FOUND: %s", relativePath)
+	return "", false
+}
 
+// findInStructure searches the places one structure keeps its files
+func findInStructure(repoPath, relativePath string, structure RepoStructure) (string, bool) {
 	switch structure {
 	case StructureStow:
-		result, found = findInStow(repoPath, relativePath)
+		return findInStow(repoPath, relativePath)
 	case StructureChezmoi:
-		result, found = findInChezmoi(repoPath, relativePath)
+		return findInChezmoi(repoPath, relativePath)
 	case StructureConfig:
 		configPath := filepath.Join(repoPath, "config", relativePath)
 		logger.Debug("    Trying config directory: %s", configPath)
 		if pathExists(configPath) {
-			logger.Info("  ✓ FOUND in config directory: %s", configPath)
 			return configPath, true
 		}
 		logger.Debug("      Not found")
-		return "", false
 	case StructureFlat:
 		// already tried at root
 		logger.Debug("    Flat structure - already checked at root")
+	}
+	return "", false
+}
+
+// pathAliases maps path components to the directory names repos use instead
+var pathAliases = map[string][]string{
+	".config": {"xdg_config", "config"},
+	"~":       {"home"},
+}
+
+// findInStow decodes the stow packages and returns the one source providing
+// a target path; a target more than one package provides as a file is a
+// conflict, only resolved when the path names the package first, like
+// git-work/.gitconfig
+func findInStow(repoPath, relativePath string) (string, bool) {
+	logger.Debug("    Searching in stow packages...")
+	state, err := DecodeStow(repoPath, nil)
+	if err != nil {
+		logger.Debug("      Couldn't decode stow packages: %v", err)
 		return "", false
 	}
 
-	if found {
-		logger.Info("  ✓ FOUND via structure search: %s", result)
-	} else {
-		logger.Warn("  ✗ NOT FOUND: %s", relativePath)
+	found := state.Lookup(relativePath)
+	if len(found) == 0 {
+		return findInStowPackage(state, relativePath)
 	}
+	for _, e := range found {
+		if !e.Dir && len(found) > 1 {
+			var packages []string
+			for _, e := range found {
+				packages = append(packages, e.Package)
+			}
+			logger.Warn("      %s is provided by packages %s, not picking one", relativePath, strings.Join(packages, ", "))
+			return "", false
+		}
+	}
+	// a directory in several packages is merged by stow, see StowState.Plan
+	logger.Debug("      ✓ Found in package: %s", found[0].Package)
+	return found[0].Source, true
+}
 
-	return result, found
+// findInStowPackage looks a path naming its package first up in that package
+func findInStowPackage(state *StowState, relativePath string) (string, bool) {
+	pkg, rest, ok := state.splitPackage(relativePath)
+	if ok {
+		for _, e := range state.Lookup(rest) {
+			if e.Package == pkg {
+				logger.Debug("      ✓ Found in named package: %s", pkg)
+				return e.Source, true
+			}
+		}
+	}
+	logger.Debug("      Not found in any stow package")
+	return "", false
 }
 
-// looksLikeStow checks if the repo uses GNU Stow layout
-// stow repos have multiple top-level dirs like "vim", "tmux", etc
-func looksLikeStow(repoPath string) bool {
-	entries, err := os.ReadDir(repoPath)
+// findInChezmoi decodes the chezmoi source state and returns the source
+// file or directory for a target path like .config/nvim
+func findInChezmoi(repoPath, relativePath string) (string, bool) {
+	state, err := DecodeChezmoi(repoPath)
 	if err != nil {
-		return false
+		logger.Debug("    Couldn't decode chezmoi source state: %v", err)
+		return "", false
 	}
 
-	// count directories that look like package names
-	packageDirs := 0
-	var foundPackages []string
+	entry, ok := state.Lookup(relativePath)
+	if !ok {
+		return "", false
+	}
+	logger.Debug("    chezmoi source for %s: %s", relativePath, entry.Source)
+	return entry.Source, true
+}
 
+// scoreChezmoi looks for chezmoi's source state files, or top-level names
+// like dot_zshrc or private_dot_ssh that decode to dotfiles
+// a bare .chezmoi.toml is only chezmoi's config, lots of repos carry one
+func scoreChezmoi(repoPath string) Candidate {
+	c := Candidate{Structure: StructureChezmoi}
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return c
+	}
+
+	var encoded []string
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".chezmoi") {
+			if isChezmoiConfig(name) {
+				c.note(15, "found %s (chezmoi's config)", name)
+			} else {
+				c.note(40, "found %s", name)
+			}
 			continue
 		}
 
-		name := entry.Name()
-		// skip hidden dirs and git dirs
-		if strings.HasPrefix(name, ".") || name == "scripts" || name == "bin" {
-			continue
+		var decoded string
+		if entry.IsDir() {
+			decoded = parseChezmoiDir(name).name
+		} else {
+			decoded = parseChezmoiFile(name).Target
 		}
+		if decoded != name && strings.HasPrefix(decoded, ".") {
+			encoded = append(encoded, name)
+		}
+	}
+	if len(encoded) > 0 {
+		c.note(min(20*len(encoded), 60), "found %d chezmoi-encoded names like %s", len(encoded), encoded[0])
+	}
+	return c
+}
 
-		// check if this dir has config-like files
-		pkgPath := filepath.Join(repoPath, name)
-		if hasConfigFiles(pkgPath) {
-			packageDirs++
-			foundPackages = append(foundPackages, name)
+// isChezmoiConfig reports whether name is chezmoi's config file rather
+// than part of a source state; .chezmoi.toml.tmpl generates one, so it is
+func isChezmoiConfig(name string) bool {
+	for _, ext := range []string{".toml", ".yaml", ".yml", ".json", ".jsonc"} {
+		if name == ".chezmoi"+ext {
+			return true
 		}
 	}
+	return false
+}
 
-	// if we found multiple package-like directories, it's probably stow
-	isStow := packageDirs >= 2
-	if isStow {
-		logger.Debug("  Found %d package directories: %v", packageDirs, foundPackages)
+// scoreDotbot looks for dotbot's install configs and script
+func scoreDotbot(repoPath string) Candidate {
+	c := Candidate{Structure: StructureDotbot}
+	files, _ := dotbotConfigFiles(repoPath)
+	for _, file := range files {
+		c.note(70, "found %s", filepath.Base(file))
+	}
+	if c.Score > 0 && dirExists(filepath.Join(repoPath, "dotbot")) {
+		c.note(20, "found the dotbot submodule")
 	}
-	return isStow
+	return c
 }
 
-// findInStow searches for a file or directory in stow-style layout
-func findInStow(repoPath, relativePath string) (string, bool) {
-	logger.Debug("    Searching in stow packages...")
+// scoreRcm looks for an rcrc, and rcm's tag-* and host-* directories
+func scoreRcm(repoPath string) Candidate {
+	c := Candidate{Structure: StructureRcm}
+	if fileExists(filepath.Join(repoPath, "rcrc")) {
+		c.note(70, "found rcrc")
+	}
 	entries, err := os.ReadDir(repoPath)
 	if err != nil {
-		logger.Debug("      Failed to read directory: %v", err)
-		return "", false
+		return c
 	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && (strings.HasPrefix(name, "tag-") || strings.HasPrefix(name, "host-")) {
+			c.note(20, "found %s/", name)
+		}
+	}
+	return c
+}
 
-	// search in each package directory
+// scoreHomeshick looks for a castle's home/ directory holding dotfiles
+func scoreHomeshick(repoPath string) Candidate {
+	c := Candidate{Structure: StructureHomeshick}
+	entries, err := os.ReadDir(filepath.Join(repoPath, "home"))
+	if err != nil {
+		return c
+	}
+	dotfiles := 0
 	for _, entry := range entries {
-		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+		if strings.HasPrefix(entry.Name(), ".") {
+			dotfiles++
+		}
+	}
+	if dotfiles > 0 {
+		c.note(min(30+10*dotfiles, 80), "found %d dotfiles under home/", dotfiles)
+	}
+	return c
+}
+
+// scoreYadm looks for yadm's config dir or ## alternates near the root
+func scoreYadm(repoPath string) Candidate {
+	c := Candidate{Structure: StructureBareRepo}
+	for _, dir := range []string{".config/yadm", ".yadm"} {
+		if dirExists(filepath.Join(repoPath, filepath.FromSlash(dir))) {
+			c.note(60, "found %s/", dir)
+		}
+	}
+	alternates := 0
+	for _, dir := range []string{repoPath, filepath.Join(repoPath, ".config")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
 			continue
 		}
+		for _, entry := range entries {
+			if strings.Contains(entry.Name(), "##") {
+				alternates++
+			}
+		}
+	}
+	if alternates > 0 {
+		c.note(min(30+15*alternates, 75), "found %d ## alternates", alternates)
+	}
+	return c
+}
 
-		pkgPath := filepath.Join(repoPath, entry.Name(), relativePath)
-		logger.Debug("      Checking package '%s': %s", entry.Name(), pkgPath)
-		if pathExists(pkgPath) {
-			logger.Debug("      ✓ Found in package: %s", entry.Name())
-			return pkgPath, true
+// scoreStow looks for stow's own files (.stowrc, ignore lists) or several
+// top-level package dirs like "vim", "tmux" holding dotfiles
+func scoreStow(repoPath string) Candidate {
+	c := Candidate{Structure: StructureStow}
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return c
+	}
+
+	for _, name := range []string{".stowrc", ".stow-global-ignore", ".stow-local-ignore"} {
+		if fileExists(filepath.Join(repoPath, name)) {
+			c.note(70, "found %s", name)
 		}
 	}
 
-	logger.Debug("      Not found in any stow package")
-	return "", false
-}
+	// count directories that look like package names
+	var packages, xdg []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
 
-// findInChezmoi searches for a file in chezmoi layout
-func findInChezmoi(repoPath, relativePath string) (string, bool) {
-	// chezmoi uses "dot_" prefix for dotfiles
-	// so .vimrc becomes dot_vimrc
-	base := filepath.Base(relativePath)
-	dir := filepath.Dir(relativePath)
-
-	if strings.HasPrefix(base, ".") {
-		chezmoiName := "dot_" + strings.TrimPrefix(base, ".")
-		chezmoiPath := filepath.Join(repoPath, dir, chezmoiName)
-		if fileExists(chezmoiPath) {
-			return chezmoiPath, true
+		name := entry.Name()
+		// skip hidden dirs and git dirs
+		if strings.HasPrefix(name, ".") || name == "scripts" || name == "bin" {
+			continue
+		}
+
+		pkgPath := filepath.Join(repoPath, name)
+		if fileExists(filepath.Join(pkgPath, ".stow-local-ignore")) {
+			c.note(70, "found %s/.stow-local-ignore", name)
+		}
+
+		// check if this dir has config-like files
+		if hasConfigFiles(pkgPath) {
+			packages = append(packages, name)
+			if dirExists(filepath.Join(pkgPath, ".config")) || dirExists(filepath.Join(pkgPath, "dot-config")) {
+				xdg = append(xdg, name)
+			}
 		}
 	}
 
-	return "", false
+	// one package dir could be anything, several are probably stow
+	switch {
+	case len(xdg) >= 2:
+		c.note(min(15*len(packages)+10, 90), "found %d package dirs, %d containing .config", len(packages), len(xdg))
+	case len(packages) >= 2:
+		c.note(min(15*len(packages), 80), "found %d package dirs containing dotfiles", len(packages))
+	case len(packages) == 1:
+		c.note(10, "found a package dir (%s) containing dotfiles", packages[0])
+	}
+	return c
+}
+
+// scoreConfig looks for a single config directory
+func scoreConfig(repoPath string) Candidate {
+	c := Candidate{Structure: StructureConfig}
+	entries, err := os.ReadDir(filepath.Join(repoPath, "config"))
+	if err == nil && len(entries) > 0 {
+		c.note(25, "found a config directory with %d entries", len(entries))
+	}
+	return c
 }
 
-// hasDotfilesAtRoot checks if there are dotfiles at repo root
-func hasDotfilesAtRoot(repoPath string) bool {
+// scoreFlat counts the dotfiles at the repo root
+func scoreFlat(repoPath string) Candidate {
+	c := Candidate{Structure: StructureFlat}
 	entries, err := os.ReadDir(repoPath)
 	if err != nil {
-		return false
+		return c
 	}
 
-	dotfileCount := 0
+	dotfiles := 0
 	for _, entry := range entries {
 		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
 			// skip .git, .gitignore, etc
 			if entry.Name() == ".git" || entry.Name() == ".gitignore" || entry.Name() == ".github" {
 				continue
 			}
-			dotfileCount++
+			dotfiles++
 		}
 	}
-
-	return dotfileCount > 0
+	if dotfiles > 0 {
+		c.note(min(10*dotfiles, 50), "found %d dotfiles at the root", dotfiles)
+	}
+	return c
 }
 
 // hasConfigFiles checks if a directory contains config-like files
@@ -271,10 +504,10 @@ func hasConfigFiles(dirPath string) bool {
 		return false
 	}
 
-	// look for common config patterns
+	// look for common config patterns, dot- is stow's --dotfiles spelling
 	for _, entry := range entries {
 		name := entry.Name()
-		if strings.HasPrefix(name, ".") || strings.Contains(name, "config") {
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "dot-") || strings.Contains(name, "config") {
 			return true
 		}
 	}
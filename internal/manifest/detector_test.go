@@ -4,6 +4,7 @@ package manifest
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -76,7 +77,7 @@ func TestResolveFilePathWithDirectory(t *testing.T) {
 	}
 
 	// Try to resolve .config/nvim (a directory)
-	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", structure)
+	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", nil, structure)
 
 	if !found {
 		t.Errorf("ResolveFilePath didn't find .config/nvim directory in Stow layout")
@@ -110,7 +111,7 @@ func TestResolveFilePathWithFile(t *testing.T) {
 
 	structure := DetectStructure(tmpDir)
 
-	resolved, found := ResolveFilePath(tmpDir, ".tmux.conf", structure)
+	resolved, found := ResolveFilePath(tmpDir, ".tmux.conf", nil, structure)
 
 	if !found {
 		t.Error("ResolveFilePath didn't find .tmux.conf file")
@@ -137,7 +138,7 @@ func TestResolveFilePathWithAliases(t *testing.T) {
 	}
 
 	// Try to resolve .config/nvim (should find xdg_config/nvim)
-	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", StructureUnknown)
+	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", nil, StructureUnknown)
 	if !found {
 		t.Error("ResolveFilePath didn't find .config/nvim via xdg_config alias")
 	}
@@ -158,7 +159,7 @@ func TestResolveFilePathWithAliases(t *testing.T) {
 	}
 
 	// Try to resolve ~/.bashrc (should find home/.bashrc)
-	resolved, found = ResolveFilePath(tmpDir, "~/.bashrc", StructureUnknown)
+	resolved, found = ResolveFilePath(tmpDir, "~/.bashrc", nil, StructureUnknown)
 	if !found {
 		t.Error("ResolveFilePath didn't find ~/.bashrc via home alias")
 	}
@@ -177,7 +178,7 @@ func TestResolveFilePathWithAliases(t *testing.T) {
 		t.Fatalf("couldn't create tmux.conf: %v", err)
 	}
 
-	resolved, found = ResolveFilePath(tmpDir, ".config/tmux", StructureUnknown)
+	resolved, found = ResolveFilePath(tmpDir, ".config/tmux", nil, StructureUnknown)
 	if !found {
 		t.Error("ResolveFilePath didn't find .config/tmux via config alias")
 	}
@@ -199,7 +200,7 @@ func TestResolveFilePathWithEmptyDirectory(t *testing.T) {
 	}
 
 	// Try to resolve .config/nvim (should find the empty xdg_config/nvim via alias)
-	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", StructureUnknown)
+	resolved, found := ResolveFilePath(tmpDir, ".config/nvim", nil, StructureUnknown)
 
 	// Should find the directory even if it's empty
 	if !found {
@@ -230,3 +231,101 @@ func TestResolveFilePathWithEmptyDirectory(t *testing.T) {
 		t.Errorf("Expected empty directory, but found %d entries", len(entries))
 	}
 }
+
+// TestDetectStructures tests that every layout is scored and ranked
+func TestDetectStructures(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []RepoStructure // most likely first
+		evidence string          // expected in the winner's evidence
+	}{
+		{
+			name: "chezmoi config in a stow repo",
+			files: map[string]string{
+				".chezmoi.toml":                  "[data]\n",
+				"nvim/.config/nvim/init.lua":     "-- nvim\n",
+				"kitty/.config/kitty/kitty.conf": "font_size 12\n",
+				"zsh/.zshrc":                     "export EDITOR=nvim\n",
+			},
+			expected: []RepoStructure{StructureStow, StructureChezmoi, StructureFlat},
+			evidence: "found 3 package dirs, 2 containing .config",
+		},
+		{
+			name: "stow repo with a config package",
+			files: map[string]string{
+				"config/.config/git/config":  "[user]\n",
+				"nvim/.config/nvim/init.lua": "-- nvim\n",
+				"tmux/.tmux.conf":            "set -g mouse on\n",
+			},
+			expected: []RepoStructure{StructureStow, StructureConfig},
+			evidence: "found 3 package dirs, 2 containing .config",
+		},
+		{
+			name: "chezmoi source state",
+			files: map[string]string{
+				".chezmoiignore":         "README.md\n",
+				"dot_zshrc":              "export EDITOR=nvim\n",
+				"private_dot_ssh/config": "Host *\n",
+			},
+			expected: []RepoStructure{StructureChezmoi, StructureStow, StructureFlat},
+			evidence: "found .chezmoiignore",
+		},
+		{
+			name: "flat",
+			files: map[string]string{
+				".zshrc":     "export EDITOR=nvim\n",
+				".tmux.conf": "set -g mouse on\n",
+				".gitignore": "*.swp\n",
+			},
+			expected: []RepoStructure{StructureFlat},
+			evidence: "found 2 dotfiles at the root",
+		},
+		{
+			name:  "nothing to go on",
+			files: map[string]string{"README.md": "hi\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			writeTree(t, repo, tt.files)
+
+			candidates := DetectStructures(repo)
+			var got []RepoStructure
+			for _, c := range candidates {
+				got = append(got, c.Structure)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Fatalf("expected %v, got %v (%+v)", tt.expected, got, candidates)
+			}
+			if len(candidates) == 0 {
+				if structure := DetectStructure(repo); structure != StructureUnknown {
+					t.Errorf("expected unknown, got %s", structure)
+				}
+				return
+			}
+			if !slices.Contains(candidates[0].Evidence, tt.evidence) {
+				t.Errorf("expected evidence %q, got %v", tt.evidence, candidates[0].Evidence)
+			}
+		})
+	}
+}
+
+// TestResolveFilePathCandidates tests that each structure is tried in order
+func TestResolveFilePathCandidates(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"config/tmux/tmux.conf": "set -g mouse on\n",
+		"dot_zshrc":             "export EDITOR=nvim\n",
+	})
+
+	if _, found := ResolveFilePath(repo, ".zshrc", nil, StructureConfig); found {
+		t.Error("expected .zshrc not to be found in the config directory")
+	}
+	resolved, found := ResolveFilePath(repo, ".zshrc", nil, StructureConfig, StructureChezmoi)
+	if !found || resolved != filepath.Join(repo, "dot_zshrc") {
+		t.Errorf("expected the second candidate to find dot_zshrc, got %q", resolved)
+	}
+}
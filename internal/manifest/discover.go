@@ -0,0 +1,204 @@
+// package manifest proposes dotfile entries for repos nobody has listed
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// invalidIDChars matches what can't go in a manifest id
+var invalidIDChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// SlugID turns a name into an id the schema accepts: lowercased, with every
+// run of other characters as "-"; "" when nothing usable is left
+func SlugID(name string) string {
+	return strings.Trim(invalidIDChars.ReplaceAllString(strings.ToLower(name), "-"), "-_")
+}
+
+// knownDotfile is a config we know where to look for, and what it needs
+type knownDotfile struct {
+	id    string
+	name  string
+	paths []string
+	deps  []string
+}
+
+// knownDotfiles are the usual home locations of popular configs
+// only the paths a repo actually has end up in a proposal
+var knownDotfiles = []knownDotfile{
+	{"nvim", "neovim", []string{".config/nvim"}, []string{"neovim"}},
+	{"vim", "vim", []string{".vimrc", ".vim", ".config/vim"}, []string{"vim"}},
+	{"emacs", "emacs", []string{".emacs", ".emacs.d", ".config/emacs", ".config/doom", ".doom.d"}, []string{"emacs"}},
+	{"helix", "helix", []string{".config/helix"}, []string{"helix"}},
+	{"tmux", "tmux", []string{".tmux.conf", ".config/tmux"}, []string{"tmux"}},
+	{"zsh", "zsh", []string{".zshrc", ".zshenv", ".zprofile", ".config/zsh"}, []string{"zsh"}},
+	{"bash", "bash", []string{".bashrc", ".bash_profile", ".bash_aliases", ".inputrc"}, []string{"bash"}},
+	{"fish", "fish", []string{".config/fish"}, []string{"fish"}},
+	{"starship", "starship", []string{".config/starship.toml"}, []string{"starship"}},
+	{"git", "git", []string{".gitconfig", ".config/git"}, []string{"git"}},
+	{"kitty", "kitty", []string{".config/kitty"}, []string{"kitty"}},
+	{"alacritty", "alacritty", []string{".config/alacritty", ".alacritty.yml", ".alacritty.toml"}, []string{"alacritty"}},
+	{"wezterm", "wezterm", []string{".config/wezterm", ".wezterm.lua"}, []string{"wezterm"}},
+	{"i3", "i3", []string{".config/i3", ".i3", ".config/i3status", ".i3status.conf"}, []string{"i3-wm"}},
+	{"sway", "sway", []string{".config/sway"}, []string{"sway"}},
+	{"hyprland", "hyprland", []string{".config/hypr"}, []string{"hyprland"}},
+	{"waybar", "waybar", []string{".config/waybar"}, []string{"waybar"}},
+	{"polybar", "polybar", []string{".config/polybar"}, []string{"polybar"}},
+	{"rofi", "rofi", []string{".config/rofi"}, []string{"rofi"}},
+	{"x11", "x11", []string{".Xresources", ".xinitrc", ".Xdefaults"}, nil},
+}
+
+// Discover proposes dotfiles for a cloned repo: every known config the
+// repo has, then every directory it keeps under .config
+// xdgDirs are more config dir names to look for (config.XDGDirectories),
+// each one is guessed to need the program of the same name
+// paths are checked with ResolveFilePath against the detected layouts, so
+// the proposal only lists what the tui can actually find
+// ids are slugs of the directory names (which stay the names), made
+// unique with a number when two slug the same, e.g. Code and code
+func Discover(repoPath string, xdgDirs []string) []Dotfile {
+	var structures []RepoStructure
+	for _, c := range DetectStructures(repoPath) {
+		structures = append(structures, c.Structure)
+	}
+	// like the tui, only the detected structure's declared layout counts
+	var layout *Layout
+	if len(structures) > 0 {
+		layout = DecodeDeclaredLayout(repoPath, structures[0])
+	}
+
+	var dotfiles []Dotfile
+	claimed := make(map[string]bool) // target paths a proposal has
+	ids := make(map[string]bool)     // ids a proposal has
+	propose := func(id, name string, paths, deps []string) {
+		d := Dotfile{Name: name, Dependencies: deps}
+		var sources []string
+		for _, p := range paths {
+			if claimed[p] {
+				continue
+			}
+			source, ok := ResolveFilePath(repoPath, p, layout, structures...)
+			if !ok || isEmptyDir(source) {
+				continue
+			}
+			claimed[p] = true
+			d.Paths = append(d.Paths, PathSpec{Target: p})
+			if rel, err := filepath.Rel(repoPath, source); err == nil {
+				sources = append(sources, filepath.ToSlash(rel))
+			}
+		}
+		if len(d.Paths) == 0 {
+			return
+		}
+		if d.Dependencies == nil {
+			d.Dependencies = []string{}
+		}
+		if id == "" {
+			id = "config"
+		}
+		d.ID = id
+		for n := 2; ids[d.ID]; n++ {
+			d.ID = fmt.Sprintf("%s-%d", id, n)
+		}
+		ids[d.ID] = true
+		d.Description = "found at " + strings.Join(sources, ", ")
+		dotfiles = append(dotfiles, d)
+	}
+
+	known := make(map[string]bool)
+	for _, k := range knownDotfiles {
+		known[k.id] = true
+		propose(k.id, k.name, k.paths, k.deps)
+	}
+	for _, dir := range xdgDirs {
+		if !known[dir] {
+			known[dir] = true
+			propose(SlugID(dir), dir, []string{".config/" + dir}, []string{dir})
+		}
+	}
+	for _, dir := range configDirNames(repoPath, structures) {
+		if !known[dir] {
+			// no idea which program reads it
+			propose(SlugID(dir), dir, []string{".config/" + dir}, nil)
+		}
+	}
+	return dotfiles
+}
+
+// configDirNames lists the names a repo keeps under .config, wherever its
+// layout puts them: .config, config/, xdg_config/, stow packages, a
+// homeshick castle, chezmoi's dot_config or a declared layout's targets
+func configDirNames(repoPath string, structures []RepoStructure) []string {
+	names := make(map[string]bool)
+	addDir := func(dir string, decode func(string) string) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if decode != nil {
+				name = decode(name)
+			}
+			if entry.IsDir() && !strings.HasPrefix(name, ".") {
+				names[name] = true
+			}
+		}
+	}
+
+	for _, dir := range []string{".config", "config", "xdg_config", "home/.config"} {
+		addDir(filepath.Join(repoPath, filepath.FromSlash(dir)), nil)
+	}
+	for _, structure := range structures {
+		switch structure {
+		case StructureStow:
+			packages, _ := os.ReadDir(repoPath)
+			for _, pkg := range packages {
+				if pkg.IsDir() && !strings.HasPrefix(pkg.Name(), ".") {
+					addDir(filepath.Join(repoPath, pkg.Name(), ".config"), nil)
+					addDir(filepath.Join(repoPath, pkg.Name(), "dot-config"), nil)
+				}
+			}
+		case StructureChezmoi:
+			decode := func(name string) string { return parseChezmoiDir(name).name }
+			for _, dir := range []string{"dot_config", "private_dot_config", "exact_dot_config"} {
+				addDir(filepath.Join(repoPath, dir), decode)
+			}
+		}
+		if HasDeclaredLayout(structure) {
+			layout, err := DecodeLayout(repoPath, structure)
+			if err != nil {
+				continue
+			}
+			for _, m := range layout.Mappings {
+				rest, ok := strings.CutPrefix(m.Target, ".config/")
+				if !ok {
+					continue
+				}
+				name, _, nested := strings.Cut(rest, "/")
+				if nested || m.Dir {
+					names[path.Clean(name)] = true
+				}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// isEmptyDir reports whether path is a directory with nothing in it,
+// like a submodule that was never checked out
+func isEmptyDir(path string) bool {
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
@@ -0,0 +1,148 @@
+package manifest
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string][]string // dotfile id -> paths
+		deps     map[string][]string
+	}{
+		{
+			name: "stow",
+			files: map[string]string{
+				"nvim/.config/nvim/init.lua":    "-- nvim\n",
+				"tmux/.tmux.conf":               "set -g mouse on\n",
+				"zsh/.zshrc":                    "export EDITOR=nvim\n",
+				"zsh/.config/zsh/aliases.zsh":   "alias g=git\n",
+				"misc/.config/btop/btop.conf":   "color_theme = \"nord\"\n",
+				"misc/.config/mytool/conf.toml": "x = 1\n",
+			},
+			expected: map[string][]string{
+				"nvim":   {".config/nvim"},
+				"tmux":   {".tmux.conf"},
+				"zsh":    {".zshrc", ".config/zsh"},
+				"btop":   {".config/btop"},
+				"mytool": {".config/mytool"},
+			},
+			deps: map[string][]string{"nvim": {"neovim"}, "btop": {"btop"}, "mytool": {}},
+		},
+		{
+			name: "chezmoi",
+			files: map[string]string{
+				".chezmoiignore": "README.md\n",
+				"dot_gitconfig":  "[user]\n",
+				"private_dot_config/private_fish/config.fish": "set -g fish_greeting\n",
+				"dot_config/helix/config.toml":                "theme = \"nord\"\n",
+			},
+			expected: map[string][]string{
+				"git":   {".gitconfig"},
+				"fish":  {".config/fish"},
+				"helix": {".config/helix"},
+			},
+		},
+		{
+			name: "flat",
+			files: map[string]string{
+				".vimrc":    "set nocompatible\n",
+				".bashrc":   "alias ll='ls -l'\n",
+				".inputrc":  "set editing-mode vi\n",
+				"README.md": "my dots\n",
+			},
+			expected: map[string][]string{
+				"vim":  {".vimrc"},
+				"bash": {".bashrc", ".inputrc"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			writeTree(t, repo, tt.files)
+
+			dotfiles := Discover(repo, []string{"btop"})
+			got := make(map[string][]string)
+			for _, d := range dotfiles {
+				got[d.ID] = d.PathNames()
+				if want, ok := tt.deps[d.ID]; ok && !slices.Equal(d.Dependencies, want) {
+					t.Errorf("%s: expected dependencies %v, got %v", d.ID, want, d.Dependencies)
+				}
+			}
+			if len(got) != len(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			for id, paths := range tt.expected {
+				if !slices.Equal(got[id], paths) {
+					t.Errorf("%s: expected %v, got %v", id, paths, got[id])
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverSlugsIDs(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".config/Code/User/settings.json":  "{}\n",
+		".config/code/settings.json":       "{}\n",
+		".config/JetBrains/idea.vmoptions": "-Xmx2g\n",
+		".config/GIMP 2.10/gimprc":         "(theme \"Dark\")\n",
+	})
+
+	got := make(map[string]string) // id -> name
+	for _, d := range Discover(repo, nil) {
+		got[d.ID] = d.Name
+	}
+	want := map[string]string{"code": "Code", "code-2": "code", "jetbrains": "JetBrains", "gimp-2-10": "GIMP 2.10"}
+	if len(got) != len(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for id, name := range want {
+		if got[id] != name {
+			t.Errorf("%s: expected name %q, got %q", id, name, got[id])
+		}
+	}
+}
+
+func TestManifestMerge(t *testing.T) {
+	m := &Manifest{
+		Categories: []Category{{ID: "vim-wizards"}},
+		Creators:   []Creator{{ID: "tj", Name: "TJ"}},
+	}
+	m.Merge(&Manifest{
+		Categories: []Category{{ID: "vim-wizards", Name: "dup"}, {ID: "added"}},
+		Creators:   []Creator{{ID: "tj", Name: "tj again"}, {ID: "me"}},
+	})
+
+	if len(m.Categories) != 2 || m.Categories[0].Name != "" {
+		t.Errorf("expected the new category only, got %+v", m.Categories)
+	}
+	if len(m.Creators) != 2 || m.GetCreator("tj").Name != "tj again" || m.GetCreator("me") == nil {
+		t.Errorf("expected tj replaced and me added, got %+v", m.Creators)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1", "1.0.0", 0},
+		{"1.2", "1.10", -1},
+		{"1.10.1", "1.10", 1},
+		{"2.0", "1.99", 1},
+		{"", "1.0", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// package manifest reads dotbot install configs
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dotbotConfigs are the config names dotbot's install script uses
+var dotbotConfigs = []string{"install.conf.yaml", "install.conf.yml", "install.conf.json"}
+
+// dotbotInstallConfig matches CONFIG="..." in dotbot's install script
+var dotbotInstallConfig = regexp.MustCompile(`(?m)^\s*CONFIG=["']?([^"'\s]+)["']?`)
+
+// dotbotConfigFiles returns the repo's dotbot configs, the one the install
+// script names first; outside is a CONFIG= path pointing out of the repo,
+// which isn't read
+func dotbotConfigFiles(repoPath string) (files []string, outside string) {
+	seen := make(map[string]bool)
+	add := func(name string) {
+		file := filepath.Join(repoPath, filepath.FromSlash(name))
+		if !seen[file] && fileExists(file) {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	if script, err := os.ReadFile(filepath.Join(repoPath, "install")); err == nil {
+		if m := dotbotInstallConfig.FindSubmatch(script); m != nil {
+			if name, ok := repoSource(string(m[1])); ok {
+				add(name)
+			} else {
+				outside = string(m[1])
+			}
+		}
+	}
+	for _, name := range dotbotConfigs {
+		add(name)
+	}
+	return files, outside
+}
+
+// dotbotLink holds the options of one link entry, or the link defaults
+type dotbotLink struct {
+	Path    *string  `yaml:"path"`
+	Glob    *bool    `yaml:"glob"`
+	If      *string  `yaml:"if"`
+	Prefix  *string  `yaml:"prefix"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// decodeDotbot reads the link directives of every dotbot config
+// other directives (shell, clean, create) have nothing to map
+func decodeDotbot(l *Layout) error {
+	files, outside := dotbotConfigFiles(l.Root)
+	if outside != "" {
+		l.Skipped[outside] = "dotbot config outside the repo"
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no dotbot config in %s", l.Root)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("couldn't read %s: %w", file, err)
+		}
+		var directives []map[string]yaml.Node
+		if err := yaml.Unmarshal(data, &directives); err != nil {
+			return fmt.Errorf("couldn't parse %s: %w", filepath.Base(file), err)
+		}
+
+		var defaults dotbotLink
+		for _, directive := range directives {
+			if node, ok := directive["defaults"]; ok {
+				var d struct {
+					Link dotbotLink `yaml:"link"`
+				}
+				if err := node.Decode(&d); err != nil {
+					return fmt.Errorf("couldn't parse defaults in %s: %w", filepath.Base(file), err)
+				}
+				defaults = d.Link
+			}
+			if node, ok := directive["link"]; ok {
+				if err := l.addDotbotLinks(&node, defaults); err != nil {
+					return fmt.Errorf("couldn't parse links in %s: %w", filepath.Base(file), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addDotbotLinks adds one link directive, a map of target to source,
+// null or an options map
+func (l *Layout) addDotbotLinks(node *yaml.Node, defaults dotbotLink) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("link must be a map")
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		target := node.Content[i].Value
+		value := node.Content[i+1]
+
+		opts := defaults
+		switch {
+		case value.Tag == "!!null":
+		case value.Kind == yaml.ScalarNode:
+			source := value.Value
+			opts.Path = &source
+		case value.Kind == yaml.MappingNode:
+			var entry dotbotLink
+			if err := value.Decode(&entry); err != nil {
+				return fmt.Errorf("%s: %w", target, err)
+			}
+			opts.merge(entry)
+		default:
+			return fmt.Errorf("%s: unexpected link value", target)
+		}
+
+		if opts.If != nil {
+			ok, known := dotbotCondition(*opts.If)
+			if !known {
+				if clean, ok := homeTarget(target); ok {
+					l.Skipped[clean] = "depends on `" + *opts.If + "`"
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		source := ""
+		if opts.Path != nil {
+			source = *opts.Path
+		} else {
+			// no source means the target's name without its leading dot
+			source = strings.TrimPrefix(path.Base(strings.TrimSuffix(target, "/")), ".")
+		}
+
+		clean, ok := repoSource(source)
+		if !ok {
+			if t, ok := homeTarget(target); ok {
+				target = t
+			}
+			l.Skipped[target] = "source outside the repo: " + source
+			continue
+		}
+		source = clean
+
+		if opts.Glob != nil && *opts.Glob && strings.ContainsAny(source, "*?[") {
+			l.addDotbotGlob(source, target, opts)
+			continue
+		}
+		l.add(filepath.Join(l.Root, filepath.FromSlash(source)), target)
+	}
+	return nil
+}
+
+// merge overrides the defaults with an entry's own options
+func (d *dotbotLink) merge(entry dotbotLink) {
+	if entry.Path != nil {
+		d.Path = entry.Path
+	}
+	if entry.Glob != nil {
+		d.Glob = entry.Glob
+	}
+	if entry.If != nil {
+		d.If = entry.If
+	}
+	if entry.Prefix != nil {
+		d.Prefix = entry.Prefix
+	}
+	if entry.Exclude != nil {
+		d.Exclude = entry.Exclude
+	}
+}
+
+// addDotbotGlob links every match of pattern into the target directory,
+// keeping the directories below the pattern's first wildcard
+func (l *Layout) addDotbotGlob(pattern, target string, opts dotbotLink) {
+	pattern = path.Clean(pattern)
+	segments := strings.Split(pattern, "/")
+	fixed := 0
+	for fixed < len(segments) && !strings.ContainsAny(segments[fixed], "*?[") {
+		fixed++
+	}
+	base := path.Join(segments[:fixed]...)
+	prefix := ""
+	if opts.Prefix != nil {
+		prefix = *opts.Prefix
+	}
+	last := segments[len(segments)-1]
+
+	_ = walkTreeAll(filepath.Join(l.Root, filepath.FromSlash(base)), func(rel, source string) {
+		full := path.Join(base, rel)
+		if !globMatch(pattern, full) {
+			return
+		}
+		// like python's glob, * doesn't match hidden names
+		if strings.HasPrefix(path.Base(rel), ".") && !strings.HasPrefix(last, ".") {
+			return
+		}
+		for _, ex := range opts.Exclude {
+			if globMatch(path.Clean(ex), full) {
+				return
+			}
+		}
+		dir, name := path.Split(rel)
+		l.add(source, path.Join(strings.TrimSuffix(target, "/"), dir, prefix+name))
+	})
+}
+
+// walkTreeAll calls fn for every file and directory under dir
+func walkTreeAll(dir string, fn func(rel, source string)) error {
+	return filepath.Walk(dir, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && filepath.Base(walkPath) == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, walkPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		fn(filepath.ToSlash(rel), walkPath)
+		return nil
+	})
+}
+
+// dotbotCondition evaluates the `if` shell conditions we understand, the
+// ones comparing uname with an os name; known is false for anything else,
+// we never run the creator's shell commands
+func dotbotCondition(cmd string) (result, known bool) {
+	if !strings.Contains(cmd, "uname") {
+		return false, false
+	}
+
+	negate := strings.Contains(cmd, "!=")
+	op := "="
+	if negate {
+		op = "!="
+	}
+	_, rhs, found := strings.Cut(cmd, op)
+	if !found {
+		return false, false
+	}
+	word := strings.Trim(strings.TrimSpace(strings.TrimLeft(rhs, "=")), `"' ]`)
+	if word == "" || strings.ContainsAny(word, " $`") {
+		return false, false
+	}
+
+	matches := strings.EqualFold(word, unameOS())
+	return matches != negate, true
+}
+
+// unameOS is what `uname -s` prints on this machine
+func unameOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "Darwin"
+	case "freebsd":
+		return "FreeBSD"
+	case "openbsd":
+		return "OpenBSD"
+	case "netbsd":
+		return "NetBSD"
+	case "windows":
+		return "Windows_NT"
+	default:
+		return "Linux"
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
+
+	"github.com/milxzy/dotfile-picker/internal/logger"
 )
 
 // Fetcher handles downloading and caching the manifest
@@ -16,6 +19,16 @@ type Fetcher struct {
 	url       string
 	cachePath string
 	client    *http.Client
+
+	// refreshInterval is how long a cached manifest is used without asking
+	// the server, zero always asks
+	refreshInterval time.Duration
+
+	// force asks the server even when the cache is fresh
+	force bool
+
+	// signatures decides which signed manifests are accepted
+	signatures SignaturePolicy
 }
 
 // NewFetcher creates a manifest fetcher
@@ -31,98 +44,371 @@ func NewFetcher(url, cachePath string) *Fetcher {
 	}
 }
 
-// Fetch downloads the latest manifest from the remote url
-// tries remote first, falls back to cache if network fails
+// SetRefreshInterval makes Fetch use a cached manifest younger than
+// interval without a request (see config.RefreshInterval)
+func (f *Fetcher) SetRefreshInterval(interval time.Duration) {
+	f.refreshInterval = interval
+}
+
+// SetForce makes Fetch ask the server even when the cache is fresh
+func (f *Fetcher) SetForce(force bool) {
+	f.force = force
+}
+
+// SetSignaturePolicy makes Fetch verify the manifest's minisign signature
+// (the url plus SignatureSuffix), for downloads and the cache alike
+func (f *Fetcher) SetSignaturePolicy(policy SignaturePolicy) {
+	f.signatures = policy
+}
+
+// FetchAction is what Fetch ended up doing
+type FetchAction int
+
+const (
+	// FetchDownloaded means the server sent a new manifest
+	FetchDownloaded FetchAction = iota
+
+	// FetchNotModified means the server said the cached one is current
+	FetchNotModified
+
+	// FetchCached means the cache was fresh enough to skip the request
+	FetchCached
+
+	// FetchFallback means the request failed and the cache was used
+	FetchFallback
+)
+
+// FetchResult describes the manifest Fetch returned
+type FetchResult struct {
+	Action FetchAction
+
+	// Age is how long ago the server last confirmed this copy
+	Age time.Duration
+
+	// Err is why the request failed, for FetchFallback
+	Err error
+
+	// Trust is how the manifest's signature checked out
+	Trust Trust
+
+	// Signer is the id of the key that signed it, for TrustVerified
+	Signer string
+}
+
+// fetchMeta is what we remember about the cached manifest, next to it
+type fetchMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// Fetch returns the manifest, from the cache while it's fresh and from the
+// server otherwise, falling back to the cache when the server fails
 func (f *Fetcher) Fetch(ctx context.Context) (*Manifest, error) {
-	// try to fetch the remote manifest
-	manifest, err := f.fetchRemote(ctx)
-	if err != nil {
-		// no worries, let's check the cache
-		cached, cacheErr := f.loadCache()
-		if cacheErr != nil {
-			// both failed - return the original error
-			return nil, fmt.Errorf("couldn't fetch manifest: %w (cache also unavailable: %v)", err, cacheErr)
+	manifest, _, err := f.FetchWithResult(ctx)
+	return manifest, err
+}
+
+// FetchWithResult is Fetch, also saying where the manifest came from
+// requests are conditional (If-None-Match, If-Modified-Since), a 304
+// keeps the cached copy
+func (f *Fetcher) FetchWithResult(ctx context.Context) (*Manifest, *FetchResult, error) {
+	meta := f.loadMeta()
+	cached, trusted, cacheErr := f.loadCache()
+	if cached == nil {
+		// validators for a cache we can't use would get us a useless 304
+		meta = fetchMeta{}
+	}
+
+	age := time.Since(meta.CheckedAt)
+	fromCache := func(action FetchAction, err error) *FetchResult {
+		result := trusted
+		result.Action, result.Err = action, err
+		if action != FetchNotModified {
+			result.Age = age
 		}
-		return cached, nil
+		return &result
 	}
 
-	// save to cache for next time (non-critical; log and continue)
-	if err := f.saveCache(manifest); err != nil {
-		fmt.Fprintf(os.Stderr, "dotfile-picker: warning: couldn't save manifest cache: %v\n", err)
+	if cached != nil && !f.force && f.refreshInterval > 0 && !meta.CheckedAt.IsZero() && age < f.refreshInterval {
+		return cached, fromCache(FetchCached, nil), nil
 	}
 
-	return manifest, nil
+	data, sig, err := f.fetchRemote(ctx, &meta)
+	switch {
+	case err != nil && cached == nil:
+		return nil, nil, fmt.Errorf("couldn't fetch manifest: %w (cache also unavailable: %v)", err, cacheErr)
+	case err != nil:
+		logger.Warn("Couldn't fetch %s, using the cached manifest: %v", f.url, err)
+		return cached, fromCache(FetchFallback, err), nil
+	case data == nil:
+		// not modified, the cache is current as of now
+		if err := f.saveMeta(meta); err != nil {
+			logger.Warn("Couldn't save manifest cache: %v", err)
+		}
+		return cached, fromCache(FetchNotModified, nil), nil
+	}
+
+	// a broken or tampered remote manifest falls back to the cache like an
+	// outage does, and never replaces it
+	manifest, result, err := f.verify(data, sig)
+	if err == nil && result.Trust == TrustUnsigned && cached != nil && trusted.Trust == TrustVerified {
+		// once a copy verified, a missing signature (a 404 on the .minisig)
+		// mustn't quietly turn checking off
+		err = fmt.Errorf("%w, the cached copy was", ErrUnsigned)
+	}
+	if err != nil {
+		if cached == nil {
+			return nil, nil, fmt.Errorf("remote manifest: %w", err)
+		}
+		logger.Warn("Remote manifest %s rejected, using the cached one: %v", f.url, err)
+		return cached, fromCache(FetchFallback, err), nil
+	}
+
+	// save to cache for next time (non-critical; log and continue)
+	if err := f.saveCache(data, sig, meta); err != nil {
+		logger.Warn("Couldn't save manifest cache: %v", err)
+	}
+	result.Action = FetchDownloaded
+	return manifest, &result, nil
 }
 
-// fetchRemote downloads the manifest from the remote url
-func (f *Fetcher) fetchRemote(ctx context.Context) (*Manifest, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+// verify checks a manifest's signature against the policy, then parses it
+func (f *Fetcher) verify(data, sig []byte) (*Manifest, FetchResult, error) {
+	trust, signer, err := f.signatures.check(data, sig)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create request: %w", err)
+		return nil, FetchResult{}, err
+	}
+	if trust == TrustUnsigned {
+		logger.Warn("Manifest %s isn't signed", f.url)
 	}
+	manifest, err := Parse(data)
+	if err != nil {
+		return nil, FetchResult{}, err
+	}
+	return manifest, FetchResult{Trust: trust, Signer: signer}, nil
+}
 
-	resp, err := f.client.Do(req)
+// fetchRemote downloads the manifest and, when keys are configured, its
+// signature (nil when there's none); nil data means it wasn't modified
+// meta holds the validators sent and gets the new ones
+func (f *Fetcher) fetchRemote(ctx context.Context, meta *fetchMeta) ([]byte, []byte, error) {
+	header := make(http.Header)
+	if meta.ETag != "" {
+		header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := f.get(ctx, f.url, header)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't fetch manifest: %w", err)
+		return nil, nil, fmt.Errorf("couldn't fetch manifest: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		meta.CheckedAt = time.Now()
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// read and parse the json
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read response: %w", err)
+		return nil, nil, fmt.Errorf("couldn't read response: %w", err)
 	}
 
-	var manifest Manifest
-	if err := json.Unmarshal(data, &manifest); err != nil {
-		return nil, fmt.Errorf("couldn't parse manifest: %w", err)
+	var sig []byte
+	if len(f.signatures.Keys) > 0 {
+		if sig, err = f.fetchSignature(ctx); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return &manifest, nil
+	*meta = fetchMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		CheckedAt:    time.Now(),
+	}
+	return data, sig, nil
 }
 
-// loadCache loads the manifest from disk cache
-func (f *Fetcher) loadCache() (*Manifest, error) {
-	data, err := os.ReadFile(f.cachePath)
+// fetchSignature downloads the manifest's signature, nil when there's none
+func (f *Fetcher) fetchSignature(ctx context.Context) ([]byte, error) {
+	resp, err := f.get(ctx, f.url+SignatureSuffix, nil)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read cache: %w", err)
+		return nil, fmt.Errorf("couldn't fetch manifest signature: %w", err)
 	}
+	defer resp.Body.Close()
 
-	var manifest Manifest
-	if err := json.Unmarshal(data, &manifest); err != nil {
-		return nil, fmt.Errorf("couldn't parse cached manifest: %w", err)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code for the manifest signature: %d", resp.StatusCode)
 	}
 
-	return &manifest, nil
+	sig, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read manifest signature: %w", err)
+	}
+	return sig, nil
 }
 
-// saveCache writes the manifest to disk cache
-func (f *Fetcher) saveCache(manifest *Manifest) error {
-	data, err := json.MarshalIndent(manifest, "", "  ")
+// get sends a GET request with extra headers
+func (f *Fetcher) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return f.client.Do(req)
+}
+
+// LoadFile reads a manifest from a local json file
+// used for the manifest bundled in configs/
+func LoadFile(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Parse decodes and validates manifest json, only errors fail it,
+// warnings are left for `dotpicker manifest lint`
+func Parse(data []byte) (*Manifest, error) {
+	manifest, issues := Check(data, CheckOptions{})
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return nil, &ValidationError{Issues: issues}
+		}
+	}
+	return manifest, nil
+}
+
+// MergeFile merges the manifest at path into m, a missing file is fine
+func MergeFile(m *Manifest, path string) error {
+	other, err := LoadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't load %s: %w", path, err)
+	}
+	m.Merge(other)
+	return nil
+}
+
+// SaveFile writes a manifest as indented json, the format LoadFile reads
+func SaveFile(path string, m *Manifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("couldn't create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return fmt.Errorf("couldn't marshal manifest: %w", err)
 	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", path, err)
+	}
+	return nil
+}
 
+// loadCache loads the manifest from disk cache, checking its signature
+// again so a cache edited on disk is no more trusted than a download
+func (f *Fetcher) loadCache() (*Manifest, FetchResult, error) {
+	data, err := os.ReadFile(f.cachePath)
+	if err != nil {
+		return nil, FetchResult{}, fmt.Errorf("couldn't read cache: %w", err)
+	}
+
+	sig, err := os.ReadFile(f.cachePath + SignatureSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, FetchResult{}, fmt.Errorf("couldn't read cached signature: %w", err)
+	}
+
+	manifest, result, err := f.verify(data, sig)
+	if err != nil {
+		return nil, FetchResult{}, fmt.Errorf("cached manifest: %w", err)
+	}
+	return manifest, result, nil
+}
+
+// saveCache writes the manifest as the server sent it, so its validators
+// and signature still describe it, then the signature and validators
+func (f *Fetcher) saveCache(data, sig []byte, meta fetchMeta) error {
+	if err := os.MkdirAll(filepath.Dir(f.cachePath), 0755); err != nil {
+		return fmt.Errorf("couldn't create %s: %w", filepath.Dir(f.cachePath), err)
+	}
 	if err := os.WriteFile(f.cachePath, data, 0644); err != nil {
 		return fmt.Errorf("couldn't write cache: %w", err)
 	}
 
+	sigPath := f.cachePath + SignatureSuffix
+	if sig == nil {
+		// an old signature would fail against the new manifest
+		if err := os.Remove(sigPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("couldn't remove %s: %w", sigPath, err)
+		}
+	} else if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", sigPath, err)
+	}
+	return f.saveMeta(meta)
+}
+
+// metaPath is where the cached manifest's validators are kept
+func (f *Fetcher) metaPath() string {
+	return f.cachePath + ".meta"
+}
+
+// loadMeta reads the cached manifest's validators, zero when there are none
+func (f *Fetcher) loadMeta() fetchMeta {
+	var meta fetchMeta
+	data, err := os.ReadFile(f.metaPath())
+	if err != nil {
+		// caches from before validators were kept still have a date
+		if info, err := os.Stat(f.cachePath); err == nil {
+			meta.CheckedAt = info.ModTime()
+		}
+		return meta
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		logger.Warn("Ignoring %s: %v", f.metaPath(), err)
+	}
+	return meta
+}
+
+// saveMeta writes the cached manifest's validators
+func (f *Fetcher) saveMeta(meta fetchMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal manifest cache metadata: %w", err)
+	}
+	if err := os.WriteFile(f.metaPath(), data, 0644); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", f.metaPath(), err)
+	}
 	return nil
 }
 
 // NeedRefresh checks if the cached manifest is stale
 // returns true if we should fetch a new one
 func (f *Fetcher) NeedRefresh(maxAge time.Duration) bool {
-	info, err := os.Stat(f.cachePath)
-	if err != nil {
+	if _, err := os.Stat(f.cachePath); err != nil {
 		// cache doesn't exist or can't read it
 		return true
 	}
-
-	age := time.Since(info.ModTime())
-	return age > maxAge
+	meta := f.loadMeta()
+	return time.Since(meta.CheckedAt) > maxAge
 }
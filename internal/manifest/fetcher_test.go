@@ -0,0 +1,194 @@
+package manifest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchWithResult(t *testing.T) {
+	const etag = `"v1"`
+	served := strings.Replace(creatorJSON, `"version": "1.0"`, `"version": "1.1"`, 1)
+
+	tests := []struct {
+		name     string
+		handler  func(w http.ResponseWriter, r *http.Request)
+		cached   bool          // a previous fetch left a cache
+		checked  time.Duration // how long ago the cache was checked
+		interval time.Duration
+		force    bool
+		timeout  time.Duration
+
+		action   FetchAction
+		requests int32
+		version  string // of the manifest returned, empty for an error
+	}{
+		{
+			name:     "first fetch",
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(served)) },
+			action:   FetchDownloaded,
+			requests: 1,
+			version:  "1.1",
+		},
+		{
+			name: "not modified",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("If-None-Match") != etag {
+					t.Errorf("expected If-None-Match %s, got %q", etag, r.Header.Get("If-None-Match"))
+				}
+				w.WriteHeader(http.StatusNotModified)
+			},
+			cached:   true,
+			checked:  48 * time.Hour,
+			interval: 24 * time.Hour,
+			action:   FetchNotModified,
+			requests: 1,
+			version:  "1.0",
+		},
+		{
+			name:     "fresh cache skips the request",
+			handler:  func(w http.ResponseWriter, r *http.Request) { t.Error("unexpected request") },
+			cached:   true,
+			checked:  time.Hour,
+			interval: 24 * time.Hour,
+			action:   FetchCached,
+			version:  "1.0",
+		},
+		{
+			name:     "force ignores the interval",
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(served)) },
+			cached:   true,
+			checked:  time.Hour,
+			interval: 24 * time.Hour,
+			force:    true,
+			action:   FetchDownloaded,
+			requests: 1,
+			version:  "1.1",
+		},
+		{
+			name:     "server error falls back to the cache",
+			handler:  func(w http.ResponseWriter, r *http.Request) { http.Error(w, "oops", http.StatusBadGateway) },
+			cached:   true,
+			checked:  48 * time.Hour,
+			action:   FetchFallback,
+			requests: 1,
+			version:  "1.0",
+		},
+		{
+			name: "timeout falls back to the cache",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(2 * time.Second):
+				}
+			},
+			cached:   true,
+			checked:  48 * time.Hour,
+			timeout:  50 * time.Millisecond,
+			action:   FetchFallback,
+			requests: 1,
+			version:  "1.0",
+		},
+		{
+			name:     "server error without a cache",
+			handler:  func(w http.ResponseWriter, r *http.Request) { http.Error(w, "oops", http.StatusInternalServerError) },
+			requests: 1,
+		},
+		{
+			name:     "invalid manifest falls back to the cache",
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"version": "1.1"}`)) },
+			cached:   true,
+			action:   FetchFallback,
+			requests: 1,
+			version:  "1.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("ETag", etag)
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			cachePath := filepath.Join(t.TempDir(), "manifest.json")
+			f := NewFetcher(server.URL, cachePath)
+			f.SetRefreshInterval(tt.interval)
+			f.SetForce(tt.force)
+			if tt.timeout > 0 {
+				f.client.Timeout = tt.timeout
+			}
+			if tt.cached {
+				meta := fetchMeta{ETag: etag, CheckedAt: time.Now().Add(-tt.checked)}
+				if err := f.saveCache([]byte(creatorJSON), nil, meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m, result, err := f.FetchWithResult(context.Background())
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, got)
+			}
+			if tt.version == "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.Version != tt.version {
+				t.Errorf("got version %s, want %s", m.Version, tt.version)
+			}
+			if result.Action != tt.action {
+				t.Errorf("got action %d, want %d", result.Action, tt.action)
+			}
+			if tt.action == FetchFallback && result.Err == nil {
+				t.Error("expected the fetch error on a fallback")
+			}
+
+			// a successful request restarts the refresh interval
+			if tt.action == FetchDownloaded || tt.action == FetchNotModified {
+				if f.NeedRefresh(time.Minute) {
+					t.Error("expected the cache to be fresh after talking to the server")
+				}
+			}
+		})
+	}
+}
+
+func TestFetchSavesWhatTheServerSent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2026 07:28:00 GMT")
+		w.Write([]byte(creatorJSON))
+	}))
+	defer server.Close()
+
+	cachePath := filepath.Join(t.TempDir(), "registries", "acme.json")
+	if _, err := NewFetcher(server.URL, cachePath).Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != creatorJSON {
+		t.Error("expected the cache to hold the manifest byte for byte")
+	}
+
+	f := NewFetcher(server.URL, cachePath)
+	if meta := f.loadMeta(); meta.LastModified != "Wed, 21 Oct 2026 07:28:00 GMT" {
+		t.Errorf("expected Last-Modified to be kept, got %+v", meta)
+	}
+}
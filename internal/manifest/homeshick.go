@@ -0,0 +1,14 @@
+// package manifest reads homeshick castles
+package manifest
+
+import "path/filepath"
+
+// decodeHomeshick maps a homeshick castle: everything under home/ is
+// linked to the same place in the home directory
+func decodeHomeshick(l *Layout) error {
+	home := filepath.Join(l.Root, "home")
+	skip := func(rel string, isDir bool) bool { return false }
+	return walkTree(home, skip, func(rel, source string) {
+		l.add(source, rel)
+	})
+}
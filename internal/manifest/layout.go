@@ -0,0 +1,263 @@
+// package manifest maps repos that declare where their files go
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/logger"
+)
+
+// Mapping is one source → target pair a repo declares
+type Mapping struct {
+	Source string // absolute path in the repo
+	Target string // slash-separated, relative to home
+	Dir    bool
+}
+
+// Layout is the declared mapping of a dotbot, yadm, rcm or homeshick repo
+// built from the repo's own config instead of guessing paths
+type Layout struct {
+	Structure RepoStructure
+	Root      string
+
+	// Mappings are sorted by Target
+	Mappings []Mapping
+
+	// Skipped lists declared targets we won't apply and why
+	// (outside home, conditions we can't evaluate, templates)
+	Skipped map[string]string
+}
+
+// declaredLayouts are the structures DecodeLayout understands
+var declaredLayouts = map[RepoStructure]func(*Layout) error{
+	StructureDotbot:    decodeDotbot,
+	StructureBareRepo:  decodeYadm,
+	StructureRcm:       decodeRcm,
+	StructureHomeshick: decodeHomeshick,
+}
+
+// HasDeclaredLayout reports whether DecodeLayout handles a structure
+func HasDeclaredLayout(structure RepoStructure) bool {
+	_, ok := declaredLayouts[structure]
+	return ok
+}
+
+// DecodeLayout reads a repo's source → target mapping for its structure
+func DecodeLayout(repoPath string, structure RepoStructure) (*Layout, error) {
+	decode, ok := declaredLayouts[structure]
+	if !ok {
+		return nil, fmt.Errorf("structure %d has no declared layout", structure)
+	}
+
+	layout := &Layout{Structure: structure, Root: repoPath, Skipped: make(map[string]string)}
+	if err := decode(layout); err != nil {
+		return nil, err
+	}
+
+	// later mappings for the same target win, they're more specific
+	byTarget := make(map[string]Mapping, len(layout.Mappings))
+	for _, m := range layout.Mappings {
+		byTarget[m.Target] = m
+	}
+	layout.Mappings = layout.Mappings[:0]
+	for _, m := range byTarget {
+		layout.Mappings = append(layout.Mappings, m)
+	}
+	sort.Slice(layout.Mappings, func(i, j int) bool {
+		return layout.Mappings[i].Target < layout.Mappings[j].Target
+	})
+	return layout, nil
+}
+
+// DecodeDeclaredLayout decodes the layout of a structure that declares one,
+// nil for other structures or when the layout can't be read
+func DecodeDeclaredLayout(repoPath string, structure RepoStructure) *Layout {
+	if !HasDeclaredLayout(structure) {
+		return nil
+	}
+	layout, err := DecodeLayout(repoPath, structure)
+	if err != nil {
+		logger.Debug("Couldn't read the declared %s layout: %v", structure, err)
+		return nil
+	}
+	return layout
+}
+
+// add records a mapping, target may start with ~/ and must stay in home
+func (l *Layout) add(source, target string) {
+	clean, ok := homeTarget(target)
+	if !ok {
+		l.Skipped[target] = "outside the home directory"
+		return
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		l.Skipped[clean] = "source doesn't exist"
+		return
+	}
+	l.Mappings = append(l.Mappings, Mapping{Source: source, Target: clean, Dir: info.IsDir()})
+}
+
+// homeTarget turns ~/foo, $HOME/foo or foo into foo, false for paths
+// outside the home directory
+func homeTarget(target string) (string, bool) {
+	target = filepath.ToSlash(target)
+	for _, prefix := range []string{"~/", "$HOME/", "${HOME}/"} {
+		if rest, ok := strings.CutPrefix(target, prefix); ok {
+			target = rest
+			break
+		}
+	}
+	if target == "~" || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "~") {
+		return "", false
+	}
+	target = path.Clean(target)
+	if target == "." || target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	return target, true
+}
+
+// repoSource cleans a slash-separated source path relative to the repo,
+// false for absolute paths and ones climbing out of the repo
+func repoSource(source string) (string, bool) {
+	source = filepath.ToSlash(source)
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~") || filepath.IsAbs(source) {
+		return "", false
+	}
+	source = path.Clean(source)
+	if source == ".." || strings.HasPrefix(source, "../") {
+		return "", false
+	}
+	return source, true
+}
+
+// Lookup returns the source for a target, following directory mappings
+// for targets inside them
+func (l *Layout) Lookup(target string) (string, bool) {
+	target = normalizeTarget(target)
+	for _, m := range l.Mappings {
+		if m.Target == target {
+			return m.Source, true
+		}
+		if m.Dir && strings.HasPrefix(target, m.Target+"/") {
+			source := filepath.Join(m.Source, filepath.FromSlash(strings.TrimPrefix(target, m.Target+"/")))
+			if pathExists(source) {
+				return source, true
+			}
+		}
+	}
+	return "", false
+}
+
+// LayoutPlan is what applying part of a declared layout comes down to
+type LayoutPlan struct {
+	// Files maps source files to targets, like a plain repo's file map
+	Files map[string]string
+
+	// Skipped lists declared targets under the path we won't apply and why
+	Skipped map[string]string
+
+	// Sources are the repo-relative paths the files came from, empty when
+	// the layout doesn't declare anything for the path
+	Sources []string
+}
+
+// Plan builds the file map for target, a manifest path like ".config/nvim"
+// returned targets keep target's spelling, so they resolve like other repos
+func (l *Layout) Plan(target string) (*LayoutPlan, error) {
+	plan := &LayoutPlan{Files: make(map[string]string), Skipped: make(map[string]string)}
+	base := normalizeTarget(target)
+	dest := func(t string) string {
+		rel := strings.TrimPrefix(strings.TrimPrefix(t, base), "/")
+		if base == "." {
+			rel = t
+		}
+		return filepath.Join(target, filepath.FromSlash(rel))
+	}
+
+	for _, m := range l.Mappings {
+		source, mapped := m.Source, m.Target
+		switch {
+		case base == "." || m.Target == base || strings.HasPrefix(m.Target, base+"/"):
+		case m.Dir && strings.HasPrefix(base, m.Target+"/"):
+			// the path is somewhere inside a linked directory
+			source = filepath.Join(m.Source, filepath.FromSlash(strings.TrimPrefix(base, m.Target+"/")))
+			mapped = base
+			if !pathExists(source) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if rel, err := filepath.Rel(l.Root, source); err == nil {
+			plan.Sources = append(plan.Sources, filepath.ToSlash(rel))
+		}
+		if err := addFiles(source, dest(mapped), plan.Files); err != nil {
+			return nil, err
+		}
+	}
+
+	for t, why := range l.Skipped {
+		if base == "." || t == base || strings.HasPrefix(t, base+"/") {
+			plan.Skipped[dest(t)] = why
+		}
+	}
+	return plan, nil
+}
+
+// addFiles maps a file, or every file under a directory, to target
+// skipping git metadata
+func addFiles(source, target string, files map[string]string) error {
+	return filepath.Walk(source, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Base(walkPath) == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(source, walkPath)
+		if err != nil {
+			return err
+		}
+		files[walkPath] = filepath.Join(target, rel)
+		return nil
+	})
+}
+
+// walkTree calls fn for every file under dir with its slash-separated path
+// relative to dir, skip decides which directories (and files) are left out
+func walkTree(dir string, skip func(rel string, isDir bool) bool, fn func(rel, source string)) error {
+	return filepath.Walk(dir, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, walkPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filepath.Base(walkPath) == ".git" || skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			fn(rel, walkPath)
+		}
+		return nil
+	})
+}
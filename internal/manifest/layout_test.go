@@ -0,0 +1,224 @@
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeLayouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		structure RepoStructure
+		expected  map[string]string // target -> repo-relative source, "" when unmapped
+		skipped   []string
+	}{
+		{
+			name: "dotbot",
+			files: map[string]string{
+				"install":           "#!/usr/bin/env bash\nCONFIG=\"install.conf.yaml\"\n",
+				"install.conf.yaml": "- defaults:\n    link:\n      relink: true\n- clean: ['~']\n- link:\n    ~/.zshrc:\n    ~/.config/nvim: nvim\n    ~/.gitconfig:\n      path: git/config\n    ~/.config/fish/conf.d/:\n      glob: true\n      path: fish/*.fish\n      prefix: 10-\n    ~/.work: {path: work, if: '[ -f /etc/work ]'}\n    ~/.linux: {path: linux, if: '[ `uname` = " + unameOS() + " ]'}\n    ~/.mac: {path: mac, if: '[ `uname` = Plan9 ]'}\n    /etc/motd: motd\n",
+				"zshrc":             "export EDITOR=nvim\n",
+				"nvim/init.lua":     "-- nvim\n",
+				"git/config":        "[user]\n",
+				"fish/a.fish":       "alias g git\n",
+				"work":              "work\n",
+				"linux":             "linux\n",
+				"mac":               "mac\n",
+				"motd":              "hi\n",
+			},
+			structure: StructureDotbot,
+			expected: map[string]string{
+				".zshrc":                        "zshrc",
+				".config/nvim":                  "nvim",
+				".config/nvim/init.lua":         "nvim/init.lua",
+				".gitconfig":                    "git/config",
+				".config/fish/conf.d/10-a.fish": "fish/a.fish",
+				".linux":                        "linux",
+				".mac":                          "",
+				".work":                         "",
+			},
+			skipped: []string{".work", "/etc/motd"},
+		},
+		{
+			name: "yadm",
+			files: map[string]string{
+				".config/yadm/bootstrap":  "#!/bin/sh\n",
+				".zshrc":                  "plain\n",
+				".zshrc##os." + unameOS(): "ours\n",
+				".zshrc##os.Plan9":        "theirs\n",
+				".gitconfig##default":     "default\n",
+				".gitconfig##class.Work":  "work\n",
+				".config/kitty##os." + unameOS() + "/kitty.conf": "font_size 12\n",
+				".vimrc##template": "{{ yadm.os }}\n",
+			},
+			structure: StructureBareRepo,
+			expected: map[string]string{
+				".zshrc":                   ".zshrc##os." + unameOS(),
+				".gitconfig":               ".gitconfig##default",
+				".config/kitty/kitty.conf": ".config/kitty##os." + unameOS() + "/kitty.conf",
+				".config/yadm/bootstrap":   "",
+				".vimrc":                   "",
+			},
+			skipped: []string{".vimrc"},
+		},
+		{
+			name: "rcm",
+			files: map[string]string{
+				"rcrc":                 "TAGS=\"work\"\nEXCLUDES=\"README.md\"\nUNDOTTED=\"bin\"\n",
+				"README.md":            "my dots\n",
+				"zshrc":                "plain\n",
+				"config/nvim/init.lua": "-- nvim\n",
+				"bin/backup":           "#!/bin/sh\n",
+				"hooks/post-up":        "#!/bin/sh\n",
+				"tag-work/zshrc":       "work\n",
+				"tag-games/zshrc":      "games\n",
+			},
+			structure: StructureRcm,
+			expected: map[string]string{
+				".zshrc":                "tag-work/zshrc",
+				".config/nvim/init.lua": "config/nvim/init.lua",
+				"bin/backup":            "bin/backup",
+				".README.md":            "",
+				".hooks/post-up":        "",
+			},
+		},
+		{
+			name: "homeshick",
+			files: map[string]string{
+				"README.md":               "castle\n",
+				"home/.bashrc":            "alias ll='ls -l'\n",
+				"home/.config/git/config": "[user]\n",
+			},
+			structure: StructureHomeshick,
+			expected: map[string]string{
+				".bashrc":            "home/.bashrc",
+				".config/git/config": "home/.config/git/config",
+				"README.md":          "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			writeTree(t, repo, tt.files)
+
+			if structure := DetectStructure(repo); structure != tt.structure {
+				t.Fatalf("expected structure %d, got %d", tt.structure, structure)
+			}
+			layout, err := DecodeLayout(repo, tt.structure)
+			if err != nil {
+				t.Fatalf("DecodeLayout: %v", err)
+			}
+
+			for target, source := range tt.expected {
+				got, ok := layout.Lookup(target)
+				if source == "" {
+					if ok {
+						t.Errorf("%s: expected no mapping, got %s", target, got)
+					}
+					continue
+				}
+				if !ok || got != filepath.Join(repo, filepath.FromSlash(source)) {
+					t.Errorf("%s: expected %s, got %q", target, source, got)
+				}
+			}
+			for _, target := range tt.skipped {
+				if layout.Skipped[target] == "" {
+					t.Errorf("expected %s to be skipped, got %v", target, layout.Skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestDotbotOutsideRepo(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "dots")
+	writeTree(t, dir, map[string]string{
+		"secret":                 "hunter2\n",
+		"evil.conf.yaml":         "- link:\n    ~/.evil: ../secret\n",
+		"dots/install":           "#!/usr/bin/env bash\nCONFIG=\"../evil.conf.yaml\"\n",
+		"dots/install.conf.yaml": "- link:\n    ~/.zshrc:\n    ~/.secret: ../secret\n    ~/.globbed:\n      glob: true\n      path: ../*\n    ~/.abs: " + filepath.ToSlash(filepath.Join(dir, "secret")) + "\n",
+		"dots/zshrc":             "export EDITOR=nvim\n",
+	})
+
+	layout, err := DecodeLayout(repo, StructureDotbot)
+	if err != nil {
+		t.Fatalf("DecodeLayout: %v", err)
+	}
+	if _, ok := layout.Lookup(".zshrc"); !ok {
+		t.Error("expected .zshrc to be mapped")
+	}
+	for _, target := range []string{".secret", ".globbed", ".abs", ".evil"} {
+		if got, ok := layout.Lookup(target); ok {
+			t.Errorf("%s: expected no mapping, got %s", target, got)
+		}
+	}
+	for _, skipped := range []string{".secret", ".globbed", ".abs", "../evil.conf.yaml"} {
+		if !strings.Contains(layout.Skipped[skipped], "outside the repo") {
+			t.Errorf("expected %s to be skipped as outside the repo, got %v", skipped, layout.Skipped)
+		}
+	}
+}
+
+func TestLayoutPlan(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"install.conf.yaml":    "- link:\n    ~/.config/nvim: nvim\n    ~/.config/work: {path: work, if: 'test -f /etc/work'}\n",
+		"nvim/init.lua":        "-- nvim\n",
+		"nvim/lua/plugins.lua": "return {}\n",
+		"work/settings":        "work\n",
+	})
+	layout, err := DecodeLayout(repo, StructureDotbot)
+	if err != nil {
+		t.Fatalf("DecodeLayout: %v", err)
+	}
+
+	// a directory mapping expands to its files, with the manifest's spelling
+	plan, err := layout.Plan("~/.config/nvim")
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	expected := map[string]string{
+		filepath.Join(repo, "nvim/init.lua"):        filepath.Join("~/.config/nvim", "init.lua"),
+		filepath.Join(repo, "nvim/lua/plugins.lua"): filepath.Join("~/.config/nvim", "lua/plugins.lua"),
+	}
+	if len(plan.Files) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, plan.Files)
+	}
+	for source, target := range expected {
+		if plan.Files[source] != target {
+			t.Errorf("%s: expected %s, got %s", source, target, plan.Files[source])
+		}
+	}
+
+	// a path inside a mapped directory
+	plan, err = layout.Plan(".config/nvim/lua")
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.Files[filepath.Join(repo, "nvim/lua/plugins.lua")] != filepath.Join(".config/nvim/lua", "plugins.lua") {
+		t.Errorf("expected plugins.lua, got %v", plan.Files)
+	}
+
+	// conditional links are reported rather than applied
+	plan, err = layout.Plan(".config")
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(plan.Files) != 2 || plan.Skipped[filepath.Join(".config", "work")] == "" {
+		t.Errorf("expected nvim's files and a skipped work dir, got %v %v", plan.Files, plan.Skipped)
+	}
+
+	// nothing declared, nothing planned
+	plan, err = layout.Plan(".zshrc")
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(plan.Sources) != 0 {
+		t.Errorf("expected no sources, got %v", plan.Sources)
+	}
+}
@@ -0,0 +1,209 @@
+// package manifest describes where dotfile paths come from and go
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/internal/ignore"
+)
+
+// PathSpec is one entry of Dotfile.Paths
+// a plain string like ".config/nvim" is where the files go, and where they
+// are looked for in the repo by the detected layout; an object can name the
+// repo source exactly, put it somewhere else and filter it:
+//
+//	{"source": "nvim", "target": ".config/nvim", "exclude": ["lazy-lock.json"]}
+type PathSpec struct {
+	// Source is the repo-relative path, used as is instead of being searched
+	// for; empty looks Target up like a plain string
+	Source string `json:"source,omitempty"`
+
+	// Target is where the files go relative to $HOME, empty is Source
+	Target string `json:"target,omitempty"`
+
+	// Mode is the targets' permission bits in octal, e.g. "0600"
+	Mode string `json:"mode,omitempty"`
+
+	// Exclude lists gitignore patterns, relative to the entry, of files to
+	// leave out of a directory; "!pattern" brings one back
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Optional skips the entry when the repo doesn't have it, instead of
+	// asking where it is
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Path is what the entry is known by: the target, or the source for an
+// object without one
+func (p PathSpec) Path() string {
+	if p.Target != "" {
+		return p.Target
+	}
+	return p.Source
+}
+
+// Explicit reports whether the entry names its repo source
+func (p PathSpec) Explicit() bool {
+	return p.Source != ""
+}
+
+// FileMode parses Mode, 0 when it's not set
+func (p PathSpec) FileMode() (fs.FileMode, error) {
+	if p.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(p.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("mode %q isn't octal permission bits like 0644", p.Mode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// UnmarshalJSON reads either form of a path entry
+func (p *PathSpec) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*p = PathSpec{Target: plain}
+		return nil
+	}
+	type object PathSpec // without the methods, so this doesn't recurse
+	var spec object
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("a path is a string or an object with source and target: %w", err)
+	}
+	*p = PathSpec(spec)
+	return nil
+}
+
+// MarshalJSON writes an entry that's only a target as a plain string
+func (p PathSpec) MarshalJSON() ([]byte, error) {
+	if p.Source == "" && p.Mode == "" && len(p.Exclude) == 0 && !p.Optional {
+		return json.Marshal(p.Target)
+	}
+	type object PathSpec
+	return json.Marshal(object(p))
+}
+
+// PathNames lists what each of the dotfile's paths is known by
+func (d *Dotfile) PathNames() []string {
+	names := make([]string, len(d.Paths))
+	for i, p := range d.Paths {
+		names[i] = p.Path()
+	}
+	return names
+}
+
+// Filter is what, besides the manifest, decides which files of a
+// directory dotfile are left out
+type Filter struct {
+	// RepoPath is the creator's checkout, its .dotpickerignore is matched
+	// against paths in the repo
+	RepoPath string
+
+	// Include and Exclude are the user's own patterns, they have the last word
+	Include []string
+	Exclude []string
+}
+
+// FilterFiles applies a dotfile's path entries to resolved files (source ->
+// target, targets as the tui maps them) and returns the ones left out, by
+// target, with the rule that did it; entry modes are set in attrs
+// files inside a directory entry are matched against, in order, the
+// defaults, the repo's .dotpickerignore, the dotfile's and the entry's
+// patterns and the user's, the last one matching deciding; a file named by
+// an entry itself is always kept
+func FilterFiles(d *Dotfile, f Filter, files map[string]string, attrs map[string]FileAttrs) (map[string]string, error) {
+	var repo ignore.Matcher
+	if f.RepoPath != "" {
+		if err := repo.AddFile(filepath.Join(f.RepoPath, ignore.FileName), ignore.SourceRepo); err != nil {
+			return nil, err
+		}
+	}
+
+	// entry patterns are relative to the entry, so each gets its own
+	matchers := make(map[int][3]*ignore.Matcher)
+	layers := func(i int) [3]*ignore.Matcher {
+		if m, ok := matchers[i]; ok {
+			return m
+		}
+		defaults, manifest, user := &ignore.Matcher{}, &ignore.Matcher{}, &ignore.Matcher{}
+		defaults.Add(ignore.SourceDefault, ignore.Defaults...)
+		manifest.Add(ignore.SourceManifest, d.Exclude...)
+		manifest.Include(ignore.SourceManifest, d.Include...)
+		manifest.Add(ignore.SourceManifest, d.Paths[i].Exclude...)
+		user.Add(ignore.SourceConfig, f.Exclude...)
+		user.Include(ignore.SourceConfig, f.Include...)
+		matchers[i] = [3]*ignore.Matcher{defaults, manifest, user}
+		return matchers[i]
+	}
+
+	excluded := make(map[string]string)
+	for source, target := range files {
+		i, rel, ok := owningSpec(d.Paths, target)
+		if !ok {
+			continue
+		}
+		spec := d.Paths[i]
+
+		if rel != "" {
+			m := layers(i)
+			var decided *ignore.Rule
+			out := false
+			decide := func(rule *ignore.Rule, excluded bool) {
+				if rule != nil {
+					decided, out = rule, excluded
+				}
+			}
+			decide(m[0].Match(rel, false))
+			if repoRel, err := filepath.Rel(f.RepoPath, source); err == nil && f.RepoPath != "" && !strings.HasPrefix(repoRel, "..") {
+				decide(repo.Match(filepath.ToSlash(repoRel), false))
+			}
+			decide(m[1].Match(rel, false))
+			decide(m[2].Match(rel, false))
+			if out {
+				delete(files, source)
+				excluded[target] = decided.String()
+				continue
+			}
+		}
+
+		mode, err := spec.FileMode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Path(), err)
+		}
+		if mode != 0 {
+			a := attrs[target]
+			a.Mode = mode
+			attrs[target] = a
+		}
+	}
+	return excluded, nil
+}
+
+// owningSpec finds the entry whose target is the closest parent of target,
+// or target itself, and the path inside it ("" when it's the entry itself)
+func owningSpec(specs []PathSpec, target string) (int, string, bool) {
+	target = homeRelative(target)
+	owner, rel, best := -1, "", -1
+	for i, spec := range specs {
+		root := homeRelative(spec.Path())
+		switch {
+		case root == target && len(root) > best:
+			owner, rel, best = i, "", len(root)
+		case strings.HasPrefix(target, root+"/") && len(root) > best:
+			owner, rel, best = i, strings.TrimPrefix(target, root+"/"), len(root)
+		}
+	}
+	return owner, rel, owner >= 0
+}
+
+// homeRelative cleans a target path down to slashes relative to $HOME
+func homeRelative(p string) string {
+	return path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "~/"))
+}
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/milxzy/dotfile-picker/internal/ignore"
+)
+
+func TestPathSpecJSON(t *testing.T) {
+	data := `[".tmux.conf", {"source": "nvim", "target": ".config/nvim", "mode": "0600", "exclude": ["*.log"], "optional": true}]`
+
+	var specs []PathSpec
+	if err := json.Unmarshal([]byte(data), &specs); err != nil {
+		t.Fatal(err)
+	}
+	expected := []PathSpec{
+		{Target: ".tmux.conf"},
+		{Source: "nvim", Target: ".config/nvim", Mode: "0600", Exclude: []string{"*.log"}, Optional: true},
+	}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Fatalf("got %+v, want %+v", specs, expected)
+	}
+
+	// plain entries stay plain, so rewritten manifests don't change shape
+	out, err := json.Marshal(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[".tmux.conf",{"source":"nvim","target":".config/nvim","mode":"0600","exclude":["*.log"],"optional":true}]`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	if err := json.Unmarshal([]byte(`[42]`), &specs); err == nil {
+		t.Error("expected an error for a number")
+	}
+}
+
+func TestFilterFiles(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, ignore.FileName), []byte("# generated\nnvim/spell/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dotfile := &Dotfile{
+		Paths: []PathSpec{
+			{Source: "nvim", Target: ".config/nvim", Exclude: []string{"doc/*"}},
+			{Target: ".ssh/config", Mode: "600"},
+			{Target: ".config/nvim/lua/private", Mode: "0700", Exclude: []string{"*.bak"}},
+			{Target: "README.md"},
+		},
+		Include: []string{"CHANGELOG.md"},
+	}
+	files := map[string]string{
+		repo + "/nvim/init.lua":                 "~/.config/nvim/init.lua",
+		repo + "/nvim/lazy-lock.json":           "~/.config/nvim/lazy-lock.json",
+		repo + "/nvim/README.md":                "~/.config/nvim/README.md",
+		repo + "/nvim/CHANGELOG.md":             "~/.config/nvim/CHANGELOG.md",
+		repo + "/nvim/tests/init_spec.lua":      "~/.config/nvim/tests/init_spec.lua",
+		repo + "/nvim/doc/help.txt":             "~/.config/nvim/doc/help.txt",
+		repo + "/nvim/spell/en.utf-8.add":       "~/.config/nvim/spell/en.utf-8.add",
+		repo + "/nvim/after/.DS_Store":          "~/.config/nvim/after/.DS_Store",
+		repo + "/nvim/lua/private/keys.lua":     ".config/nvim/lua/private/keys.lua",
+		repo + "/nvim/lua/private/old/keys.bak": ".config/nvim/lua/private/old/keys.bak",
+		repo + "/ssh/config":                    ".ssh/config",
+		repo + "/README.md":                     "README.md",
+	}
+	attrs := map[string]FileAttrs{".ssh/config": {CreateOnly: true}}
+
+	// the user brings lazy-lock.json back and drops init.lua
+	filter := Filter{RepoPath: repo, Include: []string{"lazy-lock.json"}, Exclude: []string{"/init.lua"}}
+	excluded, err := FilterFiles(dotfile, filter, files, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantExcluded := map[string]string{
+		"~/.config/nvim/init.lua":               "config: /init.lua",
+		"~/.config/nvim/README.md":              "default: README*",
+		"~/.config/nvim/tests/init_spec.lua":    "default: tests/",
+		"~/.config/nvim/doc/help.txt":           "manifest: doc/*",
+		"~/.config/nvim/spell/en.utf-8.add":     ".dotpickerignore: nvim/spell/",
+		"~/.config/nvim/after/.DS_Store":        "default: .DS_Store",
+		".config/nvim/lua/private/old/keys.bak": "manifest: *.bak",
+	}
+	if !maps.Equal(excluded, wantExcluded) {
+		t.Errorf("excluded %v, want %v", excluded, wantExcluded)
+	}
+
+	// files named by an entry itself are never left out
+	wantFiles := []string{"CHANGELOG.md", "README.md", "config", "keys.lua", "lazy-lock.json"}
+	var got []string
+	for _, target := range files {
+		got = append(got, path.Base(target))
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, wantFiles) {
+		t.Errorf("kept %v, want %v", got, wantFiles)
+	}
+
+	// the closest entry's mode applies, other attributes are kept
+	wantAttrs := map[string]FileAttrs{
+		".ssh/config":                       {Mode: 0o600, CreateOnly: true},
+		".config/nvim/lua/private/keys.lua": {Mode: 0o700},
+	}
+	if !maps.Equal(attrs, wantAttrs) {
+		t.Errorf("attrs %v, want %v", attrs, wantAttrs)
+	}
+
+	if _, err := (PathSpec{Mode: "rw-------"}).FileMode(); err == nil {
+		t.Error("expected an error for a symbolic mode")
+	}
+	if mode, _ := (PathSpec{Mode: "0644"}).FileMode(); mode != fs.FileMode(0o644) {
+		t.Errorf("got mode %o", mode)
+	}
+}
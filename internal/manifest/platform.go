@@ -0,0 +1,160 @@
+// package manifest checks which machines a dotfile supports
+package manifest
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Platform says which machines a creator or dotfile is meant for
+// every field is optional, an empty one allows any machine
+type Platform struct {
+	// OS lists GOOS names ("linux", "darwin"...), "macos" works for darwin
+	OS []string `json:"os,omitempty"`
+
+	// Arch lists GOARCH names ("amd64", "arm64"...), uname -m spellings
+	// like x86_64 and aarch64 work too
+	Arch []string `json:"arch,omitempty"`
+
+	// Distros lists /etc/os-release ids, a distro also matches the ones in
+	// its ID_LIKE (so "arch" covers endeavouros); implies linux
+	Distros []string `json:"distros,omitempty"`
+
+	// Session is the graphical session the config needs, "wayland" or "x11"
+	Session string `json:"session,omitempty"`
+}
+
+// session types
+const (
+	SessionWayland = "wayland"
+	SessionX11     = "x11"
+)
+
+// Machine is what platform constraints are checked against
+type Machine struct {
+	OS           string   // runtime.GOOS
+	Arch         string   // runtime.GOARCH
+	Distro       string   // ID from /etc/os-release, empty off linux
+	DistroFamily []string // ID_LIKE from /etc/os-release
+	Session      string   // SessionWayland, SessionX11, or empty when unknown
+}
+
+// CurrentMachine describes the machine we're running on
+func CurrentMachine() Machine {
+	info := currentMachine()
+	return Machine{
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Distro:       info.distro,
+		DistroFamily: info.distroFamily,
+		Session:      detectSession(os.Getenv),
+	}
+}
+
+// detectSession guesses the graphical session from the environment, empty
+// for a tty, ssh or anything that isn't wayland or x11 (macos)
+func detectSession(getenv func(string) string) string {
+	switch strings.ToLower(getenv("XDG_SESSION_TYPE")) {
+	case SessionWayland:
+		return SessionWayland
+	case SessionX11:
+		return SessionX11
+	case "tty":
+		return ""
+	}
+	switch {
+	case getenv("WAYLAND_DISPLAY") != "":
+		return SessionWayland
+	case getenv("DISPLAY") != "" && runtime.GOOS != "darwin":
+		return SessionX11
+	}
+	return ""
+}
+
+// Unsupported says why p rules out m, e.g. "macos only", and is empty when
+// m is fine; a session constraint only counts once the session is known,
+// so a config can still be picked over ssh
+func (p Platform) Unsupported(m Machine) string {
+	if len(p.OS) > 0 && !slices.ContainsFunc(p.OS, func(name string) bool { return normalizeOS(name) == m.OS }) {
+		return osNames(p.OS) + " only"
+	}
+	if len(p.Arch) > 0 && !slices.ContainsFunc(p.Arch, func(arch string) bool { return normalizeArch(arch) == m.Arch }) {
+		return strings.Join(p.Arch, "/") + " only"
+	}
+	if len(p.Distros) > 0 && !slices.ContainsFunc(p.Distros, func(d string) bool {
+		return strings.EqualFold(d, m.Distro) || containsFold(m.DistroFamily, d)
+	}) {
+		return strings.Join(p.Distros, "/") + " only"
+	}
+	if p.Session != "" && m.Session != "" && !strings.EqualFold(p.Session, m.Session) {
+		return "needs " + sessionName(p.Session)
+	}
+	return ""
+}
+
+// Unsupported says why a creator's dotfile can't be used on m, counting
+// the creator's own constraints first; empty when it can
+func (c *Creator) Unsupported(d *Dotfile, m Machine) string {
+	if reason := c.Platform.Unsupported(m); reason != "" {
+		return reason
+	}
+	return d.Platform.Unsupported(m)
+}
+
+// normalizeOS turns the names people use for an os into its GOOS name
+func normalizeOS(name string) string {
+	switch name = strings.ToLower(name); name {
+	case "macos", "osx", "mac":
+		return "darwin"
+	default:
+		return name
+	}
+}
+
+// normalizeArch turns uname -m spellings into GOARCH names, the one
+// spelling platform checks and yadm alternates both compare in
+func normalizeArch(arch string) string {
+	switch arch = strings.ToLower(arch); arch {
+	case "x86_64", "x64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686", "x86":
+		return "386"
+	default:
+		return arch
+	}
+}
+
+// osNames lists oses for a message, darwin as people call it
+func osNames(oses []string) string {
+	names := make([]string, len(oses))
+	for i, name := range oses {
+		if names[i] = normalizeOS(name); names[i] == "darwin" {
+			names[i] = "macos"
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// sessionName is how a session type reads in a message
+func sessionName(session string) string {
+	if strings.EqualFold(session, SessionX11) {
+		return "X11"
+	}
+	return strings.ToLower(session)
+}
+
+// String describes the machine, e.g. "linux/amd64 fedora wayland"
+func (m Machine) String() string {
+	parts := []string{m.OS + "/" + m.Arch}
+	if m.Distro != "" {
+		parts = append(parts, m.Distro)
+	}
+	if m.Session != "" {
+		parts = append(parts, m.Session)
+	}
+	return strings.Join(parts, " ")
+}
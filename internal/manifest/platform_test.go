@@ -0,0 +1,99 @@
+package manifest
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlatformUnsupported(t *testing.T) {
+	fedora := Machine{OS: "linux", Arch: "amd64", Distro: "fedora", Session: SessionWayland}
+	endeavour := Machine{OS: "linux", Arch: "arm64", Distro: "endeavouros", DistroFamily: []string{"arch"}, Session: SessionX11}
+	mac := Machine{OS: "darwin", Arch: "arm64"}
+
+	tests := []struct {
+		name     string
+		platform Platform
+		machine  Machine
+		expected string
+	}{
+		{name: "no constraints", machine: fedora},
+		{name: "macos only on linux", platform: Platform{OS: []string{"macos"}}, machine: fedora, expected: "macos only"},
+		{name: "macos only on a mac", platform: Platform{OS: []string{"darwin"}}, machine: mac},
+		{name: "uname arch names", platform: Platform{Arch: []string{"aarch64"}}, machine: mac},
+		{name: "wrong arch", platform: Platform{Arch: []string{"x86_64"}}, machine: mac, expected: "x86_64 only"},
+		{name: "distro", platform: Platform{Distros: []string{"fedora"}}, machine: fedora},
+		{name: "distro family", platform: Platform{Distros: []string{"arch"}}, machine: endeavour},
+		{name: "other distro", platform: Platform{Distros: []string{"arch", "debian"}}, machine: fedora, expected: "arch/debian only"},
+		{name: "distros imply linux", platform: Platform{Distros: []string{"arch"}}, machine: mac, expected: "arch only"},
+		{name: "x11 config on wayland", platform: Platform{Session: SessionX11}, machine: fedora, expected: "needs X11"},
+		{name: "wayland config on wayland", platform: Platform{Session: SessionWayland}, machine: fedora},
+		{name: "unknown session", platform: Platform{Session: SessionWayland}, machine: mac},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.platform.Unsupported(tt.machine); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreatorUnsupported(t *testing.T) {
+	var creator Creator
+	data := `{"id": "mac", "os": ["macos"], "dotfiles": [{"id": "yabai", "paths": [".yabairc"], "session": "x11"}]}`
+	if err := json.Unmarshal([]byte(data), &creator); err != nil {
+		t.Fatal(err)
+	}
+
+	// the creator's constraints come first, then the dotfile's
+	dotfile := &creator.Dotfiles[0]
+	if got := creator.Unsupported(dotfile, Machine{OS: "linux", Session: SessionWayland}); got != "macos only" {
+		t.Errorf("got %q on linux", got)
+	}
+	if got := creator.Unsupported(dotfile, Machine{OS: "darwin", Session: SessionWayland}); got != "needs X11" {
+		t.Errorf("got %q on a mac under wayland", got)
+	}
+	if got := creator.Unsupported(dotfile, Machine{OS: "darwin"}); got != "" {
+		t.Errorf("got %q on a mac", got)
+	}
+}
+
+func TestDetectSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{name: "session type", env: map[string]string{"XDG_SESSION_TYPE": "wayland", "DISPLAY": ":0"}, expected: SessionWayland},
+		{name: "xwayland display", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, expected: SessionWayland},
+		{name: "tty", env: map[string]string{"XDG_SESSION_TYPE": "tty"}},
+		{name: "nothing", env: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectSession(func(key string) string { return tt.env[key] }); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchArch(t *testing.T) {
+	tests := []struct {
+		ours, theirs string
+		matches      bool
+	}{
+		{ours: "x86_64", theirs: "amd64", matches: true},
+		{ours: "x86_64", theirs: "x86_64", matches: true},
+		{ours: "arm64", theirs: "aarch64", matches: true},
+		{ours: "i686", theirs: "386", matches: true},
+		{ours: "x86_64", theirs: "arm64"},
+	}
+	for _, tt := range tests {
+		if got := (machineInfo{arch: tt.ours}).matchArch(tt.theirs); got != tt.matches {
+			t.Errorf("matchArch(%q) on %s = %v, want %v", tt.theirs, tt.ours, got, tt.matches)
+		}
+	}
+}
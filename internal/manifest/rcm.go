@@ -0,0 +1,117 @@
+// package manifest reads rcm dotfile directories
+package manifest
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// rcrc holds the rcrc settings that decide what rcup links
+type rcrc struct {
+	tags     []string
+	excludes []string
+	undotted []string
+}
+
+// readRcrc reads the repo's rcrc, a shell file of VAR="value" lines
+func readRcrc(repoPath string) rcrc {
+	var rc rcrc
+	f, err := os.Open(filepath.Join(repoPath, "rcrc"))
+	if err != nil {
+		return rc
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Trim(value, `"'`))
+		switch key {
+		case "TAGS":
+			rc.tags = fields
+		case "EXCLUDES":
+			rc.excludes = fields
+		case "UNDOTTED":
+			rc.undotted = fields
+		}
+	}
+	return rc
+}
+
+// decodeRcm maps an rcm dotfiles directory like rcup does: top-level names
+// get a leading dot (unless UNDOTTED), tag-<tag> directories for the rcrc's
+// TAGS and host-<hostname> for this machine override the plain files
+func decodeRcm(l *Layout) error {
+	rc := readRcrc(l.Root)
+	machine := currentMachine()
+
+	dirs := []string{""}
+	for _, tag := range rc.tags {
+		dirs = append(dirs, "tag-"+tag)
+	}
+	dirs = append(dirs, "host-"+machine.hostname)
+
+	for _, dir := range dirs {
+		root := filepath.Join(l.Root, dir)
+		if !dirExists(root) {
+			continue
+		}
+
+		skip := func(rel string, isDir bool) bool {
+			name := path.Base(rel)
+			if !strings.Contains(rel, "/") {
+				// dotfiles in the dotfiles dir are ignored, as are rcm's own dirs
+				if strings.HasPrefix(name, ".") || name == "hooks" ||
+					(dir == "" && (strings.HasPrefix(name, "tag-") || strings.HasPrefix(name, "host-"))) {
+					return true
+				}
+			}
+			return rcmExcluded(rc.excludes, rel)
+		}
+		err := walkTree(root, skip, func(rel, source string) {
+			first, rest, _ := strings.Cut(rel, "/")
+			if !rcmUndotted(rc.undotted, first) {
+				first = "." + first
+			}
+			l.add(source, path.Join(first, rest))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rcmExcluded matches EXCLUDES patterns, which may be prefixed with the
+// dotfiles dir they apply to (dir:pattern)
+func rcmExcluded(excludes []string, rel string) bool {
+	for _, pattern := range excludes {
+		if _, p, ok := strings.Cut(pattern, ":"); ok {
+			pattern = p
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rcmUndotted reports whether a top-level name is linked without a dot
+func rcmUndotted(undotted []string, name string) bool {
+	for _, pattern := range undotted {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+// package manifest verifies minisign signatures on manifests
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// manifests are signed with minisign (https://jedisct1.github.io/minisign/):
+// `minisign -Sm manifest.json` writes manifest.json.minisig next to it, and
+// the public key is the base64 line of minisign.pub
+
+// SignatureSuffix is appended to a manifest's url or path to find its signature
+const SignatureSuffix = ".minisig"
+
+// minisign algorithm ids: "Ed" signs the file, "ED" its blake2b-512 hash
+var (
+	algLegacy    = [2]byte{'E', 'd'}
+	algPrehashed = [2]byte{'E', 'D'}
+)
+
+// signature verification errors
+var (
+	ErrUnsigned     = errors.New("manifest isn't signed")
+	ErrUntrustedKey = errors.New("manifest is signed with a key that isn't trusted")
+	ErrBadSignature = errors.New("manifest signature doesn't match, it may have been tampered with")
+	ErrMalformedKey = errors.New("malformed minisign public key")
+	ErrMalformedSig = errors.New("malformed minisign signature")
+
+	errNoTrustedKeys = errors.New("no trusted keys configured")
+)
+
+// minisign file layout
+const (
+	untrustedComment  = "untrusted comment:"
+	trustedComment    = "trusted comment:"
+	keyIDLen          = 8
+	sigLen            = ed25519.SignatureSize
+	publicKeyBlobSize = 2 + keyIDLen + ed25519.PublicKeySize
+)
+
+// PublicKey is a trusted minisign public key
+type PublicKey struct {
+	ID  [8]byte
+	Key ed25519.PublicKey
+}
+
+// KeyID is the key id the way minisign prints it
+func (k PublicKey) KeyID() string {
+	return keyIDString(k.ID)
+}
+
+// ParsePublicKey reads a minisign public key, either the base64 line or a
+// whole minisign.pub file with its comment
+func ParsePublicKey(s string) (PublicKey, error) {
+	var line string
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, untrustedComment) {
+			line = l
+			break
+		}
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(blob) != publicKeyBlobSize || [2]byte(blob[:2]) != algLegacy {
+		return PublicKey{}, ErrMalformedKey
+	}
+
+	var key PublicKey
+	copy(key.ID[:], blob[2:2+keyIDLen])
+	key.Key = ed25519.PublicKey(blob[2+keyIDLen:])
+	return key, nil
+}
+
+// ParsePublicKeys reads several keys, saying which one is broken
+func ParsePublicKeys(keys []string) ([]PublicKey, error) {
+	parsed := make([]PublicKey, 0, len(keys))
+	for i, k := range keys {
+		key, err := ParsePublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		parsed = append(parsed, key)
+	}
+	return parsed, nil
+}
+
+// signature is a parsed .minisig file
+type signature struct {
+	algorithm [2]byte
+	keyID     [8]byte
+	sig       []byte
+	comment   string // the trusted comment
+	globalSig []byte // signs sig and the trusted comment
+}
+
+// parseSignature reads a .minisig file
+func parseSignature(data []byte) (*signature, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], untrustedComment) || !strings.HasPrefix(lines[2], trustedComment) {
+		return nil, ErrMalformedSig
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(blob) != 2+keyIDLen+sigLen {
+		return nil, ErrMalformedSig
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != sigLen {
+		return nil, ErrMalformedSig
+	}
+
+	s := &signature{
+		sig:       blob[2+keyIDLen:],
+		comment:   strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), trustedComment+" "),
+		globalSig: global,
+	}
+	copy(s.algorithm[:], blob[:2])
+	copy(s.keyID[:], blob[2:2+keyIDLen])
+	if s.algorithm != algLegacy && s.algorithm != algPrehashed {
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrMalformedSig, s.algorithm[:])
+	}
+	return s, nil
+}
+
+// VerifySignature checks data against a .minisig signature made by one of
+// keys and returns that key; sig is nil when the manifest isn't signed
+func VerifySignature(data, sig []byte, keys []PublicKey) (PublicKey, error) {
+	if len(keys) == 0 {
+		return PublicKey{}, errNoTrustedKeys
+	}
+	if sig == nil {
+		return PublicKey{}, ErrUnsigned
+	}
+	s, err := parseSignature(sig)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	for _, key := range keys {
+		if key.ID != s.keyID {
+			continue
+		}
+
+		message := data
+		if s.algorithm == algPrehashed {
+			sum := blake2b.Sum512(data)
+			message = sum[:]
+		}
+		if !ed25519.Verify(key.Key, message, s.sig) {
+			return PublicKey{}, ErrBadSignature
+		}
+		// the trusted comment is signed too, minisign checks it the same way
+		global := append(bytes.Clone(s.sig), s.comment...)
+		if !ed25519.Verify(key.Key, global, s.globalSig) {
+			return PublicKey{}, ErrBadSignature
+		}
+		return key, nil
+	}
+	return PublicKey{}, fmt.Errorf("%w (key id %s)", ErrUntrustedKey, keyIDString(s.keyID))
+}
+
+// keyIDString renders a key id like minisign does, as big-endian hex of
+// the little-endian number
+func keyIDString(id [8]byte) string {
+	reversed := make([]byte, len(id))
+	for i := range id {
+		reversed[i] = id[len(id)-1-i]
+	}
+	return strings.ToUpper(hex.EncodeToString(reversed))
+}
+
+// Trust is how far a manifest's signature checked out
+type Trust int
+
+const (
+	// TrustUnchecked means no keys are configured, so nothing was checked
+	TrustUnchecked Trust = iota
+
+	// TrustVerified means a trusted key signed the manifest
+	TrustVerified
+
+	// TrustUnsigned means keys are configured but the manifest has no
+	// signature, it's only used when signatures aren't required
+	TrustUnsigned
+)
+
+// SignaturePolicy is how a Fetcher treats signatures
+type SignaturePolicy struct {
+	// Keys are trusted to sign the manifest, none turns checking off
+	Keys []PublicKey
+
+	// Require rejects unsigned manifests instead of warning about them
+	// a signature that doesn't verify is always rejected
+	Require bool
+}
+
+// check verifies a manifest against the policy, returning how trusted it is
+// and the key that signed it
+func (p SignaturePolicy) check(data, sig []byte) (Trust, string, error) {
+	if len(p.Keys) == 0 {
+		return TrustUnchecked, "", nil
+	}
+	key, err := VerifySignature(data, sig, p.Keys)
+	switch {
+	case err == nil:
+		return TrustVerified, key.KeyID(), nil
+	case errors.Is(err, ErrUnsigned) && !p.Require:
+		return TrustUnsigned, "", nil
+	default:
+		return TrustUnchecked, "", err
+	}
+}
@@ -0,0 +1,201 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testKey is a minisign key pair for signing test manifests
+type testKey struct {
+	id      [8]byte
+	private ed25519.PrivateKey
+	public  string // the base64 line of minisign.pub
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key testKey
+	if _, err := rand.Read(key.id[:]); err != nil {
+		t.Fatal(err)
+	}
+	key.private = private
+	key.public = base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), key.id[:]...), public...))
+	return key
+}
+
+// sign writes a .minisig the way `minisign -S` does, prehashed unless
+// legacy is set
+func (k testKey) sign(data []byte, legacy bool) []byte {
+	alg, message := "ED", data
+	if legacy {
+		alg = "Ed"
+	} else {
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	}
+	sig := ed25519.Sign(k.private, message)
+	comment := "timestamp:1760000000\tfile:manifest.json"
+	global := ed25519.Sign(k.private, append(append([]byte{}, sig...), comment...))
+
+	blob := append(append([]byte(alg), k.id[:]...), sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(blob), comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestVerifySignature(t *testing.T) {
+	data := []byte(creatorJSON)
+	key, other := newTestKey(t), newTestKey(t)
+	trusted, err := ParsePublicKeys([]string{"untrusted comment: minisign public key\n" + key.public + "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the trusted comment is covered by the global signature
+	tampered := bytes.Replace(key.sign(data, false), []byte("timestamp:1760000000"), []byte("timestamp:1760000001"), 1)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sig     []byte
+		wantErr error
+	}{
+		{name: "prehashed", data: data, sig: key.sign(data, false)},
+		{name: "legacy", data: data, sig: key.sign(data, true)},
+		{name: "tampered manifest", data: append([]byte(" "), data...), sig: key.sign(data, false), wantErr: ErrBadSignature},
+		{name: "tampered trusted comment", data: data, sig: tampered, wantErr: ErrBadSignature},
+		{name: "untrusted key", data: data, sig: other.sign(data, false), wantErr: ErrUntrustedKey},
+		{name: "unsigned", data: data, wantErr: ErrUnsigned},
+		{name: "malformed", data: data, sig: []byte("not a signature"), wantErr: ErrMalformedSig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := VerifySignature(tt.data, tt.sig, trusted)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && signer.ID != key.id {
+				t.Errorf("got signer %s, want %s", signer.KeyID(), keyIDString(key.id))
+			}
+		})
+	}
+
+	if _, err := ParsePublicKey("not a key"); !errors.Is(err, ErrMalformedKey) {
+		t.Errorf("expected ErrMalformedKey, got %v", err)
+	}
+}
+
+func TestFetchVerifiesSignatures(t *testing.T) {
+	key, other := newTestKey(t), newTestKey(t)
+	trusted, err := ParsePublicKeys([]string{key.public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(creatorJSON)
+
+	tests := []struct {
+		name    string
+		sig     []byte // served next to the manifest, nil for a 404
+		keys    []PublicKey
+		require bool
+		cached  bool
+
+		trust   Trust
+		action  FetchAction
+		wantErr bool
+	}{
+		{name: "signed", sig: key.sign(data, false), keys: trusted, trust: TrustVerified, action: FetchDownloaded},
+		{name: "no keys configured", keys: nil, trust: TrustUnchecked, action: FetchDownloaded},
+		{name: "unsigned warns", keys: trusted, trust: TrustUnsigned, action: FetchDownloaded},
+		{name: "unsigned is rejected when required", keys: trusted, require: true, wantErr: true},
+		{name: "untrusted key", sig: other.sign(data, false), keys: trusted, wantErr: true},
+		{
+			name:   "unsigned doesn't replace the signed cache",
+			keys:   trusted,
+			cached: true,
+			trust:  TrustVerified,
+			action: FetchFallback,
+		},
+		{
+			name:   "tampered falls back to the signed cache",
+			sig:    key.sign(append([]byte(" "), data...), false),
+			keys:   trusted,
+			cached: true,
+			trust:  TrustVerified,
+			action: FetchFallback,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/manifest.json":
+					w.Write(data)
+				case r.URL.Path == "/manifest.json"+SignatureSuffix && tt.sig != nil:
+					w.Write(tt.sig)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			f := NewFetcher(server.URL+"/manifest.json", filepath.Join(t.TempDir(), "manifest.json"))
+			f.SetSignaturePolicy(SignaturePolicy{Keys: tt.keys, Require: tt.require})
+			if tt.cached {
+				if err := f.saveCache(data, key.sign(data, true), fetchMeta{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, result, err := f.FetchWithResult(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Action != tt.action || result.Trust != tt.trust {
+				t.Errorf("got action %d trust %d, want %d and %d", result.Action, result.Trust, tt.action, tt.trust)
+			}
+			if tt.trust == TrustVerified && result.Signer != keyIDString(key.id) {
+				t.Errorf("got signer %q", result.Signer)
+			}
+
+			// the cache is checked again when it's read
+			if tt.trust == TrustVerified {
+				f.SetSignaturePolicy(SignaturePolicy{Keys: mustParseKeys(t, other.public), Require: true})
+				if _, _, err := f.loadCache(); err == nil {
+					t.Error("expected the cache to be rejected by a different key")
+				}
+			}
+		})
+	}
+}
+
+func mustParseKeys(t *testing.T, keys ...string) []PublicKey {
+	t.Helper()
+	parsed, err := ParsePublicKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
@@ -0,0 +1,116 @@
+// package manifest builds sparse-checkout patterns from dotfile paths
+package manifest
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// SparsePatterns returns gitignore-style sparse-checkout patterns covering
+// every place ResolveFilePath might find the given dotfile paths
+// root-level files are always included so layout markers like .chezmoiroot
+// and flat dotfiles are still visible to DetectStructure
+func SparsePatterns(paths []string) []string {
+	patterns := []string{
+		"/*",   // every file at the repo root
+		"!/*/", // but no top-level directories unless matched below
+	}
+
+	seen := make(map[string]bool)
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, p := range paths {
+		for _, candidate := range candidateLocations(p) {
+			// at the root, or one level down inside a stow-style package
+			add("/" + candidate)
+			add("/*/" + candidate)
+		}
+	}
+
+	return patterns
+}
+
+// candidateLocations lists repo-relative spots a dotfile path may live at
+// mirrors the lookups done by ResolveFilePath and the structure finders
+func candidateLocations(relativePath string) []string {
+	clean := path.Clean(strings.TrimPrefix(strings.TrimPrefix(relativePath, "~"), "/"))
+	if clean == "." || clean == "" {
+		return nil
+	}
+
+	candidates := []string{clean}
+
+	// without the leading dot, at the root (".tmux.conf" -> "tmux.conf")
+	base := path.Base(clean)
+	if strings.HasPrefix(base, ".") {
+		candidates = append(candidates, strings.TrimPrefix(base, "."))
+	}
+
+	// directory aliases (".config" -> "xdg_config", "~" -> "home")
+	aliases := make([]string, 0, len(pathAliases))
+	for pattern := range pathAliases {
+		aliases = append(aliases, pattern)
+	}
+	sort.Strings(aliases)
+
+	for _, pattern := range aliases {
+		replacements := pathAliases[pattern]
+		if pattern == "~" {
+			if strings.HasPrefix(relativePath, "~") {
+				for _, replacement := range replacements {
+					candidates = append(candidates, path.Join(replacement, clean))
+				}
+			}
+			continue
+		}
+		if strings.Contains(clean, pattern) {
+			for _, replacement := range replacements {
+				candidates = append(candidates, strings.Replace(clean, pattern, replacement, 1))
+			}
+		}
+	}
+
+	// chezmoi source names (".config/nvim" -> "dot_config/nvim")
+	parts := strings.Split(clean, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			parts[i] = "dot_" + strings.TrimPrefix(part, ".")
+		}
+	}
+	if chezmoi := strings.Join(parts, "/"); chezmoi != clean {
+		candidates = append(candidates, chezmoi)
+	}
+	// with attribute prefixes and a .tmpl suffix ("private_dot_ssh/config.tmpl")
+	for i := range parts {
+		parts[i] = "*" + parts[i]
+	}
+	candidates = append(candidates, strings.Join(parts, "/")+"*")
+
+	// single config directory layout
+	candidates = append(candidates, path.Join("config", clean))
+
+	return candidates
+}
+
+// DotfileSparsePatterns is SparsePatterns for a dotfile's entries, a named
+// source is covered where it is; nil (a full clone) when one is the repo
+func DotfileSparsePatterns(d *Dotfile) []string {
+	paths := make([]string, 0, len(d.Paths))
+	for _, p := range d.Paths {
+		if !p.Explicit() {
+			paths = append(paths, p.Path())
+			continue
+		}
+		if path.Clean(p.Source) == "." {
+			return nil
+		}
+		paths = append(paths, p.Source)
+	}
+	return SparsePatterns(paths)
+}
@@ -0,0 +1,47 @@
+// package manifest contains tests for sparse-checkout pattern generation
+package manifest
+
+import "testing"
+
+// TestSparsePatterns checks every lookup location is covered
+func TestSparsePatterns(t *testing.T) {
+	patterns := SparsePatterns([]string{".config/nvim", "~/.bashrc"})
+
+	has := make(map[string]bool)
+	for _, p := range patterns {
+		has[p] = true
+	}
+
+	expected := []string{
+		"/*", "!/*/", // root files for structure detection
+		"/.config/nvim", "/*/.config/nvim", // exact and stow package
+		"/xdg_config/nvim", "/config/nvim", // .config aliases
+		"/dot_config/nvim",     // chezmoi
+		"/*dot_config/*nvim*",  // chezmoi with attributes
+		"/config/.config/nvim", // config directory layout
+		"/home/.bashrc",        // ~ alias
+		"/bashrc",              // without leading dot
+	}
+	for _, e := range expected {
+		if !has[e] {
+			t.Errorf("expected pattern %q in %v", e, patterns)
+		}
+	}
+}
+
+// TestSparsePatternsDeterministic makes sure repeated calls agree
+// (cached sparse checkouts compare pattern lists when widening)
+func TestSparsePatternsDeterministic(t *testing.T) {
+	first := SparsePatterns([]string{".config/nvim", ".tmux.conf"})
+	for i := 0; i < 10; i++ {
+		again := SparsePatterns([]string{".config/nvim", ".tmux.conf"})
+		if len(again) != len(first) {
+			t.Fatalf("pattern count changed: %d vs %d", len(again), len(first))
+		}
+		for j := range first {
+			if first[j] != again[j] {
+				t.Fatalf("pattern %d changed: %q vs %q", j, first[j], again[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,593 @@
+// package manifest decodes GNU Stow directories into target paths
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// stowDefaultIgnore is stow's built-in ignore list, used by packages
+// without a .stow-local-ignore when the repo has no .stow-global-ignore
+var stowDefaultIgnore = []string{
+	`RCS`, `.+,v`, `CVS`, `\.\#.+`, `\.cvsignore`, `\.svn`, `_darcs`, `\.hg`,
+	`\.git`, `\.gitignore`, `\.gitmodules`, `.+~`, `\#.*\#`,
+	`^/README.*`, `^/LICENSE.*`, `^/COPYING`,
+}
+
+// StowEntry is one file or directory a package puts in the target tree
+type StowEntry struct {
+	Package string
+	Source  string // absolute path in the repo
+	Target  string // slash-separated, relative to home
+	Dir     bool
+}
+
+// StowConflict is a target more than one package provides
+type StowConflict struct {
+	Target   string
+	Packages []string
+}
+
+// StowState is a decoded stow directory
+type StowState struct {
+	// Root is the stow directory, the repo root
+	Root string
+
+	// Packages are the package names in use, sorted
+	Packages []string
+
+	// Dotfiles is stow's --dotfiles: dot-foo is stowed as .foo
+	Dotfiles bool
+
+	// NoFolding is stow's --no-folding: always link files, never directories
+	NoFolding bool
+
+	// Entries are sorted by Target then Package, ignored files are left out
+	Entries []StowEntry
+}
+
+// DecodeStow maps a stow directory to target paths like `stow --dotfiles`
+// would, settings picks the packages (all top-level directories without it)
+// and whether dot- prefixes are used, the rest comes from the repo's .stowrc
+func DecodeStow(repoPath string, settings *Stow) (*StowState, error) {
+	state := &StowState{Root: repoPath}
+	rc := readStowrc(repoPath)
+	state.NoFolding = rc.noFolding
+
+	packages, err := stowPackages(repoPath, settings)
+	if err != nil {
+		return nil, err
+	}
+	state.Packages = packages
+
+	switch {
+	case settings != nil && settings.Dotfiles != nil:
+		state.Dotfiles = *settings.Dotfiles
+	case rc.dotfiles:
+		state.Dotfiles = true
+	default:
+		state.Dotfiles = usesDotPrefix(repoPath, packages)
+	}
+
+	global, err := readStowIgnore(filepath.Join(repoPath, ".stow-global-ignore"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range packages {
+		dir := filepath.Join(repoPath, pkg)
+		patterns, err := readStowIgnore(filepath.Join(dir, ".stow-local-ignore"))
+		if err != nil {
+			return nil, err
+		}
+		if patterns == nil {
+			patterns = global
+		}
+		if patterns == nil {
+			patterns = stowDefaultIgnore
+		}
+		ignore, err := compileStowIgnore(append(patterns, rc.ignore...))
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", pkg, err)
+		}
+		if err := state.walk(pkg, dir, "", "", ignore); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(state.Entries, func(i, j int) bool {
+		if state.Entries[i].Target != state.Entries[j].Target {
+			return state.Entries[i].Target < state.Entries[j].Target
+		}
+		return state.Entries[i].Package < state.Entries[j].Package
+	})
+	return state, nil
+}
+
+// stowPackages lists the package directories, checking the ones asked for
+func stowPackages(repoPath string, settings *Stow) ([]string, error) {
+	if settings != nil && len(settings.Packages) > 0 {
+		packages := append([]string(nil), settings.Packages...)
+		for _, pkg := range packages {
+			if strings.ContainsAny(pkg, `/\`) || !dirExists(filepath.Join(repoPath, pkg)) {
+				return nil, fmt.Errorf("stow package %s doesn't exist", pkg)
+			}
+		}
+		sort.Strings(packages)
+		return packages, nil
+	}
+
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", repoPath, err)
+	}
+	var packages []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			packages = append(packages, entry.Name())
+		}
+	}
+	return packages, nil
+}
+
+// walk adds the entries of one package directory, rel is the path inside
+// the package and targetDir where it lands
+func (s *StowState) walk(pkg, dir, rel, targetDir string, ignore *stowIgnore) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		entryRel := path.Join(rel, name)
+		if name == ".stow-local-ignore" || ignore.match(entryRel) {
+			continue
+		}
+
+		target := path.Join(targetDir, s.targetName(name))
+		source := filepath.Join(dir, name)
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			// stow links whatever the package's symlink is, follow it to see which
+			isDir = dirExists(source)
+		}
+
+		s.Entries = append(s.Entries, StowEntry{Package: pkg, Source: source, Target: target, Dir: isDir})
+		if isDir && entry.IsDir() {
+			if err := s.walk(pkg, source, entryRel, target, ignore); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// targetName undoes the --dotfiles dot- prefix
+func (s *StowState) targetName(name string) string {
+	if s.Dotfiles && strings.HasPrefix(name, "dot-") && len(name) > len("dot-") {
+		return "." + strings.TrimPrefix(name, "dot-")
+	}
+	return name
+}
+
+// Lookup returns every entry for a target path, one per package providing it
+func (s *StowState) Lookup(target string) []StowEntry {
+	target = normalizeTarget(target)
+	i := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].Target >= target })
+	var found []StowEntry
+	for ; i < len(s.Entries) && s.Entries[i].Target == target; i++ {
+		found = append(found, s.Entries[i])
+	}
+	return found
+}
+
+// splitPackage splits a target that names its package first, such as
+// "git-work/.gitconfig", ok is false when the first part isn't a package
+func (s *StowState) splitPackage(target string) (pkg, rest string, ok bool) {
+	pkg, rest, found := strings.Cut(normalizeTarget(target), "/")
+	if !found || rest == "" || !s.hasPackage(pkg) {
+		return "", "", false
+	}
+	return pkg, rest, true
+}
+
+// Under returns the entries at or inside target, empty or "." means all
+func (s *StowState) Under(target string) []StowEntry {
+	target = normalizeTarget(target)
+	var entries []StowEntry
+	for _, e := range s.Entries {
+		if target == "." || e.Target == target || strings.HasPrefix(e.Target, target+"/") {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Conflicts returns the targets stow would refuse to link: files provided
+// by more than one package, or a file in one and a directory in another
+// directories in several packages are fine, stow merges them
+func (s *StowState) Conflicts() []StowConflict {
+	var conflicts []StowConflict
+	for i := 0; i < len(s.Entries); {
+		j := i
+		files := 0
+		for ; j < len(s.Entries) && s.Entries[j].Target == s.Entries[i].Target; j++ {
+			if !s.Entries[j].Dir {
+				files++
+			}
+		}
+		if j-i > 1 && files > 0 {
+			conflict := StowConflict{Target: s.Entries[i].Target}
+			for _, e := range s.Entries[i:j] {
+				conflict.Packages = append(conflict.Packages, e.Package)
+			}
+			conflicts = append(conflicts, conflict)
+		}
+		i = j
+	}
+	return conflicts
+}
+
+// StowPlan is what stowing part of a stow directory comes down to
+type StowPlan struct {
+	// Files maps sources to targets, like a plain repo's file map
+	// when linking, a folded directory is a single entry
+	Files map[string]string
+
+	// Attrs marks the targets that are linked rather than copied
+	Attrs map[string]FileAttrs
+
+	// Skipped lists conflicting targets and which packages provide them
+	Skipped map[string]string
+
+	// Folded are the directory targets linked as a whole
+	Folded []string
+
+	// Unfold are existing directory links into the stow directory (folded
+	// by an earlier stow of another package) that have to become real
+	// directories before anything is linked inside them, shallowest first
+	Unfold []string
+
+	// Packages are the packages the plan takes files from
+	Packages []string
+
+	// Sources are the repo-relative paths target was found at, one per
+	// package, empty when no package has it
+	Sources []string
+}
+
+// Plan builds the file map for target, a manifest path such as
+// ".config/nvim", a package name (the whole package is stowed) or a path
+// in one package, "git-work/.gitconfig", which wins over the conflict
+// with link set, targets become symlinks into the repo and directories only
+// one package provides are folded into one link, like stow does; home is
+// checked for links an earlier stow left behind
+func (s *StowState) Plan(target, home string, link bool) *StowPlan {
+	plan := &StowPlan{
+		Files:   make(map[string]string),
+		Attrs:   make(map[string]FileAttrs),
+		Skipped: make(map[string]string),
+	}
+
+	entries := s.Under(target)
+	base := normalizeTarget(target)
+	dest := func(e StowEntry) string {
+		rel := strings.TrimPrefix(strings.TrimPrefix(e.Target, base), "/")
+		if base == "." {
+			rel = e.Target
+		}
+		return filepath.Join(target, filepath.FromSlash(rel))
+	}
+	// naming a package picks it, conflicts with other packages don't matter
+	explicit := false
+	if len(entries) == 0 && s.hasPackage(base) {
+		entries = s.packageEntries(base)
+		dest = func(e StowEntry) string { return filepath.FromSlash(e.Target) }
+		plan.Sources = []string{base}
+		explicit = true
+	} else if pkg, rest, ok := s.splitPackage(base); len(entries) == 0 && ok {
+		for _, e := range s.Under(rest) {
+			if e.Package != pkg {
+				continue
+			}
+			entries = append(entries, e)
+			if rel, err := filepath.Rel(s.Root, e.Source); err == nil && e.Target == rest {
+				plan.Sources = append(plan.Sources, filepath.ToSlash(rel))
+			}
+		}
+		base = rest
+		dest = func(e StowEntry) string {
+			return filepath.Join(filepath.FromSlash(rest), filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(e.Target, rest), "/")))
+		}
+		explicit = true
+	} else {
+		for _, e := range s.Lookup(base) {
+			if rel, err := filepath.Rel(s.Root, e.Source); err == nil {
+				plan.Sources = append(plan.Sources, filepath.ToSlash(rel))
+			}
+		}
+	}
+
+	conflicts := make(map[string][]string)
+	for _, c := range s.Conflicts() {
+		conflicts[c.Target] = c.Packages
+	}
+	providers := make(map[string]int)
+	for _, e := range s.Entries {
+		providers[e.Target]++
+	}
+
+	// earlier stows may have folded directories we now need to link inside,
+	// starting with the ones above target
+	unfolded := make(map[string]string)
+	existing := func(targetPath string) (string, bool) {
+		if old, ok := unfolded[path.Dir(targetPath)]; ok {
+			// once unfolded, the parent holds links to what it pointed at
+			candidate := filepath.Join(old, path.Base(targetPath))
+			if pathExistsLstat(candidate) {
+				return candidate, true
+			}
+			return "", false
+		}
+		full := filepath.Join(home, filepath.FromSlash(targetPath))
+		if owner, isLink := s.linkOwner(full); isLink {
+			return owner, true
+		}
+		return "", pathExistsLstat(full)
+	}
+	if link && base != "." && len(entries) > 0 && entries[0].Target == base {
+		var ancestors []string
+		for dir := path.Dir(base); dir != "."; dir = path.Dir(dir) {
+			ancestors = append([]string{dir}, ancestors...)
+		}
+		for _, dir := range ancestors {
+			if owner, ok := existing(dir); ok && owner != "" && dirExists(owner) {
+				plan.Unfold = append(plan.Unfold, filepath.FromSlash(dir))
+				unfolded[dir] = owner
+			}
+		}
+	}
+
+	packages := make(map[string]bool)
+	var folded []string
+	for _, e := range entries {
+		if insideAny(e.Target, folded) {
+			continue
+		}
+		to := dest(e)
+		if pkgs, ok := conflicts[e.Target]; ok && !explicit {
+			plan.Skipped[to] = "conflict: provided by packages " + strings.Join(pkgs, ", ")
+			continue
+		}
+		if !link {
+			if !e.Dir {
+				plan.Files[e.Source] = to
+				packages[e.Package] = true
+			}
+			continue
+		}
+
+		// owner is where an existing link points, inside the stow directory
+		owner, exists := existing(e.Target)
+		if owner == e.Source {
+			// stowed already
+			if e.Dir {
+				folded = append(folded, e.Target)
+			}
+			continue
+		}
+
+		if e.Dir {
+			switch {
+			case owner != "" && dirExists(owner):
+				plan.Unfold = append(plan.Unfold, to)
+				unfolded[e.Target] = owner
+			case !exists && !s.NoFolding && providers[e.Target] == 1:
+				plan.Files[e.Source] = to
+				plan.Attrs[to] = FileAttrs{Link: true}
+				plan.Folded = append(plan.Folded, to)
+				folded = append(folded, e.Target)
+				packages[e.Package] = true
+			}
+			continue
+		}
+
+		plan.Files[e.Source] = to
+		plan.Attrs[to] = FileAttrs{Link: true}
+		packages[e.Package] = true
+	}
+
+	for pkg := range packages {
+		plan.Packages = append(plan.Packages, pkg)
+	}
+	sort.Strings(plan.Packages)
+	return plan
+}
+
+// hasPackage reports whether name is one of the packages in use
+func (s *StowState) hasPackage(name string) bool {
+	i := sort.SearchStrings(s.Packages, name)
+	return i < len(s.Packages) && s.Packages[i] == name
+}
+
+// packageEntries returns everything one package provides
+func (s *StowState) packageEntries(pkg string) []StowEntry {
+	var entries []StowEntry
+	for _, e := range s.Entries {
+		if e.Package == pkg {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// linkOwner reports whether path is a symlink and, if it points into the
+// stow directory, the source it points at (links elsewhere aren't ours)
+func (s *StowState) linkOwner(path string) (string, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return "", true
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(path), dest)
+	}
+	dest = filepath.Clean(dest)
+	root := filepath.Clean(s.Root)
+	if dest != root && !strings.HasPrefix(dest, root+string(filepath.Separator)) {
+		return "", true
+	}
+	return dest, true
+}
+
+// insideAny reports whether target is inside one of dirs
+func insideAny(target string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(target, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pathExistsLstat checks if a path exists without following a final symlink
+func pathExistsLstat(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// stowrc holds the .stowrc options that change what gets stowed
+type stowrc struct {
+	dotfiles  bool
+	noFolding bool
+	ignore    []string
+}
+
+// readStowrc reads the options from the repo's .stowrc, if it has one
+func readStowrc(repoPath string) stowrc {
+	var rc stowrc
+	f, err := os.Open(filepath.Join(repoPath, ".stowrc"))
+	if err != nil {
+		return rc
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, opt := range strings.Fields(scanner.Text()) {
+			switch {
+			case opt == "--dotfiles":
+				rc.dotfiles = true
+			case opt == "--no-folding":
+				rc.noFolding = true
+			case strings.HasPrefix(opt, "--ignore="):
+				rc.ignore = append(rc.ignore, strings.TrimPrefix(opt, "--ignore=")+`\z`)
+			}
+		}
+	}
+	return rc
+}
+
+// usesDotPrefix guesses --dotfiles for repos without a .stowrc saying so
+func usesDotPrefix(repoPath string, packages []string) bool {
+	for _, pkg := range packages {
+		entries, err := os.ReadDir(filepath.Join(repoPath, pkg))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "dot-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readStowIgnore reads an ignore file, nil when there isn't one
+func readStowIgnore(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", file, err)
+	}
+
+	comment := regexp.MustCompile(`\s+#.+`)
+	patterns := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = comment.ReplaceAllString(line, "")
+		patterns = append(patterns, strings.ReplaceAll(line, `\#`, "#"))
+	}
+	return patterns, nil
+}
+
+// stowIgnore is a compiled ignore list
+// patterns with a / match the package-relative path (with a leading /),
+// the rest match the base name
+type stowIgnore struct {
+	path    *regexp.Regexp
+	segment *regexp.Regexp
+	suffix  *regexp.Regexp
+}
+
+// compileStowIgnore compiles patterns the way stow does
+// patterns ending in \z come from --ignore and match a path suffix
+func compileStowIgnore(patterns []string) (*stowIgnore, error) {
+	var paths, segments, suffixes []string
+	for _, p := range patterns {
+		switch {
+		case strings.HasSuffix(p, `\z`):
+			suffixes = append(suffixes, p)
+		case strings.Contains(p, "/"):
+			paths = append(paths, p)
+		default:
+			segments = append(segments, p)
+		}
+	}
+
+	ignore := &stowIgnore{}
+	var err error
+	if len(paths) > 0 {
+		if ignore.path, err = regexp.Compile(`(^|/)(` + strings.Join(paths, "|") + `)(/|$)`); err != nil {
+			return nil, fmt.Errorf("bad ignore pattern: %w", err)
+		}
+	}
+	if len(segments) > 0 {
+		if ignore.segment, err = regexp.Compile(`^(` + strings.Join(segments, "|") + `)$`); err != nil {
+			return nil, fmt.Errorf("bad ignore pattern: %w", err)
+		}
+	}
+	if len(suffixes) > 0 {
+		if ignore.suffix, err = regexp.Compile(`(` + strings.Join(suffixes, "|") + `)`); err != nil {
+			return nil, fmt.Errorf("bad ignore pattern: %w", err)
+		}
+	}
+	return ignore, nil
+}
+
+// match reports whether a package-relative path is ignored
+func (ig *stowIgnore) match(rel string) bool {
+	if ig.suffix != nil && ig.suffix.MatchString(rel) {
+		return true
+	}
+	if ig.path != nil && ig.path.MatchString("/"+rel) {
+		return true
+	}
+	return ig.segment != nil && ig.segment.MatchString(path.Base(rel))
+}
@@ -0,0 +1,260 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stowTestRepo is a stow directory using --dotfiles, with two packages
+// sharing .config and both shipping a .gitconfig
+func stowTestRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".stowrc":                                "--dotfiles --ignore=\\.swp\n",
+		"README.md":                              "my dots\n",
+		"nvim/dot-config/nvim/init.lua":          "-- nvim\n",
+		"nvim/dot-config/nvim/lua/plugins.lua":   "return {}\n",
+		"nvim/dot-config/nvim/.init.lua.swp":     "swap\n",
+		"nvim/README.md":                         "ignored by default\n",
+		"kitty/dot-config/kitty/kitty.conf":      "font_size 12\n",
+		"kitty/dot-config/kitty/notes.txt":       "local ignore\n",
+		"kitty/.stow-local-ignore":               "notes\\.txt  # not for home\n",
+		"kitty/README.md":                        "kept, the local list replaces the defaults\n",
+		"git/dot-gitconfig":                      "[user]\n",
+		"git-work/dot-gitconfig":                 "[user]\n\tname = work\n",
+		"git-work/dot-config/git/work.gitconfig": "[core]\n",
+		"zsh/dot-zshrc":                          "export EDITOR=nvim\n",
+		"zsh/dot-zshrc~":                         "backup\n",
+	})
+	return repo
+}
+
+func TestDecodeStow(t *testing.T) {
+	repo := stowTestRepo(t)
+
+	state, err := DecodeStow(repo, nil)
+	if err != nil {
+		t.Fatalf("DecodeStow: %v", err)
+	}
+	if !state.Dotfiles {
+		t.Error("expected --dotfiles from .stowrc")
+	}
+	if !slices.Equal(state.Packages, []string{"git", "git-work", "kitty", "nvim", "zsh"}) {
+		t.Errorf("unexpected packages %v", state.Packages)
+	}
+
+	tests := []struct {
+		target   string
+		packages []string
+	}{
+		{".config", []string{"git-work", "kitty", "nvim"}},
+		{".config/nvim/init.lua", []string{"nvim"}},
+		{".config/kitty/kitty.conf", []string{"kitty"}},
+		{"README.md", []string{"kitty"}},
+		{".gitconfig", []string{"git", "git-work"}},
+		{".zshrc", []string{"zsh"}},
+		{".config/nvim/.init.lua.swp", nil},
+		{".config/kitty/notes.txt", nil},
+		{".zshrc~", nil},
+		{".stow-local-ignore", nil},
+	}
+	for _, tt := range tests {
+		var packages []string
+		for _, e := range state.Lookup(tt.target) {
+			packages = append(packages, e.Package)
+		}
+		if !slices.Equal(packages, tt.packages) {
+			t.Errorf("%s: expected %v, got %v", tt.target, tt.packages, packages)
+		}
+	}
+
+	conflicts := state.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Target != ".gitconfig" {
+		t.Errorf("expected a .gitconfig conflict, got %+v", conflicts)
+	}
+
+	// picking packages leaves the conflict out
+	state, err = DecodeStow(repo, &Stow{Packages: []string{"git", "nvim"}})
+	if err != nil {
+		t.Fatalf("DecodeStow: %v", err)
+	}
+	if len(state.Conflicts()) != 0 {
+		t.Errorf("expected no conflicts, got %+v", state.Conflicts())
+	}
+	if _, err := DecodeStow(repo, &Stow{Packages: []string{"emacs"}}); err == nil {
+		t.Error("expected an error for a missing package")
+	}
+
+	// without --dotfiles dot- names are taken literally
+	off := false
+	state, err = DecodeStow(repo, &Stow{Dotfiles: &off})
+	if err != nil {
+		t.Fatalf("DecodeStow: %v", err)
+	}
+	if len(state.Lookup("dot-zshrc")) != 1 {
+		t.Error("expected dot-zshrc to keep its name")
+	}
+}
+
+func TestStowIgnore(t *testing.T) {
+	ignore, err := compileStowIgnore(stowDefaultIgnore)
+	if err != nil {
+		t.Fatalf("compileStowIgnore: %v", err)
+	}
+	tests := []struct {
+		rel     string
+		ignored bool
+	}{
+		{"README.md", true},
+		{"docs/README.md", false},
+		{".git", true},
+		{"sub/.gitmodules", true},
+		{"init.lua~", true},
+		{"#init.lua#", true},
+		{".gitconfig", false},
+		{"LICENSE", true},
+		{"COPYING.txt", false},
+	}
+	for _, tt := range tests {
+		if got := ignore.match(tt.rel); got != tt.ignored {
+			t.Errorf("match(%q) = %v, want %v", tt.rel, got, tt.ignored)
+		}
+	}
+}
+
+func TestStowPlan(t *testing.T) {
+	repo := stowTestRepo(t)
+	state, err := DecodeStow(repo, nil)
+	if err != nil {
+		t.Fatalf("DecodeStow: %v", err)
+	}
+	home := t.TempDir()
+
+	// copying: every file, targets keep the manifest's spelling
+	plan := state.Plan("~/.config/nvim", home, false)
+	expected := map[string]string{
+		filepath.Join(repo, "nvim/dot-config/nvim/init.lua"):        filepath.Join("~/.config/nvim", "init.lua"),
+		filepath.Join(repo, "nvim/dot-config/nvim/lua/plugins.lua"): filepath.Join("~/.config/nvim", "lua/plugins.lua"),
+	}
+	if len(plan.Files) != len(expected) || len(plan.Attrs) != 0 {
+		t.Errorf("expected %v without attrs, got %v %v", expected, plan.Files, plan.Attrs)
+	}
+	for source, target := range expected {
+		if plan.Files[source] != target {
+			t.Errorf("%s: expected %s, got %s", source, target, plan.Files[source])
+		}
+	}
+	if !slices.Equal(plan.Sources, []string{"nvim/dot-config/nvim"}) {
+		t.Errorf("unexpected sources %v", plan.Sources)
+	}
+
+	// conflicting files are skipped, not picked
+	plan = state.Plan(".gitconfig", home, false)
+	if len(plan.Files) != 0 || plan.Skipped[".gitconfig"] == "" {
+		t.Errorf("expected .gitconfig to be skipped, got %v %v", plan.Files, plan.Skipped)
+	}
+
+	// naming the package picks it
+	plan = state.Plan("git-work/.gitconfig", home, false)
+	if plan.Files[filepath.Join(repo, "git-work/dot-gitconfig")] != ".gitconfig" || len(plan.Files) != 1 || len(plan.Skipped) != 0 {
+		t.Errorf("expected git-work's .gitconfig, got %v %v", plan.Files, plan.Skipped)
+	}
+	if !slices.Equal(plan.Sources, []string{"git-work/dot-gitconfig"}) {
+		t.Errorf("unexpected sources %v", plan.Sources)
+	}
+	plan = state.Plan("git-work", home, false)
+	if plan.Files[filepath.Join(repo, "git-work/dot-gitconfig")] != ".gitconfig" || len(plan.Skipped) != 0 {
+		t.Errorf("expected the whole git-work package, got %v %v", plan.Files, plan.Skipped)
+	}
+
+	// a package name stows the whole package
+	plan = state.Plan("zsh", home, false)
+	if plan.Files[filepath.Join(repo, "zsh/dot-zshrc")] != ".zshrc" {
+		t.Errorf("expected the zsh package, got %v", plan.Files)
+	}
+
+	// linking folds a directory only one package provides
+	plan = state.Plan(".config", home, true)
+	folded := []string{filepath.Join(".config", "git"), filepath.Join(".config", "kitty"), filepath.Join(".config", "nvim")}
+	if !slices.Equal(plan.Folded, folded) {
+		t.Errorf("expected %v to be folded, got %v", folded, plan.Folded)
+	}
+	if plan.Files[filepath.Join(repo, "nvim/dot-config/nvim")] != filepath.Join(".config", "nvim") {
+		t.Errorf("expected .config/nvim to link to the package directory, got %v", plan.Files)
+	}
+	if !plan.Attrs[filepath.Join(".config", "nvim")].Link {
+		t.Error("expected the folded directory to be a link")
+	}
+	if !slices.Equal(plan.Packages, []string{"git-work", "kitty", "nvim"}) {
+		t.Errorf("unexpected packages %v", plan.Packages)
+	}
+
+	// an existing directory isn't folded over, its files are linked
+	if err := os.MkdirAll(filepath.Join(home, ".config", "kitty"), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	plan = state.Plan(".config/kitty", home, true)
+	if len(plan.Folded) != 0 || !plan.Attrs[filepath.Join(".config/kitty", "kitty.conf")].Link {
+		t.Errorf("expected kitty.conf to be linked on its own, got %v %v", plan.Folded, plan.Attrs)
+	}
+
+	// what's stowed already is left alone
+	if err := os.Symlink(filepath.Join(repo, "nvim/dot-config/nvim"), filepath.Join(home, ".config", "nvim")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	plan = state.Plan(".config/nvim", home, true)
+	if len(plan.Files) != 0 {
+		t.Errorf("expected nothing to do, got %v", plan.Files)
+	}
+}
+
+func TestStowPlanUnfold(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"fish/.config/fish/config.fish":         "set -g fish_greeting\n",
+		"fish-extra/.config/fish/conf.d/a.fish": "alias g git\n",
+	})
+	home := t.TempDir()
+
+	// stow fish first, it folds .config into one link
+	if err := os.Symlink(filepath.Join(repo, "fish", ".config"), filepath.Join(home, ".config")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	state, err := DecodeStow(repo, &Stow{Packages: []string{"fish-extra"}})
+	if err != nil {
+		t.Fatalf("DecodeStow: %v", err)
+	}
+	plan := state.Plan(".config/fish/conf.d", home, true)
+	unfold := []string{".config", filepath.Join(".config", "fish")}
+	if !slices.Equal(plan.Unfold, unfold) {
+		t.Errorf("expected %v to be unfolded, got %v", unfold, plan.Unfold)
+	}
+	if !slices.Equal(plan.Folded, []string{filepath.Join(".config/fish/conf.d")}) {
+		t.Errorf("expected conf.d to be folded, got %v", plan.Folded)
+	}
+}
+
+func TestResolveFilePathStow(t *testing.T) {
+	repo := stowTestRepo(t)
+
+	if structure := DetectStructure(repo); structure != StructureStow {
+		t.Fatalf("expected stow, got %d", structure)
+	}
+
+	got, ok := ResolveFilePath(repo, ".zshrc", nil, StructureStow)
+	if !ok || got != filepath.Join(repo, "zsh", "dot-zshrc") {
+		t.Errorf("expected zsh/dot-zshrc, got %q", got)
+	}
+	if got, ok := ResolveFilePath(repo, ".gitconfig", nil, StructureStow); ok {
+		t.Errorf("expected the .gitconfig conflict not to resolve, got %q", got)
+	}
+	// naming the package picks its side of the conflict
+	got, ok = ResolveFilePath(repo, "git-work/.gitconfig", nil, StructureStow)
+	if !ok || got != filepath.Join(repo, "git-work", "dot-gitconfig") {
+		t.Errorf("expected git-work/dot-gitconfig, got %q", got)
+	}
+}
@@ -2,6 +2,14 @@
 // it loads creator info, categories, and dotfile metadata from json
 package manifest
 
+import (
+	"cmp"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // Manifest represents the entire dotfile registry
 // contains all creators and categories available
 type Manifest struct {
@@ -25,19 +33,116 @@ type Creator struct {
 	Name        string    `json:"name"`
 	GitHub      string    `json:"github"`
 	Repo        string    `json:"repo"`
+	Source      *Source   `json:"source,omitempty"`
+	Stow        *Stow     `json:"stow,omitempty"`
 	Categories  []string  `json:"categories"`
 	Description string    `json:"description"`
 	Dotfiles    []Dotfile `json:"dotfiles"`
+
+	// Platform limits the creator to some machines, e.g. a macOS setup
+	Platform
+
+	// Metadata is what the tui shows about the creator besides the
+	// description, all optional
+	Metadata
+
+	// Registry names the registry the creator was loaded from, set when
+	// registries are merged and never written back
+	Registry string `json:"-"`
+}
+
+// Metadata describes a creator's setup for people picking one by its looks
+type Metadata struct {
+	// Screenshots and Preview are image urls, Preview is the one to show
+	// first when there's room for just one
+	Screenshots []string `json:"screenshots,omitempty"`
+	Preview     string   `json:"preview,omitempty"`
+
+	Tags    []string `json:"tags,omitempty"`
+	License string   `json:"license,omitempty"` // spdx id, e.g. MIT
+
+	// Verified marks creators the registry maintainers have checked
+	Verified bool `json:"verified,omitempty"`
+
+	// Stars and Updated are snapshots taken when the entry was written,
+	// Updated as YYYY-MM-DD
+	Stars   int    `json:"stars,omitempty"`
+	Updated string `json:"updated,omitempty"`
+}
+
+// UpdatedTime parses Updated, the zero time when it's missing or malformed
+func (m Metadata) UpdatedTime() time.Time {
+	t, err := time.Parse(time.DateOnly, m.Updated)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Source says how a creator's Repo is fetched, optional
+// without it the kind is guessed from Repo: archive urls (.tar.gz, .tgz,
+// .tar, .zip), local paths, and git for everything else
+type Source struct {
+	// Type is "git", "local" or "archive"
+	Type string `json:"type"`
+
+	// Copy makes a local source a snapshot in the cache instead of being
+	// used in place (useful for slow network shares)
+	Copy bool `json:"copy,omitempty"`
+}
+
+// source types
+const (
+	SourceGit     = "git"
+	SourceLocal   = "local"
+	SourceArchive = "archive"
+)
+
+// Stow describes a creator's GNU Stow repo, optional
+// without it every top-level directory is a package and the dot- prefix
+// convention comes from the repo's .stowrc, or is guessed from the names
+type Stow struct {
+	// Packages are the package directories to stow from
+	Packages []string `json:"packages,omitempty"`
+
+	// Dotfiles is stow's --dotfiles: dot-zshrc is stowed as .zshrc
+	Dotfiles *bool `json:"dotfiles,omitempty"`
 }
 
 // Dotfile represents a single config file or set of files
 // like tmux.conf or i3 config
 type Dotfile struct {
-	ID           string   `json:"id"`
-	Name         string   `json:"name"`
-	Description  string   `json:"description"`
-	Paths        []string `json:"paths"`
-	Dependencies []string `json:"dependencies"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Paths        []PathSpec `json:"paths"`
+	Dependencies []string   `json:"dependencies"`
+
+	// Exclude and Include are gitignore patterns for the files of its
+	// directory paths, on top of the defaults; Include brings back what the
+	// defaults or Exclude leave out
+	Exclude []string `json:"exclude,omitempty"`
+	Include []string `json:"include,omitempty"`
+
+	// Platform limits the dotfile to some machines, on top of its creator's
+	Platform
+}
+
+// FileAttrs says how a file lands in $HOME beyond a plain copy
+// the zero value is a plain copy keeping the source file's permissions
+type FileAttrs struct {
+	// Mode is the target's permission bits, 0 keeps the source's
+	Mode fs.FileMode
+
+	// Symlink makes the target a symlink, the source holds the link target
+	Symlink bool
+
+	// CreateOnly leaves an existing target alone
+	CreateOnly bool
+
+	// Link makes the target a symlink to the source itself, like stow does
+	// the source may be a directory (a folded tree)
+	Link bool
 }
 
 // GetCategory finds a category by id
@@ -62,6 +167,16 @@ func (m *Manifest) GetCreator(id string) *Creator {
 	return nil
 }
 
+// CreatorIDs returns the set of creator ids in the manifest
+// used to tell which cached repos are still referenced
+func (m *Manifest) CreatorIDs() map[string]bool {
+	ids := make(map[string]bool, len(m.Creators))
+	for _, creator := range m.Creators {
+		ids[creator.ID] = true
+	}
+	return ids
+}
+
 // GetCreatorsByCategory filters creators by category id
 // returns empty slice if none found
 func (m *Manifest) GetCreatorsByCategory(categoryID string) []Creator {
@@ -87,3 +202,43 @@ func (c *Creator) GetDotfile(id string) *Dotfile {
 	}
 	return nil
 }
+
+// Merge adds another manifest's categories and creators to m, a creator
+// with an id m already has replaces it
+func (m *Manifest) Merge(other *Manifest) {
+	for _, category := range other.Categories {
+		if m.GetCategory(category.ID) == nil {
+			m.Categories = append(m.Categories, category)
+		}
+	}
+	for _, creator := range other.Creators {
+		if existing := m.GetCreator(creator.ID); existing != nil {
+			*existing = creator
+			continue
+		}
+		m.Creators = append(m.Creators, creator)
+	}
+}
+
+// CompareVersions compares manifest versions like "1.4" and "1.10.2"
+// number by number, missing numbers count as 0; it returns -1, 0 or 1
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := versionPart(as, i), versionPart(bs, i)
+		if x != y {
+			return cmp.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// versionPart is the i-th number of a version, 0 when it's missing or
+// not a number
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	n, _ := strconv.Atoi(parts[i])
+	return n
+}
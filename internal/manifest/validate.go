@@ -0,0 +1,661 @@
+// package manifest validates manifests against the schema and beyond
+package manifest
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the manifest format this build reads, manifests carry
+// it as the major part of their "version"
+const SchemaVersion = 1
+
+// Schema is the JSON Schema for SchemaVersion manifests, for editors and ci
+//
+//go:embed schema/manifest.v1.json
+var Schema []byte
+
+// issue severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is one problem in a manifest, pointing at where it is
+type Issue struct {
+	Line     int    // 1-based, 0 when unknown
+	Column   int    // 1-based
+	Field    string // e.g. creators[2].dotfiles[0].paths
+	Severity string
+	Message  string
+}
+
+// String formats the issue like a compiler error, without the file name
+func (i Issue) String() string {
+	field := ""
+	if i.Field != "" {
+		field = i.Field + ": "
+	}
+	return fmt.Sprintf("%d:%d: %s: %s%s", i.Line, i.Column, i.Severity, field, i.Message)
+}
+
+// ValidationError is returned when a manifest has errors, not just warnings
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	var errs []string
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			errs = append(errs, issue.String())
+		}
+	}
+	if len(errs) > 3 {
+		errs = append(errs[:3], fmt.Sprintf("and %d more", len(errs)-3))
+	}
+	return "invalid manifest: " + strings.Join(errs, "; ")
+}
+
+// CheckOptions tunes the checks that need knowledge from outside the manifest
+type CheckOptions struct {
+	// KnownDependency reports whether a dependency name has install metadata
+	// (see deps.IsKnown), unknown ones are warnings; nil skips the check
+	KnownDependency func(name string) bool
+
+	// StrictFields makes unknown fields errors, as `manifest lint` wants;
+	// loading only warns, so a 1.x manifest with a field added later still
+	// loads in older binaries
+	StrictFields bool
+}
+
+// Check validates manifest json against the schema, then the manifest's
+// semantics; the manifest is nil when the json doesn't even parse
+func Check(data []byte, opts CheckOptions) (*Manifest, []Issue) {
+	c := &checker{data: data, opts: opts}
+
+	root, err := parseTree(data)
+	if err != nil {
+		c.issue(errorOffset(err), "", SeverityError, "%v", err)
+		return nil, c.issues
+	}
+	c.root = root
+
+	var schema map[string]any
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		panic(fmt.Sprintf("embedded manifest schema is broken: %v", err))
+	}
+	c.defs, _ = schema["$defs"].(map[string]any)
+
+	// a newer format gets one clear error instead of a pile of schema ones
+	if v := root.fields["version"]; v != nil && v.kind == 's' {
+		if major, _, _ := strings.Cut(v.str, "."); major != strconv.Itoa(SchemaVersion) {
+			if n, err := strconv.Atoi(major); err == nil && n > SchemaVersion {
+				c.issue(v.offset, "version", SeverityError,
+					"manifest version %s needs a newer dotpicker (this one reads version %d)", v.str, SchemaVersion)
+				return nil, c.issues
+			}
+		}
+	}
+
+	c.schema(root, schema, "")
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		// the schema should have caught it, but don't hand back half a manifest
+		if len(c.issues) == 0 {
+			c.issue(0, "", SeverityError, "%v", err)
+		}
+		return nil, c.issues
+	}
+	c.semantics(&m, opts)
+
+	// schema and semantic issues read top to bottom
+	sort.SliceStable(c.issues, func(i, j int) bool {
+		a, b := c.issues[i], c.issues[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return &m, c.issues
+}
+
+// checker collects issues for one manifest
+type checker struct {
+	data   []byte
+	opts   CheckOptions
+	root   *jsonNode
+	defs   map[string]any
+	issues []Issue
+}
+
+// issue records a problem at a byte offset in the json
+func (c *checker) issue(offset int64, field, severity, format string, args ...any) {
+	line, col := lineColumn(c.data, offset)
+	c.issues = append(c.issues, Issue{
+		Line:     line,
+		Column:   col,
+		Field:    field,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// at records a problem at a field, given as path segments
+// (strings for keys, ints for indexes); the closest existing node is used
+func (c *checker) at(severity string, segments []any, format string, args ...any) {
+	c.issue(c.root.find(segments...).offset, fieldName(segments), severity, format, args...)
+}
+
+// schema checks node against the subset of JSON Schema our schema uses:
+// $ref, type, enum, properties, required, additionalProperties, items,
+// minItems, minLength, pattern, and anyOf between schemas of different types
+func (c *checker) schema(node *jsonNode, s map[string]any, field string) {
+	if ref, ok := s["$ref"].(string); ok {
+		c.schema(node, c.resolve(ref), field)
+		return
+	}
+	if alternatives, ok := s["anyOf"].([]any); ok {
+		// the alternative of the node's type decides, so its issues are
+		// the ones that make sense to show
+		var types []string
+		for _, alt := range alternatives {
+			sub, _ := alt.(map[string]any)
+			if ref, ok := sub["$ref"].(string); ok {
+				sub = c.resolve(ref)
+			}
+			want, _ := sub["type"].(string)
+			if want == node.typeName() {
+				c.schema(node, sub, field)
+				return
+			}
+			types = append(types, want)
+		}
+		c.issue(node.offset, field, SeverityError, "expected %s, got %s", strings.Join(types, " or "), node.typeName())
+		return
+	}
+
+	if want, ok := s["type"].(string); ok && node.typeName() != want {
+		c.issue(node.offset, field, SeverityError, "expected %s, got %s", want, node.typeName())
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		var allowed []string
+		matched := false
+		for _, e := range enum {
+			allowed = append(allowed, fmt.Sprintf("%q", e))
+			if node.kind == 's' && node.str == e {
+				matched = true
+			}
+		}
+		if !matched {
+			c.issue(node.offset, field, SeverityError, "must be one of %s", strings.Join(allowed, ", "))
+			return
+		}
+	}
+
+	switch node.kind {
+	case 'o':
+		props, _ := s["properties"].(map[string]any)
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if name := r.(string); node.fields[name] == nil {
+					c.issue(node.offset, field, SeverityError, "missing required field %q", name)
+				}
+			}
+		}
+		for _, key := range node.keys {
+			child := node.fields[key]
+			sub, known := props[key].(map[string]any)
+			if !known {
+				if s["additionalProperties"] == false {
+					severity := SeverityWarning
+					if c.opts.StrictFields {
+						severity = SeverityError
+					}
+					c.issue(node.keyOffsets[key], joinField(field, key), severity, "unknown field %q", key)
+				}
+				continue
+			}
+			c.schema(child, sub, joinField(field, key))
+		}
+		for _, key := range node.duplicates {
+			c.issue(node.keyOffsets[key], joinField(field, key), SeverityError, "field %q appears more than once", key)
+		}
+
+	case 'a':
+		if min, ok := s["minItems"].(float64); ok && len(node.items) < int(min) {
+			c.issue(node.offset, field, SeverityError, "needs at least %d item(s)", int(min))
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range node.items {
+				c.schema(item, items, fmt.Sprintf("%s[%d]", field, i))
+			}
+		}
+
+	case 's':
+		if min, ok := s["minLength"].(float64); ok && len(node.str) < int(min) {
+			c.issue(node.offset, field, SeverityError, "must not be empty")
+		}
+		if pattern, ok := s["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(node.str) {
+			msg := fmt.Sprintf("%q doesn't match %s", node.str, pattern)
+			if desc, ok := s["description"].(string); ok {
+				msg += " (" + desc + ")"
+			}
+			c.issue(node.offset, field, SeverityError, "%s", msg)
+		}
+	}
+}
+
+// resolve looks up a "#/$defs/..." reference
+func (c *checker) resolve(ref string) map[string]any {
+	def, _ := c.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+	return def
+}
+
+// semantics checks what the schema can't: ids are unique, categories
+// exist, repos are urls we can fetch, paths stay inside $HOME
+func (c *checker) semantics(m *Manifest, opts CheckOptions) {
+	categories := make(map[string]bool)
+	for i, category := range m.Categories {
+		if categories[category.ID] {
+			c.at(SeverityError, []any{"categories", i, "id"}, "duplicate category id %q", category.ID)
+		}
+		categories[category.ID] = true
+	}
+
+	creators := make(map[string]bool)
+	for i, creator := range m.Creators {
+		at := func(severity string, rest []any, format string, args ...any) {
+			c.at(severity, append([]any{"creators", i}, rest...), format, args...)
+		}
+
+		if creators[creator.ID] {
+			at(SeverityError, []any{"id"}, "duplicate creator id %q", creator.ID)
+		}
+		creators[creator.ID] = true
+
+		for j, category := range creator.Categories {
+			if !categories[category] {
+				at(SeverityError, []any{"categories", j}, "unknown category %q", category)
+			}
+		}
+
+		kind := ""
+		if creator.Source != nil {
+			kind = creator.Source.Type
+		}
+		if severity, problem := checkRepo(creator.Repo, kind); problem != "" {
+			at(severity, []any{"repo"}, "%s", problem)
+		}
+		if creator.Updated != "" && creator.UpdatedTime().IsZero() {
+			at(SeverityError, []any{"updated"}, "updated %q isn't a date", creator.Updated)
+		}
+		if creator.Stars < 0 {
+			at(SeverityError, []any{"stars"}, "stars can't be negative")
+		}
+
+		dotfiles := make(map[string]bool)
+		for j, dotfile := range creator.Dotfiles {
+			if dotfiles[dotfile.ID] {
+				at(SeverityError, []any{"dotfiles", j, "id"}, "duplicate dotfile id %q in %s", dotfile.ID, creator.ID)
+			}
+			dotfiles[dotfile.ID] = true
+
+			paths := make(map[string]bool)
+			for k, p := range dotfile.Paths {
+				entry := []any{"dotfiles", j, "paths", k}
+				// an object's problems point at its fields
+				fieldOf := func(name string) []any {
+					if c.root.find(append([]any{"creators", i}, entry...)...).kind == 'o' {
+						return append(slices.Clone(entry), name)
+					}
+					return entry
+				}
+
+				if p.Path() == "" {
+					at(SeverityError, entry, "path needs a source or a target")
+					continue
+				}
+				if problem := checkPath(p.Path()); problem != "" {
+					at(SeverityError, fieldOf("target"), "%s", problem)
+				}
+				if problem := checkSource(p.Source); problem != "" {
+					at(SeverityError, fieldOf("source"), "%s", problem)
+				}
+				for l, pattern := range p.Exclude {
+					if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+						at(SeverityError, append(fieldOf("exclude"), l), "exclude pattern %q is malformed", pattern)
+					}
+				}
+				if paths[p.Path()] {
+					at(SeverityWarning, entry, "path %q is listed twice", p.Path())
+				}
+				paths[p.Path()] = true
+			}
+
+			for k, dep := range dotfile.Dependencies {
+				if opts.KnownDependency != nil && !opts.KnownDependency(dep) {
+					at(SeverityWarning, []any{"dotfiles", j, "dependencies", k},
+						"unknown dependency %q, it'll be installed as a package of that name", dep)
+				}
+			}
+		}
+	}
+}
+
+// scpLike matches scp-style git remotes like git@github.com:owner/repo.git
+var scpLike = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/].*$`)
+
+// checkRepo says what's wrong with a creator's repo, and how bad it is
+// kind is the creator's source type, empty when it's guessed
+func checkRepo(repo, kind string) (severity, problem string) {
+	if strings.TrimSpace(repo) != repo {
+		return SeverityError, "repo has leading or trailing spaces"
+	}
+
+	local := strings.HasPrefix(repo, "/") || strings.HasPrefix(repo, "~") ||
+		strings.HasPrefix(repo, "./") || strings.HasPrefix(repo, "../")
+	if local || kind == SourceLocal {
+		return SeverityWarning, "repo is a local path, it only exists on your machine"
+	}
+	if scpLike.MatchString(repo) {
+		return "", ""
+	}
+
+	u, err := url.Parse(repo)
+	if err != nil {
+		return SeverityError, fmt.Sprintf("repo isn't a valid url: %v", err)
+	}
+	switch u.Scheme {
+	case "https", "ssh", "git", "file":
+	case "http":
+		return SeverityWarning, "repo uses http, prefer https"
+	case "":
+		return SeverityError, fmt.Sprintf("repo %q isn't a url (https://host/owner/repo) or a path", repo)
+	default:
+		return SeverityError, fmt.Sprintf("repo uses unsupported scheme %q", u.Scheme)
+	}
+	if u.Scheme != "file" && u.Host == "" {
+		return SeverityError, "repo url has no host"
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return SeverityError, "repo url contains a password, use git_auth instead"
+		}
+	}
+
+	// github repos are always owner/name
+	if strings.EqualFold(u.Host, "github.com") && kind != SourceArchive {
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+			return SeverityError, "github repo url should be https://github.com/owner/repo"
+		}
+	}
+	return "", ""
+}
+
+// checkPath says what's wrong with a dotfile path, paths are relative to
+// $HOME (a leading ~/ is fine) and must stay inside it
+func checkPath(p string) string {
+	clean := strings.TrimPrefix(p, "~/")
+	if strings.HasPrefix(clean, "/") {
+		return fmt.Sprintf("path %q is absolute, paths are relative to your home directory", p)
+	}
+	if clean = path.Clean(clean); clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Sprintf("path %q leaves the home directory", p)
+	}
+	if clean == "." {
+		return fmt.Sprintf("path %q is the whole home directory", p)
+	}
+	return ""
+}
+
+// checkSource says what's wrong with a path entry's repo source, if
+// anything; "." is the whole repo, for repos that are one config
+func checkSource(p string) string {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") {
+		return fmt.Sprintf("source %q is absolute, sources are relative to the repo root", p)
+	}
+	if clean := path.Clean(p); clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Sprintf("source %q leaves the repo", p)
+	}
+	return ""
+}
+
+// joinField appends a key to a field name
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// fieldName spells path segments the way issues show them
+func fieldName(segments []any) string {
+	var b strings.Builder
+	for _, s := range segments {
+		switch s := s.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", s)
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// lineColumn turns a byte offset into a 1-based line and column
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return line, col
+}
+
+// parseError is a json error with where it happened
+type parseError struct {
+	offset int64
+	err    error
+}
+
+func (e *parseError) Error() string { return e.err.Error() }
+
+func (e *parseError) Unwrap() error { return e.err }
+
+// errorOffset finds where a json error happened, 0 when it doesn't say
+func errorOffset(err error) int64 {
+	var parse *parseError
+	if errors.As(err, &parse) {
+		return parse.offset
+	}
+	return 0
+}
+
+// jsonNode is a json value that remembers where it was in the file
+type jsonNode struct {
+	kind   byte  // 'o'bject, 'a'rray, 's'tring, 'n'umber, 'b'ool, 'z' null
+	offset int64 // where the value starts
+
+	str string
+
+	// objects keep their keys in order, and the ones that repeat
+	keys       []string
+	fields     map[string]*jsonNode
+	keyOffsets map[string]int64
+	duplicates []string
+
+	items []*jsonNode
+}
+
+// typeName is the node's JSON Schema type
+func (n *jsonNode) typeName() string {
+	switch n.kind {
+	case 'o':
+		return "object"
+	case 'a':
+		return "array"
+	case 's':
+		return "string"
+	case 'n':
+		return "number"
+	case 'b':
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// find walks keys and indexes down from n, stopping at the deepest node
+// that exists so an issue about a missing field points at its parent
+func (n *jsonNode) find(segments ...any) *jsonNode {
+	node := n
+	for _, s := range segments {
+		var next *jsonNode
+		switch s := s.(type) {
+		case string:
+			next = node.fields[s]
+		case int:
+			if s >= 0 && s < len(node.items) {
+				next = node.items[s]
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return node
+}
+
+// parseTree decodes json into nodes with offsets
+func parseTree(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	p := &treeParser{data: data, dec: dec}
+	root, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &parseError{offset: p.start(), err: fmt.Errorf("invalid json: unexpected data after the manifest")}
+	}
+	return root, nil
+}
+
+// treeParser builds jsonNodes from a token stream
+type treeParser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// start is where the next token begins, past whitespace and separators
+func (p *treeParser) start() int64 {
+	offset := p.dec.InputOffset()
+	for offset < int64(len(p.data)) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// value reads one json value
+func (p *treeParser) value() (*jsonNode, error) {
+	offset := p.start()
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, syntaxError(err, offset)
+	}
+	node := &jsonNode{offset: offset}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node.kind = 'o'
+			node.fields = make(map[string]*jsonNode)
+			node.keyOffsets = make(map[string]int64)
+			for p.dec.More() {
+				keyOffset := p.start()
+				keyTok, err := p.dec.Token()
+				if err != nil {
+					return nil, syntaxError(err, keyOffset)
+				}
+				key := keyTok.(string)
+				child, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				if _, seen := node.fields[key]; seen {
+					node.duplicates = append(node.duplicates, key)
+				} else {
+					node.keys = append(node.keys, key)
+				}
+				node.fields[key] = child
+				node.keyOffsets[key] = keyOffset
+			}
+		case '[':
+			node.kind = 'a'
+			for p.dec.More() {
+				child, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, child)
+			}
+		}
+		// the closing delimiter
+		if _, err := p.dec.Token(); err != nil {
+			return nil, syntaxError(err, p.start())
+		}
+	case string:
+		node.kind = 's'
+		node.str = t
+	case json.Number:
+		node.kind = 'n'
+	case bool:
+		node.kind = 'b'
+	default:
+		node.kind = 'z'
+	}
+	return node, nil
+}
+
+// syntaxError attaches an offset to a decoding error
+func syntaxError(err error, offset int64) error {
+	// the decoder counts the offending byte as read
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) && syntax.Offset > 0 {
+		offset = syntax.Offset - 1
+	}
+	return &parseError{offset: offset, err: fmt.Errorf("invalid json: %w", err)}
+}
+
+// Position finds where a field is in manifest json, as path segments
+// (strings for keys, ints for indexes), for issues found outside Check
+func Position(data []byte, segments ...any) (line, col int) {
+	root, err := parseTree(data)
+	if err != nil {
+		return 0, 0
+	}
+	return lineColumn(data, root.find(segments...).offset)
+}
+
+// FieldName spells path segments the way issues show them
+func FieldName(segments ...any) string {
+	return fieldName(segments)
+}
@@ -0,0 +1,271 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/milxzy/dotfile-picker/configs"
+)
+
+// creatorJSON is a valid manifest with one creator, the tests break it
+const creatorJSON = `{
+  "version": "1.0",
+  "categories": [{"id": "neovim", "name": "Neovim"}],
+  "creators": [
+    {
+      "id": "someone",
+      "name": "Someone",
+      "repo": "https://github.com/someone/dotfiles",
+      "categories": ["neovim"],
+      "dotfiles": [
+        {"id": "nvim", "name": "Neovim", "paths": [".config/nvim"], "dependencies": ["neovim"]}
+      ]
+    }
+  ]
+}`
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string // replaced in creatorJSON
+		issues   []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "unknown field",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone", "homepage": "x",`,
+			issues: []string{`7:26: error: creators[0].homepage: unknown field "homepage"`},
+		},
+		{
+			name:   "missing field",
+			old:    `"id": "nvim", "name": "Neovim", `,
+			new:    `"id": "nvim", `,
+			issues: []string{`11:9: error: creators[0].dotfiles[0]: missing required field "name"`},
+		},
+		{
+			name:   "wrong type",
+			old:    `"paths": [".config/nvim"]`,
+			new:    `"paths": ".config/nvim"`,
+			issues: []string{`11:51: error: creators[0].dotfiles[0].paths: expected array, got string`},
+		},
+		{
+			name:   "bad id",
+			old:    `"id": "someone"`,
+			new:    `"id": "Some One"`,
+			issues: []string{`6:13: error: creators[0].id: "Some One" doesn't match`},
+		},
+		{
+			name:   "unknown category",
+			old:    `"categories": ["neovim"]`,
+			new:    `"categories": ["neovim", "emacs"]`,
+			issues: []string{`9:32: error: creators[0].categories[1]: unknown category "emacs"`},
+		},
+		{
+			name:   "absolute path",
+			old:    `[".config/nvim"]`,
+			new:    `[".config/nvim", "/etc/hosts"]`,
+			issues: []string{`11:68: error: creators[0].dotfiles[0].paths[1]: path "/etc/hosts" is absolute`},
+		},
+		{
+			name:   "path leaves home",
+			old:    `[".config/nvim"]`,
+			new:    `["~/../root/.ssh"]`,
+			issues: []string{`11:52: error: creators[0].dotfiles[0].paths[0]: path "~/../root/.ssh" leaves the home directory`},
+		},
+		{
+			name:   "duplicate path",
+			old:    `[".config/nvim"]`,
+			new:    `[".config/nvim", ".config/nvim"]`,
+			issues: []string{`11:68: warning: creators[0].dotfiles[0].paths[1]: path ".config/nvim" is listed twice`},
+		},
+		{
+			name: "duplicate ids",
+			old:  `{"id": "nvim", "name": "Neovim", "paths": [".config/nvim"], "dependencies": ["neovim"]}`,
+			new:  `{"id": "nvim", "name": "Neovim", "paths": [".config/nvim"]}, {"id": "nvim", "name": "again", "paths": [".vimrc"]}`,
+			issues: []string{
+				`11:77: error: creators[0].dotfiles[1].id: duplicate dotfile id "nvim" in someone`,
+			},
+		},
+		{
+			name:   "github repo without owner",
+			old:    `https://github.com/someone/dotfiles`,
+			new:    `https://github.com/dotfiles`,
+			issues: []string{`8:15: error: creators[0].repo: github repo url should be https://github.com/owner/repo`},
+		},
+		{
+			name:   "repo without scheme",
+			old:    `https://github.com/someone/dotfiles`,
+			new:    `github.com/someone/dotfiles`,
+			issues: []string{`8:15: error: creators[0].repo: repo "github.com/someone/dotfiles" isn't a url`},
+		},
+		{
+			name: "scp-style repo",
+			old:  `https://github.com/someone/dotfiles`,
+			new:  `git@github.com:someone/dotfiles.git`,
+		},
+		{
+			name:   "local repo",
+			old:    `https://github.com/someone/dotfiles`,
+			new:    `~/src/dotfiles`,
+			issues: []string{`8:15: warning: creators[0].repo: repo is a local path`},
+		},
+		{
+			name:   "unknown dependency",
+			old:    `"dependencies": ["neovim"]`,
+			new:    `"dependencies": ["neovim", "frobnicate"]`,
+			issues: []string{`11:96: warning: creators[0].dotfiles[0].dependencies[1]: unknown dependency "frobnicate"`},
+		},
+		{
+			name: "platform constraints",
+			old:  `"name": "Neovim", `,
+			new:  `"name": "Neovim", "os": ["linux", "macos"], "arch": ["x86_64"], "distros": ["arch"], "session": "wayland", `,
+		},
+		{
+			name: "metadata",
+			old:  `"name": "Someone",`,
+			new:  `"name": "Someone", "screenshots": ["https://example.com/desk.png"], "tags": ["catppuccin", "minimal"], "license": "MIT", "verified": true, "stars": 1200, "updated": "2025-03-01",`,
+		},
+		{
+			name:   "updated isn't a date",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone", "updated": "2024-02-30",`,
+			issues: []string{`7:37: error: creators[0].updated: updated "2024-02-30" isn't a date`},
+		},
+		{
+			name:   "screenshot isn't a url",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone", "screenshots": ["ftp://x"],`,
+			issues: []string{`7:42: error: creators[0].screenshots[0]: "ftp://x" doesn't match`},
+		},
+		{
+			name: "path object",
+			old:  `[".config/nvim"]`,
+			new:  `[{"source": "nvim", "target": ".config/nvim", "mode": "0644", "exclude": ["lazy-lock.json"]}]`,
+		},
+		{
+			name:   "path object source leaves the repo",
+			old:    `[".config/nvim"]`,
+			new:    `[{"source": "../nvim", "target": ".config/nvim"}]`,
+			issues: []string{`11:63: error: creators[0].dotfiles[0].paths[0].source: source "../nvim" leaves the repo`},
+		},
+		{
+			name:   "path object with a bad mode",
+			old:    `[".config/nvim"]`,
+			new:    `[{"target": ".config/nvim", "mode": "rw"}]`,
+			issues: []string{`11:87: error: creators[0].dotfiles[0].paths[0].mode: "rw" doesn't match`},
+		},
+		{
+			name:   "path of the wrong type",
+			old:    `[".config/nvim"]`,
+			new:    `[42]`,
+			issues: []string{`11:52: error: creators[0].dotfiles[0].paths[0]: expected string or object, got number`},
+		},
+		{
+			name:   "unknown os",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone", "os": ["beos"],`,
+			issues: []string{`7:33: error: creators[0].os[0]: must be one of "linux"`},
+		},
+		{
+			name:   "duplicate key",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone", "name": "Someone Else",`,
+			issues: []string{`7:26: error: creators[0].name: field "name" appears more than once`},
+		},
+		{
+			name:   "newer version",
+			old:    `"version": "1.0"`,
+			new:    `"version": "2.3"`,
+			issues: []string{`2:14: error: version: manifest version 2.3 needs a newer dotpicker`},
+		},
+		{
+			name:   "syntax error",
+			old:    `"name": "Someone",`,
+			new:    `"name": "Someone",,`,
+			issues: []string{`7:25: error: invalid json`},
+		},
+	}
+
+	known := func(name string) bool { return name == "neovim" }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := strings.Replace(creatorJSON, tt.old, tt.new, 1)
+			if tt.old != "" && data == creatorJSON {
+				t.Fatalf("%q isn't in the test manifest", tt.old)
+			}
+
+			m, issues := Check([]byte(data), CheckOptions{KnownDependency: known, StrictFields: true})
+			if len(issues) != len(tt.issues) {
+				t.Fatalf("expected %d issues, got %v", len(tt.issues), issues)
+			}
+			for i, want := range tt.issues {
+				if got := issues[i].String(); !strings.HasPrefix(got, want) {
+					t.Errorf("issue %d = %q, want prefix %q", i, got, want)
+				}
+			}
+
+			hasErrors := false
+			for _, issue := range issues {
+				hasErrors = hasErrors || issue.Severity == SeverityError
+			}
+			if m == nil && !hasErrors {
+				t.Error("expected a manifest when there are no errors")
+			}
+		})
+	}
+}
+
+func TestLoadFileValidates(t *testing.T) {
+	dir := t.TempDir()
+
+	bad := filepath.Join(dir, "bad.json")
+	data := strings.Replace(creatorJSON, `"categories": ["neovim"]`, `"categories": ["emacs"]`, 1)
+	if err := os.WriteFile(bad, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadFile(bad)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `9:22: error: creators[0].categories[0]: unknown category "emacs"`) {
+		t.Errorf("error doesn't point at the category: %v", err)
+	}
+
+	// warnings don't stop a manifest from loading
+	warned := filepath.Join(dir, "warned.json")
+	data = strings.Replace(creatorJSON, `["neovim"]}`, `["frobnicate"]}`, 1)
+	if err := os.WriteFile(warned, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(warned); err != nil {
+		t.Errorf("expected warnings to load, got %v", err)
+	}
+
+	// fields a newer 1.x adds are only warnings outside of lint
+	newer := filepath.Join(dir, "newer.json")
+	data = strings.Replace(creatorJSON, `"name": "Someone",`, `"name": "Someone", "homepage": "x",`, 1)
+	if err := os.WriteFile(newer, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(newer); err != nil {
+		t.Errorf("expected an unknown field to load, got %v", err)
+	}
+	_, issues := Check([]byte(data), CheckOptions{})
+	if len(issues) != 1 || issues[0].Severity != SeverityWarning {
+		t.Errorf("expected one warning, got %v", issues)
+	}
+}
+
+func TestBundledManifestIsValid(t *testing.T) {
+	if _, issues := Check(configs.Manifest, CheckOptions{}); len(issues) > 0 {
+		t.Errorf("configs/manifest.json has issues: %v", issues)
+	}
+}
@@ -0,0 +1,198 @@
+// package manifest resolves yadm repos and their ## alternates
+package manifest
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// yadmSkipped are yadm's own files, they configure yadm, not the home dir
+var yadmSkipped = []string{".config/yadm", ".local/share/yadm", ".yadm"}
+
+// yadmCandidate is one file competing for a target
+type yadmCandidate struct {
+	source   string
+	score    int
+	template bool
+}
+
+// decodeYadm maps a yadm repo: its tree is the home directory, and
+// names like .zshrc##os.Linux are alternates, the best match on this
+// machine wins the target
+func decodeYadm(l *Layout) error {
+	machine := currentMachine()
+	best := make(map[string]yadmCandidate)
+	var order []string
+
+	consider := func(target string, c yadmCandidate) {
+		if current, ok := best[target]; !ok || c.score > current.score {
+			if !ok {
+				order = append(order, target)
+			}
+			best[target] = c
+		}
+	}
+
+	skip := func(rel string, isDir bool) bool {
+		for _, s := range yadmSkipped {
+			if rel == s {
+				return true
+			}
+		}
+		if !isDir {
+			return false
+		}
+		// an alternate directory is picked as a whole
+		target, conditions, ok := strings.Cut(rel, "##")
+		if !ok {
+			return false
+		}
+		if score, template := yadmScore(conditions, machine); score >= 0 {
+			consider(target, yadmCandidate{source: filepath.Join(l.Root, filepath.FromSlash(rel)), score: score, template: template})
+		}
+		return true
+	}
+
+	err := walkTree(l.Root, skip, func(rel, source string) {
+		dir, name := path.Split(rel)
+		base, conditions, ok := strings.Cut(name, "##")
+		if !ok {
+			// a plain file loses to any alternate that matches
+			consider(rel, yadmCandidate{source: source, score: -1})
+			return
+		}
+		if score, template := yadmScore(conditions, machine); score >= 0 {
+			consider(dir+base, yadmCandidate{source: source, score: score, template: template})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, target := range order {
+		c := best[target]
+		if c.template {
+			l.Skipped[target] = "yadm template"
+			continue
+		}
+		l.add(c.source, target)
+	}
+	return nil
+}
+
+// yadmScore scores an alternate's conditions against this machine, higher
+// is more specific, -1 when a condition doesn't match
+// templates are flagged, we don't run yadm's template processors
+func yadmScore(conditions string, machine machineInfo) (int, bool) {
+	score := 0
+	template := false
+	for _, condition := range strings.Split(conditions, ",") {
+		label, value, _ := strings.Cut(condition, ".")
+		negate := false
+		if rest, ok := strings.CutPrefix(value, "~"); ok {
+			negate, value = true, rest
+		}
+
+		var weight int
+		var matches bool
+		switch label {
+		case "default":
+			continue
+		case "template", "t":
+			template = true
+			continue
+		case "extension", "e":
+			continue
+		case "arch", "a":
+			weight, matches = 1, machine.matchArch(value)
+		case "os", "o":
+			weight, matches = 2, strings.EqualFold(value, machine.os)
+		case "distro_family", "f":
+			weight, matches = 4, containsFold(machine.distroFamily, value)
+		case "distro", "d":
+			weight, matches = 8, strings.EqualFold(value, machine.distro)
+		case "class", "c":
+			// classes come from the user's yadm config, which we don't have
+			weight, matches = 16, false
+		case "hostname", "h":
+			weight, matches = 32, strings.EqualFold(value, machine.hostname)
+		case "user", "u":
+			weight, matches = 64, value == machine.user
+		default:
+			return -1, false
+		}
+		if matches == negate {
+			return -1, false
+		}
+		score += 1000 + weight
+	}
+	return score, template
+}
+
+// machineInfo is what alternates and host-specific files are matched against
+type machineInfo struct {
+	os           string // as uname -s prints it
+	arch         string // as uname -m prints it
+	hostname     string // short name
+	user         string
+	distro       string   // ID from /etc/os-release
+	distroFamily []string // ID_LIKE from /etc/os-release
+}
+
+// currentMachine describes the machine we're running on
+func currentMachine() machineInfo {
+	m := machineInfo{os: unameOS(), arch: unameArch()}
+	if host, err := os.Hostname(); err == nil {
+		m.hostname, _, _ = strings.Cut(host, ".")
+	}
+	if u, err := user.Current(); err == nil {
+		m.user = u.Username
+	}
+	if f, err := os.Open("/etc/os-release"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), "=")
+			value = strings.Trim(value, `"'`)
+			switch key {
+			case "ID":
+				m.distro = value
+			case "ID_LIKE":
+				m.distroFamily = strings.Fields(value)
+			}
+		}
+	}
+	return m
+}
+
+// matchArch compares an arch name with ours, accepting both spellings
+func (m machineInfo) matchArch(arch string) bool {
+	return normalizeArch(arch) == normalizeArch(m.arch)
+}
+
+// unameArch is what `uname -m` prints on this machine
+func unameArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// containsFold reports whether list has s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
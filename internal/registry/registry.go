@@ -0,0 +1,243 @@
+// package registry merges every manifest dotpicker reads into one: the
+// official one, team registries, the user's own and the creators from add-repo
+package registry
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/milxzy/dotfile-picker/configs"
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/logger"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// built-in registry names
+const (
+	Official = "official"
+	Added    = "added"
+)
+
+// Registry is one manifest to merge
+type Registry struct {
+	// Name is shown next to the registry's creators
+	Name string
+
+	// Source is the url or path it comes from, for messages
+	Source string
+
+	// Namespace prefixes creator ids as "<namespace>.<id>", empty keeps them
+	// manifest ids can't contain dots, so namespaced ids never collide
+	Namespace string
+
+	// Load reads the manifest, the result is nil for local files
+	Load func(ctx context.Context) (*manifest.Manifest, *manifest.FetchResult, error)
+}
+
+// Status is how loading one registry went
+type Status struct {
+	Name     string
+	Source   string
+	Creators int
+	Err      error
+
+	// Fetch says whether a remote registry came from the server or the
+	// cache and how old it is, nil for local files
+	Fetch *manifest.FetchResult
+
+	// Bundled is set when the official registry is the built-in copy, which
+	// is trusted like the binary itself
+	Bundled bool
+}
+
+// Badge sums up how far a registry can be trusted: "built-in", "signed
+// <key id>", "unsigned" or "unverified" when no keys are configured
+// it's empty for local files and registries that failed to load
+func (s Status) Badge() string {
+	switch {
+	case s.Err != nil:
+		return ""
+	case s.Bundled:
+		return "built-in"
+	case s.Fetch == nil:
+		return ""
+	}
+	switch s.Fetch.Trust {
+	case manifest.TrustVerified:
+		return "signed " + s.Fetch.Signer
+	case manifest.TrustUnsigned:
+		return "unsigned"
+	default:
+		return "unverified"
+	}
+}
+
+// FromConfig lists the registries cfg describes, lowest precedence first:
+// the official manifest, team registries in config order, the json files
+// in cfg.ManifestsDir by name, and the creators added with add-repo
+func FromConfig(cfg *config.Config) []Registry {
+	registries := []Registry{{
+		Name:   Official,
+		Source: cfg.ManifestURL,
+		Load: func(ctx context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+			fetcher, err := newFetcher(cfg, cfg.ManifestURL, cfg.ManifestCachePath, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			return loadOfficial(ctx, configs.Manifest, fetcher)
+		},
+	}}
+
+	for _, team := range cfg.Registries {
+		namespace := team.Name
+		if team.Override {
+			namespace = ""
+		}
+		registries = append(registries, Registry{
+			Name:      team.Name,
+			Source:    team.URL,
+			Namespace: namespace,
+			Load: func(ctx context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+				fetcher, err := newFetcher(cfg, team.URL, cfg.RegistryCachePath(team.Name), team.Keys)
+				if err != nil {
+					return nil, nil, err
+				}
+				return fetcher.FetchWithResult(ctx)
+			},
+		})
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.ManifestsDir, "*.json"))
+	sort.Strings(files)
+	for _, file := range files {
+		registries = append(registries, Registry{
+			Name:   "local:" + strings.TrimSuffix(filepath.Base(file), ".json"),
+			Source: file,
+			Load: func(context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+				man, err := manifest.LoadFile(file)
+				return man, nil, err
+			},
+		})
+	}
+
+	return append(registries, Registry{
+		Name:   Added,
+		Source: cfg.AddedManifestPath,
+		Load: func(context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+			man := &manifest.Manifest{}
+			return man, nil, manifest.MergeFile(man, cfg.AddedManifestPath)
+		},
+	})
+}
+
+// newFetcher makes a fetcher that honours the refresh settings and checks
+// signatures with the global trusted keys plus the registry's own
+// a registry with its own keys is expected to be signed, always
+func newFetcher(cfg *config.Config, url, cachePath string, keys []string) (*manifest.Fetcher, error) {
+	trusted, err := manifest.ParsePublicKeys(append(slices.Clone(cfg.TrustedKeys), keys...))
+	if err != nil {
+		return nil, fmt.Errorf("trusted keys: %w", err)
+	}
+
+	fetcher := manifest.NewFetcher(url, cachePath)
+	fetcher.SetRefreshInterval(cfg.RefreshInterval)
+	fetcher.SetForce(cfg.RefreshManifest)
+	fetcher.SetSignaturePolicy(manifest.SignaturePolicy{Keys: trusted, Require: cfg.RequireSignatures || len(keys) > 0})
+	return fetcher, nil
+}
+
+// loadOfficial picks the newer of the bundled manifest and the remote one
+// (or its cached copy, when offline), by Manifest.Version; a tie goes to
+// the remote one, it may have fixes that didn't bump the version
+// the result is nil when the bundled manifest won
+func loadOfficial(ctx context.Context, bundled []byte, fetcher *manifest.Fetcher) (*manifest.Manifest, *manifest.FetchResult, error) {
+	builtin, err := manifest.Parse(bundled)
+	if err != nil {
+		// a build problem, but the remote manifest can still work
+		logger.Error("Bundled manifest is invalid: %v", err)
+	}
+
+	fetched, result, err := fetcher.FetchWithResult(ctx)
+	switch {
+	case err != nil && builtin == nil:
+		return nil, nil, err
+	case err != nil:
+		logger.Info("Using bundled manifest %s: %v", builtin.Version, err)
+		return builtin, nil, nil
+	case builtin != nil && manifest.CompareVersions(builtin.Version, fetched.Version) > 0:
+		logger.Info("Using bundled manifest %s, it's newer than the fetched %s", builtin.Version, fetched.Version)
+		return builtin, nil, nil
+	}
+	return fetched, result, nil
+}
+
+// Load reads and merges every registry cfg describes
+func Load(ctx context.Context, cfg *config.Config) (*manifest.Manifest, []Status, error) {
+	return Merge(ctx, FromConfig(cfg))
+}
+
+// Merge loads registries in order and merges them: a creator replaces an
+// earlier one with the same (namespaced) id, a category keeps its first
+// definition so registries can share them. a registry that fails to load
+// is skipped and reported in its Status; Merge only fails when that
+// leaves no creators at all
+func Merge(ctx context.Context, registries []Registry) (*manifest.Manifest, []Status, error) {
+	merged := &manifest.Manifest{}
+	statuses := make([]Status, 0, len(registries))
+	var firstErr error
+
+	for _, registry := range registries {
+		status := Status{Name: registry.Name, Source: registry.Source}
+		man, result, err := registry.Load(ctx)
+		if err != nil {
+			logger.Warn("Couldn't load registry %s (%s): %v", registry.Name, registry.Source, err)
+			status.Err = err
+			statuses = append(statuses, status)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("couldn't load %s registry: %w", registry.Name, err)
+			}
+			continue
+		}
+
+		for i := range man.Creators {
+			creator := &man.Creators[i]
+			if registry.Namespace != "" {
+				creator.ID = registry.Namespace + "." + creator.ID
+			}
+			creator.Registry = registry.Name
+			if existing := merged.GetCreator(creator.ID); existing != nil {
+				logger.Info("Registry %s replaces creator %s from %s", registry.Name, creator.ID, existing.Registry)
+			}
+		}
+		if merged.Version == "" {
+			merged.Version = man.Version
+		}
+		merged.Merge(man)
+
+		status.Creators = len(man.Creators)
+		status.Fetch = result
+		status.Bundled = registry.Name == Official && result == nil
+		statuses = append(statuses, status)
+	}
+
+	// an empty add-repo file alone doesn't count as a registry loading
+	if len(merged.Creators) == 0 && firstErr != nil {
+		return nil, statuses, firstErr
+	}
+	return merged, statuses, nil
+}
+
+// Failed returns the registries that couldn't be loaded
+func Failed(statuses []Status) []Status {
+	var failed []Status
+	for _, s := range statuses {
+		if s.Err != nil {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
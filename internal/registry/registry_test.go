@@ -0,0 +1,282 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/milxzy/dotfile-picker/internal/config"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// static is a registry that always loads the same creators
+func static(name, namespace string, categories []manifest.Category, creators ...manifest.Creator) Registry {
+	return Registry{
+		Name:      name,
+		Namespace: namespace,
+		Load: func(context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+			// a fresh copy each time, Merge rewrites ids in place
+			return &manifest.Manifest{
+				Version:    "1.0",
+				Categories: slices.Clone(categories),
+				Creators:   slices.Clone(creators),
+			}, nil, nil
+		},
+	}
+}
+
+// broken is a registry that fails to load
+func broken(name string) Registry {
+	return Registry{
+		Name: name,
+		Load: func(context.Context) (*manifest.Manifest, *manifest.FetchResult, error) {
+			return nil, nil, errors.New("connection refused")
+		},
+	}
+}
+
+func TestMerge(t *testing.T) {
+	neovim := []manifest.Category{{ID: "neovim", Name: "Neovim"}}
+	public := manifest.Creator{ID: "someone", Name: "Someone", Repo: "https://github.com/someone/dotfiles", Categories: []string{"neovim"}}
+	internal := manifest.Creator{ID: "someone", Name: "Someone (internal)", Repo: "https://git.acme.dev/someone/dotfiles", Categories: []string{"neovim"}}
+
+	tests := []struct {
+		name       string
+		registries []Registry
+		creators   map[string]string // id -> registry
+		names      map[string]string // id -> name, when it matters
+		categories []string
+		failed     []string
+		wantErr    bool
+	}{
+		{
+			name: "team registries are namespaced",
+			registries: []Registry{
+				static(Official, "", neovim, public),
+				static("acme", "acme", []manifest.Category{{ID: "neovim", Name: "acme's neovim"}, {ID: "internal", Name: "Internal"}}, internal),
+			},
+			creators:   map[string]string{"someone": Official, "acme.someone": "acme"},
+			names:      map[string]string{"someone": "Someone", "acme.someone": "Someone (internal)"},
+			categories: []string{"neovim", "internal"},
+		},
+		{
+			name: "later registries replace creators with the same id",
+			registries: []Registry{
+				static(Official, "", neovim, public),
+				static("local:mine", "", nil, internal),
+			},
+			creators: map[string]string{"someone": "local:mine"},
+			names:    map[string]string{"someone": "Someone (internal)"},
+		},
+		{
+			name: "a broken registry is skipped",
+			registries: []Registry{
+				static(Official, "", neovim, public),
+				broken("acme"),
+			},
+			creators: map[string]string{"someone": Official},
+			failed:   []string{"acme"},
+		},
+		{
+			name: "nothing loaded",
+			registries: []Registry{
+				broken(Official),
+				static(Added, "", nil),
+			},
+			failed:  []string{Official},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			man, statuses, err := Merge(context.Background(), tt.registries)
+
+			var failed []string
+			for _, s := range Failed(statuses) {
+				failed = append(failed, s.Name)
+			}
+			if !slices.Equal(failed, tt.failed) {
+				t.Errorf("failed registries = %v, want %v", failed, tt.failed)
+			}
+			if len(statuses) != len(tt.registries) {
+				t.Errorf("expected a status per registry, got %d", len(statuses))
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(man.Creators) != len(tt.creators) {
+				t.Errorf("expected %d creators, got %d", len(tt.creators), len(man.Creators))
+			}
+			for id, registry := range tt.creators {
+				creator := man.GetCreator(id)
+				if creator == nil {
+					t.Errorf("creator %s missing", id)
+					continue
+				}
+				if creator.Registry != registry {
+					t.Errorf("%s came from %q, want %q", id, creator.Registry, registry)
+				}
+				if name, ok := tt.names[id]; ok && creator.Name != name {
+					t.Errorf("%s is %q, want %q", id, creator.Name, name)
+				}
+			}
+
+			if tt.categories != nil {
+				var ids []string
+				for _, c := range man.Categories {
+					ids = append(ids, c.ID)
+				}
+				if !slices.Equal(ids, tt.categories) {
+					t.Errorf("categories = %v, want %v", ids, tt.categories)
+				}
+				// the first definition of a shared category wins
+				if got := man.GetCategory("neovim").Name; got != "Neovim" {
+					t.Errorf("neovim category renamed to %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		ManifestURL:       "https://example.com/manifest.json",
+		ManifestsDir:      filepath.Join(dir, "manifests"),
+		AddedManifestPath: filepath.Join(dir, "added.json"),
+		Registries: []config.Registry{
+			{Name: "acme", URL: "https://acme.dev/manifest.json"},
+			{Name: "fixes", URL: "https://fixes.dev/manifest.json", Override: true},
+		},
+	}
+	if err := os.MkdirAll(cfg.ManifestsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"work.json", "home.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(cfg.ManifestsDir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names, namespaces []string
+	for _, r := range FromConfig(cfg) {
+		names = append(names, r.Name)
+		namespaces = append(namespaces, r.Namespace)
+	}
+
+	wantNames := []string{Official, "acme", "fixes", "local:home", "local:work", Added}
+	if !slices.Equal(names, wantNames) {
+		t.Errorf("registries = %v, want %v", names, wantNames)
+	}
+	wantNamespaces := []string{"", "acme", "", "", "", ""}
+	if !slices.Equal(namespaces, wantNamespaces) {
+		t.Errorf("namespaces = %v, want %v", namespaces, wantNamespaces)
+	}
+}
+
+func TestLoadOfficial(t *testing.T) {
+	bundled := []byte(`{"version": "1.4", "categories": [], "creators": []}`)
+
+	tests := []struct {
+		name      string
+		remote    string // served version, empty when the server is down
+		cached    string // cached version, empty for none
+		expected  string
+		remoteWon bool
+	}{
+		{name: "newer remote", remote: "1.10", expected: "1.10", remoteWon: true},
+		{name: "older remote", remote: "1.2", expected: "1.4"},
+		{name: "same version prefers remote", remote: "1.4", expected: "1.4", remoteWon: true},
+		{name: "offline with a newer cache", cached: "1.5", expected: "1.5"},
+		{name: "offline with an older cache", cached: "1.1", expected: "1.4"},
+		{name: "offline first run", expected: "1.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.remote == "" {
+					http.Error(w, "down", http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprintf(w, `{"version": %q, "categories": [{"id": "c", "name": "C"}], "creators": [
+					{"id": "remote", "name": "r", "repo": "https://github.com/r/dotfiles", "categories": ["c"],
+					 "dotfiles": [{"id": "d", "name": "d", "paths": [".d"]}]}]}`, tt.remote)
+			}))
+			defer server.Close()
+
+			cachePath := filepath.Join(t.TempDir(), "manifest.json")
+			if tt.cached != "" {
+				data := fmt.Sprintf(`{"version": %q, "categories": [], "creators": []}`, tt.cached)
+				if err := os.WriteFile(cachePath, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			man, result, err := loadOfficial(context.Background(), bundled, manifest.NewFetcher(server.URL, cachePath))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if man.Version != tt.expected {
+				t.Errorf("got version %s, want %s", man.Version, tt.expected)
+			}
+			if remoteWon := man.GetCreator("remote") != nil; remoteWon != tt.remoteWon {
+				t.Errorf("remote won = %v, want %v", remoteWon, tt.remoteWon)
+			}
+			if bundledWon := result == nil; bundledWon != (tt.expected == "1.4" && !tt.remoteWon) {
+				t.Errorf("expected no fetch result only when the bundled manifest wins, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRegistryKeysRequireSignatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/manifest.json" {
+			// no .minisig
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"version": "1.0", "categories": [], "creators": []}`)
+	}))
+	defer server.Close()
+
+	key := "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+	tests := []struct {
+		name     string
+		registry config.Registry
+		wantErr  bool
+	}{
+		{name: "no keys", registry: config.Registry{Name: "acme", URL: server.URL + "/manifest.json"}},
+		{name: "own keys", registry: config.Registry{Name: "acme", URL: server.URL + "/manifest.json", Keys: []string{key}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ConfigDir: t.TempDir(), Registries: []config.Registry{tt.registry}}
+			for _, r := range FromConfig(cfg) {
+				if r.Name != "acme" {
+					continue
+				}
+				_, _, err := r.Load(context.Background())
+				if (err != nil) != tt.wantErr {
+					t.Errorf("got %v, want error %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
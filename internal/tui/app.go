@@ -3,16 +3,17 @@ package tui
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/milxzy/dotfile-picker/internal/applier"
 	"github.com/milxzy/dotfile-picker/internal/backup"
@@ -20,8 +21,10 @@ import (
 	"github.com/milxzy/dotfile-picker/internal/config"
 	"github.com/milxzy/dotfile-picker/internal/deps"
 	"github.com/milxzy/dotfile-picker/internal/diff"
+	"github.com/milxzy/dotfile-picker/internal/history"
 	"github.com/milxzy/dotfile-picker/internal/logger"
 	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
 )
 
 func renderDiffSummary(results []*diff.Result) string {
@@ -63,10 +66,24 @@ type Model struct {
 	// configuration and services
 	cfg      *config.Config
 	manifest *manifest.Manifest
-	fetcher  *manifest.Fetcher
 	cache    *cache.Manager
 	backup   *backup.Manager
 	applier  *applier.Applier
+	history  *history.Store
+
+	// registries is how loading each registry went, failures are shown
+	registries []registry.Status
+
+	// machine is what creator and dotfile platform constraints are checked
+	// against; unsupported entries are hidden unless showUnsupported
+	machine         manifest.Machine
+	showUnsupported bool
+	hiddenCreators  int
+	hiddenDotfiles  int
+
+	// upstream counts commits made since the user applied a creator's
+	// dotfiles, by creator id; counted in the background, git logs are slow
+	upstream map[string]int
 
 	// ui state
 	categoryList list.Model
@@ -74,6 +91,7 @@ type Model struct {
 	dotfileList  list.Model
 	spinner      spinner.Model
 	dirBrowser   *DirBrowser
+	cacheList    list.Model
 
 	// selections
 	selectedCategory *manifest.Category
@@ -82,11 +100,35 @@ type Model struct {
 
 	// workflow state
 	repoStructure manifest.RepoStructure
-	fileMap       map[string]string // source path -> target path
-	sortedTargets []string          // deterministic order for file view
+	candidates    []manifest.Candidate          // layouts the repo might use, most likely first
+	override      manifest.RepoStructure        // layout the user picked instead, StructureUnknown to detect
+	fileMap       map[string]string             // source path -> target path
+	sortedTargets []string                      // deterministic order for file view
+	sourceRoots   []string                      // repo-relative paths the files came from
+	fileAttrs     map[string]manifest.FileAttrs // modes, symlinks, create-only, by target
+	skippedFiles  map[string]string             // targets we can't apply (chezmoi scripts...) and why
+	excludedFiles map[string]string             // targets ignore patterns left out, and the rule
+	unfold        []string                      // folded stow links to turn back into directories first
 	diffResults   []*diff.Result
 	// diffViewer    *DiffViewer // temporarily disabled until next release
 
+	// download progress
+	syncResult     *cache.SyncResult // what the cache did, e.g. stale copy after a failed pull
+	submodules     *cache.SubmoduleReport
+	progress       cache.Progress
+	progressCh     chan cache.Progress
+	cancelDownload context.CancelFunc
+
+	// creator detail pane
+	detailCreator *manifest.Creator
+	detailView    viewport.Model
+	readme        string // the README's markdown, "" until loaded or when there's none
+	readmeNote    string // what the pane says about the README
+
+	// cache management
+	cacheRepos []cache.RepoInfo
+	prefetch   *prefetchState
+
 	// dependency checking
 	depChecker    *deps.Checker
 	depResults    []deps.CheckResult
@@ -110,20 +152,20 @@ func (i listItem) Description() string { return i.description }
 func (i listItem) FilterValue() string { return i.title }
 
 // New creates a new TUI model
-func New(ctx context.Context) (*Model, error) {
-	// load config
-	cfg, err := config.Default()
-	if err != nil {
-		return nil, err
-	}
-
+func New(ctx context.Context, cfg *config.Config) (*Model, error) {
 	if err := cfg.EnsureDirectories(); err != nil {
 		return nil, err
 	}
 
 	// create services
-	fetcher := manifest.NewFetcher(cfg.ManifestURL, cfg.ManifestCachePath)
 	cacheManager := cache.NewManager(cfg.CacheDir)
+	cacheManager.SetRefreshPolicy(cache.RefreshPolicy{
+		Mode:   cache.RefreshMode(cfg.RepoRefresh),
+		MaxAge: cfg.RepoMaxAge,
+	})
+	cacheManager.SetAuthenticator(cache.NewAuthenticator(cfg.GitAuth))
+	historyStore := history.NewStore(cfg.HistoryPath)
+	cacheManager.SetLinked(historyStore.Linked)
 	backupManager := backup.NewManager(cfg.BackupDir)
 	applierInstance, err := applier.NewApplier(backupManager, cfg)
 	if err != nil {
@@ -145,10 +187,11 @@ func New(ctx context.Context) (*Model, error) {
 	return &Model{
 		screen:     ScreenLoading,
 		cfg:        cfg,
-		fetcher:    fetcher,
 		cache:      cacheManager,
 		backup:     backupManager,
 		applier:    applierInstance,
+		history:    historyStore,
+		machine:    manifest.CurrentMachine(),
 		spinner:    s,
 		depChecker: depChecker,
 	}, nil
@@ -171,9 +214,23 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.dirBrowser != nil {
 			m.dirBrowser.Resize(msg.Width, msg.Height)
 		}
+		if m.screen == ScreenCreatorDetail {
+			m.layoutCreatorDetail()
+		}
 		return m, nil
 
 	case tea.KeyMsg:
+		// first ctrl+c aborts a running download, a second one quits
+		if msg.String() == "ctrl+c" && m.cancelDownload != nil {
+			m.cancelDownload()
+			m.cancelDownload = nil
+			m.statusMsg = "cancelling download"
+			return m, nil
+		}
+		if msg.String() == "ctrl+c" && m.cancelPrefetch() {
+			return m, nil
+		}
+
 		// Handle screen-specific keys first
 		if m.screen == ScreenDependencyCheck {
 			switch msg.String() {
@@ -222,6 +279,49 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		if m.screen == ScreenTreeConfirm && msg.String() == "s" {
+			// not the layout the repo uses, resolve the files again with the next one
+			m.override = nextStructure(m.candidates, m.repoStructure)
+			m.screen = ScreenDownloading
+			m.statusMsg = "resolving file paths as " + describeStructure(m.override)
+			return m, tea.Batch(m.spinner.Tick, m.detectStructure)
+		}
+
+		if m.screen == ScreenCache {
+			if model, cmd, handled := m.handleCacheKey(msg.String()); handled {
+				return model, cmd
+			}
+		}
+
+		if m.screen == ScreenCategory && msg.String() == "c" && m.categoryList.FilterState() != list.Filtering {
+			return m.openCacheScreen()
+		}
+
+		if m.screen == ScreenCreator && msg.String() == "p" && m.creatorList.FilterState() != list.Filtering {
+			return m.startPrefetch()
+		}
+
+		if m.screen == ScreenCreator && msg.String() == "i" && m.creatorList.FilterState() != list.Filtering {
+			return m.openCreatorDetail()
+		}
+
+		if m.screen == ScreenCreatorDetail {
+			if model, cmd, handled := m.handleCreatorDetailKey(msg); handled {
+				return model, cmd
+			}
+		}
+
+		if msg.String() == "a" && (m.screen == ScreenCreator && m.creatorList.FilterState() != list.Filtering || m.screen == ScreenDotfile) {
+			// show or hide creators and dotfiles meant for other machines
+			m.showUnsupported = !m.showUnsupported
+			if m.screen == ScreenCreator {
+				m.buildCreatorList()
+			} else {
+				m.buildDotfileList()
+			}
+			return m, nil
+		}
+
 		// Error screen handling removed - ESC navigation handles going back
 
 		switch msg.String() {
@@ -247,6 +347,9 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.screen = ScreenTreeConfirm
 			case ScreenComplete:
 				m.screen = ScreenCategory
+			case ScreenCache:
+				m.screen = ScreenCategory
+				m.statusMsg = ""
 			case ScreenError:
 				// try to go back to a safe screen
 				if m.selectedCreator != nil {
@@ -267,13 +370,52 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case manifestLoadedMsg:
 		m.manifest = msg.manifest
+		m.registries = msg.registries
 		m.screen = ScreenCategory
 		m.buildCategoryList()
 		return m, nil
 
+	case cacheListedMsg:
+		m.cacheRepos = msg.repos
+		m.buildCacheList()
+		m.statusMsg = ""
+		if len(msg.removed) > 0 {
+			var freed int64
+			for _, r := range msg.removed {
+				freed += r.Size
+			}
+			m.statusMsg = fmt.Sprintf("removed %d repo(s), freed %s", len(msg.removed), cache.FormatSize(freed))
+		}
+		return m, nil
+
+	case readmeLoadedMsg:
+		m.handleReadmeLoaded(msg)
+		return m, nil
+
+	case upstreamCountedMsg:
+		m.handleUpstreamCounted(msg)
+		return m, nil
+
+	case prefetchProgressMsg:
+		return m, m.handlePrefetchProgress(msg)
+
+	case prefetchFinishedMsg:
+		m.finishPrefetch()
+		return m, nil
+
+	case downloadProgressMsg:
+		m.progress = msg.progress
+		return m, waitForProgress(m.progressCh)
+
+	case downloadCancelledMsg:
+		m.finishDownload()
+		m.screen = ScreenDotfile
+		return m, nil
+
 	case repoDownloadedMsg:
+		m.finishDownload()
+		m.syncResult = msg.sync
 		// repo downloaded, proceed to dependency check or structure detection
-		// (submodules are skipped - modern plugin managers auto-install)
 		if m.depChecker != nil && len(m.selectedDotfile.Dependencies) > 0 {
 			return m, m.checkDependencies
 		}
@@ -331,7 +473,16 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case filesResolvedMsg:
 		// files resolved, save state
 		m.repoStructure = msg.structure
+		m.candidates = msg.candidates
 		m.fileMap = msg.fileMap
+		m.fileAttrs = msg.attrs
+		m.skippedFiles = msg.skipped
+		m.excludedFiles = msg.excluded
+		m.unfold = msg.unfold
+		m.sourceRoots = msg.roots
+		if msg.submodules != nil {
+			m.submodules = msg.submodules
+		}
 		m.sortedTargets = make([]string, 0, len(msg.fileMap))
 		for _, target := range msg.fileMap {
 			m.sortedTargets = append(m.sortedTargets, target)
@@ -344,6 +495,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case pathNotFoundMsg:
 		// Auto-detection failed, show directory browser
+		m.submodules = msg.submodules
 		m.screen = ScreenDirectoryBrowser
 		m.dirBrowser = NewDirBrowser(msg.repoPath, msg.requestedPath, m.width, m.height)
 		return m, nil
@@ -364,6 +516,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case errorMsg:
+		m.finishDownload()
 		m.err = msg.err
 		m.screen = ScreenError
 		return m, nil
@@ -387,6 +540,8 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.dirBrowser != nil {
 			m.dirBrowser, cmd = m.dirBrowser.Update(msg)
 		}
+	case ScreenCache:
+		m.cacheList, cmd = m.cacheList.Update(msg)
 	}
 
 	// Diff viewer temporarily disabled
@@ -417,6 +572,10 @@ func (m *Model) View() string {
 		return m.viewPluginManagerDetect()
 	case ScreenDirectoryBrowser:
 		return m.viewDirectoryBrowser()
+	case ScreenCache:
+		return m.viewCache()
+	case ScreenCreatorDetail:
+		return m.viewCreatorDetail()
 	case ScreenComplete:
 		return m.viewComplete()
 	case ScreenError:
@@ -441,7 +600,13 @@ func (m *Model) viewCategories() string {
 	b.WriteString("\n\n")
 	b.WriteString(m.categoryList.View())
 	b.WriteString("\n")
-	b.WriteString(formatHelp("enter: select • q: quit"))
+	if summary := registrySummary(m.registries); summary != "" {
+		b.WriteString(mutedStyle.Render("manifests: "+summary) + "\n")
+	}
+	for _, failed := range registry.Failed(m.registries) {
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("⚠ %s registry unavailable: %v", failed.Name, failed.Err)) + "\n")
+	}
+	b.WriteString(formatHelp("enter: select • c: manage cache • q: quit"))
 
 	return centerContentBoth(m.width, m.height, b.String())
 }
@@ -456,7 +621,14 @@ func (m *Model) viewCreators() string {
 	b.WriteString("\n\n")
 	b.WriteString(m.creatorList.View())
 	b.WriteString("\n")
-	b.WriteString(formatHelp("enter: select • esc: back • q: quit"))
+	if status := m.prefetchStatus(); status != "" {
+		b.WriteString(status)
+		b.WriteString("\n")
+	}
+	if note := m.unsupportedNote(m.hiddenCreators, "creator"); note != "" {
+		b.WriteString(mutedStyle.Render(note) + "\n")
+	}
+	b.WriteString(formatHelp("enter: select • i: details • p: prefetch all • a: other platforms • esc: back • q: quit"))
 
 	return centerContentBoth(m.width, m.height, b.String())
 }
@@ -471,7 +643,10 @@ func (m *Model) viewDotfiles() string {
 	b.WriteString("\n\n")
 	b.WriteString(m.dotfileList.View())
 	b.WriteString("\n")
-	b.WriteString(formatHelp("enter: apply • esc: back • q: quit"))
+	if note := m.unsupportedNote(m.hiddenDotfiles, "dotfile"); note != "" {
+		b.WriteString(mutedStyle.Render(note) + "\n")
+	}
+	b.WriteString(formatHelp("enter: apply • a: other platforms • esc: back • q: quit"))
 	b.WriteString("\n")
 	b.WriteString(mutedStyle.Render("note: applying will create backups of your existing configs"))
 
@@ -487,23 +662,21 @@ func (m *Model) viewTreeConfirm() string {
 	b.WriteString(formatSubtitle(fmt.Sprintf("%s - %s", m.selectedCreator.Name, m.selectedDotfile.Name)))
 	b.WriteString("\n\n")
 
-	// Show detected structure type
-	structureType := "unknown"
-	switch m.repoStructure {
-	case manifest.StructureFlat:
-		structureType = "flat (dotfiles at root)"
-	case manifest.StructureStow:
-		structureType = "stow layout"
-	case manifest.StructureChezmoi:
-		structureType = "chezmoi"
-	case manifest.StructureConfig:
-		structureType = "config directory"
-	case manifest.StructureBareRepo:
-		structureType = "bare repository"
-	}
-
-	b.WriteString(fmt.Sprintf("📂 Detected structure: %s\n", structureType))
+	// let the user know when they're looking at an old copy of the repo
+	if note := m.syncResult.Summary(); note != "" {
+		b.WriteString(mutedStyle.Render("⚠ "+note) + "\n\n")
+	}
+	if m.syncResult != nil {
+		if note := m.syncResult.Repair.Summary(); note != "" {
+			b.WriteString(mutedStyle.Render("🔧 "+note) + "\n\n")
+		}
+	}
+
+	b.WriteString(m.viewStructure())
 	b.WriteString(fmt.Sprintf("📝 Files to apply: %d\n\n", len(m.fileMap)))
+	b.WriteString(m.viewSubmoduleReport())
+	b.WriteString(m.viewSkippedFiles())
+	b.WriteString(m.viewExcludedFiles())
 
 	// Show file tree in deterministic order with pagination to avoid jitter
 	maxFiles := 20
@@ -529,13 +702,105 @@ func (m *Model) viewTreeConfirm() string {
 	}
 
 	b.WriteString("\n")
-	b.WriteString(formatHelp("enter: confirm and continue • esc: cancel • q: quit"))
+	b.WriteString(formatHelp("enter: confirm and continue • s: try another layout • esc: cancel • q: quit"))
 	b.WriteString("\n")
 	b.WriteString(mutedStyle.Render("note: backups will be created before any files are modified"))
 
 	return centerContentBoth(m.width, m.height, b.String())
 }
 
+// viewStructure says which layout the files were resolved with and why
+func (m *Model) viewStructure() string {
+	var b strings.Builder
+	name := describeStructure(m.repoStructure)
+	if m.override != manifest.StructureUnknown && m.override == m.repoStructure {
+		name += " (picked by you)"
+	} else if len(m.candidates) > 0 && m.candidates[0].Structure == m.repoStructure {
+		name += fmt.Sprintf(" (%d%% sure)", m.candidates[0].Score)
+	}
+	b.WriteString(fmt.Sprintf("📂 Detected structure: %s\n", name))
+
+	var others []string
+	for i, c := range m.candidates {
+		if c.Structure == m.repoStructure {
+			for _, evidence := range c.Evidence {
+				b.WriteString(mutedStyle.Render("   "+evidence) + "\n")
+			}
+			continue
+		}
+		if i < 4 {
+			others = append(others, fmt.Sprintf("%s %d%%", c.Structure, c.Score))
+		}
+	}
+	if len(others) > 0 {
+		b.WriteString(mutedStyle.Render("   also considered: "+strings.Join(others, ", ")) + "\n")
+	}
+	return b.String()
+}
+
+// structureNames describes every layout, in the order they're offered
+var structureNames = []struct {
+	structure manifest.RepoStructure
+	name      string
+}{
+	{manifest.StructureStow, "stow layout"},
+	{manifest.StructureChezmoi, "chezmoi"},
+	{manifest.StructureDotbot, "dotbot"},
+	{manifest.StructureRcm, "rcm"},
+	{manifest.StructureHomeshick, "homeshick castle"},
+	{manifest.StructureBareRepo, "bare repository (yadm)"},
+	{manifest.StructureConfig, "config directory"},
+	{manifest.StructureFlat, "flat (dotfiles at root)"},
+}
+
+// describeStructure names a layout for the tree view
+func describeStructure(structure manifest.RepoStructure) string {
+	for _, s := range structureNames {
+		if s.structure == structure {
+			return s.name
+		}
+	}
+	return "unknown"
+}
+
+// preferStructure moves the user's pick to the front of the candidates,
+// adding it when detection found no evidence for it at all
+func preferStructure(candidates []manifest.Candidate, structure manifest.RepoStructure) []manifest.Candidate {
+	preferred := manifest.Candidate{Structure: structure}
+	rest := make([]manifest.Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Structure == structure {
+			preferred = c
+			continue
+		}
+		rest = append(rest, c)
+	}
+	return append([]manifest.Candidate{preferred}, rest...)
+}
+
+// nextStructure is the layout to try after current: the other candidates
+// by score, then every layout nothing pointed to, wrapping around
+func nextStructure(candidates []manifest.Candidate, current manifest.RepoStructure) manifest.RepoStructure {
+	var order []manifest.RepoStructure
+	seen := make(map[manifest.RepoStructure]bool)
+	for _, c := range candidates {
+		order = append(order, c.Structure)
+		seen[c.Structure] = true
+	}
+	for _, s := range structureNames {
+		if !seen[s.structure] {
+			order = append(order, s.structure)
+		}
+	}
+
+	for i, s := range order {
+		if s == current {
+			return order[(i+1)%len(order)]
+		}
+	}
+	return order[0]
+}
+
 // viewDownloading shows the downloading screen with dynamic status
 func (m *Model) viewDownloading() string {
 	var b strings.Builder
@@ -547,7 +812,26 @@ func (m *Model) viewDownloading() string {
 		b.WriteString(fmt.Sprintf("%s processing...", m.spinner.View()))
 	}
 	b.WriteString("\n\n")
+
+	// while a clone is running, show what git is doing instead of just a spinner
+	if m.cancelDownload != nil && m.progress.Stage != "" {
+		counts := fmt.Sprintf("%d", m.progress.Current)
+		if m.progress.Total > 0 {
+			counts = fmt.Sprintf("%d/%d", m.progress.Current, m.progress.Total)
+		}
+		b.WriteString(fmt.Sprintf("%s  %s\n", m.progress.Stage, mutedStyle.Render(counts)))
+		if m.progress.Total > 0 {
+			b.WriteString(formatProgressBar(m.progress.Percent(), 40))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+
 	b.WriteString(mutedStyle.Render("this may take a moment..."))
+	if m.cancelDownload != nil {
+		b.WriteString("\n")
+		b.WriteString(formatHelp("ctrl+c: cancel download"))
+	}
 
 	return centerContentBoth(m.width, m.height, b.String())
 }
@@ -637,7 +921,83 @@ func (m *Model) viewPluginManagerDetect() string {
 	return centerContentBoth(m.width, m.height, b.String())
 }
 
-// Note: viewSubmoduleConfirm removed - submodules are now skipped entirely
+// viewSkippedFiles lists the targets in the selection we won't touch
+func (m *Model) viewSkippedFiles() string {
+	if len(m.skippedFiles) == 0 {
+		return ""
+	}
+
+	targets := make([]string, 0, len(m.skippedFiles))
+	for target := range m.skippedFiles {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⏭  Not applied: %d\n", len(targets)))
+	for i, target := range targets {
+		if i == 5 {
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("  ... and %d more", len(targets)-5)) + "\n")
+			break
+		}
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("  • %s (%s)", target, m.skippedFiles[target])) + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// viewExcludedFiles lists the files ignore patterns left out, with the
+// rule that did it
+func (m *Model) viewExcludedFiles() string {
+	if len(m.excludedFiles) == 0 {
+		return ""
+	}
+
+	targets := make([]string, 0, len(m.excludedFiles))
+	for target := range m.excludedFiles {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🚫 Excluded: %d\n", len(targets)))
+	for i, target := range targets {
+		if i == 5 {
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("  ... and %d more", len(targets)-5)) + "\n")
+			break
+		}
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("  • %s (%s)", target, m.excludedFiles[target])) + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// viewSubmoduleReport lists the submodules under the selected paths and
+// whether they could be checked out, empty when there are none
+func (m *Model) viewSubmoduleReport() string {
+	if m.submodules.Summary() == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📦 %s\n", m.submodules.Summary()))
+	for _, r := range m.submodules.Results {
+		switch r.Status {
+		case cache.SubmoduleResolved:
+			b.WriteString(fmt.Sprintf("  ✓ %s @ %s\n", r.Path, r.ShortCommit()))
+		case cache.SubmodulePrivate:
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("  🔒 %s: private or missing, add git_auth for %s to fetch it", r.Path, r.URL)) + "\n")
+		default:
+			reason := "unknown error"
+			if r.Err != nil {
+				reason, _, _ = strings.Cut(r.Err.Error(), "\n")
+			}
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("  ✗ %s: %s", r.Path, reason)) + "\n")
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
 
 // viewComplete shows the completion screen
 func (m *Model) viewComplete() string {
@@ -710,6 +1070,7 @@ func (m *Model) handleEnter() (tea.Model, tea.Cmd) {
 				m.selectedCategory = cat
 				m.screen = ScreenCreator
 				m.buildCreatorList()
+				return m, m.countUpstream(m.manifest.GetCreatorsByCategory(cat.ID))
 			}
 		}
 	case ScreenCreator:
@@ -721,16 +1082,27 @@ func (m *Model) handleEnter() (tea.Model, tea.Cmd) {
 				m.buildDotfileList()
 			}
 		}
+	case ScreenCreatorDetail:
+		// the creator the pane shows
+		m.selectedCreator = m.detailCreator
+		m.screen = ScreenDotfile
+		m.buildDotfileList()
 	case ScreenDotfile:
 		// select dotfile - now download repo and proceed
 		if item, ok := m.dotfileList.SelectedItem().(listItem); ok {
 			if dotfile, ok := item.data.(*manifest.Dotfile); ok {
 				m.selectedDotfile = dotfile
+				m.override = manifest.StructureUnknown
 				m.statusMsg = "downloading " + m.selectedCreator.Name + "'s dotfiles"
 
-				// Download the repo
+				// Download the repo, ctrl+c cancels through this context
+				ctx, cancel := context.WithCancel(context.Background())
+				m.cancelDownload = cancel
+				m.progress = cache.Progress{}
+				m.progressCh = make(chan cache.Progress, 16)
+
 				m.screen = ScreenDownloading
-				return m, tea.Batch(m.spinner.Tick, m.downloadRepo)
+				return m, tea.Batch(m.spinner.Tick, m.downloadRepo(ctx, m.progressCh), waitForProgress(m.progressCh))
 			}
 		}
 	case ScreenTreeConfirm:
@@ -758,52 +1130,74 @@ func (m *Model) handleEnter() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-// fetchManifest loads the manifest
-// fetchManifest loads the manifest from the local configs directory
+// fetchManifest loads and merges every registry: the official manifest,
+// team registries, the user's manifests and the creators from add-repo
 func (m *Model) fetchManifest() tea.Msg {
-	// Use local manifest file for faster startup and offline support
-	// The manifest is bundled with the binary in configs/manifest.json
-	localManifestPath := filepath.Join("configs", "manifest.json")
-
-	// Try to read the local manifest file
-	manifest, err := m.loadLocalManifest(localManifestPath)
+	man, statuses, err := registry.Load(context.Background(), m.cfg)
 	if err != nil {
-		// If local file doesn't exist, try the old remote fetch as fallback
-		manifest, err = m.fetcher.Fetch(context.Background())
-		if err != nil {
-			return errorMsg{fmt.Errorf("couldn't load manifest: %w", err)}
-		}
+		return errorMsg{fmt.Errorf("couldn't load manifest: %w", err)}
 	}
-
-	return manifestLoadedMsg{manifest}
+	return manifestLoadedMsg{manifest: man, registries: statuses}
 }
 
-// loadLocalManifest reads and parses the local manifest.json file
-func (m *Model) loadLocalManifest(path string) (*manifest.Manifest, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+// downloadRepo downloads the selected creator's repo
+// progress updates are streamed into ch, which is closed when the download ends
+func (m *Model) downloadRepo(ctx context.Context, ch chan cache.Progress) tea.Cmd {
+	creator := m.selectedCreator
+	dotfile := m.selectedDotfile
+	return func() tea.Msg {
+		defer close(ch)
+
+		opts := cache.GitOptions{
+			Progress: func(p cache.Progress) {
+				select {
+				case ch <- p:
+				default:
+					// ui is behind, drop this update - the next one supersedes it
+				}
+			},
+		}
+		if m.cfg.SparseCheckout {
+			// only fetch what this dotfile needs, detection widens it later if required
+			opts.Sparse = manifest.DotfileSparsePatterns(dotfile)
+		}
 
-	var man manifest.Manifest
-	if err := json.Unmarshal(data, &man); err != nil {
-		return nil, fmt.Errorf("couldn't parse manifest: %w", err)
+		sync, err := m.cache.EnsureRepoWithOptions(ctx, creator, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Info("Download of %s cancelled by user", creator.Name)
+				return downloadCancelledMsg{}
+			}
+			return errorMsg{err}
+		}
+		if note := sync.Summary(); note != "" {
+			logger.Warn("%s: %s", creator.Name, note)
+		}
+		if note := sync.Repair.Summary(); note != "" {
+			logger.Warn("%s: %s", creator.Name, note)
+		}
+		return repoDownloadedMsg{creatorID: creator.ID, sync: sync}
 	}
-
-	return &man, nil
 }
 
-// downloadRepo downloads the selected creator's repo
-func (m *Model) downloadRepo() tea.Msg {
-	ctx := context.Background()
-	if err := m.cache.EnsureRepo(ctx, m.selectedCreator); err != nil {
-		return errorMsg{err}
+// waitForProgress waits for the next progress update from a running download
+func waitForProgress(ch chan cache.Progress) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return downloadProgressMsg{progress: p}
 	}
-	return repoDownloadedMsg{creatorID: m.selectedCreator.ID}
 }
 
-// Note: checkSubmodules and initSubmodules removed - submodules are now skipped entirely
-// Modern plugin managers auto-install, and submodule failures rarely matter for dotfiles
+// finishDownload releases the download context once it's no longer needed
+func (m *Model) finishDownload() {
+	if m.cancelDownload != nil {
+		m.cancelDownload()
+		m.cancelDownload = nil
+	}
+}
 
 // detectStructure detects the repo structure and resolves file paths
 func (m *Model) detectStructure() tea.Msg {
@@ -816,22 +1210,133 @@ func (m *Model) detectStructure() tea.Msg {
 	searchPath := m.cache.GetRepoPath(m.selectedCreator.ID)
 	logger.Info("Repository path: %s", searchPath)
 
-	structure := manifest.DetectStructure(searchPath)
+	// layouts are tried most likely first, or the user's pick first
+	candidates := manifest.DetectStructures(searchPath)
+	if m.override != manifest.StructureUnknown {
+		candidates = preferStructure(candidates, m.override)
+	}
+	structure := manifest.StructureUnknown
+	structures := make([]manifest.RepoStructure, 0, len(candidates))
+	for _, c := range candidates {
+		structures = append(structures, c.Structure)
+	}
+	if len(structures) > 0 {
+		structure = structures[0]
+	}
+	logger.Info("Using structure: %s (candidates: %v)", structure, structures)
+
+	// chezmoi names (dot_, private_, .tmpl...) have to be decoded to targets
+	var chezmoi *manifest.ChezmoiState
+	if structure == manifest.StructureChezmoi {
+		state, err := manifest.DecodeChezmoi(searchPath)
+		if err != nil {
+			logger.Warn("Couldn't decode chezmoi source state: %v", err)
+		}
+		chezmoi = state
+	}
+
+	// stow packages are merged, with dot- names and ignore lists applied
+	var stow *manifest.StowState
+	if structure == manifest.StructureStow {
+		state, err := manifest.DecodeStow(searchPath, m.selectedCreator.Stow)
+		if err != nil {
+			logger.Warn("Couldn't decode stow packages: %v", err)
+		}
+		stow = state
+	}
+
+	// dotbot, yadm, rcm and homeshick repos say where their files go
+	var layout *manifest.Layout
+	if manifest.HasDeclaredLayout(structure) {
+		decoded, err := manifest.DecodeLayout(searchPath, structure)
+		if err != nil {
+			logger.Warn("Couldn't decode repo layout: %v", err)
+		}
+		layout = decoded
+	}
 
 	// resolve file paths
 	fileMap := make(map[string]string)
-	for _, path := range m.selectedDotfile.Paths {
+	attrs := make(map[string]manifest.FileAttrs)
+	skipped := make(map[string]string)
+	var roots, unfold []string
+	submodules := &cache.SubmoduleReport{}
+	for _, spec := range m.selectedDotfile.Paths {
+		path, target := spec.Path(), specTarget(spec)
 		logger.Debug("Processing requested path: %s", path)
-		sourcePath, found := manifest.ResolveFilePath(searchPath, path, structure)
+
+		// a named source is used as is, the layouts only guess
+		if chezmoi != nil && !spec.Explicit() {
+			root, err := m.resolveChezmoi(chezmoi, path, fileMap, attrs, skipped)
+			if err != nil {
+				return errorMsg{err}
+			}
+			if root != "" {
+				roots = append(roots, root)
+				continue
+			}
+		}
+		if stow != nil && !spec.Explicit() {
+			plan, err := m.resolveStow(&stow, path, submodules)
+			if err != nil {
+				return errorMsg{err}
+			}
+			if len(plan.Sources) > 0 {
+				addPlanned(fileMap, attrs, skipped, plan.Files, plan.Attrs, plan.Skipped)
+				roots = append(roots, plan.Sources...)
+				unfold = append(unfold, plan.Unfold...)
+				continue
+			}
+		}
+		if layout != nil && !spec.Explicit() {
+			plan, err := m.resolveLayout(&layout, path, submodules)
+			if err != nil {
+				return errorMsg{err}
+			}
+			if len(plan.Sources) > 0 {
+				addPlanned(fileMap, attrs, skipped, plan.Files, nil, plan.Skipped)
+				roots = append(roots, plan.Sources...)
+				continue
+			}
+		}
+		sourcePath, found := filepath.Join(searchPath, filepath.FromSlash(spec.Source)), false
+		if spec.Explicit() {
+			_, err := os.Stat(sourcePath)
+			found = err == nil
+		} else {
+			sourcePath, found = manifest.ResolveFilePath(searchPath, path, layout, structures...)
+		}
+		if !found && m.expandSparseCheckout(searchPath) {
+			// the partial clone didn't cover it, retry against the full tree
+			return m.detectStructure()
+		}
+		if !found && spec.Optional {
+			logger.Info("Optional path %s isn't in the repo, skipping it", path)
+			continue
+		}
 		if !found {
 			logger.Error("Path not found: %s - triggering directory browser", path)
 			// Return pathNotFoundMsg to trigger directory browser
 			return pathNotFoundMsg{
 				requestedPath: path,
 				repoPath:      searchPath,
+				submodules:    submodules,
 			}
 		}
 
+		if rel, err := filepath.Rel(searchPath, sourcePath); err == nil {
+			roots = append(roots, filepath.ToSlash(rel))
+
+			// submodules under this path are checked out at their pinned commits
+			report := cache.ResolveSubmodules(context.Background(), searchPath, []string{rel}, m.cache.GitOptions())
+			for _, r := range report.Results {
+				if r.Status != cache.SubmoduleResolved {
+					logger.Warn("Submodule %s %s: %v", r.Path, r.Status, r.Err)
+				}
+			}
+			submodules.Results = append(submodules.Results, report.Results...)
+		}
+
 		// check if it's a file or directory
 		info, err := os.Stat(sourcePath)
 		if err != nil {
@@ -841,113 +1346,226 @@ func (m *Model) detectStructure() tea.Msg {
 
 		if info.IsDir() {
 			logger.Info("Source is a directory, walking to find all files...")
-			// for directories, we'll walk and add all files
-			filesFound := 0
-			err := filepath.Walk(sourcePath, func(walkPath string, walkInfo os.FileInfo, walkErr error) error {
-				if walkErr != nil {
-					return walkErr
-				}
-
-				// Skip .git directories entirely (both file placeholders and real git dirs)
-				if walkInfo.IsDir() && filepath.Base(walkPath) == ".git" {
-					logger.Debug("  Skipping .git directory: %s", walkPath)
-					return filepath.SkipDir
-				}
-
-				if !walkInfo.IsDir() {
-					// get relative path from source
-					relPath, err := filepath.Rel(sourcePath, walkPath)
-					if err != nil {
-						return err
-					}
-					// target path is the dotfile path + relative path
-					targetPath := filepath.Join(path, relPath)
-					fileMap[walkPath] = targetPath
-					filesFound++
-					logger.Debug("  Found file: %s → %s", relPath, targetPath)
-				}
-				return nil
-			})
+			filesFound, err := collectFiles(sourcePath, target, fileMap)
 			if err != nil {
 				logger.Error("Failed to walk directory %s: %v", sourcePath, err)
 				return errorMsg{fmt.Errorf("couldn't walk directory %s: %w", sourcePath, err)}
 			}
-
 			logger.Info("Found %d files in directory", filesFound)
 
-			// If directory is empty (or only has .git file), try to resolve as submodule
+			if filesFound == 0 && spec.Optional {
+				logger.Info("Optional directory %s is empty, skipping it", path)
+				continue
+			}
 			if filesFound == 0 {
-				logger.Warn("Directory is empty, checking for submodules...")
-				// Check if this might be a submodule
-				isEmpty, err := cache.IsEmptyDirectory(sourcePath)
-				if err == nil && isEmpty {
-					// Try to resolve all submodules recursively (depth limit 3)
-					// This handles nested submodules automatically
-					ctx := context.Background()
-					repoPath := m.cache.GetRepoPath(m.selectedCreator.ID)
-
-					logger.Info("Attempting to resolve submodules...")
-					if err := cache.ResolveSubmodulesRecursive(ctx, repoPath, 3); err == nil {
-						logger.Info("Submodules resolved, re-walking directory...")
-						// Submodules resolved! Re-walk the directory
-						filesFound = 0
-						err := filepath.Walk(sourcePath, func(walkPath string, walkInfo os.FileInfo, walkErr error) error {
-							if walkErr != nil {
-								return walkErr
-							}
-
-							// Skip .git directories entirely (both file placeholders and real git dirs)
-							if walkInfo.IsDir() && filepath.Base(walkPath) == ".git" {
-								return filepath.SkipDir
-							}
-
-							if !walkInfo.IsDir() {
-								relPath, err := filepath.Rel(sourcePath, walkPath)
-								if err != nil {
-									return err
-								}
-								targetPath := filepath.Join(path, relPath)
-								fileMap[walkPath] = targetPath
-								filesFound++
-								logger.Debug("  Found file after submodule resolution: %s → %s", relPath, targetPath)
-							}
-							return nil
-						})
-						if err != nil {
-							logger.Error("Failed to walk submodule directory: %v", err)
-							return errorMsg{fmt.Errorf("couldn't walk submodule directory %s: %w", sourcePath, err)}
-						}
-						logger.Info("Found %d files after submodule resolution", filesFound)
-					} else {
-						logger.Warn("Submodule resolution failed: %v", err)
-					}
-				}
-
-				// If still empty after trying submodule resolution, show browser
-				if filesFound == 0 {
-					logger.Error("Directory still empty after submodule check - triggering directory browser")
-					return pathNotFoundMsg{
-						requestedPath: path,
-						repoPath:      searchPath,
-					}
+				logger.Error("Directory is empty - triggering directory browser")
+				return pathNotFoundMsg{
+					requestedPath: path,
+					repoPath:      searchPath,
+					submodules:    submodules,
 				}
 			}
 		} else {
-			logger.Info("Source is a single file: %s → %s", sourcePath, path)
+			logger.Info("Source is a single file: %s → %s", sourcePath, target)
 			// single file
-			fileMap[sourcePath] = path
+			fileMap[sourcePath] = target
 		}
 	}
 
+	// ignore patterns and modes, per path entry
+	excluded, err := manifest.FilterFiles(m.selectedDotfile, m.ignoreFilter(searchPath), fileMap, attrs)
+	if err != nil {
+		return errorMsg{err}
+	}
+	for target, reason := range excluded {
+		logger.Info("Leaving out %s (%s)", target, reason)
+	}
+
 	logger.Section("File Map Resolution Complete")
 	logger.FileMap(fileMap)
 
 	return filesResolvedMsg{
-		structure: structure,
-		fileMap:   fileMap,
+		structure:  structure,
+		candidates: candidates,
+		fileMap:    fileMap,
+		attrs:      attrs,
+		skipped:    skipped,
+		excluded:   excluded,
+		unfold:     unfold,
+		roots:      roots,
+		submodules: submodules,
+	}
+}
+
+// resolveChezmoi adds the files a chezmoi source state has for path,
+// rendering templates into the cache; returns the repo-relative source
+// path, empty when the source state has nothing for path
+func (m *Model) resolveChezmoi(state *manifest.ChezmoiState, path string, fileMap map[string]string,
+	attrs map[string]manifest.FileAttrs, skipped map[string]string) (string, error) {
+	entry, ok := state.Lookup(path)
+	if !ok {
+		return "", nil
+	}
+
+	renderDir := filepath.Join(m.cfg.CacheDir, ".rendered", m.selectedCreator.ID)
+	plan, err := state.Plan(path, renderDir)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve %s in the chezmoi source: %w", path, err)
+	}
+	addPlanned(fileMap, attrs, skipped, plan.Files, plan.Attrs, plan.Skipped)
+	logger.Info("chezmoi: %s → %d file(s), %d skipped", path, len(plan.Files), len(plan.Skipped))
+
+	root, err := filepath.Rel(m.cache.GetRepoPath(m.selectedCreator.ID), entry.Source)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve %s in the chezmoi source: %w", path, err)
+	}
+	return filepath.ToSlash(root), nil
+}
+
+// resolveStow plans path across the stow packages, linking instead of
+// copying when the user asked for it; submodules in the packages are
+// checked out first and the packages decoded again to see their files
+func (m *Model) resolveStow(state **manifest.StowState, path string, submodules *cache.SubmoduleReport) (*manifest.StowPlan, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get home directory: %w", err)
+	}
+
+	plan := (*state).Plan(path, homeDir, m.cfg.StowLink)
+	if len(plan.Sources) == 0 {
+		return plan, nil
+	}
+
+	report := cache.ResolveSubmodules(context.Background(), (*state).Root, plan.Sources, m.cache.GitOptions())
+	for _, r := range report.Results {
+		if r.Status != cache.SubmoduleResolved {
+			logger.Warn("Submodule %s %s: %v", r.Path, r.Status, r.Err)
+		}
+	}
+	submodules.Results = append(submodules.Results, report.Results...)
+	if report.Count(cache.SubmoduleResolved) > 0 {
+		decoded, err := manifest.DecodeStow((*state).Root, m.selectedCreator.Stow)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode stow packages: %w", err)
+		}
+		*state = decoded
+		plan = decoded.Plan(path, homeDir, m.cfg.StowLink)
+	}
+
+	logger.Info("stow: %s → %d file(s) from %v, %d folded, %d conflicts",
+		path, len(plan.Files), plan.Packages, len(plan.Folded), len(plan.Skipped))
+	return plan, nil
+}
+
+// resolveLayout plans path from the repo's declared mappings, checking out
+// submodules under the mapped sources and decoding the layout again if any were
+func (m *Model) resolveLayout(layout **manifest.Layout, path string, submodules *cache.SubmoduleReport) (*manifest.LayoutPlan, error) {
+	plan, err := (*layout).Plan(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't plan %s: %w", path, err)
+	}
+	if len(plan.Sources) == 0 {
+		return plan, nil
+	}
+
+	report := cache.ResolveSubmodules(context.Background(), (*layout).Root, plan.Sources, m.cache.GitOptions())
+	for _, r := range report.Results {
+		if r.Status != cache.SubmoduleResolved {
+			logger.Warn("Submodule %s %s: %v", r.Path, r.Status, r.Err)
+		}
+	}
+	submodules.Results = append(submodules.Results, report.Results...)
+	if report.Count(cache.SubmoduleResolved) > 0 {
+		decoded, err := manifest.DecodeLayout((*layout).Root, (*layout).Structure)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode repo layout: %w", err)
+		}
+		*layout = decoded
+		if plan, err = decoded.Plan(path); err != nil {
+			return nil, fmt.Errorf("couldn't plan %s: %w", path, err)
+		}
+	}
+
+	logger.Info("layout: %s → %d file(s) from %v, %d skipped",
+		path, len(plan.Files), plan.Sources, len(plan.Skipped))
+	return plan, nil
+}
+
+// addPlanned merges a decoded repo's plan into the resolved files
+func addPlanned(fileMap map[string]string, attrs map[string]manifest.FileAttrs, skipped map[string]string,
+	files map[string]string, fileAttrs map[string]manifest.FileAttrs, why map[string]string) {
+	for source, target := range files {
+		fileMap[source] = target
+	}
+	for target, attr := range fileAttrs {
+		attrs[target] = attr
+	}
+	for target, reason := range why {
+		logger.Warn("Skipping %s (%s)", target, reason)
+		skipped[target] = reason
 	}
 }
 
+// specTarget is where a path entry's files go; an entry naming its source
+// has its target taken literally under $HOME, the others go through the
+// applier's xdg guess like they always have
+func specTarget(spec manifest.PathSpec) string {
+	target := spec.Path()
+	if !spec.Explicit() || strings.HasPrefix(target, "~") {
+		return target
+	}
+	return "~/" + filepath.ToSlash(filepath.Clean(target))
+}
+
+// collectFiles maps every file under sourcePath to the same place under
+// target, skipping git metadata (.git dirs, and the .git files submodules have)
+func collectFiles(sourcePath, target string, fileMap map[string]string) (int, error) {
+	filesFound := 0
+	err := filepath.Walk(sourcePath, func(walkPath string, walkInfo os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if filepath.Base(walkPath) == ".git" {
+			logger.Debug("  Skipping git metadata: %s", walkPath)
+			if walkInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !walkInfo.IsDir() {
+			// get relative path from source
+			relPath, err := filepath.Rel(sourcePath, walkPath)
+			if err != nil {
+				return err
+			}
+			// target path is the dotfile path + relative path
+			targetPath := filepath.Join(target, relPath)
+			fileMap[walkPath] = targetPath
+			filesFound++
+			logger.Debug("  Found file: %s → %s", relPath, targetPath)
+		}
+		return nil
+	})
+	return filesFound, err
+}
+
+// expandSparseCheckout turns a partial clone into a full one so detection
+// can see the whole tree, returns true if the checkout was expanded
+func (m *Model) expandSparseCheckout(repoPath string) bool {
+	if !cache.IsSparse(repoPath) {
+		return false
+	}
+
+	logger.Info("Path not in sparse checkout, fetching the full tree...")
+	if err := cache.ExpandSparse(context.Background(), repoPath, m.cache.GitOptions()); err != nil {
+		logger.Warn("Couldn't expand sparse checkout: %v", err)
+		return false
+	}
+	return true
+}
+
 // detectPluginManager scans neovim config for plugin managers
 func (m *Model) detectPluginManager() tea.Msg {
 	// Find the nvim config directory in the file map
@@ -989,14 +1607,27 @@ func (m *Model) generateDiffs() tea.Msg {
 	}
 
 	for sourcePath, targetRelPath := range m.fileMap {
-		// resolve target path to absolute
-		targetPath := m.applier.ResolveTargetPath(targetRelPath, homeDir)
+		// a folded stow directory is linked whole, diff what's inside it
+		files := map[string]string{sourcePath: targetRelPath}
+		if m.fileAttrs[targetRelPath].Link {
+			if info, err := os.Stat(sourcePath); err == nil && info.IsDir() {
+				files = make(map[string]string)
+				if _, err := collectFiles(sourcePath, targetRelPath, files); err != nil {
+					return errorMsg{fmt.Errorf("couldn't walk directory %s: %w", sourcePath, err)}
+				}
+			}
+		}
 
-		result, err := diff.GenerateDiff(sourcePath, targetPath)
-		if err != nil {
-			return errorMsg{fmt.Errorf("couldn't generate diff for %s: %w", targetRelPath, err)}
+		for source, target := range files {
+			// resolve target path to absolute
+			targetPath := m.applier.ResolveTargetPath(target, homeDir)
+
+			result, err := diff.GenerateDiff(source, targetPath)
+			if err != nil {
+				return errorMsg{fmt.Errorf("couldn't generate diff for %s: %w", target, err)}
+			}
+			results = append(results, result)
 		}
-		results = append(results, result)
 	}
 
 	return diffGeneratedMsg{result: results}
@@ -1005,14 +1636,13 @@ func (m *Model) generateDiffs() tea.Msg {
 // checkDependencies checks if required tools are installed
 func (m *Model) checkDependencies() tea.Msg {
 	// Convert string dependencies to Dependency structs
-	deps := make([]deps.Dependency, 0, len(m.selectedDotfile.Dependencies))
+	needed := make([]deps.Dependency, 0, len(m.selectedDotfile.Dependencies))
 
 	for _, depName := range m.selectedDotfile.Dependencies {
-		dep := getDependencyInfo(depName)
-		deps = append(deps, dep)
+		needed = append(needed, deps.Lookup(depName))
 	}
 
-	results := m.depChecker.CheckMultiple(deps)
+	results := m.depChecker.CheckMultiple(needed)
 
 	// Convert to interface{} to avoid import cycles in models.go
 	interfaceResults := make([]interface{}, len(results))
@@ -1023,104 +1653,6 @@ func (m *Model) checkDependencies() tea.Msg {
 	return dependenciesCheckedMsg{results: interfaceResults}
 }
 
-// getDependencyInfo returns dependency metadata
-func getDependencyInfo(name string) deps.Dependency {
-	// Map common dependency names to their info
-	depMap := map[string]deps.Dependency{
-		"neovim": {
-			Name:    "neovim",
-			Command: "nvim",
-			PackageNames: map[string]string{
-				"homebrew": "neovim",
-				"apt":      "neovim",
-				"pacman":   "neovim",
-				"dnf":      "neovim",
-			},
-			Description: "Neovim text editor",
-		},
-		"tmux": {
-			Name:    "tmux",
-			Command: "tmux",
-			PackageNames: map[string]string{
-				"homebrew": "tmux",
-				"apt":      "tmux",
-				"pacman":   "tmux",
-				"dnf":      "tmux",
-			},
-			Description: "Terminal multiplexer",
-		},
-		"zsh": {
-			Name:    "zsh",
-			Command: "zsh",
-			PackageNames: map[string]string{
-				"homebrew": "zsh",
-				"apt":      "zsh",
-				"pacman":   "zsh",
-				"dnf":      "zsh",
-			},
-			Description: "Z shell",
-		},
-		"alacritty": {
-			Name:    "alacritty",
-			Command: "alacritty",
-			PackageNames: map[string]string{
-				"homebrew": "alacritty",
-				"apt":      "alacritty",
-				"pacman":   "alacritty",
-				"dnf":      "alacritty",
-			},
-			Description: "GPU-accelerated terminal emulator",
-		},
-		"i3-wm": {
-			Name:    "i3-wm",
-			Command: "i3",
-			PackageNames: map[string]string{
-				"homebrew": "i3",
-				"apt":      "i3-wm",
-				"pacman":   "i3-wm",
-				"dnf":      "i3",
-			},
-			Description: "i3 tiling window manager",
-		},
-		"polybar": {
-			Name:    "polybar",
-			Command: "polybar",
-			PackageNames: map[string]string{
-				"homebrew": "polybar",
-				"apt":      "polybar",
-				"pacman":   "polybar",
-				"dnf":      "polybar",
-			},
-			Description: "Polybar status bar",
-		},
-		"oh-my-zsh": {
-			Name:    "oh-my-zsh",
-			Command: "omz", // oh-my-zsh doesn't have a binary, just a framework
-			PackageNames: map[string]string{
-				"homebrew": "", // oh-my-zsh is installed via script, not package manager
-			},
-			Description: "Oh My Zsh framework (install manually)",
-		},
-	}
-
-	if dep, ok := depMap[name]; ok {
-		return dep
-	}
-
-	// Fallback for unknown dependencies
-	return deps.Dependency{
-		Name:    name,
-		Command: name,
-		PackageNames: map[string]string{
-			"homebrew": name,
-			"apt":      name,
-			"pacman":   name,
-			"dnf":      name,
-		},
-		Description: name,
-	}
-}
-
 // installMissingDependencies installs all missing dependencies
 func (m *Model) installMissingDependencies() tea.Msg {
 	for _, result := range m.depResults {
@@ -1175,7 +1707,13 @@ func (m *Model) installPluginManager() tea.Msg {
 
 // applyFiles applies all files with backups
 func (m *Model) applyFiles() tea.Msg {
-	results := m.applier.ApplyMultiple(m.fileMap, m.selectedCreator, m.selectedDotfile)
+	for _, target := range m.unfold {
+		if err := m.applier.Unfold(target); err != nil {
+			return errorMsg{err}
+		}
+	}
+
+	results := m.applier.ApplyMultipleWithAttrs(m.fileMap, m.fileAttrs, m.selectedCreator, m.selectedDotfile)
 
 	// check for errors
 	var hasErrors bool
@@ -1197,9 +1735,115 @@ func (m *Model) applyFiles() tea.Msg {
 		return errorMsg{fmt.Errorf("failed to apply some files:\n%s", strings.Join(errMsgs, "\n"))}
 	}
 
+	m.recordApplied(results)
+
 	return applyCompleteMsg{results: results}
 }
 
+// recordApplied remembers the commit we applied from so later runs can
+// show what changed upstream, and the targets linked into the cache so it
+// keeps them; failures only cost us that
+func (m *Model) recordApplied(results []*applier.ApplyResult) {
+	commit, err := cache.GetLatestCommit(m.cache.GetRepoPath(m.selectedCreator.ID))
+	if err != nil {
+		logger.Warn("Couldn't read applied commit: %v", err)
+		return
+	}
+
+	var linked []string
+	for _, result := range results {
+		if result.Linked {
+			linked = append(linked, result.TargetPath)
+		}
+	}
+	sort.Strings(linked)
+
+	err = m.history.Record(history.Entry{
+		CreatorID:   m.selectedCreator.ID,
+		CreatorName: m.selectedCreator.Name,
+		DotfileID:   m.selectedDotfile.ID,
+		DotfileName: m.selectedDotfile.Name,
+		Repo:        m.selectedCreator.Repo,
+		Source:      m.selectedCreator.Source,
+		Commit:      commit,
+		Paths:       m.sourceRoots,
+		Linked:      linked,
+		AppliedAt:   time.Now(),
+	})
+	if err != nil {
+		logger.Warn("Couldn't record applied dotfile: %v", err)
+	}
+}
+
+// countUpstream counts upstream changes for creators off the update loop
+func (m *Model) countUpstream(creators []manifest.Creator) tea.Cmd {
+	if m.history == nil || len(creators) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(creators))
+	for _, c := range creators {
+		ids = append(ids, c.ID)
+	}
+	return func() tea.Msg {
+		counts := make(map[string]int, len(ids))
+		for _, id := range ids {
+			counts[id] = m.upstreamChanges(id)
+		}
+		return upstreamCountedMsg{counts: counts}
+	}
+}
+
+// handleUpstreamCounted stores the counts and shows them, keeping the
+// cursor where it was; a list being filtered is left alone until it's
+// built again
+func (m *Model) handleUpstreamCounted(msg upstreamCountedMsg) {
+	if m.upstream == nil {
+		m.upstream = make(map[string]int)
+	}
+	changed := false
+	for id, n := range msg.counts {
+		if m.upstream[id] != n {
+			m.upstream[id] = n
+			changed = true
+		}
+	}
+	if changed && m.screen == ScreenCreator && m.creatorList.FilterState() == list.Unfiltered {
+		index := m.creatorList.Index()
+		m.buildCreatorList()
+		m.creatorList.Select(index)
+	}
+}
+
+// upstreamChanges counts commits touching dotfiles the user applied from a
+// creator since they applied them, only looks at the local cached repo
+func (m *Model) upstreamChanges(creatorID string) int {
+	entries, err := m.history.ForCreator(creatorID)
+	if err != nil || len(entries) == 0 {
+		return 0
+	}
+
+	repoPath := m.cache.GetRepoPath(creatorID)
+	head, err := cache.GetLatestCommit(repoPath)
+	if err != nil {
+		return 0
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.Commit == head {
+			continue
+		}
+		changes, err := cache.ChangesSince(repoPath, e.Commit, e.Paths)
+		if err != nil {
+			continue
+		}
+		for _, c := range changes.Commits {
+			seen[c.Hash] = true
+		}
+	}
+	return len(seen)
+}
+
 // buildCategoryList creates the category list
 func (m *Model) buildCategoryList() {
 	var items []list.Item
@@ -1228,11 +1872,27 @@ func (m *Model) buildCategoryList() {
 func (m *Model) buildCreatorList() {
 	creators := m.manifest.GetCreatorsByCategory(m.selectedCategory.ID)
 	var items []list.Item
+	m.hiddenCreators = 0
 	for i := range creators {
 		creator := &creators[i]
+		description := creatorDescription(creator, m.registries)
+		if reason := creator.Platform.Unsupported(m.machine); reason != "" {
+			if !m.showUnsupported {
+				m.hiddenCreators++
+				continue
+			}
+			description = "✗ " + reason + " • " + description
+		}
+		title := fmt.Sprintf("%s (%d dotfiles)", creator.Name, len(creator.Dotfiles))
+		if creator.Verified {
+			title += " ✔"
+		}
+		if n := m.upstream[creator.ID]; n > 0 {
+			title += fmt.Sprintf(" ↑ %d upstream change(s)", n)
+		}
 		items = append(items, listItem{
-			title:       fmt.Sprintf("%s (%d dotfiles)", creator.Name, len(creator.Dotfiles)),
-			description: creator.Description,
+			title:       title,
+			description: description,
 			data:        creator,
 		})
 	}
@@ -1247,14 +1907,102 @@ func (m *Model) buildCreatorList() {
 	m.creatorList.SetFilteringEnabled(true)
 }
 
+// registrySummary says where each remote registry came from, how old it is
+// and whether it's signed, e.g. "official checked 2 days ago (✓ signed
+// 8F3A…) • acme offline copy from 9 days ago (⚠ unsigned)"
+func registrySummary(statuses []registry.Status) string {
+	var parts []string
+	for _, s := range statuses {
+		if s.Err != nil {
+			continue
+		}
+		if s.Bundled {
+			parts = append(parts, s.Name+" built-in copy")
+			continue
+		}
+		if s.Fetch == nil {
+			continue
+		}
+		var part string
+		switch s.Fetch.Action {
+		case manifest.FetchDownloaded:
+			part = s.Name + " updated just now"
+		case manifest.FetchNotModified:
+			part = s.Name + " up to date"
+		case manifest.FetchCached:
+			part = s.Name + " checked " + cache.FormatAge(s.Fetch.Age)
+		case manifest.FetchFallback:
+			part = s.Name + " offline copy from " + cache.FormatAge(s.Fetch.Age)
+		}
+		parts = append(parts, part+" ("+strings.TrimSpace(trustMark(s)+" "+s.Badge())+")")
+	}
+	return strings.Join(parts, " • ")
+}
+
+// trustMark is a one-character badge for a registry's signature, empty
+// when there's nothing to say
+func trustMark(s registry.Status) string {
+	if s.Fetch == nil || s.Err != nil {
+		return ""
+	}
+	switch s.Fetch.Trust {
+	case manifest.TrustVerified:
+		return "✓"
+	case manifest.TrustUnsigned:
+		return "⚠"
+	}
+	return ""
+}
+
+// creatorDescription prefixes a creator's description with its registry
+// and, for signed or unsigned registries, their trust mark
+func creatorDescription(creator *manifest.Creator, statuses []registry.Status) string {
+	if creator.Registry == "" {
+		return creator.Description
+	}
+	tag := creator.Registry
+	for _, s := range statuses {
+		if s.Name == creator.Registry {
+			if mark := trustMark(s); mark != "" {
+				tag += " " + mark
+			}
+		}
+	}
+	return "[" + tag + "] " + creator.Description
+}
+
+// unsupportedNote says how many entries were hidden for not supporting
+// this machine, or that they're shown, e.g. "2 dotfiles hidden, they're
+// not for linux/amd64 fedora wayland"
+func (m *Model) unsupportedNote(hidden int, noun string) string {
+	switch {
+	case m.showUnsupported:
+		return "showing " + noun + "s for other platforms, marked ✗"
+	case hidden == 1:
+		return fmt.Sprintf("1 %s hidden, it's not for %s", noun, m.machine)
+	case hidden > 1:
+		return fmt.Sprintf("%d %ss hidden, they're not for %s", hidden, noun, m.machine)
+	}
+	return ""
+}
+
 // buildDotfileList creates the dotfile list for selected creator
 func (m *Model) buildDotfileList() {
 	var items []list.Item
+	m.hiddenDotfiles = 0
 	for i := range m.selectedCreator.Dotfiles {
 		dotfile := &m.selectedCreator.Dotfiles[i]
+		description := dotfile.Description
+		if reason := m.selectedCreator.Unsupported(dotfile, m.machine); reason != "" {
+			if !m.showUnsupported {
+				m.hiddenDotfiles++
+				continue
+			}
+			description = "✗ " + reason + " • " + description
+		}
 		items = append(items, listItem{
 			title:       dotfile.Name,
-			description: dotfile.Description,
+			description: description,
 			data:        dotfile,
 		})
 	}
@@ -1306,6 +2054,11 @@ func (m *Model) viewDirectoryBrowser() string {
 	return b.String()
 }
 
+// ignoreFilter is the user's side of what directory dotfiles leave out
+func (m *Model) ignoreFilter(repoPath string) manifest.Filter {
+	return manifest.Filter{RepoPath: repoPath, Include: m.cfg.Include, Exclude: m.cfg.Exclude}
+}
+
 // resolveSelectedDirectory resolves a user-selected directory path
 func (m *Model) resolveSelectedDirectory(selectedPath string) tea.Cmd {
 	return func() tea.Msg {
@@ -1314,7 +2067,7 @@ func (m *Model) resolveSelectedDirectory(selectedPath string) tea.Cmd {
 		if len(m.selectedDotfile.Paths) == 0 {
 			return errorMsg{fmt.Errorf("dotfile %q has no target paths defined", m.selectedDotfile.ID)}
 		}
-		targetPath := m.selectedDotfile.Paths[0]
+		targetPath := specTarget(m.selectedDotfile.Paths[0])
 
 		// Check if it's a file or directory
 		info, err := os.Stat(selectedPath)
@@ -1326,23 +2079,7 @@ func (m *Model) resolveSelectedDirectory(selectedPath string) tea.Cmd {
 
 		if info.IsDir() {
 			// Walk the directory and add all files
-			err := filepath.Walk(selectedPath, func(walkPath string, walkInfo os.FileInfo, walkErr error) error {
-				if walkErr != nil {
-					return walkErr
-				}
-				if !walkInfo.IsDir() {
-					// Get relative path from source
-					relPath, err := filepath.Rel(selectedPath, walkPath)
-					if err != nil {
-						return err
-					}
-					// Target path is the dotfile path + relative path
-					targetFullPath := filepath.Join(targetPath, relPath)
-					fileMap[walkPath] = targetFullPath
-				}
-				return nil
-			})
-			if err != nil {
+			if _, err := collectFiles(selectedPath, targetPath, fileMap); err != nil {
 				return errorMsg{fmt.Errorf("couldn't walk directory %s: %w", selectedPath, err)}
 			}
 		} else {
@@ -1350,17 +2087,32 @@ func (m *Model) resolveSelectedDirectory(selectedPath string) tea.Cmd {
 			fileMap[selectedPath] = targetPath
 		}
 
+		var roots []string
+		repoPath := m.cache.GetRepoPath(m.selectedCreator.ID)
+		if rel, err := filepath.Rel(repoPath, selectedPath); err == nil {
+			roots = append(roots, filepath.ToSlash(rel))
+		}
+
+		attrs := make(map[string]manifest.FileAttrs)
+		excluded, err := manifest.FilterFiles(m.selectedDotfile, m.ignoreFilter(repoPath), fileMap, attrs)
+		if err != nil {
+			return errorMsg{err}
+		}
+
 		return filesResolvedMsg{
 			structure: manifest.StructureUnknown, // User manually selected
 			fileMap:   fileMap,
+			attrs:     attrs,
+			excluded:  excluded,
+			roots:     roots,
 		}
 	}
 }
 
 // Run starts the TUI application
-func Run() error {
+func Run(cfg *config.Config) error {
 	ctx := context.Background()
-	m, err := New(ctx)
+	m, err := New(ctx, cfg)
 	if err != nil {
 		return err
 	}
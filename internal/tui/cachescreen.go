@@ -0,0 +1,167 @@
+// package tui provides the cache management screen
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/registry"
+)
+
+// openCacheScreen switches to the cache screen and starts measuring repos
+func (m *Model) openCacheScreen() (tea.Model, tea.Cmd) {
+	m.screen = ScreenCache
+	m.cacheRepos = nil
+	m.statusMsg = "measuring cached repos"
+	return m, tea.Batch(m.spinner.Tick, m.listCache)
+}
+
+// handleCacheKey handles the keys specific to the cache screen
+// returns handled=false for keys the normal navigation should see
+func (m *Model) handleCacheKey(key string) (tea.Model, tea.Cmd, bool) {
+	switch key {
+	case "d", "D":
+		item, ok := m.cacheList.SelectedItem().(listItem)
+		if !ok {
+			return m, nil, true
+		}
+		repo, ok := item.data.(cache.RepoInfo)
+		if !ok {
+			return m, nil, true
+		}
+		m.statusMsg = "removing " + repo.CreatorID
+		return m, m.removeCachedRepos(repo.CreatorID), true
+	case "g", "G":
+		// a registry that didn't load makes its creators look unreferenced
+		if failed := registry.Failed(m.registries); len(failed) > 0 {
+			m.statusMsg = fmt.Sprintf("not removing anything while the %s registry is unavailable", failed[0].Name)
+			return m, nil, true
+		}
+		m.statusMsg = "removing repos no longer in the manifest"
+		return m, m.gcCache(cache.GCPolicy{Unreferenced: true}), true
+	}
+	return m, nil, false
+}
+
+// listCache measures every cached repo
+func (m *Model) listCache() tea.Msg {
+	repos, err := m.cache.ListRepos(m.manifest.CreatorIDs())
+	if err != nil {
+		return errorMsg{err}
+	}
+	return cacheListedMsg{repos: repos}
+}
+
+// removeCachedRepos deletes specific creators' repos, then relists
+func (m *Model) removeCachedRepos(ids ...string) tea.Cmd {
+	return func() tea.Msg {
+		for _, id := range ids {
+			if err := m.cache.ClearCreatorCache(id); err != nil {
+				return errorMsg{fmt.Errorf("couldn't remove %s: %w", id, err)}
+			}
+		}
+		return m.listCache()
+	}
+}
+
+// gcCache runs a gc policy, then relists
+func (m *Model) gcCache(policy cache.GCPolicy) tea.Cmd {
+	return func() tea.Msg {
+		removed, err := m.cache.GC(m.manifest.CreatorIDs(), policy, false)
+		if err != nil {
+			return errorMsg{err}
+		}
+
+		msg := m.listCache()
+		if listed, ok := msg.(cacheListedMsg); ok {
+			listed.removed = removed
+			return listed
+		}
+		return msg
+	}
+}
+
+// buildCacheList turns the cached repos into list items
+func (m *Model) buildCacheList() {
+	var items []list.Item
+	for _, repo := range m.cacheRepos {
+		items = append(items, listItem{
+			title:       fmt.Sprintf("%s (%s)", repo.CreatorID, cache.FormatSize(repo.Size)),
+			description: describeCachedRepo(repo),
+			data:        repo,
+		})
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.SelectedTitle = selectedStyle
+	delegate.Styles.SelectedDesc = mutedStyle
+
+	m.cacheList = list.New(items, delegate, 80, 20)
+	m.cacheList.Title = ""
+	m.cacheList.SetShowStatusBar(false)
+	m.cacheList.SetFilteringEnabled(false)
+}
+
+// describeCachedRepo is the one-line summary under each cached repo
+func describeCachedRepo(repo cache.RepoInfo) string {
+	var parts []string
+	if repo.LastFetch.IsZero() {
+		parts = append(parts, "fetched: unknown")
+	} else {
+		parts = append(parts, "fetched "+cache.FormatAge(repo.Age()))
+	}
+	if repo.Commit != "" {
+		parts = append(parts, cache.CommitChange{Hash: repo.Commit}.ShortHash())
+	}
+	if !repo.Referenced {
+		parts = append(parts, "no longer in the manifest")
+	}
+	if len(repo.Links) > 0 {
+		parts = append(parts, fmt.Sprintf("linked from %d targets, kept", len(repo.Links)))
+	}
+	return strings.Join(parts, " • ")
+}
+
+// viewCache shows cached repos and their disk usage
+func (m *Model) viewCache() string {
+	var b strings.Builder
+
+	b.WriteString(formatTitle("dotfile picker"))
+	b.WriteString("\n")
+	b.WriteString(formatSubtitle("cached repos"))
+	b.WriteString("\n\n")
+
+	if m.cacheRepos == nil {
+		b.WriteString(fmt.Sprintf("%s %s...", m.spinner.View(), m.statusMsg))
+		return centerContentBoth(m.width, m.height, b.String())
+	}
+
+	var total int64
+	unreferenced := 0
+	for _, repo := range m.cacheRepos {
+		total += repo.Size
+		if !repo.Referenced {
+			unreferenced++
+		}
+	}
+
+	if len(m.cacheRepos) == 0 {
+		b.WriteString(mutedStyle.Render("nothing cached yet"))
+		b.WriteString("\n")
+	} else {
+		b.WriteString(m.cacheList.View())
+		b.WriteString("\n")
+	}
+
+	b.WriteString(fmt.Sprintf("Total: %s in %d repo(s), %d no longer in the manifest\n", cache.FormatSize(total), len(m.cacheRepos), unreferenced))
+	if m.statusMsg != "" {
+		b.WriteString(mutedStyle.Render(m.statusMsg))
+		b.WriteString("\n")
+	}
+	b.WriteString(formatHelp("d: delete selected • g: remove repos not in the manifest • esc: back • q: quit"))
+
+	return centerContentBoth(m.width, m.height, b.String())
+}
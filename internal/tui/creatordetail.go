@@ -0,0 +1,202 @@
+// package tui provides the creator detail pane
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// readmeNames are the files we show as a repo's README, in order
+var readmeNames = []string{"readme.md", "readme.markdown", "readme", "readme.txt"}
+
+// openCreatorDetail shows the highlighted creator's metadata, and their
+// README once the repo is cached
+func (m *Model) openCreatorDetail() (tea.Model, tea.Cmd) {
+	item, ok := m.creatorList.SelectedItem().(listItem)
+	if !ok {
+		return m, nil
+	}
+	creator, ok := item.data.(*manifest.Creator)
+	if !ok {
+		return m, nil
+	}
+
+	m.detailCreator = creator
+	m.readme = ""
+	m.readmeNote = "looking for a README"
+	m.screen = ScreenCreatorDetail
+	m.layoutCreatorDetail()
+	return m, m.loadReadme(creator.ID)
+}
+
+// handleCreatorDetailKey handles the keys specific to the detail pane
+// returns handled=false for keys the normal navigation should see
+func (m *Model) handleCreatorDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "i":
+		m.screen = ScreenCreator
+		return m, nil, true
+	case "enter", "ctrl+c", "q":
+		return m, nil, false
+	}
+	var cmd tea.Cmd
+	m.detailView, cmd = m.detailView.Update(msg)
+	return m, cmd, true
+}
+
+// loadReadme reads a cached repo's README, it never downloads
+func (m *Model) loadReadme(creatorID string) tea.Cmd {
+	return func() tea.Msg {
+		if !m.cache.IsRepoCached(creatorID) {
+			return readmeLoadedMsg{creatorID: creatorID}
+		}
+		path, err := findReadme(m.cache.GetRepoPath(creatorID))
+		if err != nil || path == "" {
+			return readmeLoadedMsg{creatorID: creatorID, cached: true, err: err}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return readmeLoadedMsg{creatorID: creatorID, cached: true, err: err}
+		}
+		return readmeLoadedMsg{creatorID: creatorID, cached: true, name: stripControl(filepath.Base(path)), text: stripControl(string(data))}
+	}
+}
+
+// handleReadmeLoaded puts a loaded README into the pane, unless the user
+// moved on to another creator meanwhile
+func (m *Model) handleReadmeLoaded(msg readmeLoadedMsg) {
+	if m.detailCreator == nil || m.detailCreator.ID != msg.creatorID {
+		return
+	}
+	m.readme = msg.text
+	switch {
+	case msg.err != nil:
+		m.readmeNote = fmt.Sprintf("couldn't read the README: %v", msg.err)
+	case !msg.cached:
+		m.readmeNote = "the README shows up here once the repo is downloaded"
+	case msg.text == "":
+		m.readmeNote = "the repo has no README"
+	default:
+		m.readmeNote = msg.name
+	}
+	m.layoutCreatorDetail()
+}
+
+// findReadme finds the README at the root of a repo, "" when there's none
+func findReadme(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read %s: %w", dir, err)
+	}
+	for _, name := range readmeNames {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.ToLower(entry.Name()) == name {
+				return filepath.Join(dir, entry.Name()), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// layoutCreatorDetail sizes the pane to the terminal and fills it
+func (m *Model) layoutCreatorDetail() {
+	if m.detailCreator == nil {
+		return
+	}
+	width := min(contentWidth, max(m.width-4, 40))
+	height := max(m.height-8, 10)
+
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Width(width).Render(creatorMetadata(m.detailCreator, time.Now())))
+	b.WriteString("\n\n")
+	if m.readme != "" {
+		b.WriteString(mutedStyle.Render("── "+m.readmeNote+" ──") + "\n\n")
+		b.WriteString(renderMarkdown(m.readme, width-2))
+	} else {
+		b.WriteString(mutedStyle.Render(m.readmeNote))
+	}
+
+	m.detailView = viewport.New(width, height)
+	m.detailView.SetContent(b.String())
+}
+
+// creatorMetadata sums up a creator: repo, license, stars, when the entry
+// was last checked, tags and screenshots
+func creatorMetadata(c *manifest.Creator, now time.Time) string {
+	var b strings.Builder
+
+	var facts []string
+	if c.Verified {
+		facts = append(facts, successStyle.UnsetPadding().Render("✔ verified"))
+	}
+	facts = append(facts, stripControl(c.Repo))
+	if c.License != "" {
+		facts = append(facts, stripControl(c.License))
+	}
+	if c.Stars > 0 {
+		facts = append(facts, "★ "+formatStars(c.Stars))
+	}
+	if updated := c.UpdatedTime(); !updated.IsZero() {
+		facts = append(facts, "updated "+cache.FormatAge(now.Sub(updated)))
+	}
+	b.WriteString(strings.Join(facts, " • "))
+
+	if c.Description != "" {
+		b.WriteString("\n\n" + stripControl(c.Description))
+	}
+	if len(c.Tags) > 0 {
+		b.WriteString("\n\n")
+		for _, tag := range c.Tags {
+			b.WriteString(formatBadge(stripControl(tag)))
+		}
+	}
+
+	// a terminal can't show the images, their urls open in a browser
+	images := c.Screenshots
+	if c.Preview != "" {
+		images = append([]string{c.Preview}, images...)
+	}
+	if len(images) > 0 {
+		b.WriteString("\n\n🖼  screenshots\n")
+		seen := make(map[string]bool)
+		for _, url := range images {
+			if !seen[url] {
+				seen[url] = true
+				b.WriteString(mutedStyle.Render("  • "+stripControl(url)) + "\n")
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatStars shortens big star counts, e.g. 12300 → 12.3k
+func formatStars(n int) string {
+	if n < 1000 {
+		return fmt.Sprint(n)
+	}
+	return strings.Replace(fmt.Sprintf("%.1fk", float64(n)/1000), ".0k", "k", 1)
+}
+
+// viewCreatorDetail shows the detail pane
+func (m *Model) viewCreatorDetail() string {
+	var b strings.Builder
+
+	b.WriteString(formatTitle("dotfile picker"))
+	b.WriteString("\n")
+	b.WriteString(formatSubtitle(stripControl(m.detailCreator.Name)))
+	b.WriteString("\n")
+	b.WriteString(m.detailView.View())
+	b.WriteString("\n")
+	b.WriteString(formatHelp(fmt.Sprintf("↑/↓: scroll (%3.f%%) • enter: dotfiles • esc: back • q: quit", m.detailView.ScrollPercent()*100)))
+
+	return centerContent(m.width, b.String())
+}
@@ -0,0 +1,152 @@
+// package tui renders markdown for the creator detail pane
+package tui
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	// markdown styles
+	mdHeadingStyle = lipgloss.NewStyle().Foreground(primaryColor).Bold(true)
+	mdCodeStyle    = lipgloss.NewStyle().Foreground(accentColor)
+	mdQuoteStyle   = lipgloss.NewStyle().Foreground(mutedColor).Italic(true)
+	mdLinkStyle    = lipgloss.NewStyle().Foreground(secondaryColor).Underline(true)
+
+	// inline markdown, applied in this order
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdCode      = regexp.MustCompile("`([^`]+)`")
+	mdBold      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdHTMLImage = regexp.MustCompile(`(?i)<img[^>]*>`)
+	mdHTMLAlt   = regexp.MustCompile(`(?i)\balt="([^"]*)"`)
+	mdHTMLTag   = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdOrdered   = regexp.MustCompile(`^(\d+)[.)]\s+(.*)$`)
+	mdRule      = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+)
+
+// renderMarkdown turns a README into styled text wrapped at width
+// it covers what READMEs mostly use: headings, paragraphs, lists, quotes,
+// code blocks, links and images (shown as their alt text, a terminal can't
+// draw them); html is stripped
+func renderMarkdown(src string, width int) string {
+	if width < 20 {
+		width = 20
+	}
+	src = stripControl(src)
+	wrap := lipgloss.NewStyle().Width(width)
+
+	var out []string
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, wrap.Render(renderInline(strings.Join(paragraph, " "))), "")
+			paragraph = nil
+		}
+	}
+
+	inCode := false
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			flush()
+			if inCode {
+				out = append(out, "")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, mdCodeStyle.Render("  "+strings.ReplaceAll(line, "\t", "    ")))
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			heading := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			if heading != "" {
+				out = append(out, mdHeadingStyle.Render(stripHTML(heading)), "")
+			}
+		case mdRule.MatchString(trimmed):
+			flush()
+			out = append(out, mutedStyle.Render(strings.Repeat("─", min(width, 40))), "")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			out = append(out, mdQuoteStyle.Render("│ "+renderInline(quote)))
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			flush()
+			indent := strings.Repeat("  ", (len(line)-len(strings.TrimLeft(line, " \t")))/2)
+			out = append(out, listItemLine(indent+"• ", trimmed[2:], width))
+		case mdOrdered.MatchString(trimmed):
+			flush()
+			parts := mdOrdered.FindStringSubmatch(trimmed)
+			out = append(out, listItemLine(parts[1]+". ", parts[2], width))
+		default:
+			if text := strings.TrimSpace(stripHTML(trimmed)); text != "" || mdHTMLImage.MatchString(trimmed) {
+				paragraph = append(paragraph, trimmed)
+			}
+		}
+	}
+	flush()
+
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+// listItemLine renders a list item with its wrapped lines hanging under
+// the text instead of the bullet
+func listItemLine(bullet, text string, width int) string {
+	body := lipgloss.NewStyle().Width(max(width-lipgloss.Width(bullet), 10)).Render(renderInline(text))
+	return lipgloss.JoinHorizontal(lipgloss.Top, bullet, body)
+}
+
+// renderInline styles images, links, code and bold text in a line
+func renderInline(s string) string {
+	s = mdHTMLImage.ReplaceAllStringFunc(s, func(tag string) string {
+		alt := ""
+		if parts := mdHTMLAlt.FindStringSubmatch(tag); parts != nil {
+			alt = parts[1]
+		}
+		return mutedStyle.Render(strings.TrimSpace("🖼 " + alt))
+	})
+	s = stripHTML(s)
+	s = mdImage.ReplaceAllStringFunc(s, func(img string) string {
+		return mutedStyle.Render("🖼 " + mdImage.FindStringSubmatch(img)[1])
+	})
+	s = mdLink.ReplaceAllStringFunc(s, func(link string) string {
+		return mdLinkStyle.Render(mdLink.FindStringSubmatch(link)[1])
+	})
+	s = mdCode.ReplaceAllStringFunc(s, func(code string) string {
+		return mdCodeStyle.Render(mdCode.FindStringSubmatch(code)[1])
+	})
+	return mdBold.ReplaceAllStringFunc(s, func(bold string) string {
+		parts := mdBold.FindStringSubmatch(bold)
+		return lipgloss.NewStyle().Bold(true).Render(parts[1] + parts[2])
+	})
+}
+
+// stripControl drops C0 and C1 control characters except newlines and
+// tabs, a README or manifest could otherwise send escape sequences that
+// retitle, recolor or otherwise drive the terminal
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stripHTML drops html tags, keeping their text
+func stripHTML(s string) string {
+	return mdHTMLTag.ReplaceAllString(s, "")
+}
@@ -3,8 +3,10 @@ package tui
 
 import (
 	"github.com/milxzy/dotfile-picker/internal/applier"
+	"github.com/milxzy/dotfile-picker/internal/cache"
 	"github.com/milxzy/dotfile-picker/internal/diff"
 	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
 )
 
 // Screen represents different views in the app
@@ -23,13 +25,16 @@ const (
 	ScreenDependencyCheck
 	ScreenPluginManagerDetect
 	ScreenDirectoryBrowser
+	ScreenCache
+	ScreenCreatorDetail
 )
 
 // messages for bubble tea
 type (
 	// manifestLoadedMsg is sent when the manifest is loaded
 	manifestLoadedMsg struct {
-		manifest *manifest.Manifest
+		manifest   *manifest.Manifest
+		registries []registry.Status
 	}
 
 	// errorMsg is sent when an error occurs
@@ -52,15 +57,47 @@ type (
 		dotfiles []*manifest.Dotfile
 	}
 
+	// upstreamCountedMsg carries upstream change counts, by creator id
+	upstreamCountedMsg struct {
+		counts map[string]int
+	}
+
+	// readmeLoadedMsg carries a cached repo's README for the detail pane
+	readmeLoadedMsg struct {
+		creatorID string
+		cached    bool   // false when the repo isn't downloaded yet
+		name      string // the README's file name
+		text      string
+		err       error
+	}
+
 	// repoDownloadedMsg is sent when a repo finishes downloading
 	repoDownloadedMsg struct {
 		creatorID string
+		sync      *cache.SyncResult
+	}
+
+	// downloadProgressMsg carries a clone/pull progress update
+	downloadProgressMsg struct {
+		progress cache.Progress
 	}
 
+	// downloadCancelledMsg is sent when the user aborts a download
+	downloadCancelledMsg struct{}
+
 	// filesResolvedMsg is sent when file paths are resolved
 	filesResolvedMsg struct {
-		structure manifest.RepoStructure
-		fileMap   map[string]string
+		structure  manifest.RepoStructure
+		candidates []manifest.Candidate // ranked layouts, with the evidence for each
+		fileMap    map[string]string
+		attrs      map[string]manifest.FileAttrs // by target, see applier.ApplyMultipleWithAttrs
+		skipped    map[string]string             // targets that can't be applied, and why
+		excluded   map[string]string             // targets ignore patterns left out, and the rule
+		unfold     []string                      // folded stow links to unfold before applying
+		roots      []string                      // repo-relative source paths, kept for the history
+
+		// submodules under the resolved paths, nil when the user picked a directory
+		submodules *cache.SubmoduleReport
 	}
 
 	// diffGeneratedMsg is sent when diffs are generated
@@ -97,6 +134,24 @@ type (
 	pathNotFoundMsg struct {
 		requestedPath string
 		repoPath      string
+		submodules    *cache.SubmoduleReport
+	}
+
+	// cacheListedMsg carries the cached repos, plus any a gc just removed
+	cacheListedMsg struct {
+		repos   []cache.RepoInfo
+		removed []cache.RepoInfo
+	}
+
+	// prefetchProgressMsg is sent as each creator of a prefetch finishes
+	prefetchProgressMsg struct {
+		creatorName string
+		err         error
+	}
+
+	// prefetchFinishedMsg is sent when a whole prefetch is done
+	prefetchFinishedMsg struct {
+		err error
 	}
 
 	// directorySelectedMsg sent when user selects a directory from browser
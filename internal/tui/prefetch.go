@@ -0,0 +1,129 @@
+// package tui provides the prefetch-a-category action
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/milxzy/dotfile-picker/internal/cache"
+	"github.com/milxzy/dotfile-picker/internal/logger"
+	"github.com/milxzy/dotfile-picker/internal/manifest"
+)
+
+// prefetchState tracks a running or finished category prefetch
+type prefetchState struct {
+	category string
+	total    int
+	done     int
+	failed   map[string]error // creator name -> error
+	running  bool
+	cancel   context.CancelFunc
+	ch       chan prefetchProgressMsg
+}
+
+// startPrefetch downloads every creator in the selected category in parallel
+func (m *Model) startPrefetch() (tea.Model, tea.Cmd) {
+	if m.prefetch != nil && m.prefetch.running {
+		return m, nil
+	}
+
+	creators := m.manifest.GetCreatorsByCategory(m.selectedCategory.ID)
+	if len(creators) == 0 {
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.prefetch = &prefetchState{
+		category: m.selectedCategory.Name,
+		total:    len(creators),
+		failed:   make(map[string]error),
+		running:  true,
+		cancel:   cancel,
+		ch:       make(chan prefetchProgressMsg, len(creators)),
+	}
+
+	logger.Info("Prefetching %d creators in %s", len(creators), m.selectedCategory.Name)
+	return m, tea.Batch(m.spinner.Tick, m.prefetchCreators(ctx, creators, m.prefetch.ch), waitForPrefetch(m.prefetch.ch))
+}
+
+// prefetchCreators runs the parallel download, reporting each creator on ch
+func (m *Model) prefetchCreators(ctx context.Context, creators []manifest.Creator, ch chan prefetchProgressMsg) tea.Cmd {
+	return func() tea.Msg {
+		defer close(ch)
+		err := m.cache.EnsureReposWithOptions(ctx, creators, cache.GitOptions{},
+			func(c *manifest.Creator, _ *cache.SyncResult, err error) {
+				// buffered for every creator, never blocks a worker
+				ch <- prefetchProgressMsg{creatorName: c.Name, err: err}
+			})
+		return prefetchFinishedMsg{err: err}
+	}
+}
+
+// waitForPrefetch delivers the next finished creator
+func waitForPrefetch(ch chan prefetchProgressMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// handlePrefetchProgress records one finished creator
+func (m *Model) handlePrefetchProgress(msg prefetchProgressMsg) tea.Cmd {
+	if m.prefetch == nil {
+		return nil
+	}
+	m.prefetch.done++
+	if msg.err != nil {
+		logger.Warn("Prefetch of %s failed: %v", msg.creatorName, msg.err)
+		m.prefetch.failed[msg.creatorName] = msg.err
+	}
+	return waitForPrefetch(m.prefetch.ch)
+}
+
+// finishPrefetch marks the prefetch done and releases its context
+func (m *Model) finishPrefetch() {
+	if m.prefetch == nil || !m.prefetch.running {
+		return
+	}
+	m.prefetch.running = false
+	m.prefetch.cancel()
+}
+
+// cancelPrefetch aborts a running prefetch, returns false if none is running
+func (m *Model) cancelPrefetch() bool {
+	if m.prefetch == nil || !m.prefetch.running {
+		return false
+	}
+	m.prefetch.cancel()
+	return true
+}
+
+// prefetchStatus is the one-line summary shown under the creator list
+func (m *Model) prefetchStatus() string {
+	p := m.prefetch
+	if p == nil {
+		return ""
+	}
+
+	if p.running {
+		return fmt.Sprintf("%s prefetching %s: %d/%d repos", m.spinner.View(), p.category, p.done, p.total)
+	}
+
+	status := fmt.Sprintf("prefetched %d/%d repos in %s", p.done-len(p.failed), p.total, p.category)
+	if len(p.failed) == 0 {
+		return successStyle.Render("✓ " + status)
+	}
+
+	names := make([]string, 0, len(p.failed))
+	for name := range p.failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return errorStyle.Render(fmt.Sprintf("⚠ %s, failed: %s", status, strings.Join(names, ", ")))
+}
@@ -2,6 +2,7 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -145,6 +146,20 @@ func formatBadge(text string) string {
 	return badgeStyle.Render(text)
 }
 
+// formatProgressBar renders a fixed-width bar for a 0-100 percentage
+func formatProgressBar(percent, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := width * percent / 100
+	bar := progressBarStyle.Render(strings.Repeat("█", filled)) +
+		mutedStyle.Render(strings.Repeat("░", width-filled))
+	return fmt.Sprintf("%s %3d%%", bar, percent)
+}
+
 // centerContent adds horizontal padding to center the view in the terminal
 func centerContent(totalWidth int, content string) string {
 	if totalWidth <= contentWidth+4 {
@@ -2,16 +2,23 @@
 package tui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/milxzy/dotfile-picker/internal/applier"
 	"github.com/milxzy/dotfile-picker/internal/backup"
 	"github.com/milxzy/dotfile-picker/internal/cache"
 	"github.com/milxzy/dotfile-picker/internal/config"
 	"github.com/milxzy/dotfile-picker/internal/manifest"
+	"github.com/milxzy/dotfile-picker/internal/registry"
 )
 
 // TestWorkflowComponents tests that all workflow components integrate properly
@@ -93,3 +100,245 @@ func TestManifestLoading(t *testing.T) {
 
 	t.Logf("loaded %d creators in %d categories", len(m.Creators), len(m.Categories))
 }
+
+// TestPrefetchCategory checks that prefetching downloads every creator in the category
+func TestPrefetchCategory(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// local sources keep the test offline
+	var creators []manifest.Creator
+	for _, id := range []string{"alpha", "beta", "gamma"} {
+		dir := filepath.Join(tmpDir, "sources", id)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".zshrc"), []byte("# "+id+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		creators = append(creators, manifest.Creator{ID: id, Name: id, Repo: dir, Categories: []string{"shells"}})
+	}
+	creators = append(creators, manifest.Creator{ID: "broken", Name: "broken", Repo: filepath.Join(tmpDir, "missing"), Categories: []string{"shells"}})
+
+	m := &Model{
+		cache:            cache.NewManager(filepath.Join(tmpDir, "cache")),
+		manifest:         &manifest.Manifest{Creators: creators},
+		selectedCategory: &manifest.Category{ID: "shells", Name: "Shells"},
+	}
+
+	_, _ = m.startPrefetch()
+	finished := make(chan tea.Msg, 1)
+	go func() { finished <- m.prefetchCreators(context.Background(), creators, m.prefetch.ch)() }()
+	for msg := range m.prefetch.ch {
+		m.handlePrefetchProgress(msg)
+	}
+	if _, ok := (<-finished).(prefetchFinishedMsg); !ok {
+		t.Error("expected a prefetchFinishedMsg")
+	}
+	m.finishPrefetch()
+
+	if m.prefetch.done != len(creators) {
+		t.Errorf("expected %d finished creators, got %d", len(creators), m.prefetch.done)
+	}
+	if len(m.prefetch.failed) != 1 || m.prefetch.failed["broken"] == nil {
+		t.Errorf("expected only the broken creator to fail, got %v", m.prefetch.failed)
+	}
+	for _, id := range []string{"alpha", "beta", "gamma"} {
+		if !m.cache.IsRepoCached(id) {
+			t.Errorf("expected %s to be prefetched", id)
+		}
+	}
+}
+
+// TestStructureOverride tests cycling through layouts from the tree view
+func TestStructureOverride(t *testing.T) {
+	candidates := []manifest.Candidate{
+		{Structure: manifest.StructureStow, Score: 90},
+		{Structure: manifest.StructureConfig, Score: 25},
+	}
+
+	// the runner-up first, then layouts detection found nothing for
+	if next := nextStructure(candidates, manifest.StructureStow); next != manifest.StructureConfig {
+		t.Errorf("expected config after stow, got %s", next)
+	}
+	if next := nextStructure(candidates, manifest.StructureConfig); next != manifest.StructureChezmoi {
+		t.Errorf("expected chezmoi after config, got %s", next)
+	}
+	if next := nextStructure(candidates, manifest.StructureFlat); next != manifest.StructureStow {
+		t.Errorf("expected to wrap around to stow, got %s", next)
+	}
+
+	preferred := preferStructure(candidates, manifest.StructureFlat)
+	if len(preferred) != 3 || preferred[0].Structure != manifest.StructureFlat || preferred[1].Structure != manifest.StructureStow {
+		t.Errorf("expected flat to be tried first, got %+v", preferred)
+	}
+	preferred = preferStructure(candidates, manifest.StructureConfig)
+	if len(preferred) != 2 || preferred[0].Score != 25 {
+		t.Errorf("expected config to keep its score, got %+v", preferred)
+	}
+}
+
+// TestExplicitPaths tests path entries that name their source and target
+func TestExplicitPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "sources", "bat")
+	for _, name := range []string{"nvim/init.lua", "nvim/lazy-lock.json", "nvim/README.md", "tmux/tmux.conf"} {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	creator := &manifest.Creator{ID: "bat", Name: "bat", Repo: repo}
+	m := &Model{
+		cfg:             &config.Config{CacheDir: filepath.Join(tmpDir, "cache")},
+		cache:           cache.NewManager(filepath.Join(tmpDir, "cache")),
+		selectedCreator: creator,
+		selectedDotfile: &manifest.Dotfile{ID: "nvim", Paths: []manifest.PathSpec{
+			{Source: "nvim", Target: ".config/nvim", Exclude: []string{"lazy-lock.json"}},
+			{Source: "tmux/tmux.conf", Target: ".tmux.conf", Mode: "0600"},
+			{Source: "wezterm", Target: ".config/wezterm", Optional: true},
+		}},
+	}
+	if _, err := m.cache.EnsureRepoWithOptions(context.Background(), creator, cache.GitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := m.detectStructure().(filesResolvedMsg)
+	if !ok {
+		t.Fatalf("expected the files to resolve, got %#v", m.detectStructure())
+	}
+
+	repoPath := m.cache.GetRepoPath("bat")
+	expected := map[string]string{
+		filepath.Join(repoPath, "nvim", "init.lua"):  "~/.config/nvim/init.lua",
+		filepath.Join(repoPath, "tmux", "tmux.conf"): "~/.tmux.conf",
+	}
+	if len(msg.fileMap) != len(expected) {
+		t.Errorf("got files %v, want %v", msg.fileMap, expected)
+	}
+	for source, target := range expected {
+		if msg.fileMap[source] != target {
+			t.Errorf("%s → %q, want %q", source, msg.fileMap[source], target)
+		}
+	}
+	if msg.attrs["~/.tmux.conf"].Mode != 0o600 {
+		t.Errorf("expected the tmux.conf mode to be set, got %v", msg.attrs)
+	}
+
+	// the tree confirm screen says why files were left out
+	wantExcluded := map[string]string{
+		"~/.config/nvim/lazy-lock.json": "manifest: lazy-lock.json",
+		"~/.config/nvim/README.md":      "default: README*",
+	}
+	if !maps.Equal(msg.excluded, wantExcluded) {
+		t.Errorf("excluded %v, want %v", msg.excluded, wantExcluded)
+	}
+}
+
+func TestCreatorDetail(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "sources", "bat")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	readme := "<p align=\"center\"><img src=\"desk.png\" alt=\"my desk\"></p>\n\n# bat's dotfiles\n\nA **cozy** setup, see [the wiki](https://example.com).\n\n- tokyonight everywhere\n"
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	creator := &manifest.Creator{ID: "bat", Name: "bat", Repo: repo, Metadata: manifest.Metadata{
+		Tags: []string{"cozy"}, License: "MIT", Verified: true, Stars: 12300,
+	}}
+	m := &Model{
+		cache:         cache.NewManager(filepath.Join(tmpDir, "cache")),
+		width:         100,
+		height:        60,
+		detailCreator: creator,
+	}
+
+	// nothing to show until the repo is downloaded
+	m.handleReadmeLoaded(m.loadReadme("bat")().(readmeLoadedMsg))
+	m.layoutCreatorDetail()
+	if view := m.detailView.View(); !strings.Contains(view, "once the repo is downloaded") || !strings.Contains(view, "★ 12.3k") {
+		t.Errorf("unexpected pane before download:\n%s", view)
+	}
+
+	if _, err := m.cache.EnsureRepoWithOptions(context.Background(), creator, cache.GitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	m.handleReadmeLoaded(m.loadReadme("bat")().(readmeLoadedMsg))
+	if m.readmeNote != "README.md" {
+		t.Fatalf("expected the README to load, got %q", m.readmeNote)
+	}
+	view := m.detailView.View()
+	for _, want := range []string{"bat's dotfiles", "🖼 my desk", "cozy", "the wiki", "• tokyonight everywhere"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q in the pane:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "<p") || strings.Contains(view, "**") {
+		t.Errorf("expected the markdown to be rendered:\n%s", view)
+	}
+}
+
+func TestStripControl(t *testing.T) {
+	// an OSC title change, a bell, a CSI through its C1 form and a DEL
+	evil := "# hi\x1b]0;pwned\x07\r\n\tcode\u009b31mred\x7f\n"
+	if got := stripControl(evil); got != "# hi]0;pwned\n\tcode31mred\n" {
+		t.Errorf("stripControl = %q", got)
+	}
+
+	rendered := renderMarkdown(evil, 80)
+	for _, bad := range []string{"\x1b]", "\x07", "\u009b", "\x7f"} {
+		if strings.Contains(rendered, bad) {
+			t.Errorf("expected %q to be stripped from %q", bad, rendered)
+		}
+	}
+	meta := creatorMetadata(&manifest.Creator{Repo: "x", Description: "a\x1b[2Jb"}, time.Now())
+	if strings.Contains(meta, "\x1b[2J") {
+		t.Errorf("expected the description to be stripped, got %q", meta)
+	}
+}
+
+func TestUpstreamCounted(t *testing.T) {
+	category := &manifest.Category{ID: "tiling-wm", Name: "tiling"}
+	m := &Model{
+		screen:           ScreenCreator,
+		selectedCategory: category,
+		manifest: &manifest.Manifest{
+			Categories: []manifest.Category{*category},
+			Creators: []manifest.Creator{
+				{ID: "bat", Name: "bat", Categories: []string{"tiling-wm"}},
+				{ID: "owl", Name: "owl", Categories: []string{"tiling-wm"}},
+			},
+		},
+	}
+	m.buildCreatorList()
+	m.creatorList.Select(1)
+
+	// counts arrive later, the list picks them up without losing the cursor
+	m.handleUpstreamCounted(upstreamCountedMsg{counts: map[string]int{"owl": 2}})
+	item, ok := m.creatorList.SelectedItem().(listItem)
+	if !ok || item.title != "owl (0 dotfiles) ↑ 2 upstream change(s)" {
+		t.Errorf("got %+v selected", m.creatorList.SelectedItem())
+	}
+}
+
+func TestCacheGCNeedsEveryRegistry(t *testing.T) {
+	m := &Model{
+		screen:     ScreenCache,
+		registries: []registry.Status{{Name: "acme", Err: errors.New("offline")}},
+	}
+
+	// acme's creators would all look unreferenced
+	_, cmd, handled := m.handleCacheKey("g")
+	if !handled || cmd != nil {
+		t.Fatalf("expected gc to be refused, got handled=%v cmd=%v", handled, cmd != nil)
+	}
+	if !strings.Contains(m.statusMsg, "acme registry is unavailable") {
+		t.Errorf("got status %q", m.statusMsg)
+	}
+}